@@ -0,0 +1,145 @@
+'use client';
+
+import React, { useEffect, useState } from 'react';
+import {
+  ACTIVITY_TYPES,
+  ActivityEvent,
+  ActivityType,
+  openActivityStream,
+} from '@/lib/services/activity';
+import ClientOnly from '@/components/client-only';
+import { formatNumber } from '@/lib/utils/format';
+
+// Number of events kept on screen
+const MAX_EVENTS = 100;
+
+const TYPE_LABELS: Record<ActivityType, string> = {
+  pageview: 'Page view',
+  signup: 'Signup',
+  email_verified: 'Email verified',
+  order: 'Order',
+  payment: 'Payment',
+  subscription: 'Subscription',
+  contact: 'Contact',
+};
+
+const TYPE_COLORS: Record<ActivityType, string> = {
+  pageview: 'bg-gray-100 text-gray-700',
+  signup: 'bg-green-100 text-green-700',
+  email_verified: 'bg-teal-100 text-teal-700',
+  order: 'bg-indigo-100 text-indigo-700',
+  payment: 'bg-blue-100 text-blue-700',
+  subscription: 'bg-purple-100 text-purple-700',
+  contact: 'bg-yellow-100 text-yellow-700',
+};
+
+/**
+ * Summarizes the details of an event in one line
+ */
+const describe = (event: ActivityEvent): string => {
+  const d = event.data;
+  switch (event.type) {
+    case 'pageview':
+      return [d.path, d.source || d.channel, d.country, d.device_type].filter(Boolean).join(' · ');
+    case 'signup':
+      return `${d.email} via ${d.method}`;
+    case 'contact':
+      return `${d.name} <${d.email}>: ${d.subject}`;
+    case 'order':
+    case 'payment':
+      return [d.event, d.total_formatted || d.refunded_amount_formatted, d.user_id].filter(Boolean).join(' · ');
+    case 'subscription':
+      return [d.event, d.status, d.user_id].filter(Boolean).join(' · ');
+    default:
+      return String(d.user_id ?? '');
+  }
+};
+
+/**
+ * Live Activity Page Component
+ * Streams page views, signups, purchases and other events as they happen
+ */
+export default function ActivityPage() {
+  const [events, setEvents] = useState<ActivityEvent[]>([]);
+  const [online, setOnline] = useState<number | null>(null);
+  const [connected, setConnected] = useState(false);
+  const [types, setTypes] = useState<ActivityType[]>([]);
+
+  // Reopen the stream whenever the type filter changes
+  useEffect(() => {
+    const close = openActivityStream(types, {
+      onEvent: (event) => setEvents((prev) => [event, ...prev].slice(0, MAX_EVENTS)),
+      onVisitors: setOnline,
+      onConnectionChange: setConnected,
+    });
+    return close;
+  }, [types]);
+
+  const toggleType = (type: ActivityType) => {
+    setTypes((prev) => (prev.includes(type) ? prev.filter((t) => t !== type) : [...prev, type]));
+  };
+
+  return (
+    <ClientOnly>
+      <div className="px-4 sm:px-6 lg:px-8 py-8 w-full mx-auto">
+        <div className="flex justify-between items-center mb-6">
+          <h1 className="text-2xl font-bold">Live Activity</h1>
+          <div className="flex items-center gap-4 text-sm">
+            <span className="text-gray-700">
+              {online === null ? '-' : formatNumber(online)} online
+            </span>
+            <span className="flex items-center gap-1.5 text-gray-500">
+              <span className={`h-2 w-2 rounded-full ${connected ? 'bg-green-500' : 'bg-gray-300'}`}></span>
+              {connected ? 'Connected' : 'Connecting...'}
+            </span>
+            <button
+              onClick={() => setEvents([])}
+              className="px-3 py-2 bg-white border border-gray-300 rounded-md shadow-sm text-sm font-medium text-gray-700 hover:bg-gray-50"
+            >
+              Clear
+            </button>
+          </div>
+        </div>
+
+        <div className="flex flex-wrap gap-2 mb-4">
+          {ACTIVITY_TYPES.map((type) => (
+            <button
+              key={type}
+              onClick={() => toggleType(type)}
+              className={`px-3 py-1 rounded-full text-xs font-medium border ${
+                types.includes(type)
+                  ? 'border-indigo-500 bg-indigo-50 text-indigo-700'
+                  : 'border-gray-300 bg-white text-gray-600'
+              }`}
+            >
+              {TYPE_LABELS[type]}
+            </button>
+          ))}
+          {types.length > 0 && (
+            <button onClick={() => setTypes([])} className="px-3 py-1 text-xs text-gray-500 hover:text-gray-700">
+              Show all
+            </button>
+          )}
+        </div>
+
+        <div className="bg-white shadow rounded-lg divide-y divide-gray-100">
+          {events.length === 0 ? (
+            <p className="p-6 text-sm text-gray-400">Waiting for activity...</p>
+          ) : (
+            events.map((event) => (
+              <div key={`${event.id}-${event.received_at}`} className="flex items-center gap-4 px-4 py-3 text-sm">
+                <span className="w-20 text-gray-400 tabular-nums">
+                  {new Date(event.received_at).toLocaleTimeString()}
+                </span>
+                <span className={`w-28 text-center px-2 py-0.5 rounded text-xs font-medium ${TYPE_COLORS[event.type]}`}>
+                  {TYPE_LABELS[event.type]}
+                </span>
+                <span className="text-gray-700 truncate">{describe(event)}</span>
+              </div>
+            ))
+          )}
+        </div>
+      </div>
+    </ClientOnly>
+  );
+}
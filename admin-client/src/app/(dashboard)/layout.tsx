@@ -38,6 +38,12 @@ export default function DashboardLayout({
                 >
                   Dashboard
                 </Link>
+                <Link
+                  href="/activity"
+                  className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
+                >
+                  Activity
+                </Link>
                 <Link
                   href="/users"
                   className="border-transparent text-gray-500 hover:border-gray-300 hover:text-gray-700 inline-flex items-center px-1 pt-1 border-b-2 text-sm font-medium"
@@ -0,0 +1,133 @@
+import { API_URL } from '@/lib/config';
+import { getAuthToken } from './auth';
+
+/**
+ * Activity event types sent by the server, besides the visitors count
+ */
+export const ACTIVITY_TYPES = [
+  'pageview',
+  'signup',
+  'email_verified',
+  'order',
+  'payment',
+  'subscription',
+  'contact',
+] as const;
+
+export type ActivityType = (typeof ACTIVITY_TYPES)[number];
+
+/**
+ * Represents an event received from the live activity stream
+ */
+export interface ActivityEvent {
+  id: number;
+  type: ActivityType;
+  data: Record<string, unknown>;
+  received_at: string;
+}
+
+export interface ActivityStreamHandlers {
+  onEvent: (event: ActivityEvent) => void;
+  onVisitors?: (online: number) => void;
+  onConnectionChange?: (connected: boolean) => void;
+}
+
+// Delay before reopening a stream that dropped
+const RECONNECT_DELAY_MS = 3000;
+
+/**
+ * Fetches a short-lived token that opens the activity stream. EventSource cannot
+ * send the Authorization header, so the token is passed in the stream URL instead.
+ * @returns Promise containing the stream token
+ */
+export const getStreamToken = async (): Promise<string> => {
+  const response = await fetch(`${API_URL}/admin/stream/token`, {
+    method: 'POST',
+    headers: {
+      'Authorization': `Bearer ${getAuthToken()}`,
+    },
+  });
+
+  if (!response.ok) {
+    const error = await response.text();
+    throw new Error(error || 'Failed to fetch stream token');
+  }
+
+  const data = await response.json();
+  return data.token;
+};
+
+/**
+ * Opens the live activity stream, limited to the given types or every type when empty.
+ * Each stream token opens one stream within a minute, so when the connection drops a
+ * new token is fetched and the stream is reopened from the last event received.
+ * @returns Function closing the stream
+ */
+export const openActivityStream = (
+  types: ActivityType[],
+  handlers: ActivityStreamHandlers
+): (() => void) => {
+  let source: EventSource | null = null;
+  let lastEventId = '';
+  let closed = false;
+  let retryTimer: ReturnType<typeof setTimeout> | undefined;
+
+  const reconnect = () => {
+    handlers.onConnectionChange?.(false);
+    if (!closed) {
+      retryTimer = setTimeout(connect, RECONNECT_DELAY_MS);
+    }
+  };
+
+  const connect = async () => {
+    let token: string;
+    try {
+      token = await getStreamToken();
+    } catch (err) {
+      console.error('Error fetching stream token:', err);
+      reconnect();
+      return;
+    }
+    if (closed) return;
+
+    const params = new URLSearchParams({ token });
+    if (types.length > 0) params.set('types', types.join(','));
+    if (lastEventId) params.set('last_event_id', lastEventId);
+
+    const stream = new EventSource(`${API_URL}/admin/stream?${params}`);
+    source = stream;
+    stream.onopen = () => handlers.onConnectionChange?.(true);
+    stream.onerror = () => {
+      // EventSource would retry with the same token, which is used up
+      stream.close();
+      source = null;
+      reconnect();
+    };
+
+    ACTIVITY_TYPES.forEach((type) => {
+      stream.addEventListener(type, (e) => {
+        const message = e as MessageEvent<string>;
+        if (message.lastEventId) lastEventId = message.lastEventId;
+        handlers.onEvent({
+          id: Number(message.lastEventId),
+          type,
+          data: JSON.parse(message.data),
+          received_at: new Date().toISOString(),
+        });
+      });
+    });
+    stream.addEventListener('visitors', (e) => {
+      const message = e as MessageEvent<string>;
+      if (message.lastEventId) lastEventId = message.lastEventId;
+      handlers.onVisitors?.(JSON.parse(message.data).online);
+    });
+  };
+
+  connect();
+
+  return () => {
+    closed = true;
+    clearTimeout(retryTimer);
+    source?.close();
+  };
+};
@@ -81,6 +81,7 @@ export const getStatusColor = (status: string | null | undefined): string => {
   
   switch (status.toLowerCase()) {
     case 'active':
+    case 'on_trial':
       return 'text-green-500'
     case 'cancelled':
       return 'text-yellow-500'
@@ -106,8 +107,8 @@ export const hasActiveSubscription = (userData: { subscription?: { status?: stri
     return false;
   }
   
-  // More robust check for active status
-  const isActive = status?.toLowerCase() === 'active';
+  // Trialling users are entitled just like paying ones
+  const isActive = status?.toLowerCase() === 'active' || status?.toLowerCase() === 'on_trial';
   const hasVariant = variantId !== undefined && variantId !== null;
   
   return isActive && hasVariant;
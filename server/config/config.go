@@ -0,0 +1,456 @@
+// Package config loads, validates and reports the server configuration.
+// Values are resolved in increasing order of precedence from built-in defaults,
+// an optional YAML file, a .env file and finally the process environment.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"saas-server/database"
+	"saas-server/pkg/analytics"
+	"saas-server/pkg/dunning"
+	"saas-server/pkg/ingest"
+	"saas-server/pkg/invoice"
+	"saas-server/pkg/lemonsqueezy"
+	"saas-server/pkg/rollup"
+	"saas-server/pkg/trial"
+	"saas-server/pkg/webhooks"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the YAML file read when CONFIG_FILE is not set
+const DefaultFile = "config.yaml"
+
+// Config holds all configuration for the server process
+type Config struct {
+	Environment  string             `yaml:"environment" env:"ENVIRONMENT"`
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Google       OAuthConfig        `yaml:"google" env:"GOOGLE"`
+	GitHub       OAuthConfig        `yaml:"github" env:"GITHUB"`
+	LemonSqueezy LemonSqueezyConfig `yaml:"lemon_squeezy"`
+	Plunk        PlunkConfig        `yaml:"plunk"`
+	Admin        AdminConfig        `yaml:"admin"`
+	Invoice      InvoiceConfig      `yaml:"invoice"`
+	Dunning      DunningConfig      `yaml:"dunning"`
+	Trial        TrialConfig        `yaml:"trial"`
+	Analytics    AnalyticsConfig    `yaml:"analytics"`
+	Webhooks     WebhooksConfig     `yaml:"webhooks"`
+	Telemetry    TelemetryConfig    `yaml:"telemetry"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port              string        `yaml:"port" env:"PORT"`
+	FrontendURL       string        `yaml:"frontend_url" env:"FRONTEND_URL"`
+	AllowedOrigins    []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// TrustedProxies lists the addresses or CIDR ranges of the reverse proxies whose
+	// X-Forwarded-For header is believed
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// DatabaseConfig holds PostgreSQL connection settings.
+// URL takes precedence over the individual connection fields when set.
+type DatabaseConfig struct {
+	URL      string `yaml:"url" env:"DATABASE_URL" secret:"true"`
+	Host     string `yaml:"host" env:"DB_HOST"`
+	Port     string `yaml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE"`
+
+	// QueryTimeout bounds a single repository operation; ReportTimeout bounds
+	// heavier admin and analytics aggregates. Zero disables the deadline.
+	QueryTimeout       time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+	ReportTimeout      time.Duration `yaml:"report_timeout" env:"DB_REPORT_TIMEOUT"`
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD"`
+
+	// Subscription status cache shared by handlers; a size of zero disables it
+	SubscriptionCacheSize int           `yaml:"subscription_cache_size" env:"SUBSCRIPTION_CACHE_SIZE"`
+	SubscriptionCacheTTL  time.Duration `yaml:"subscription_cache_ttl" env:"SUBSCRIPTION_CACHE_TTL"`
+}
+
+// AuthConfig holds user session settings
+type AuthConfig struct {
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+}
+
+// OAuthConfig holds the credentials of a single OAuth provider.
+// The env prefix of the parent field is prepended to each variable name.
+type OAuthConfig struct {
+	ClientID     string `yaml:"client_id" env:"CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL  string `yaml:"redirect_url" env:"REDIRECT_URL"`
+}
+
+// LemonSqueezyConfig holds payment provider settings
+type LemonSqueezyConfig struct {
+	APIKey        string `yaml:"api_key" env:"LEMON_SQUEEZY_API_KEY" secret:"true"`
+	StoreID       string `yaml:"store_id" env:"LEMON_SQUEEZY_STORE_ID"`
+	SigningSecret string `yaml:"signing_secret" env:"LEMON_SQUEEZY_SIGNING_SECRET" secret:"true"`
+	// CheckoutSecret signs the custom data attached to checkouts so webhooks can trust it
+	CheckoutSecret string `yaml:"checkout_secret" env:"LEMON_SQUEEZY_CHECKOUT_SECRET" secret:"true"`
+
+	// BaseURL overrides the production API, for example to use a local fake server
+	BaseURL    string        `yaml:"base_url" env:"LEMON_SQUEEZY_BASE_URL"`
+	Timeout    time.Duration `yaml:"timeout" env:"LEMON_SQUEEZY_TIMEOUT"`
+	MaxRetries int           `yaml:"max_retries" env:"LEMON_SQUEEZY_MAX_RETRIES"`
+
+	// CatalogSyncInterval is how often products and variants are copied into the local catalog
+	CatalogSyncInterval time.Duration `yaml:"catalog_sync_interval" env:"LEMON_SQUEEZY_CATALOG_SYNC_INTERVAL"`
+}
+
+// PlunkConfig holds transactional email settings
+type PlunkConfig struct {
+	SecretAPIKey string `yaml:"secret_api_key" env:"PLUNK_SECRET_API_KEY" secret:"true"`
+}
+
+// AdminConfig holds admin dashboard credentials and contact settings
+type AdminConfig struct {
+	Username  string `yaml:"username" env:"ADMIN_USERNAME"`
+	Password  string `yaml:"password" env:"ADMIN_PASSWORD" secret:"true"`
+	JWTSecret string `yaml:"jwt_secret" env:"ADMIN_JWT_SECRET" secret:"true"`
+	Email     string `yaml:"email" env:"ADMIN_EMAIL"`
+	ClientURL string `yaml:"client_url" env:"ADMIN_CLIENT_URL"`
+}
+
+// InvoiceConfig holds the seller details printed on PDF invoices
+type InvoiceConfig struct {
+	CompanyName string   `yaml:"company_name" env:"INVOICE_COMPANY_NAME"`
+	Address     []string `yaml:"address" env:"INVOICE_COMPANY_ADDRESS"`
+	Email       string   `yaml:"email" env:"INVOICE_COMPANY_EMAIL"`
+	TaxID       string   `yaml:"tax_id" env:"INVOICE_COMPANY_TAX_ID"`
+	AccentColor string   `yaml:"accent_color" env:"INVOICE_ACCENT_COLOR"`
+}
+
+// DunningConfig controls how failed subscription payments are chased.
+// Reminders are offsets from the first failed payment at which an email is sent.
+type DunningConfig struct {
+	GracePeriod   time.Duration   `yaml:"grace_period" env:"DUNNING_GRACE_PERIOD"`
+	Reminders     []time.Duration `yaml:"reminders" env:"DUNNING_REMINDER_SCHEDULE"`
+	CheckInterval time.Duration   `yaml:"check_interval" env:"DUNNING_CHECK_INTERVAL"`
+}
+
+// TrialConfig controls free trials. When Period and VariantID are set, every new
+// account gets an app-managed trial of that plan without entering a card.
+// Reminders are sent ReminderDays before any trial ends.
+type TrialConfig struct {
+	Period        time.Duration `yaml:"period" env:"TRIAL_PERIOD"`
+	VariantID     int           `yaml:"variant_id" env:"TRIAL_VARIANT_ID"`
+	ReminderDays  int           `yaml:"reminder_days" env:"TRIAL_REMINDER_DAYS"`
+	CheckInterval time.Duration `yaml:"check_interval" env:"TRIAL_CHECK_INTERVAL"`
+}
+
+// AnalyticsConfig controls page view tracking. VisitorID is "hash" to derive
+// anonymous visitor IDs from the IP address and user agent with a daily salt, or
+// "cookie" to keep a random ID in a first-party cookie. GeoIPDatabase is the path
+// of a MaxMind DB file used to resolve countries; without it only the CF-IPCountry
+// header set by Cloudflare is used. Page views are rolled up every RollupInterval;
+// raw views older than RetentionDays are then deleted, or moved to an archive table
+// when RetentionMode is "archive". A RetentionDays of zero keeps them forever.
+// Tracked views and events are buffered, up to QueueSize, and written BatchSize at
+// a time or every FlushInterval.
+type AnalyticsConfig struct {
+	VisitorID      string        `yaml:"visitor_id" env:"ANALYTICS_VISITOR_ID"`
+	GeoIPDatabase  string        `yaml:"geoip_database" env:"GEOIP_DATABASE"`
+	RollupInterval time.Duration `yaml:"rollup_interval" env:"ANALYTICS_ROLLUP_INTERVAL"`
+	RetentionDays  int           `yaml:"retention_days" env:"ANALYTICS_RETENTION_DAYS"`
+	RetentionMode  string        `yaml:"retention_mode" env:"ANALYTICS_RETENTION_MODE"`
+	BatchSize      int           `yaml:"batch_size" env:"ANALYTICS_BATCH_SIZE"`
+	FlushInterval  time.Duration `yaml:"flush_interval" env:"ANALYTICS_FLUSH_INTERVAL"`
+	QueueSize      int           `yaml:"queue_size" env:"ANALYTICS_QUEUE_SIZE"`
+}
+
+// Page view retention modes
+const (
+	RetentionDelete  = "delete"
+	RetentionArchive = "archive"
+)
+
+// WebhooksConfig controls the outgoing webhooks users register. Due deliveries are
+// sent every DeliveryInterval and endpoints have Timeout to respond; a failed
+// delivery is retried after each delay in RetrySchedule before it is given up.
+// Delivery logs are kept for LogRetentionDays, or forever if zero.
+// AllowPrivateNetworks accepts plain HTTP endpoints and private or loopback
+// addresses, which is only meant for local development.
+type WebhooksConfig struct {
+	DeliveryInterval     time.Duration   `yaml:"delivery_interval" env:"WEBHOOK_DELIVERY_INTERVAL"`
+	Timeout              time.Duration   `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	RetrySchedule        []time.Duration `yaml:"retry_schedule" env:"WEBHOOK_RETRY_SCHEDULE"`
+	LogRetentionDays     int             `yaml:"log_retention_days" env:"WEBHOOK_LOG_RETENTION_DAYS"`
+	AllowPrivateNetworks bool            `yaml:"allow_private_networks" env:"WEBHOOK_ALLOW_PRIVATE_NETWORKS"`
+}
+
+// TelemetryConfig holds OpenTelemetry exporter settings
+type TelemetryConfig struct {
+	ServiceName  string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+}
+
+// Default returns a configuration populated with development defaults
+func Default() *Config {
+	return &Config{
+		Environment: "development",
+		Server: ServerConfig{
+			Port:              "8080",
+			FrontendURL:       "http://localhost:3000",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:                  "localhost",
+			Port:                  "5432",
+			SSLMode:               "disable",
+			QueryTimeout:          5 * time.Second,
+			ReportTimeout:         30 * time.Second,
+			SlowQueryThreshold:    500 * time.Millisecond,
+			SubscriptionCacheSize: 10000,
+			SubscriptionCacheTTL:  5 * time.Minute,
+		},
+		LemonSqueezy: LemonSqueezyConfig{
+			Timeout:             10 * time.Second,
+			MaxRetries:          3,
+			CatalogSyncInterval: 15 * time.Minute,
+		},
+		Admin: AdminConfig{
+			ClientURL: "http://localhost:3001",
+		},
+		Invoice: InvoiceConfig{
+			CompanyName: "SaaS",
+			AccentColor: invoice.DefaultAccentColor,
+		},
+		Dunning: DunningConfig{
+			GracePeriod:   7 * 24 * time.Hour,
+			Reminders:     []time.Duration{0, 3 * 24 * time.Hour, 6 * 24 * time.Hour},
+			CheckInterval: 15 * time.Minute,
+		},
+		Trial: TrialConfig{
+			ReminderDays:  3,
+			CheckInterval: time.Hour,
+		},
+		Analytics: AnalyticsConfig{
+			VisitorID:      analytics.VisitorHash,
+			RollupInterval: 15 * time.Minute,
+			RetentionMode:  RetentionDelete,
+			BatchSize:      500,
+			FlushInterval:  2 * time.Second,
+			QueueSize:      10000,
+		},
+		Webhooks: WebhooksConfig{
+			DeliveryInterval: 5 * time.Second,
+			Timeout:          10 * time.Second,
+			RetrySchedule: []time.Duration{
+				time.Minute, 5 * time.Minute, 30 * time.Minute,
+				2 * time.Hour, 8 * time.Hour, 24 * time.Hour,
+			},
+			LogRetentionDays: 30,
+		},
+		Telemetry: TelemetryConfig{
+			ServiceName: "saas-server",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file named by CONFIG_FILE
+// (or config.yaml if present), the .env file if present and the environment.
+// It does not validate the result; call Validate before using it.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	// Load .env into the environment without overriding variables that are already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile
+	}
+	if err := cfg.loadFile(path); err != nil {
+		if explicit || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile merges values from a YAML file into the configuration
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// DSN returns the PostgreSQL connection string
+func (d DatabaseConfig) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Password, d.Name, d.SSLMode,
+	)
+}
+
+// Options returns the query limits applied by the database package
+func (d DatabaseConfig) Options() database.Options {
+	return database.Options{
+		QueryTimeout:          d.QueryTimeout,
+		ReportTimeout:         d.ReportTimeout,
+		SlowQueryThreshold:    d.SlowQueryThreshold,
+		SubscriptionCacheSize: d.SubscriptionCacheSize,
+		SubscriptionCacheTTL:  d.SubscriptionCacheTTL,
+	}
+}
+
+// Enabled reports whether any credential for the provider has been configured
+func (o OAuthConfig) Enabled() bool {
+	return o.ClientID != "" || o.ClientSecret != "" || o.RedirectURL != ""
+}
+
+// Options returns the HTTP behaviour of the Lemon Squeezy client
+func (l LemonSqueezyConfig) Options() lemonsqueezy.Options {
+	return lemonsqueezy.Options{
+		BaseURL:    l.BaseURL,
+		Timeout:    l.Timeout,
+		MaxRetries: l.MaxRetries,
+	}
+}
+
+// Enabled reports whether payments are configured
+func (l LemonSqueezyConfig) Enabled() bool {
+	return l.APIKey != "" || l.StoreID != "" || l.SigningSecret != "" || l.CheckoutSecret != ""
+}
+
+// Brand returns the seller details printed on invoices
+func (i InvoiceConfig) Brand() invoice.Brand {
+	return invoice.Brand{
+		Name:        i.CompanyName,
+		Address:     i.Address,
+		Email:       i.Email,
+		TaxID:       i.TaxID,
+		AccentColor: i.AccentColor,
+	}
+}
+
+// Options returns the dunning schedule; links in reminder emails point at frontendURL
+// when the payment provider cannot supply a payment update link
+func (d DunningConfig) Options(frontendURL string) dunning.Options {
+	return dunning.Options{
+		GracePeriod:   d.GracePeriod,
+		Reminders:     d.Reminders,
+		CheckInterval: d.CheckInterval,
+		BillingURL:    strings.TrimRight(frontendURL, "/") + "/overview",
+	}
+}
+
+// Options returns the trial settings; reminder emails link to the plans on frontendURL
+func (t TrialConfig) Options(frontendURL string) trial.Options {
+	return trial.Options{
+		Period:        t.Period,
+		VariantID:     t.VariantID,
+		ReminderLead:  time.Duration(t.ReminderDays) * 24 * time.Hour,
+		CheckInterval: t.CheckInterval,
+		UpgradeURL:    strings.TrimRight(frontendURL, "/") + "/overview",
+	}
+}
+
+// RollupOptions returns the settings of the page view rollup and retention job
+func (a AnalyticsConfig) RollupOptions() rollup.Options {
+	return rollup.Options{
+		Interval:  a.RollupInterval,
+		Retention: time.Duration(a.RetentionDays) * 24 * time.Hour,
+		Archive:   a.RetentionMode == RetentionArchive,
+	}
+}
+
+// IngestOptions returns the batching settings of tracked page views and events
+func (a AnalyticsConfig) IngestOptions() ingest.Options {
+	return ingest.Options{
+		BatchSize:     a.BatchSize,
+		FlushInterval: a.FlushInterval,
+		QueueSize:     a.QueueSize,
+	}
+}
+
+// Options returns the delivery settings of outgoing webhooks
+func (w WebhooksConfig) Options() webhooks.Options {
+	return webhooks.Options{
+		Interval:             w.DeliveryInterval,
+		Timeout:              w.Timeout,
+		Retries:              w.RetrySchedule,
+		LogRetention:         time.Duration(w.LogRetentionDays) * 24 * time.Hour,
+		AllowPrivateNetworks: w.AllowPrivateNetworks,
+	}
+}
+
+// TrustedProxyPrefixes returns TrustedProxies as ranges, a single address being a
+// range of its own. Entries that do not parse are left out; Validate reports them.
+func (s ServerConfig) TrustedProxyPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range s.TrustedProxies {
+		if prefix, err := parseProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Enabled reports whether transactional email is configured
+func (p PlunkConfig) Enabled() bool {
+	return p.SecretAPIKey != ""
+}
+
+// IsProduction reports whether the server runs in the production environment
+func (c *Config) IsProduction() bool {
+	return strings.EqualFold(c.Environment, "production")
+}
+
+// CORSOrigins returns the origins allowed to make credentialed cross-origin requests
+func (c *Config) CORSOrigins() []string {
+	if len(c.Server.AllowedOrigins) > 0 {
+		return c.Server.AllowedOrigins
+	}
+	return []string{c.Admin.ClientURL, c.Server.FrontendURL}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType      = reflect.TypeOf(time.Duration(0))
+	durationSliceType = reflect.TypeOf([]time.Duration(nil))
+)
+
+// field describes a single configurable leaf value and the variable it is read from
+type field struct {
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// fields walks the configuration struct and returns every leaf value tagged with env
+func fields(cfg *Config) []field {
+	var out []field
+	collectFields(reflect.ValueOf(cfg).Elem(), "", &out)
+	return out
+}
+
+// collectFields recursively collects leaf fields, joining nested env tags with underscores
+func collectFields(v reflect.Value, prefix string, out *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		env := sf.Tag.Get("env")
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			nested := prefix
+			if env != "" {
+				nested = prefix + env + "_"
+			}
+			collectFields(fv, nested, out)
+			continue
+		}
+
+		if env == "" {
+			continue
+		}
+		*out = append(*out, field{
+			env:    prefix + env,
+			secret: sf.Tag.Get("secret") == "true",
+			value:  fv,
+		})
+	}
+}
+
+// applyEnv overrides configuration values with any matching environment variables
+func applyEnv(cfg *Config) error {
+	for _, f := range fields(cfg) {
+		raw, ok := os.LookupEnv(f.env)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setValue(f.value, raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", f.env, err)
+		}
+	}
+	return nil
+}
+
+// setValue parses a raw environment string into the field's type
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		if v.Type() == durationSliceType {
+			durations := make([]time.Duration, 0, len(items))
+			for _, item := range items {
+				d, err := time.ParseDuration(item)
+				if err != nil {
+					return err
+				}
+				durations = append(durations, d)
+			}
+			v.Set(reflect.ValueOf(durations))
+			return nil
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Summary returns a human-readable listing of every setting with secrets redacted,
+// suitable for printing at startup
+func (c *Config) Summary() string {
+	var b strings.Builder
+	b.WriteString("Configuration:\n")
+	for _, f := range fields(c) {
+		fmt.Fprintf(&b, "  %-32s %s\n", f.env, displayValue(f))
+	}
+	return b.String()
+}
+
+// displayValue formats a field for the summary, hiding secret values
+func displayValue(f field) string {
+	if f.value.IsZero() {
+		return "(not set)"
+	}
+	if f.secret {
+		return "********"
+	}
+	if f.value.Type() == durationSliceType {
+		items := make([]string, 0, f.value.Len())
+		for _, d := range f.value.Interface().([]time.Duration) {
+			items = append(items, d.String())
+		}
+		return strings.Join(items, ",")
+	}
+	if f.value.Kind() == reflect.Slice {
+		return strings.Join(f.value.Interface().([]string), ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
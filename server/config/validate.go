@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+
+	"saas-server/pkg/analytics"
+	"saas-server/pkg/invoice"
+)
+
+// Validate checks that every always-required value is present and that each optional
+// integration is either fully configured or not configured at all.
+// All problems are reported together so they can be fixed in one pass.
+func (c *Config) Validate() error {
+	var errs []error
+	require := func(value, name, reason string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required %s", name, reason))
+		}
+	}
+
+	// Core settings
+	require(c.Server.Port, "PORT", "to start the HTTP server")
+	require(c.Auth.JWTSecret, "JWT_SECRET", "to sign user sessions")
+	if c.Database.URL == "" {
+		require(c.Database.Host, "DB_HOST", "when DATABASE_URL is not set")
+		require(c.Database.User, "DB_USER", "when DATABASE_URL is not set")
+		require(c.Database.Name, "DB_NAME", "when DATABASE_URL is not set")
+	}
+	if c.Server.FrontendURL != "" {
+		if _, err := url.ParseRequestURI(c.Server.FrontendURL); err != nil {
+			errs = append(errs, fmt.Errorf("FRONTEND_URL is not a valid URL: %v", err))
+		}
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := parseProxy(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q is not an address or CIDR range", proxy))
+		}
+	}
+
+	// Admin dashboard
+	require(c.Admin.Username, "ADMIN_USERNAME", "for the admin dashboard")
+	require(c.Admin.Password, "ADMIN_PASSWORD", "for the admin dashboard")
+	require(c.Admin.JWTSecret, "ADMIN_JWT_SECRET", "for the admin dashboard")
+	if c.Admin.JWTSecret != "" && c.Admin.JWTSecret == c.Auth.JWTSecret {
+		errs = append(errs, errors.New("ADMIN_JWT_SECRET must differ from JWT_SECRET"))
+	}
+
+	// OAuth providers
+	if c.Google.Enabled() {
+		require(c.Google.ClientID, "GOOGLE_CLIENT_ID", "when Google sign-in is configured")
+		require(c.Google.ClientSecret, "GOOGLE_CLIENT_SECRET", "when Google sign-in is configured")
+		require(c.Google.RedirectURL, "GOOGLE_REDIRECT_URL", "when Google sign-in is configured")
+	}
+	if c.GitHub.Enabled() {
+		require(c.GitHub.ClientID, "GITHUB_CLIENT_ID", "when GitHub sign-in is configured")
+		require(c.GitHub.ClientSecret, "GITHUB_CLIENT_SECRET", "when GitHub sign-in is configured")
+		require(c.GitHub.RedirectURL, "GITHUB_REDIRECT_URL", "when GitHub sign-in is configured")
+	}
+
+	// Payments
+	if c.LemonSqueezy.Enabled() {
+		require(c.LemonSqueezy.APIKey, "LEMON_SQUEEZY_API_KEY", "when payments are configured")
+		require(c.LemonSqueezy.StoreID, "LEMON_SQUEEZY_STORE_ID", "when payments are configured")
+		require(c.LemonSqueezy.SigningSecret, "LEMON_SQUEEZY_SIGNING_SECRET", "when payments are configured")
+		require(c.LemonSqueezy.CheckoutSecret, "LEMON_SQUEEZY_CHECKOUT_SECRET", "when payments are configured")
+		if c.LemonSqueezy.BaseURL != "" {
+			if _, err := url.ParseRequestURI(c.LemonSqueezy.BaseURL); err != nil {
+				errs = append(errs, fmt.Errorf("LEMON_SQUEEZY_BASE_URL is not a valid URL: %v", err))
+			}
+		}
+		if c.LemonSqueezy.MaxRetries < 0 {
+			errs = append(errs, errors.New("LEMON_SQUEEZY_MAX_RETRIES must not be negative"))
+		}
+		if c.LemonSqueezy.CatalogSyncInterval <= 0 {
+			errs = append(errs, errors.New("LEMON_SQUEEZY_CATALOG_SYNC_INTERVAL must be positive"))
+		}
+	}
+
+	// Email: the contact form delivers to the admin mailbox
+	if c.Plunk.Enabled() {
+		require(c.Admin.Email, "ADMIN_EMAIL", "when email is configured, to receive contact form messages")
+		require(c.Server.FrontendURL, "FRONTEND_URL", "when email is configured, to build links in emails")
+	}
+	if c.Admin.Email != "" {
+		if _, err := mail.ParseAddress(c.Admin.Email); err != nil {
+			errs = append(errs, fmt.Errorf("ADMIN_EMAIL is not a valid address: %v", err))
+		}
+	}
+
+	// Dunning
+	if c.Dunning.GracePeriod < 0 {
+		errs = append(errs, errors.New("DUNNING_GRACE_PERIOD must not be negative"))
+	}
+	if c.Dunning.CheckInterval <= 0 {
+		errs = append(errs, errors.New("DUNNING_CHECK_INTERVAL must be positive"))
+	}
+	for i, offset := range c.Dunning.Reminders {
+		if offset < 0 || (i > 0 && offset <= c.Dunning.Reminders[i-1]) {
+			errs = append(errs, errors.New("DUNNING_REMINDER_SCHEDULE must list non-negative offsets in increasing order"))
+			break
+		}
+	}
+
+	// Trials
+	if c.Trial.Period < 0 {
+		errs = append(errs, errors.New("TRIAL_PERIOD must not be negative"))
+	}
+	if (c.Trial.Period > 0) != (c.Trial.VariantID > 0) {
+		errs = append(errs, errors.New("TRIAL_PERIOD and TRIAL_VARIANT_ID must be set together"))
+	}
+	if c.Trial.ReminderDays < 0 {
+		errs = append(errs, errors.New("TRIAL_REMINDER_DAYS must not be negative"))
+	}
+	if c.Trial.CheckInterval <= 0 {
+		errs = append(errs, errors.New("TRIAL_CHECK_INTERVAL must be positive"))
+	}
+
+	// Analytics
+	if c.Analytics.VisitorID != analytics.VisitorHash && c.Analytics.VisitorID != analytics.VisitorCookie {
+		errs = append(errs, fmt.Errorf("ANALYTICS_VISITOR_ID must be %q or %q", analytics.VisitorHash, analytics.VisitorCookie))
+	}
+	if c.Analytics.RollupInterval <= 0 {
+		errs = append(errs, errors.New("ANALYTICS_ROLLUP_INTERVAL must be positive"))
+	}
+	if c.Analytics.RetentionDays < 0 {
+		errs = append(errs, errors.New("ANALYTICS_RETENTION_DAYS must not be negative"))
+	}
+	if c.Analytics.RetentionMode != RetentionDelete && c.Analytics.RetentionMode != RetentionArchive {
+		errs = append(errs, fmt.Errorf("ANALYTICS_RETENTION_MODE must be %q or %q", RetentionDelete, RetentionArchive))
+	}
+	if c.Analytics.BatchSize <= 0 {
+		errs = append(errs, errors.New("ANALYTICS_BATCH_SIZE must be positive"))
+	}
+	if c.Analytics.FlushInterval <= 0 {
+		errs = append(errs, errors.New("ANALYTICS_FLUSH_INTERVAL must be positive"))
+	}
+	if c.Analytics.QueueSize < c.Analytics.BatchSize {
+		errs = append(errs, errors.New("ANALYTICS_QUEUE_SIZE must be at least ANALYTICS_BATCH_SIZE"))
+	}
+
+	// Webhooks
+	if c.Webhooks.DeliveryInterval <= 0 {
+		errs = append(errs, errors.New("WEBHOOK_DELIVERY_INTERVAL must be positive"))
+	}
+	if c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("WEBHOOK_TIMEOUT must be positive"))
+	}
+	for _, delay := range c.Webhooks.RetrySchedule {
+		if delay <= 0 {
+			errs = append(errs, errors.New("WEBHOOK_RETRY_SCHEDULE must list positive delays"))
+			break
+		}
+	}
+	if c.Webhooks.LogRetentionDays < 0 {
+		errs = append(errs, errors.New("WEBHOOK_LOG_RETENTION_DAYS must not be negative"))
+	}
+	if c.Webhooks.AllowPrivateNetworks && c.IsProduction() {
+		errs = append(errs, errors.New("WEBHOOK_ALLOW_PRIVATE_NETWORKS must not be set in production"))
+	}
+
+	// Invoices are only issued for payments
+	if c.LemonSqueezy.Enabled() {
+		require(c.Invoice.CompanyName, "INVOICE_COMPANY_NAME", "to brand invoices when payments are enabled")
+	}
+	if c.Invoice.AccentColor != "" {
+		if err := invoice.ValidateColor(c.Invoice.AccentColor); err != nil {
+			errs = append(errs, fmt.Errorf("INVOICE_ACCENT_COLOR: %v", err))
+		}
+	}
+	if c.Invoice.Email != "" {
+		if _, err := mail.ParseAddress(c.Invoice.Email); err != nil {
+			errs = append(errs, fmt.Errorf("INVOICE_COMPANY_EMAIL is not a valid address: %v", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
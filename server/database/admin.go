@@ -1,13 +1,17 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"saas-server/models"
 )
 
 // GetUsers retrieves a paginated list of users with optional search
-func (db *DB) GetUsers(page int, limit int, search string) ([]models.User, int, error) {
+func (db *DB) GetUsers(ctx context.Context, page int, limit int, search string) ([]models.User, int, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
 	offset := (page - 1) * limit
 
 	// Base query with all fields
@@ -46,13 +50,13 @@ func (db *DB) GetUsers(page int, limit int, search string) ([]models.User, int,
 
 	// Get total count
 	var total int
-	err := db.QueryRow(countQuery, args[:len(args)-2]...).Scan(&total)
+	err := db.QueryRowContext(ctx, countQuery, args[:len(args)-2]...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error counting users: %v", err)
 	}
 
 	// Execute the main query
-	rows, err := db.Query(baseQuery, args...)
+	rows, err := db.QueryContext(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error querying users: %v", err)
 	}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"saas-server/models"
+
+	"github.com/lib/pq"
+)
+
+// apiKeyColumns lists the columns scanned by scanAPIKey, in order
+const apiKeyColumns = `
+		id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip,
+		revoked_at, created_at`
+
+// CreateAPIKey stores a key with the ID, prefix and hash already set on k, unless its
+// user already holds max active keys. The user's row is locked while the keys are
+// counted, so that concurrent requests cannot both take the last place.
+func (db *DB) CreateAPIKey(ctx context.Context, k *models.APIKey, max int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.inTx(ctx, func(tx *DB) error {
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, k.UserID); err != nil {
+			return err
+		}
+
+		var active int
+		countQuery := `
+			SELECT COUNT(*)
+			FROM api_keys
+			WHERE user_id = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+		if err := tx.QueryRowContext(ctx, countQuery, k.UserID).Scan(&active); err != nil {
+			return err
+		}
+		if active >= max {
+			return ErrAPIKeyLimit
+		}
+
+		query := `
+			INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+			RETURNING created_at`
+
+		return tx.QueryRowContext(ctx, query, k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash,
+			pq.Array(k.Scopes), k.ExpiresAt).Scan(&k.CreatedAt)
+	})
+}
+
+// GetAPIKeys returns a user's keys, revoked and expired ones included, newest first
+func (db *DB) GetAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByPrefix returns the key with the given prefix, or sql.ErrNoRows if there is none
+func (db *DB) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + apiKeyColumns + `
+		FROM api_keys
+		WHERE prefix = $1`
+
+	return scanAPIKey(db.QueryRowContext(ctx, query, prefix))
+}
+
+// RevokeAPIKey revokes one of a user's keys at the given time and returns it, or
+// returns sql.ErrNoRows if the user has no key with that ID. A key already revoked
+// keeps its original revocation time.
+func (db *DB) RevokeAPIKey(ctx context.Context, userID, id string, at time.Time) (*models.APIKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE api_keys
+		SET revoked_at = COALESCE(revoked_at, $1)
+		WHERE id = $2 AND user_id = $3
+		RETURNING` + apiKeyColumns
+
+	return scanAPIKey(db.QueryRowContext(ctx, query, at, id, userID))
+}
+
+// TouchAPIKey records when and from which address a key was last used
+func (db *DB) TouchAPIKey(ctx context.Context, id string, at time.Time, ip string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`, at, ip, id)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var k models.APIKey
+	err := row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Name,
+		&k.Prefix,
+		&k.KeyHash,
+		pq.Array(&k.Scopes),
+		&k.ExpiresAt,
+		&k.LastUsedAt,
+		&k.LastUsedIP,
+		&k.RevokedAt,
+		&k.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
@@ -11,7 +12,10 @@ import (
 )
 
 // CreateRefreshToken creates a new refresh token in the database
-func (db *DB) CreateRefreshToken(userID string, tokenHash string, deviceInfo string, ipAddress string, expiresAt time.Time) error {
+func (db *DB) CreateRefreshToken(ctx context.Context, userID string, tokenHash string, deviceInfo string, ipAddress string, expiresAt time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO refresh_tokens (id, user_id, token_hash, device_info, ip_address, expires_at, created_at, last_used_at, is_blocked)
 		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, false)`
@@ -27,12 +31,15 @@ func (db *DB) CreateRefreshToken(userID string, tokenHash string, deviceInfo str
 	// Generate a new UUID for the token
 	tokenID := uuid.New().String()
 
-	_, err := db.Exec(query, tokenID, userID, tokenHash, deviceInfo, ipAddress, expiresAt)
+	_, err := db.ExecContext(ctx, query, tokenID, userID, tokenHash, deviceInfo, ipAddress, expiresAt)
 	return err
 }
 
 // GetRefreshToken retrieves a refresh token from the database by its hash
-func (db *DB) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+func (db *DB) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var token models.RefreshToken
 	query := `
 		SELECT id, user_id, token_hash, device_info, ip_address, expires_at, created_at, last_used_at, is_blocked
@@ -41,7 +48,7 @@ func (db *DB) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
 		AND expires_at > CURRENT_TIMESTAMP
 		AND is_blocked = false`
 
-	err := db.QueryRow(query, tokenHash).Scan(
+	err := db.QueryRowContext(ctx, query, tokenHash).Scan(
 		&token.ID,
 		&token.UserID,
 		&token.TokenHash,
@@ -62,28 +69,37 @@ func (db *DB) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
 }
 
 // DeleteAllUserRefreshTokens removes all refresh tokens for a user
-func (db *DB) DeleteAllUserRefreshTokens(userID string) error {
+func (db *DB) DeleteAllUserRefreshTokens(ctx context.Context, userID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE refresh_tokens
 		SET is_blocked = true
 		WHERE user_id = $1`
 
-	_, err := db.Exec(query, userID)
+	_, err := db.ExecContext(ctx, query, userID)
 	return err
 }
 
 // AddToBlacklist adds a token to the blacklist
-func (db *DB) AddToBlacklist(jti string, userID string, expiresAt time.Time) error {
+func (db *DB) AddToBlacklist(ctx context.Context, jti string, userID string, expiresAt time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO token_blacklist (jti, user_id, expires_at)
 		VALUES ($1, $2, $3)`
 
-	_, err := db.Exec(query, jti, userID, expiresAt)
+	_, err := db.ExecContext(ctx, query, jti, userID, expiresAt)
 	return err
 }
 
 // IsTokenBlacklisted checks if a token is blacklisted
-func (db *DB) IsTokenBlacklisted(jti string) (bool, error) {
+func (db *DB) IsTokenBlacklisted(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `
 		SELECT EXISTS(
@@ -91,29 +107,77 @@ func (db *DB) IsTokenBlacklisted(jti string) (bool, error) {
 			WHERE jti = $1 AND expires_at > CURRENT_TIMESTAMP
 		)`
 
-	err := db.QueryRow(query, jti).Scan(&exists)
+	err := db.QueryRowContext(ctx, query, jti).Scan(&exists)
 	return exists, err
 }
 
-// CleanupExpiredBlacklistedTokens removes expired tokens from the blacklist
-func (db *DB) CleanupExpiredBlacklistedTokens() error {
-	query := `DELETE FROM token_blacklist WHERE expires_at <= CURRENT_TIMESTAMP`
-	_, err := db.Exec(query)
-	return err
+// UseAdminStreamToken records the use of the admin stream token jti and reports whether
+// it was the first. The insert is a single statement, so of concurrent uses only one wins.
+func (db *DB) UseAdminStreamToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO admin_stream_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`
+
+	result, err := db.ExecContext(ctx, query, jti, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// DeleteExpiredTokens removes refresh, blacklist, password reset, email verification and
+// used admin stream tokens that expired before the given time and returns the number of rows deleted per kind
+func (db *DB) DeleteExpiredTokens(ctx context.Context, before time.Time) (map[string]int64, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	queries := []struct {
+		kind  string
+		query string
+	}{
+		{"refresh tokens", "DELETE FROM refresh_tokens WHERE expires_at < $1"},
+		{"blacklist entries", "DELETE FROM token_blacklist WHERE expires_at < $1"},
+		{"password reset tokens", "DELETE FROM password_reset_tokens WHERE expires_at < $1"},
+		{"email verification tokens", "DELETE FROM email_verification_tokens WHERE expires_at < $1"},
+		{"admin stream tokens", "DELETE FROM admin_stream_tokens WHERE expires_at < $1"},
+	}
+
+	deleted := make(map[string]int64, len(queries))
+	for _, q := range queries {
+		result, err := db.ExecContext(ctx, q.query, before)
+		if err != nil {
+			return deleted, err
+		}
+		if rows, err := result.RowsAffected(); err == nil {
+			deleted[q.kind] = rows
+		}
+	}
+	return deleted, nil
 }
 
 // CreatePasswordResetToken creates a new password reset token for a user
-func (db *DB) CreatePasswordResetToken(userID string, token string, expiresAt time.Time) error {
+func (db *DB) CreatePasswordResetToken(ctx context.Context, userID string, token string, expiresAt time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO password_reset_tokens (user_id, token, expires_at)
 		VALUES ($1, $2, $3)`
 
-	_, err := db.Exec(query, userID, token, expiresAt)
+	_, err := db.ExecContext(ctx, query, userID, token, expiresAt)
 	return err
 }
 
 // GetPasswordResetToken retrieves a valid password reset token
-func (db *DB) GetPasswordResetToken(token string) (string, error) {
+func (db *DB) GetPasswordResetToken(ctx context.Context, token string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var userID string
 	query := `
 		SELECT user_id
@@ -122,7 +186,7 @@ func (db *DB) GetPasswordResetToken(token string) (string, error) {
 		AND expires_at > CURRENT_TIMESTAMP
 		AND used_at IS NULL`
 
-	err := db.QueryRow(query, token).Scan(&userID)
+	err := db.QueryRowContext(ctx, query, token).Scan(&userID)
 	if err == sql.ErrNoRows {
 		return "", errors.New("token not found")
 	}
@@ -130,7 +194,10 @@ func (db *DB) GetPasswordResetToken(token string) (string, error) {
 }
 
 // MarkPasswordResetTokenUsed marks a password reset token as used
-func (db *DB) MarkPasswordResetTokenUsed(token string) error {
+func (db *DB) MarkPasswordResetTokenUsed(ctx context.Context, token string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE password_reset_tokens
 		SET used_at = CURRENT_TIMESTAMP
@@ -138,7 +205,7 @@ func (db *DB) MarkPasswordResetTokenUsed(token string) error {
 		AND used_at IS NULL
 		AND expires_at > CURRENT_TIMESTAMP`
 
-	result, err := db.Exec(query, token)
+	result, err := db.ExecContext(ctx, query, token)
 	if err != nil {
 		return err
 	}
@@ -156,97 +223,103 @@ func (db *DB) MarkPasswordResetTokenUsed(token string) error {
 }
 
 // StoreEmailVerificationToken stores a new email verification token
-func (db *DB) StoreEmailVerificationToken(token, userID, email string, expiresAt time.Time) error {
+func (db *DB) StoreEmailVerificationToken(ctx context.Context, token, userID, email string, expiresAt time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO email_verification_tokens (token, user_id, email, expires_at)
 		VALUES ($1, $2, $3, $4)
 	`
-	_, err := db.Exec(query, token, userID, email, expiresAt)
+	_, err := db.ExecContext(ctx, query, token, userID, email, expiresAt)
 	return err
 }
 
-// VerifyEmail verifies the email using the token and updates the user's email_verified status
-func (db *DB) VerifyEmail(token string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("[DB] Failed to begin transaction: %v", err)
-		return err
-	}
-	defer tx.Rollback()
-
-	// First, let's check if the token exists at all
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM email_verification_tokens WHERE token = $1)`
-	err = tx.QueryRow(checkQuery, token).Scan(&exists)
-	if err != nil {
-		log.Printf("[DB] Error checking token existence: %v", err)
-		return err
-	}
-
-	if !exists {
-		log.Printf("[DB] Token does not exist: %s", token)
-		return errors.New("invalid or expired token")
-	}
+// VerifyEmail verifies the email using the token and updates the user's email_verified status.
+// It returns the ID of the user whose address was verified, or an empty string if
+// the address had already been verified.
+func (db *DB) VerifyEmail(ctx context.Context, token string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var verifiedUserID string
+	err := db.inTx(ctx, func(tx *DB) error {
+		// First, let's check if the token exists at all
+		var exists bool
+		checkQuery := `SELECT EXISTS(SELECT 1 FROM email_verification_tokens WHERE token = $1)`
+		err := tx.QueryRowContext(ctx, checkQuery, token).Scan(&exists)
+		if err != nil {
+			log.Printf("[DB] Error checking token existence: %v", err)
+			return err
+		}
 
-	// Now check the token's status and get user info
-	var userID string
-	var expiresAt time.Time
-	var usedAt sql.NullTime
-	var emailVerified bool
-	query := `
-		SELECT evt.user_id, evt.expires_at, evt.used_at, u.email_verified
-		FROM email_verification_tokens evt
-		JOIN users u ON u.id = evt.user_id
-		WHERE evt.token = $1
-	`
-	err = tx.QueryRow(query, token).Scan(&userID, &expiresAt, &usedAt, &emailVerified)
-	if err != nil {
-		log.Printf("[DB] Error querying token details: %v", err)
-		if err == sql.ErrNoRows {
+		if !exists {
+			log.Printf("[DB] Token does not exist: %s", token)
 			return errors.New("invalid or expired token")
 		}
-		return err
-	}
 
-	if emailVerified {
-		return nil
-	}
+		// Now check the token's status and get user info
+		var userID string
+		var expiresAt time.Time
+		var usedAt sql.NullTime
+		var emailVerified bool
+		query := `
+			SELECT evt.user_id, evt.expires_at, evt.used_at, u.email_verified
+			FROM email_verification_tokens evt
+			JOIN users u ON u.id = evt.user_id
+			WHERE evt.token = $1
+		`
+		err = tx.QueryRowContext(ctx, query, token).Scan(&userID, &expiresAt, &usedAt, &emailVerified)
+		if err != nil {
+			log.Printf("[DB] Error querying token details: %v", err)
+			if err == sql.ErrNoRows {
+				return errors.New("invalid or expired token")
+			}
+			return err
+		}
 
-	if usedAt.Valid {
-		return errors.New("token already used")
-	}
+		if emailVerified {
+			return nil
+		}
 
-	if time.Now().After(expiresAt) {
-		return errors.New("token has expired")
-	}
+		if usedAt.Valid {
+			return errors.New("token already used")
+		}
 
-	// Mark token as used
-	_, err = tx.Exec(`
-		UPDATE email_verification_tokens
-		SET used_at = CURRENT_TIMESTAMP
-		WHERE token = $1
-	`, token)
-	if err != nil {
-		return err
-	}
+		if time.Now().After(expiresAt) {
+			return errors.New("token has expired")
+		}
 
-	// Update user's email_verified status
-	result, err := tx.Exec(`
-		UPDATE users
-		SET email_verified = true
-		WHERE id = $1
-	`, userID)
-	if err != nil {
-		return err
-	}
+		// Mark token as used
+		_, err = tx.ExecContext(ctx, `
+			UPDATE email_verification_tokens
+			SET used_at = CURRENT_TIMESTAMP
+			WHERE token = $1
+		`, token)
+		if err != nil {
+			return err
+		}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		return errors.New("user not found")
-	}
+		// Update user's email_verified status
+		result, err := tx.ExecContext(ctx, `
+			UPDATE users
+			SET email_verified = true
+			WHERE id = $1
+		`, userID)
+		if err != nil {
+			return err
+		}
 
-	return tx.Commit()
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return errors.New("user not found")
+		}
+
+		verifiedUserID = userID
+		return nil
+	})
+	return verifiedUserID, err
 }
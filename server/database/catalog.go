@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"saas-server/models"
+
+	"github.com/lib/pq"
+)
+
+const productColumns = `id, store_id, name, description, slug, status, price,
+		       price_formatted, thumb_url, created_at, updated_at, synced_at`
+
+const variantColumns = `id, product_id, name, description, price, status,
+		       is_subscription, billing_interval, billing_interval_count,
+		       created_at, updated_at, synced_at`
+
+// UpsertProduct inserts or updates a product. When product.Variants is not nil the
+// product's variants are replaced with it; otherwise they are left untouched.
+func (db *DB) UpsertProduct(ctx context.Context, product *models.Product) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.inTx(ctx, func(tx *DB) error {
+		return tx.upsertProduct(ctx, product)
+	})
+}
+
+// upsertProduct writes the product and its variants using the caller's transaction and deadline
+func (db *DB) upsertProduct(ctx context.Context, product *models.Product) error {
+	query := `
+		INSERT INTO products (
+			id, store_id, name, description, slug, status, price,
+			price_formatted, thumb_url, created_at, updated_at, synced_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			store_id = EXCLUDED.store_id,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			slug = EXCLUDED.slug,
+			status = EXCLUDED.status,
+			price = EXCLUDED.price,
+			price_formatted = EXCLUDED.price_formatted,
+			thumb_url = EXCLUDED.thumb_url,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at,
+			synced_at = CURRENT_TIMESTAMP`
+
+	_, err := db.ExecContext(ctx, query, product.ID, product.StoreID, product.Name, product.Description,
+		product.Slug, product.Status, product.Price, product.PriceFormatted, product.ThumbURL,
+		product.CreatedAt, product.UpdatedAt)
+	if err != nil || product.Variants == nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(product.Variants))
+	for i := range product.Variants {
+		product.Variants[i].ProductID = product.ID
+		if err := db.upsertVariant(ctx, &product.Variants[i]); err != nil {
+			return err
+		}
+		ids = append(ids, int64(product.Variants[i].ID))
+	}
+
+	// Drop variants the provider no longer lists for this product
+	_, err = db.ExecContext(ctx, `DELETE FROM variants WHERE product_id = $1 AND NOT (id = ANY($2))`,
+		product.ID, pq.Array(ids))
+	return err
+}
+
+// UpsertVariant inserts or updates a single variant of an existing product
+func (db *DB) UpsertVariant(ctx context.Context, variant *models.Variant) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.upsertVariant(ctx, variant)
+}
+
+func (db *DB) upsertVariant(ctx context.Context, variant *models.Variant) error {
+	query := `
+		INSERT INTO variants (
+			id, product_id, name, description, price, status,
+			is_subscription, billing_interval, billing_interval_count,
+			created_at, updated_at, synced_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			product_id = EXCLUDED.product_id,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			price = EXCLUDED.price,
+			status = EXCLUDED.status,
+			is_subscription = EXCLUDED.is_subscription,
+			billing_interval = EXCLUDED.billing_interval,
+			billing_interval_count = EXCLUDED.billing_interval_count,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at,
+			synced_at = CURRENT_TIMESTAMP`
+
+	_, err := db.ExecContext(ctx, query, variant.ID, variant.ProductID, variant.Name, variant.Description,
+		variant.Price, variant.Status, variant.IsSubscription, variant.Interval, variant.IntervalCount,
+		variant.CreatedAt, variant.UpdatedAt)
+	return err
+}
+
+// DeleteProduct removes a product and its variants
+func (db *DB) DeleteProduct(ctx context.Context, productID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM products WHERE id = $1`, productID)
+	return err
+}
+
+// DeleteVariant removes a single variant
+func (db *DB) DeleteVariant(ctx context.Context, variantID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM variants WHERE id = $1`, variantID)
+	return err
+}
+
+// ReplaceStoreCatalog makes the store's catalog match products exactly: every product
+// and its variants are upserted and products of the store that are not listed are removed.
+// The replacement is atomic, so readers see either the old or the new catalog.
+func (db *DB) ReplaceStoreCatalog(ctx context.Context, storeID int, products []models.Product) error {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	return db.inTx(ctx, func(tx *DB) error {
+		ids := make([]int64, 0, len(products))
+		for i := range products {
+			products[i].StoreID = storeID
+			if products[i].Variants == nil {
+				products[i].Variants = []models.Variant{}
+			}
+			if err := tx.upsertProduct(ctx, &products[i]); err != nil {
+				return err
+			}
+			ids = append(ids, int64(products[i].ID))
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM products WHERE store_id = $1 AND NOT (id = ANY($2))`,
+			storeID, pq.Array(ids))
+		return err
+	})
+}
+
+// GetProducts returns the catalog with variants, limited to one store unless storeID is 0
+func (db *DB) GetProducts(ctx context.Context, storeID int) ([]models.Product, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + productColumns + `
+		FROM products
+		WHERE $1 = 0 OR store_id = $1
+		ORDER BY id`
+
+	rows, err := db.QueryContext(ctx, query, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, *product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := db.loadVariants(ctx, products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetProduct returns a single product with its variants, or sql.ErrNoRows
+func (db *DB) GetProduct(ctx context.Context, productID int) (*models.Product, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+	product, err := scanProduct(db.QueryRowContext(ctx, query, productID))
+	if err != nil {
+		return nil, err
+	}
+
+	products := []models.Product{*product}
+	if err := db.loadVariants(ctx, products); err != nil {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+// GetVariant returns a single variant, or sql.ErrNoRows
+func (db *DB) GetVariant(ctx context.Context, variantID int) (*models.Variant, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var v models.Variant
+	query := `SELECT ` + variantColumns + ` FROM variants WHERE id = $1`
+	err := db.QueryRowContext(ctx, query, variantID).Scan(&v.ID, &v.ProductID, &v.Name, &v.Description,
+		&v.Price, &v.Status, &v.IsSubscription, &v.Interval, &v.IntervalCount,
+		&v.CreatedAt, &v.UpdatedAt, &v.SyncedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// loadVariants fills in the variants of each product with a single query
+func (db *DB) loadVariants(ctx context.Context, products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(products))
+	ids := make([]int64, len(products))
+	for i := range products {
+		products[i].Variants = []models.Variant{}
+		index[products[i].ID] = i
+		ids[i] = int64(products[i].ID)
+	}
+
+	query := `
+		SELECT ` + variantColumns + `
+		FROM variants
+		WHERE product_id = ANY($1)
+		ORDER BY product_id, price, id`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.Variant
+		if err := rows.Scan(&v.ID, &v.ProductID, &v.Name, &v.Description, &v.Price, &v.Status,
+			&v.IsSubscription, &v.Interval, &v.IntervalCount,
+			&v.CreatedAt, &v.UpdatedAt, &v.SyncedAt); err != nil {
+			return err
+		}
+		i := index[v.ProductID]
+		products[i].Variants = append(products[i].Variants, v)
+	}
+	return rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(row rowScanner) (*models.Product, error) {
+	var p models.Product
+	err := row.Scan(&p.ID, &p.StoreID, &p.Name, &p.Description, &p.Slug, &p.Status, &p.Price,
+		&p.PriceFormatted, &p.ThumbURL, &p.CreatedAt, &p.UpdatedAt, &p.SyncedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
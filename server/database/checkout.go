@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"saas-server/models"
+	"time"
+)
+
+// CreatePendingCheckout records a checkout before it is created with the payment provider
+func (db *DB) CreatePendingCheckout(ctx context.Context, checkout *models.Checkout) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO checkouts (id, user_id, variant_id, discount_code, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		RETURNING created_at`
+
+	checkout.Status = models.CheckoutPending
+	return db.QueryRowContext(ctx, query, checkout.ID, checkout.UserID, checkout.VariantID,
+		checkout.DiscountCode, checkout.Status).Scan(&checkout.CreatedAt)
+}
+
+// SetCheckoutURL stores the provider's checkout ID and URL on a pending checkout
+func (db *DB) SetCheckoutURL(ctx context.Context, id, providerCheckoutID, checkoutURL string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE checkouts
+		SET provider_checkout_id = $1, checkout_url = $2
+		WHERE id = $3`
+
+	_, err := db.ExecContext(ctx, query, providerCheckoutID, checkoutURL, id)
+	return err
+}
+
+// DeleteCheckout removes a checkout that could not be created with the payment provider
+func (db *DB) DeleteCheckout(ctx context.Context, id string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM checkouts WHERE id = $1`, id)
+	return err
+}
+
+// CompleteCheckout marks a pending checkout as paid by the given order
+func (db *DB) CompleteCheckout(ctx context.Context, id string, orderID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE checkouts
+		SET status = $1, order_id = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = $4`
+
+	_, err := db.ExecContext(ctx, query, models.CheckoutCompleted, orderID, id, models.CheckoutPending)
+	return err
+}
+
+// GetAbandonedCheckouts returns checkouts still pending that were started before the given time
+func (db *DB) GetAbandonedCheckouts(ctx context.Context, before time.Time) ([]models.Checkout, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT c.id, c.user_id, u.email, c.variant_id, c.discount_code,
+		       c.provider_checkout_id, c.checkout_url, c.status, c.created_at
+		FROM checkouts c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.status = $1 AND c.created_at < $2
+		ORDER BY c.created_at DESC`
+
+	rows, err := db.QueryContext(ctx, query, models.CheckoutPending, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkouts := []models.Checkout{}
+	for rows.Next() {
+		var c models.Checkout
+		if err := rows.Scan(&c.ID, &c.UserID, &c.UserEmail, &c.VariantID, &c.DiscountCode,
+			&c.ProviderCheckoutID, &c.CheckoutURL, &c.Status, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkouts = append(checkouts, c)
+	}
+	return checkouts, rows.Err()
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"saas-server/models"
+	"time"
+)
+
+const (
+	// DashboardTopPages is the number of most viewed paths on the dashboard
+	DashboardTopPages = 10
+	// DashboardRecentSignups is the number of newest users on the dashboard
+	DashboardRecentSignups = 10
+)
+
+// GetDashboardSummary aggregates the admin dashboard KPIs as of now. Each section is
+// a single aggregate query so the cost does not grow with the number of KPIs.
+func (db *DB) GetDashboardSummary(ctx context.Context, now time.Time) (*models.DashboardSummary, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	weekAgo := now.AddDate(0, 0, -7)
+	monthAgo := now.AddDate(0, 0, -30)
+
+	summary := &models.DashboardSummary{
+		GeneratedAt:   now,
+		Revenue:       models.RevenueKPIs{MonthStart: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)},
+		TopPages:      []models.PageCount{},
+		RecentSignups: []models.RecentSignup{},
+	}
+
+	// Users
+	usersQuery := `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE email_verified),
+		       COUNT(*) FILTER (WHERE created_at >= $1),
+		       COUNT(*) FILTER (WHERE created_at >= $2),
+		       COUNT(*) FILTER (WHERE created_at >= $3)
+		FROM users`
+
+	u := &summary.Users
+	err := db.QueryRowContext(ctx, usersQuery, today, weekAgo, monthAgo).Scan(
+		&u.Total, &u.Verified, &u.NewToday, &u.New7Days, &u.New30Days)
+	if err != nil {
+		return nil, err
+	}
+	u.Unverified = u.Total - u.Verified
+
+	// Live subscriptions per plan
+	plansQuery := `
+		SELECT s.product_id, s.variant_id, COALESCE(p.name, ''), COALESCE(v.name, ''),
+		       COUNT(*) FILTER (WHERE s.status = 'active'),
+		       COUNT(*) FILTER (WHERE s.status = 'on_trial'),
+		       COUNT(*) FILTER (WHERE s.status = 'past_due')
+		FROM subscriptions s
+		LEFT JOIN products p ON p.id = s.product_id
+		LEFT JOIN variants v ON v.id = s.variant_id
+		WHERE s.status IN ('active', 'on_trial', 'past_due')
+		GROUP BY s.product_id, s.variant_id, p.name, v.name
+		ORDER BY COUNT(*) DESC, s.variant_id`
+
+	rows, err := db.QueryContext(ctx, plansQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := &summary.Subscriptions
+	subs.ByPlan = []models.PlanCount{}
+	for rows.Next() {
+		var p models.PlanCount
+		if err := rows.Scan(&p.ProductID, &p.VariantID, &p.ProductName, &p.VariantName,
+			&p.Active, &p.Trialing, &p.PastDue); err != nil {
+			return nil, err
+		}
+		subs.Active += p.Active
+		subs.Trialing += p.Trialing
+		subs.PastDue += p.PastDue
+		subs.ByPlan = append(subs.ByPlan, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	appTrialsQuery := `SELECT COUNT(*) FROM trials WHERE source = $1 AND status = $2`
+	err = db.QueryRowContext(ctx, appTrialsQuery, models.TrialSourceApp, models.TrialActive).Scan(&subs.AppTrials)
+	if err != nil {
+		return nil, err
+	}
+
+	// Revenue collected this month, counted the same way as GetPayments
+	revenueQuery := `
+		SELECT currency, SUM(amount)
+		FROM (
+			SELECT total - refunded_amount AS amount, currency
+			FROM orders
+			WHERE status IN ('paid', 'refunded', 'partial_refund')
+			  AND currency IS NOT NULL
+			  AND created_at >= $1 AND created_at < $2
+			UNION ALL
+			SELECT total - refunded_amount, currency
+			FROM subscription_invoices
+			WHERE billing_reason <> 'initial'
+			  AND status IN ('paid', 'refunded', 'partial_refund')
+			  AND created_at >= $1 AND created_at < $2
+		) collected
+		GROUP BY currency
+		ORDER BY currency`
+
+	revenueRows, err := db.QueryContext(ctx, revenueQuery, summary.Revenue.MonthStart, now)
+	if err != nil {
+		return nil, err
+	}
+	defer revenueRows.Close()
+
+	summary.Revenue.ThisMonth = []models.CurrencyAmount{}
+	for revenueRows.Next() {
+		var a models.CurrencyAmount
+		if err := revenueRows.Scan(&a.Currency, &a.Amount); err != nil {
+			return nil, err
+		}
+		summary.Revenue.ThisMonth = append(summary.Revenue.ThisMonth, a)
+	}
+	if err := revenueRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Waitlist and newsletter growth
+	waitlistQuery := `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE created_at >= $1),
+		       COUNT(*) FILTER (WHERE created_at >= $2)
+		FROM early_access`
+
+	w := &summary.Waitlist
+	if err := db.QueryRowContext(ctx, waitlistQuery, weekAgo, monthAgo).Scan(&w.Total, &w.New7Days, &w.New30Days); err != nil {
+		return nil, err
+	}
+
+	newsletterQuery := `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE created_at >= $1),
+		       COUNT(*) FILTER (WHERE created_at >= $2)
+		FROM newsletter_subscriptions
+		WHERE subscribed`
+
+	n := &summary.Newsletter
+	if err := db.QueryRowContext(ctx, newsletterQuery, weekAgo, monthAgo).Scan(&n.Total, &n.New7Days, &n.New30Days); err != nil {
+		return nil, err
+	}
+
+	// Top pages over the last 30 days
+	pagesQuery := `
+		SELECT path, COUNT(*)
+		FROM page_views
+		WHERE created_at >= $1
+		GROUP BY path
+		ORDER BY COUNT(*) DESC, path
+		LIMIT $2`
+
+	pageRows, err := db.QueryContext(ctx, pagesQuery, monthAgo, DashboardTopPages)
+	if err != nil {
+		return nil, err
+	}
+	defer pageRows.Close()
+
+	for pageRows.Next() {
+		var p models.PageCount
+		if err := pageRows.Scan(&p.Path, &p.Views); err != nil {
+			return nil, err
+		}
+		summary.TopPages = append(summary.TopPages, p)
+	}
+	if err := pageRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Recent signups
+	signupsQuery := `
+		SELECT id, email, name, COALESCE(email_verified, false), created_at
+		FROM users
+		ORDER BY created_at DESC
+		LIMIT $1`
+
+	signupRows, err := db.QueryContext(ctx, signupsQuery, DashboardRecentSignups)
+	if err != nil {
+		return nil, err
+	}
+	defer signupRows.Close()
+
+	for signupRows.Next() {
+		var s models.RecentSignup
+		if err := signupRows.Scan(&s.ID, &s.Email, &s.Name, &s.EmailVerified, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		summary.RecentSignups = append(summary.RecentSignups, s)
+	}
+	if err := signupRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
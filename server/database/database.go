@@ -2,23 +2,52 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 
+	"saas-server/models"
+	"saas-server/pkg/cache"
+
 	_ "github.com/lib/pq"
 )
 
 // ErrNotFound is returned when a requested resource is not found
 var ErrNotFound = errors.New("resource not found")
 
-// DB wraps the sql.DB connection and provides database operations
+// ErrAPIKeyLimit is returned by CreateAPIKey when the user already holds the most
+// active keys allowed
+var ErrAPIKeyLimit = errors.New("api key limit reached")
+
+// Options limits how long database work may take and configures caching
+type Options struct {
+	// QueryTimeout is the deadline for a single repository operation
+	QueryTimeout time.Duration
+	// ReportTimeout is the deadline for aggregate queries behind admin and analytics reports
+	ReportTimeout time.Duration
+	// SlowQueryThreshold is the duration above which a statement is logged as slow
+	SlowQueryThreshold time.Duration
+	// SubscriptionCacheSize bounds the subscription status cache; zero disables it
+	SubscriptionCacheSize int
+	// SubscriptionCacheTTL is how long a cached subscription status stays valid
+	SubscriptionCacheTTL time.Duration
+}
+
+// DB wraps the sql.DB connection and provides database operations.
+// It implements Store; the copy handed to WithTx callbacks runs every
+// statement inside the transaction instead of on the pool.
 type DB struct {
 	*sql.DB
+	tx          *sql.Tx
+	opts        Options
+	dsn         string
+	statusCache *cache.Cache[string, *models.UserSubscriptionStatus]
 }
 
-// New creates a new database connection and verifies it with a ping
-func New(dataSourceName string) (*DB, error) {
+// New creates a new database connection and verifies it with a ping.
+// Zero values in opts disable the corresponding limit.
+func New(dataSourceName string, opts Options) (*DB, error) {
 	db, err := sql.Open("postgres", dataSourceName)
 	if err != nil {
 		return nil, err
@@ -33,6 +62,23 @@ func New(dataSourceName string) (*DB, error) {
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+	return &DB{DB: db, opts: opts, dsn: dataSourceName, statusCache: newStatusCache(opts)}, nil
+}
+
+// withTimeout derives the context for a single repository operation.
+// The returned cancel function must be called once the operation's rows have been read.
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withDeadline(ctx, db.opts.QueryTimeout)
+}
+
+// withReportTimeout derives the context for an aggregate report query
+func (db *DB) withReportTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withDeadline(ctx, db.opts.ReportTimeout)
 }
 
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
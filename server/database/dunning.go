@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"saas-server/models"
+	"time"
+)
+
+// dunningColumns lists the columns scanned by scanDunningCase, in order
+const dunningColumns = `
+		id, subscription_id, user_id, status, failed_at, grace_ends_at,
+		reminders_sent, last_reminder_at, update_payment_url, downgraded_at,
+		resolved_at, created_at, updated_at`
+
+// OpenDunningCase starts a dunning case for a subscription. If the subscription
+// already has an unresolved case, c is filled from it and false is returned.
+func (db *DB) OpenDunningCase(ctx context.Context, c *models.DunningCase) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO dunning_cases (
+			subscription_id, user_id, status, failed_at, grace_ends_at,
+			update_payment_url, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (subscription_id) WHERE resolved_at IS NULL DO NOTHING
+		RETURNING` + dunningColumns
+
+	created, err := scanDunningCase(db.QueryRowContext(ctx, query, c.SubscriptionID, c.UserID,
+		models.DunningOpen, c.FailedAt, c.GraceEndsAt, c.UpdatePaymentURL))
+	if err == nil {
+		*c = *created
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	existing, err := db.GetUnresolvedDunningCase(ctx, c.SubscriptionID)
+	if err != nil {
+		return false, err
+	}
+	*c = *existing
+	return false, nil
+}
+
+// GetUnresolvedDunningCase returns the open or downgraded case of a subscription,
+// or sql.ErrNoRows if its payments are in order
+func (db *DB) GetUnresolvedDunningCase(ctx context.Context, subscriptionID int) (*models.DunningCase, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + dunningColumns + `
+		FROM dunning_cases
+		WHERE subscription_id = $1 AND resolved_at IS NULL`
+
+	return scanDunningCase(db.QueryRowContext(ctx, query, subscriptionID))
+}
+
+// GetUnresolvedDunningCases returns every open or downgraded case, oldest failure first
+func (db *DB) GetUnresolvedDunningCases(ctx context.Context) ([]models.DunningCase, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + dunningColumns + `
+		FROM dunning_cases
+		WHERE resolved_at IS NULL
+		ORDER BY failed_at`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cases []models.DunningCase
+	for rows.Next() {
+		c, err := scanDunningCase(rows)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, *c)
+	}
+	return cases, rows.Err()
+}
+
+// ClaimDunningReminder counts the next reminder of a case as sent and keeps the payment
+// link it contains. It returns false if another instance already claimed reminder
+// number sent+1, so that each reminder is emailed at most once.
+func (db *DB) ClaimDunningReminder(ctx context.Context, id int, sent int, sentAt time.Time, updatePaymentURL string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE dunning_cases
+		SET reminders_sent = reminders_sent + 1,
+		    last_reminder_at = $1,
+		    update_payment_url = COALESCE(NULLIF($2, ''), update_payment_url),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND reminders_sent = $4 AND status = $5`
+
+	result, err := db.ExecContext(ctx, query, sentAt, updatePaymentURL, id, sent, models.DunningOpen)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// TransitionDunningCase moves a case from one status to another at the given time.
+// Recovered and closed cases are resolved, which allows a new case to be opened later.
+// It returns false if the case was no longer in the from status.
+func (db *DB) TransitionDunningCase(ctx context.Context, id int, from, to string, at time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE dunning_cases
+		SET status = $1,
+		    downgraded_at = CASE WHEN $1 = $5 THEN $2 ELSE downgraded_at END,
+		    resolved_at = CASE WHEN $1 IN ($6, $7) THEN $2 ELSE resolved_at END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = $4`
+
+	result, err := db.ExecContext(ctx, query, to, at, id, from,
+		models.DunningDowngraded, models.DunningRecovered, models.DunningClosed)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// GetDunningStats summarizes the cases opened since the given time
+func (db *DB) GetDunningStats(ctx context.Context, since time.Time) (*models.DunningStats, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE status = $2),
+		       COUNT(*) FILTER (WHERE status = $3),
+		       COUNT(*) FILTER (WHERE status = $4),
+		       COUNT(*) FILTER (WHERE status = $5),
+		       COALESCE(SUM(reminders_sent), 0),
+		       COALESCE(AVG(EXTRACT(EPOCH FROM resolved_at - failed_at) / 3600)
+		                FILTER (WHERE status = $4), 0)
+		FROM dunning_cases
+		WHERE failed_at >= $1`
+
+	stats := models.DunningStats{Since: since}
+	err := db.QueryRowContext(ctx, query, since, models.DunningOpen, models.DunningDowngraded,
+		models.DunningRecovered, models.DunningClosed).Scan(
+		&stats.Opened,
+		&stats.Open,
+		&stats.Downgraded,
+		&stats.Recovered,
+		&stats.Closed,
+		&stats.RemindersSent,
+		&stats.AvgHoursToRecovery,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Opened > 0 {
+		stats.RecoveryRate = float64(stats.Recovered) / float64(stats.Opened)
+	}
+	return &stats, nil
+}
+
+func scanDunningCase(row rowScanner) (*models.DunningCase, error) {
+	var c models.DunningCase
+	err := row.Scan(
+		&c.ID,
+		&c.SubscriptionID,
+		&c.UserID,
+		&c.Status,
+		&c.FailedAt,
+		&c.GraceEndsAt,
+		&c.RemindersSent,
+		&c.LastReminderAt,
+		&c.UpdatePaymentURL,
+		&c.DowngradedAt,
+		&c.ResolvedAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
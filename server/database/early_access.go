@@ -1,13 +1,17 @@
 package database
 
 import (
+	"context"
 	"saas-server/models"
 	"time"
 )
 
 // CreateEarlyAccessEntry creates a new early access entry in the database
-func (db *DB) CreateEarlyAccessEntry(email, referrer string) error {
-	_, err := db.Exec(
+func (db *DB) CreateEarlyAccessEntry(ctx context.Context, email, referrer string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
 		"INSERT INTO early_access (email, referrer, created_at, updated_at) VALUES ($1, $2, $3, $3)",
 		email, referrer, time.Now(),
 	)
@@ -15,15 +19,21 @@ func (db *DB) CreateEarlyAccessEntry(email, referrer string) error {
 }
 
 // EarlyAccessEmailExists checks if an email already exists in the early access table
-func (db *DB) EarlyAccessEmailExists(email string) (bool, error) {
+func (db *DB) EarlyAccessEmailExists(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM early_access WHERE email = $1)", email).Scan(&exists)
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM early_access WHERE email = $1)", email).Scan(&exists)
 	return exists, err
 }
 
 // UpdateEarlyAccessReferrer updates the referrer for an existing early access entry
-func (db *DB) UpdateEarlyAccessReferrer(email, referrer string) error {
-	_, err := db.Exec(
+func (db *DB) UpdateEarlyAccessReferrer(ctx context.Context, email, referrer string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
 		"UPDATE early_access SET referrer = $1, updated_at = $2 WHERE email = $3",
 		referrer, time.Now(), email,
 	)
@@ -31,8 +41,11 @@ func (db *DB) UpdateEarlyAccessReferrer(email, referrer string) error {
 }
 
 // GetAllEarlyAccessEntries returns all early access entries from the database
-func (db *DB) GetAllEarlyAccessEntries() ([]models.EarlyAccess, error) {
-	rows, err := db.Query(
+func (db *DB) GetAllEarlyAccessEntries(ctx context.Context) ([]models.EarlyAccess, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
 		"SELECT id, email, referrer, created_at, updated_at FROM early_access ORDER BY created_at DESC",
 	)
 	if err != nil {
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"saas-server/pkg/analytics"
+
+	"github.com/lib/pq"
+)
+
+// TrackEvent stores an analytics event
+func (db *DB) TrackEvent(ctx context.Context, event *analytics.Event) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	properties, err := json.Marshal(event.Properties)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO events (name, properties, user_id, visitor_id, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING id
+	`
+	return db.QueryRowContext(ctx, query, event.Name, properties, event.UserID,
+		event.VisitorID, event.CreatedAt).Scan(&event.ID)
+}
+
+// TrackEvents stores a batch of analytics events, loading them with COPY
+func (db *DB) TrackEvents(ctx context.Context, events []*analytics.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, len(events))
+	for i, e := range events {
+		properties, err := json.Marshal(e.Properties)
+		if err != nil {
+			return err
+		}
+		var visitorID interface{}
+		if e.VisitorID != "" {
+			visitorID = e.VisitorID
+		}
+		rows[i] = []interface{}{e.Name, string(properties), e.UserID, visitorID, e.CreatedAt}
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.inTx(ctx, func(tx *DB) error {
+		return tx.copyIn(ctx, "events", []string{"name", "properties", "user_id", "visitor_id", "created_at"}, rows)
+	})
+}
+
+// GetEvents returns the events with any of the given names created within [from, to),
+// oldest first
+func (db *DB) GetEvents(ctx context.Context, names []string, from, to time.Time) ([]analytics.Event, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, name, properties, user_id, COALESCE(visitor_id, ''), created_at
+		FROM events
+		WHERE name = ANY($1) AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at, id
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(names), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []analytics.Event
+	for rows.Next() {
+		var e analytics.Event
+		var properties []byte
+		if err := rows.Scan(&e.ID, &e.Name, &properties, &e.UserID, &e.VisitorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(properties, &e.Properties); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
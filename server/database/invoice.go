@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"saas-server/models"
+)
+
+// invoiceColumns lists the columns scanned by scanSubscriptionInvoice, in order
+const invoiceColumns = `
+		id, invoice_id, subscription_id, user_id, customer_id, billing_reason,
+		status, currency, subtotal, discount_total, tax, total, tax_inclusive,
+		refunded, refunded_amount, refunded_at, billing_name, billing_email,
+		card_brand, card_last_four, invoice_url, created_at, updated_at`
+
+// UpsertSubscriptionInvoice records a subscription charge, or updates it when the
+// provider reports a change such as a refund. invoice.UserID must name the owner;
+// an existing invoice keeps the owner it was recorded with.
+func (db *DB) UpsertSubscriptionInvoice(ctx context.Context, invoice *models.SubscriptionInvoice) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO subscription_invoices (
+			invoice_id, subscription_id, user_id, customer_id, billing_reason, status,
+			currency, subtotal, discount_total, tax, total, tax_inclusive, refunded,
+			refunded_amount, refunded_at, billing_name, billing_email, card_brand,
+			card_last_four, invoice_url, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+		        $18, $19, $20, $21, CURRENT_TIMESTAMP)
+		ON CONFLICT (invoice_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			refunded = EXCLUDED.refunded,
+			refunded_amount = EXCLUDED.refunded_amount,
+			refunded_at = EXCLUDED.refunded_at,
+			invoice_url = EXCLUDED.invoice_url,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, user_id, created_at, updated_at`
+
+	return db.QueryRowContext(ctx, query, invoice.InvoiceID, invoice.SubscriptionID,
+		invoice.UserID, invoice.CustomerID, invoice.BillingReason, invoice.Status,
+		invoice.Currency, invoice.Subtotal, invoice.DiscountTotal, invoice.Tax, invoice.Total,
+		invoice.TaxInclusive, invoice.Refunded, invoice.RefundedAmount, invoice.RefundedAt,
+		invoice.BillingName, invoice.BillingEmail, invoice.CardBrand, invoice.CardLastFour,
+		invoice.InvoiceURL, invoice.CreatedAt,
+	).Scan(&invoice.ID, &invoice.UserID, &invoice.CreatedAt, &invoice.UpdatedAt)
+}
+
+// GetUserSubscriptionInvoices retrieves all subscription charges of a user, newest first
+func (db *DB) GetUserSubscriptionInvoices(ctx context.Context, userID string) ([]models.SubscriptionInvoice, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + invoiceColumns + `
+		FROM subscription_invoices
+		WHERE user_id = $1
+		ORDER BY created_at DESC`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []models.SubscriptionInvoice
+	for rows.Next() {
+		invoice, err := scanSubscriptionInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, *invoice)
+	}
+	return invoices, rows.Err()
+}
+
+// GetUserSubscriptionInvoice retrieves one of a user's subscription charges.
+// It returns sql.ErrNoRows if the invoice does not exist or belongs to someone else.
+func (db *DB) GetUserSubscriptionInvoice(ctx context.Context, userID string, invoiceID int) (*models.SubscriptionInvoice, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + invoiceColumns + `
+		FROM subscription_invoices
+		WHERE user_id = $1 AND invoice_id = $2`
+
+	return scanSubscriptionInvoice(db.QueryRowContext(ctx, query, userID, invoiceID))
+}
+
+func scanSubscriptionInvoice(row rowScanner) (*models.SubscriptionInvoice, error) {
+	var invoice models.SubscriptionInvoice
+	err := row.Scan(
+		&invoice.ID,
+		&invoice.InvoiceID,
+		&invoice.SubscriptionID,
+		&invoice.UserID,
+		&invoice.CustomerID,
+		&invoice.BillingReason,
+		&invoice.Status,
+		&invoice.Currency,
+		&invoice.Subtotal,
+		&invoice.DiscountTotal,
+		&invoice.Tax,
+		&invoice.Total,
+		&invoice.TaxInclusive,
+		&invoice.Refunded,
+		&invoice.RefundedAmount,
+		&invoice.RefundedAt,
+		&invoice.BillingName,
+		&invoice.BillingEmail,
+		&invoice.CardBrand,
+		&invoice.CardLastFour,
+		&invoice.InvoiceURL,
+		&invoice.CreatedAt,
+		&invoice.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
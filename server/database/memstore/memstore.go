@@ -0,0 +1,2072 @@
+// Package memstore provides an in-memory implementation of database.Store.
+// It mirrors the behaviour of the PostgreSQL repositories closely enough to
+// exercise handlers in tests without a running database.
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/analytics"
+
+	"github.com/google/uuid"
+)
+
+type blacklistEntry struct {
+	userID    string
+	expiresAt time.Time
+}
+
+type resetToken struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+type verificationToken struct {
+	userID    string
+	email     string
+	expiresAt time.Time
+	used      bool
+}
+
+// state holds every table; it is copied wholesale to snapshot a transaction
+type state struct {
+	users              map[string]models.User
+	refreshTokens      map[string]models.RefreshToken
+	blacklist          map[string]blacklistEntry
+	resetTokens        map[string]resetToken
+	verificationTokens map[string]verificationToken
+	adminStreamTokens  map[string]time.Time
+	orders             []models.Orders
+	subscriptions      []models.Subscription
+	invoices           []models.SubscriptionInvoice
+	dunningCases       []models.DunningCase
+	trials             []models.Trial
+	subscriptionEvents []models.SubscriptionEvent
+	checkouts          []models.Checkout
+	products           map[int]models.Product
+	variants           map[int]models.Variant
+	earlyAccess        []models.EarlyAccess
+	newsletter         []models.NewsletterSubscription
+	pageViews          []analytics.PageView
+	events             []analytics.Event
+	analyticsSalts     map[string][]byte
+	rollupWatermarks   map[string]time.Time
+	rolledUpPageViews  []analytics.PageView
+	archivedPageViews  []analytics.PageView
+	webhookEndpoints   []models.WebhookEndpoint
+	webhookDeliveries  []models.WebhookDelivery
+	apiKeys            []models.APIKey
+	nextID             int
+}
+
+func newState() *state {
+	return &state{
+		users:              make(map[string]models.User),
+		refreshTokens:      make(map[string]models.RefreshToken),
+		blacklist:          make(map[string]blacklistEntry),
+		resetTokens:        make(map[string]resetToken),
+		verificationTokens: make(map[string]verificationToken),
+		adminStreamTokens:  make(map[string]time.Time),
+		products:           make(map[int]models.Product),
+		variants:           make(map[int]models.Variant),
+		analyticsSalts:     make(map[string][]byte),
+		rollupWatermarks:   make(map[string]time.Time),
+	}
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		users:              make(map[string]models.User, len(s.users)),
+		refreshTokens:      make(map[string]models.RefreshToken, len(s.refreshTokens)),
+		blacklist:          make(map[string]blacklistEntry, len(s.blacklist)),
+		resetTokens:        make(map[string]resetToken, len(s.resetTokens)),
+		verificationTokens: make(map[string]verificationToken, len(s.verificationTokens)),
+		adminStreamTokens:  make(map[string]time.Time, len(s.adminStreamTokens)),
+		orders:             append([]models.Orders(nil), s.orders...),
+		subscriptions:      append([]models.Subscription(nil), s.subscriptions...),
+		invoices:           append([]models.SubscriptionInvoice(nil), s.invoices...),
+		dunningCases:       append([]models.DunningCase(nil), s.dunningCases...),
+		trials:             append([]models.Trial(nil), s.trials...),
+		subscriptionEvents: append([]models.SubscriptionEvent(nil), s.subscriptionEvents...),
+		checkouts:          append([]models.Checkout(nil), s.checkouts...),
+		products:           make(map[int]models.Product, len(s.products)),
+		variants:           make(map[int]models.Variant, len(s.variants)),
+		earlyAccess:        append([]models.EarlyAccess(nil), s.earlyAccess...),
+		newsletter:         append([]models.NewsletterSubscription(nil), s.newsletter...),
+		pageViews:          append([]analytics.PageView(nil), s.pageViews...),
+		events:             append([]analytics.Event(nil), s.events...),
+		analyticsSalts:     make(map[string][]byte, len(s.analyticsSalts)),
+		rollupWatermarks:   make(map[string]time.Time, len(s.rollupWatermarks)),
+		rolledUpPageViews:  append([]analytics.PageView(nil), s.rolledUpPageViews...),
+		archivedPageViews:  append([]analytics.PageView(nil), s.archivedPageViews...),
+		webhookEndpoints:   append([]models.WebhookEndpoint(nil), s.webhookEndpoints...),
+		webhookDeliveries:  append([]models.WebhookDelivery(nil), s.webhookDeliveries...),
+		apiKeys:            append([]models.APIKey(nil), s.apiKeys...),
+		nextID:             s.nextID,
+	}
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.refreshTokens {
+		c.refreshTokens[k] = v
+	}
+	for k, v := range s.blacklist {
+		c.blacklist[k] = v
+	}
+	for k, v := range s.resetTokens {
+		c.resetTokens[k] = v
+	}
+	for k, v := range s.verificationTokens {
+		c.verificationTokens[k] = v
+	}
+	for k, v := range s.adminStreamTokens {
+		c.adminStreamTokens[k] = v
+	}
+	for k, v := range s.products {
+		c.products[k] = v
+	}
+	for k, v := range s.variants {
+		c.variants[k] = v
+	}
+	for k, v := range s.analyticsSalts {
+		c.analyticsSalts[k] = v
+	}
+	for k, v := range s.rollupWatermarks {
+		c.rollupWatermarks[k] = v
+	}
+	return c
+}
+
+func (s *state) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+// Store is an in-memory database.Store. The zero value is not usable; call New.
+type Store struct {
+	mu   *sync.Mutex // guards data; shared with transaction views
+	txMu *sync.Mutex // serializes transactions
+	data *state
+	inTx bool
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New returns an empty in-memory store
+func New() *Store {
+	return &Store{mu: new(sync.Mutex), txMu: new(sync.Mutex), data: newState()}
+}
+
+// WithTx runs fn with a transactional view of the store. Transactions are serialized
+// and, if fn returns an error, every change made since the transaction began is
+// discarded. Writes made outside the transaction meanwhile are not isolated from it.
+func (s *Store) WithTx(ctx context.Context, fn func(tx database.Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.data.clone()
+	s.mu.Unlock()
+
+	err := fn(&Store{mu: s.mu, txMu: s.txMu, data: s.data, inTx: true})
+	if err != nil {
+		s.mu.Lock()
+		*s.data = *snapshot
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// lock acquires the data mutex and returns its unlock function
+func (s *Store) lock() func() {
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// User operations
+
+func (s *Store) CreateUser(ctx context.Context, email, password, name string, emailVerified bool) (*models.User, error) {
+	defer s.lock()()
+	for _, u := range s.data.users {
+		if u.Email == email {
+			return nil, fmt.Errorf("user with email %s already exists", email)
+		}
+	}
+	now := time.Now()
+	user := models.User{
+		ID:            uuid.New().String(),
+		Email:         email,
+		Password:      password,
+		Name:          name,
+		EmailVerified: emailVerified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	s.data.users[user.ID] = user
+	return &user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer s.lock()()
+	for _, u := range s.data.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	defer s.lock()()
+	u, ok := s.data.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u, nil
+}
+
+func (s *Store) UserExists(ctx context.Context, email string) (bool, error) {
+	_, err := s.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id, name, email string) error {
+	return s.updateUser(id, func(u *models.User) {
+		u.Name = name
+		u.Email = email
+	})
+}
+
+func (s *Store) UpdatePassword(ctx context.Context, id, hashedPassword string) error {
+	return s.updateUser(id, func(u *models.User) {
+		u.Password = hashedPassword
+	})
+}
+
+func (s *Store) updateUser(id string, update func(u *models.User)) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return err
+	}
+	defer s.lock()()
+	u, ok := s.data.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	update(&u)
+	u.UpdatedAt = time.Now()
+	s.data.users[id] = u
+	return nil
+}
+
+func (s *Store) GetUsers(ctx context.Context, page int, limit int, search string) ([]models.User, int, error) {
+	defer s.lock()()
+	search = strings.ToLower(search)
+	var matched []models.User
+	for _, u := range s.data.users {
+		if search == "" || strings.Contains(strings.ToLower(u.Name), search) || strings.Contains(strings.ToLower(u.Email), search) {
+			u.Password = ""
+			matched = append(matched, u)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+
+	total := len(matched)
+	offset := (page - 1) * limit
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		return nil, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return matched[offset:end], total, nil
+}
+
+// Token operations
+
+func (s *Store) CreateRefreshToken(ctx context.Context, userID string, tokenHash string, deviceInfo string, ipAddress string, expiresAt time.Time) error {
+	if deviceInfo == "" {
+		deviceInfo = "Unknown Device"
+	}
+	if ipAddress == "" {
+		ipAddress = "0.0.0.0"
+	}
+	defer s.lock()()
+	now := time.Now()
+	s.data.refreshTokens[tokenHash] = models.RefreshToken{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		TokenHash:  tokenHash,
+		DeviceInfo: deviceInfo,
+		IPAddress:  ipAddress,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+	return nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	defer s.lock()()
+	token, ok := s.data.refreshTokens[tokenHash]
+	if !ok || token.IsBlocked || !token.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (s *Store) DeleteAllUserRefreshTokens(ctx context.Context, userID string) error {
+	defer s.lock()()
+	for hash, token := range s.data.refreshTokens {
+		if token.UserID == userID {
+			token.IsBlocked = true
+			s.data.refreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddToBlacklist(ctx context.Context, jti string, userID string, expiresAt time.Time) error {
+	defer s.lock()()
+	if _, ok := s.data.blacklist[jti]; ok {
+		return fmt.Errorf("token %s is already blacklisted", jti)
+	}
+	s.data.blacklist[jti] = blacklistEntry{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) IsTokenBlacklisted(ctx context.Context, jti string) (bool, error) {
+	defer s.lock()()
+	entry, ok := s.data.blacklist[jti]
+	return ok && entry.expiresAt.After(time.Now()), nil
+}
+
+func (s *Store) CreatePasswordResetToken(ctx context.Context, userID string, token string, expiresAt time.Time) error {
+	defer s.lock()()
+	s.data.resetTokens[token] = resetToken{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) GetPasswordResetToken(ctx context.Context, token string) (string, error) {
+	defer s.lock()()
+	t, ok := s.data.resetTokens[token]
+	if !ok || t.used || !t.expiresAt.After(time.Now()) {
+		return "", errors.New("token not found")
+	}
+	return t.userID, nil
+}
+
+func (s *Store) MarkPasswordResetTokenUsed(ctx context.Context, token string) error {
+	defer s.lock()()
+	t, ok := s.data.resetTokens[token]
+	if !ok || t.used || !t.expiresAt.After(time.Now()) {
+		return errors.New("token not found")
+	}
+	t.used = true
+	s.data.resetTokens[token] = t
+	return nil
+}
+
+func (s *Store) StoreEmailVerificationToken(ctx context.Context, token, userID, email string, expiresAt time.Time) error {
+	defer s.lock()()
+	s.data.verificationTokens[token] = verificationToken{userID: userID, email: email, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) VerifyEmail(ctx context.Context, token string) (string, error) {
+	defer s.lock()()
+	t, ok := s.data.verificationTokens[token]
+	if !ok {
+		return "", errors.New("invalid or expired token")
+	}
+	user, ok := s.data.users[t.userID]
+	if !ok {
+		return "", errors.New("invalid or expired token")
+	}
+	if user.EmailVerified {
+		return "", nil
+	}
+	if t.used {
+		return "", errors.New("token already used")
+	}
+	if time.Now().After(t.expiresAt) {
+		return "", errors.New("token has expired")
+	}
+
+	t.used = true
+	s.data.verificationTokens[token] = t
+	user.EmailVerified = true
+	s.data.users[user.ID] = user
+	return user.ID, nil
+}
+
+func (s *Store) UseAdminStreamToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	defer s.lock()()
+	if _, ok := s.data.adminStreamTokens[jti]; ok {
+		return false, nil
+	}
+	s.data.adminStreamTokens[jti] = expiresAt
+	return true, nil
+}
+
+func (s *Store) DeleteExpiredTokens(ctx context.Context, before time.Time) (map[string]int64, error) {
+	defer s.lock()()
+	deleted := make(map[string]int64, 5)
+	for k, v := range s.data.refreshTokens {
+		if v.ExpiresAt.Before(before) {
+			delete(s.data.refreshTokens, k)
+			deleted["refresh tokens"]++
+		}
+	}
+	for k, v := range s.data.blacklist {
+		if v.expiresAt.Before(before) {
+			delete(s.data.blacklist, k)
+			deleted["blacklist entries"]++
+		}
+	}
+	for k, v := range s.data.resetTokens {
+		if v.expiresAt.Before(before) {
+			delete(s.data.resetTokens, k)
+			deleted["password reset tokens"]++
+		}
+	}
+	for k, v := range s.data.verificationTokens {
+		if v.expiresAt.Before(before) {
+			delete(s.data.verificationTokens, k)
+			deleted["email verification tokens"]++
+		}
+	}
+	for k, v := range s.data.adminStreamTokens {
+		if v.Before(before) {
+			delete(s.data.adminStreamTokens, k)
+			deleted["admin stream tokens"]++
+		}
+	}
+	return deleted, nil
+}
+
+// Billing operations
+
+func (s *Store) CreateOrder(ctx context.Context, order *models.Orders) error {
+	defer s.lock()()
+	now := time.Now()
+	order.ID = s.data.id()
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	s.data.orders = append(s.data.orders, *order)
+	return nil
+}
+
+func (s *Store) UpdateOrderStatus(ctx context.Context, orderID int, status string, refunded bool, refundedAt *time.Time) error {
+	return s.updateOrder(orderID, func(o *models.Orders) {
+		o.Status = status
+		o.RefundedAt = refundedAt
+	})
+}
+
+func (s *Store) UpdateOrderRefund(ctx context.Context, orderID int, refundedAt *time.Time, refundedAmount int, refundedAmountFormatted string) error {
+	return s.updateOrder(orderID, func(o *models.Orders) {
+		o.Status = "refunded"
+		o.RefundedAt = refundedAt
+		o.RefundedAmount = refundedAmount
+		o.RefundedAmountFormatted = refundedAmountFormatted
+	})
+}
+
+func (s *Store) updateOrder(orderID int, update func(o *models.Orders)) error {
+	defer s.lock()()
+	for i := range s.data.orders {
+		if s.data.orders[i].OrderID == orderID {
+			update(&s.data.orders[i])
+			s.data.orders[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetUserOrders(ctx context.Context, userID string) ([]models.Orders, error) {
+	defer s.lock()()
+	var orders []models.Orders
+	for _, o := range s.data.orders {
+		if o.UserID == userID {
+			orders = append(orders, o)
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return orders, nil
+}
+
+func (s *Store) GetUserOrder(ctx context.Context, userID string, orderID int) (*models.Orders, error) {
+	defer s.lock()()
+	for _, o := range s.data.orders {
+		if o.UserID == userID && o.OrderID == orderID {
+			return &o, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetOrder(ctx context.Context, orderID int) (*models.Orders, error) {
+	defer s.lock()()
+	for _, o := range s.data.orders {
+		if o.OrderID == orderID {
+			return &o, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) UpsertSubscriptionInvoice(ctx context.Context, invoice *models.SubscriptionInvoice) error {
+	defer s.lock()()
+	now := time.Now()
+	for i := range s.data.invoices {
+		existing := &s.data.invoices[i]
+		if existing.InvoiceID != invoice.InvoiceID {
+			continue
+		}
+		existing.Status = invoice.Status
+		existing.Refunded = invoice.Refunded
+		existing.RefundedAmount = invoice.RefundedAmount
+		existing.RefundedAt = invoice.RefundedAt
+		existing.InvoiceURL = invoice.InvoiceURL
+		existing.UpdatedAt = now
+		*invoice = *existing
+		return nil
+	}
+
+	if invoice.UserID == "" {
+		return fmt.Errorf("invoice %d has no owner", invoice.InvoiceID)
+	}
+	invoice.ID = s.data.id()
+	invoice.UpdatedAt = now
+	s.data.invoices = append(s.data.invoices, *invoice)
+	return nil
+}
+
+func (s *Store) GetUserSubscriptionInvoices(ctx context.Context, userID string) ([]models.SubscriptionInvoice, error) {
+	defer s.lock()()
+	var invoices []models.SubscriptionInvoice
+	for _, inv := range s.data.invoices {
+		if inv.UserID == userID {
+			invoices = append(invoices, inv)
+		}
+	}
+	sort.SliceStable(invoices, func(i, j int) bool { return invoices[i].CreatedAt.After(invoices[j].CreatedAt) })
+	return invoices, nil
+}
+
+func (s *Store) GetUserSubscriptionInvoice(ctx context.Context, userID string, invoiceID int) (*models.SubscriptionInvoice, error) {
+	defer s.lock()()
+	for _, inv := range s.data.invoices {
+		if inv.UserID == userID && inv.InvoiceID == invoiceID {
+			return &inv, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) CreateSubscription(ctx context.Context, userID string, subscriptionID int, orderID int, customerID int, productID int, variantID int, status string, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error {
+	defer s.lock()()
+	id := strconv.Itoa(subscriptionID)
+	for _, sub := range s.data.subscriptions {
+		if sub.SubscriptionID == id {
+			return fmt.Errorf("subscription %d already exists", subscriptionID)
+		}
+	}
+	now := time.Now()
+	s.data.subscriptions = append(s.data.subscriptions, models.Subscription{
+		ID:             s.data.id(),
+		SubscriptionID: id,
+		UserID:         userID,
+		OrderID:        orderID,
+		CustomerID:     customerID,
+		ProductID:      productID,
+		VariantID:      variantID,
+		Status:         status,
+		RenewsAt:       renewsAt,
+		EndsAt:         endsAt,
+		TrialEndsAt:    trialEndsAt,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	return nil
+}
+
+func (s *Store) UpdateSubscription(ctx context.Context, subscriptionID int, status string, cancelled bool, productID int, variantID int, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error {
+	defer s.lock()()
+	id := strconv.Itoa(subscriptionID)
+	for i := range s.data.subscriptions {
+		sub := &s.data.subscriptions[i]
+		if sub.SubscriptionID != id {
+			continue
+		}
+		sub.Status = status
+		sub.Cancelled = cancelled
+		sub.ProductID = productID
+		sub.VariantID = variantID
+		sub.RenewsAt = renewsAt
+		sub.EndsAt = endsAt
+		sub.TrialEndsAt = trialEndsAt
+		sub.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) GetSubscriptionByUserID(ctx context.Context, userID string) (*models.Subscription, error) {
+	defer s.lock()()
+	var latest *models.Subscription
+	for i := range s.data.subscriptions {
+		sub := s.data.subscriptions[i]
+		if sub.UserID == userID && (latest == nil || !sub.CreatedAt.Before(latest.CreatedAt)) {
+			latest = &sub
+		}
+	}
+	if latest == nil {
+		return nil, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+func (s *Store) GetSubscriptionByID(ctx context.Context, subscriptionID int) (*models.Subscription, error) {
+	defer s.lock()()
+	id := strconv.Itoa(subscriptionID)
+	for _, sub := range s.data.subscriptions {
+		if sub.SubscriptionID == id {
+			return &sub, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) UpdateUserSubscription(ctx context.Context, userID string, subscriptionID int, status string, productID int, variantID int, renewalDate *time.Time, endDate *time.Time) error {
+	return s.updateUser(userID, func(u *models.User) {
+		u.LatestSubscriptionID = subscriptionID
+		u.LatestStatus = status
+		u.LatestProductID = productID
+		u.LatestVariantID = variantID
+		u.LatestRenewalDate = renewalDate
+		u.LatestEndDate = endDate
+	})
+}
+
+func (s *Store) GetUserSubscriptionStatus(ctx context.Context, id string) (*models.UserSubscriptionStatus, error) {
+	defer s.lock()()
+	u, ok := s.data.users[id]
+	if !ok || (u.LatestStatus == "" && u.LatestProductID == 0 && u.LatestVariantID == 0) {
+		return nil, nil
+	}
+	status := u.LatestStatus
+	productID := u.LatestProductID
+	variantID := u.LatestVariantID
+	return &models.UserSubscriptionStatus{Status: &status, ProductID: &productID, VariantID: &variantID}, nil
+}
+
+// InvalidateUserCache is a no-op; the in-memory store has no cache
+func (s *Store) InvalidateUserCache(ctx context.Context, userID string) error { return nil }
+
+func (s *Store) CreatePendingCheckout(ctx context.Context, checkout *models.Checkout) error {
+	defer s.lock()()
+	checkout.Status = models.CheckoutPending
+	checkout.CreatedAt = time.Now()
+	s.data.checkouts = append(s.data.checkouts, *checkout)
+	return nil
+}
+
+func (s *Store) SetCheckoutURL(ctx context.Context, id, providerCheckoutID, checkoutURL string) error {
+	return s.updateCheckout(id, func(c *models.Checkout) {
+		c.ProviderCheckoutID = providerCheckoutID
+		c.CheckoutURL = checkoutURL
+	})
+}
+
+func (s *Store) DeleteCheckout(ctx context.Context, id string) error {
+	defer s.lock()()
+	for i, c := range s.data.checkouts {
+		if c.ID == id {
+			s.data.checkouts = append(s.data.checkouts[:i:i], s.data.checkouts[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Store) CompleteCheckout(ctx context.Context, id string, orderID int) error {
+	return s.updateCheckout(id, func(c *models.Checkout) {
+		if c.Status != models.CheckoutPending {
+			return
+		}
+		now := time.Now()
+		c.Status = models.CheckoutCompleted
+		c.OrderID = &orderID
+		c.CompletedAt = &now
+	})
+}
+
+func (s *Store) updateCheckout(id string, update func(c *models.Checkout)) error {
+	defer s.lock()()
+	for i := range s.data.checkouts {
+		if s.data.checkouts[i].ID == id {
+			update(&s.data.checkouts[i])
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAbandonedCheckouts(ctx context.Context, before time.Time) ([]models.Checkout, error) {
+	defer s.lock()()
+	checkouts := []models.Checkout{}
+	for _, c := range s.data.checkouts {
+		if c.Status == models.CheckoutPending && c.CreatedAt.Before(before) {
+			c.UserEmail = s.data.users[c.UserID].Email
+			checkouts = append(checkouts, c)
+		}
+	}
+	sort.SliceStable(checkouts, func(i, j int) bool { return checkouts[i].CreatedAt.After(checkouts[j].CreatedAt) })
+	return checkouts, nil
+}
+
+// Dunning operations
+
+func (s *Store) OpenDunningCase(ctx context.Context, c *models.DunningCase) (bool, error) {
+	defer s.lock()()
+	for _, existing := range s.data.dunningCases {
+		if existing.SubscriptionID == c.SubscriptionID && existing.ResolvedAt == nil {
+			*c = existing
+			return false, nil
+		}
+	}
+	now := time.Now()
+	c.ID = s.data.id()
+	c.Status = models.DunningOpen
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	s.data.dunningCases = append(s.data.dunningCases, *c)
+	return true, nil
+}
+
+func (s *Store) GetUnresolvedDunningCase(ctx context.Context, subscriptionID int) (*models.DunningCase, error) {
+	defer s.lock()()
+	for _, c := range s.data.dunningCases {
+		if c.SubscriptionID == subscriptionID && c.ResolvedAt == nil {
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetUnresolvedDunningCases(ctx context.Context) ([]models.DunningCase, error) {
+	defer s.lock()()
+	var cases []models.DunningCase
+	for _, c := range s.data.dunningCases {
+		if c.ResolvedAt == nil {
+			cases = append(cases, c)
+		}
+	}
+	sort.SliceStable(cases, func(i, j int) bool { return cases[i].FailedAt.Before(cases[j].FailedAt) })
+	return cases, nil
+}
+
+func (s *Store) ClaimDunningReminder(ctx context.Context, id int, sent int, sentAt time.Time, updatePaymentURL string) (bool, error) {
+	return s.updateDunningCase(id, func(c *models.DunningCase) bool {
+		if c.RemindersSent != sent || c.Status != models.DunningOpen {
+			return false
+		}
+		c.RemindersSent++
+		c.LastReminderAt = &sentAt
+		if updatePaymentURL != "" {
+			c.UpdatePaymentURL = updatePaymentURL
+		}
+		return true
+	})
+}
+
+func (s *Store) TransitionDunningCase(ctx context.Context, id int, from, to string, at time.Time) (bool, error) {
+	return s.updateDunningCase(id, func(c *models.DunningCase) bool {
+		if c.Status != from {
+			return false
+		}
+		c.Status = to
+		switch to {
+		case models.DunningDowngraded:
+			c.DowngradedAt = &at
+		case models.DunningRecovered, models.DunningClosed:
+			c.ResolvedAt = &at
+		}
+		return true
+	})
+}
+
+// updateDunningCase applies update to a case and reports whether it changed it
+func (s *Store) updateDunningCase(id int, update func(c *models.DunningCase) bool) (bool, error) {
+	defer s.lock()()
+	for i := range s.data.dunningCases {
+		if s.data.dunningCases[i].ID == id && update(&s.data.dunningCases[i]) {
+			s.data.dunningCases[i].UpdatedAt = time.Now()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) GetDunningStats(ctx context.Context, since time.Time) (*models.DunningStats, error) {
+	defer s.lock()()
+	stats := models.DunningStats{Since: since}
+	var recoveryHours float64
+	for _, c := range s.data.dunningCases {
+		if c.FailedAt.Before(since) {
+			continue
+		}
+		stats.Opened++
+		stats.RemindersSent += c.RemindersSent
+		switch c.Status {
+		case models.DunningOpen:
+			stats.Open++
+		case models.DunningDowngraded:
+			stats.Downgraded++
+		case models.DunningRecovered:
+			stats.Recovered++
+			recoveryHours += c.ResolvedAt.Sub(c.FailedAt).Hours()
+		case models.DunningClosed:
+			stats.Closed++
+		}
+	}
+	if stats.Recovered > 0 {
+		stats.AvgHoursToRecovery = recoveryHours / float64(stats.Recovered)
+	}
+	if stats.Opened > 0 {
+		stats.RecoveryRate = float64(stats.Recovered) / float64(stats.Opened)
+	}
+	return &stats, nil
+}
+
+// Trial operations
+
+func (s *Store) CreateTrial(ctx context.Context, t *models.Trial) (bool, error) {
+	defer s.lock()()
+	for _, existing := range s.data.trials {
+		if t.Source == models.TrialSourceApp && existing.Source == models.TrialSourceApp && existing.UserID == t.UserID {
+			return false, nil
+		}
+		if t.SubscriptionID != nil && existing.SubscriptionID != nil && *existing.SubscriptionID == *t.SubscriptionID {
+			return false, nil
+		}
+	}
+	now := time.Now()
+	t.ID = s.data.id()
+	t.Status = models.TrialActive
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	s.data.trials = append(s.data.trials, *t)
+	return true, nil
+}
+
+func (s *Store) GetUserTrial(ctx context.Context, userID string) (*models.Trial, error) {
+	defer s.lock()()
+	var found *models.Trial
+	for _, t := range s.data.trials {
+		if t.UserID == userID && t.Status == models.TrialActive && (found == nil || t.EndsAt.After(found.EndsAt)) {
+			found = &t
+		}
+	}
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	return found, nil
+}
+
+func (s *Store) GetSubscriptionTrial(ctx context.Context, subscriptionID int) (*models.Trial, error) {
+	defer s.lock()()
+	for _, t := range s.data.trials {
+		if t.SubscriptionID != nil && *t.SubscriptionID == subscriptionID {
+			return &t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetTrialsEndingBefore(ctx context.Context, before time.Time) ([]models.Trial, error) {
+	defer s.lock()()
+	var trials []models.Trial
+	for _, t := range s.data.trials {
+		if t.Status == models.TrialActive && t.EndsAt.Before(before) {
+			trials = append(trials, t)
+		}
+	}
+	sort.SliceStable(trials, func(i, j int) bool { return trials[i].EndsAt.Before(trials[j].EndsAt) })
+	return trials, nil
+}
+
+func (s *Store) SetTrialEnd(ctx context.Context, id int, endsAt time.Time) error {
+	_, err := s.updateTrials(func(t *models.Trial) bool {
+		if t.ID != id || t.Status != models.TrialActive {
+			return false
+		}
+		if !t.EndsAt.Equal(endsAt) {
+			t.ReminderSentAt = nil
+		}
+		t.EndsAt = endsAt
+		return true
+	})
+	return err
+}
+
+func (s *Store) ClaimTrialReminder(ctx context.Context, id int, at time.Time) (bool, error) {
+	n, err := s.updateTrials(func(t *models.Trial) bool {
+		if t.ID != id || t.Status != models.TrialActive || t.ReminderSentAt != nil {
+			return false
+		}
+		t.ReminderSentAt = &at
+		return true
+	})
+	return n > 0, err
+}
+
+func (s *Store) EndTrial(ctx context.Context, id int, status string, at time.Time) (bool, error) {
+	n, err := s.updateTrials(func(t *models.Trial) bool {
+		if t.ID != id || t.Status != models.TrialActive {
+			return false
+		}
+		t.Status = status
+		t.EndedAt = &at
+		return true
+	})
+	return n > 0, err
+}
+
+func (s *Store) ConvertUserTrials(ctx context.Context, userID string, at time.Time) (int64, error) {
+	return s.updateTrials(func(t *models.Trial) bool {
+		if t.UserID != userID || t.Status != models.TrialActive {
+			return false
+		}
+		t.Status = models.TrialConverted
+		t.EndedAt = &at
+		return true
+	})
+}
+
+// updateTrials applies update to every trial and counts those it changed
+func (s *Store) updateTrials(update func(t *models.Trial) bool) (int64, error) {
+	defer s.lock()()
+	var n int64
+	for i := range s.data.trials {
+		if update(&s.data.trials[i]) {
+			s.data.trials[i].UpdatedAt = time.Now()
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) GetTrialConversionReport(ctx context.Context, since time.Time) (*models.TrialReport, error) {
+	defer s.lock()()
+	report := &models.TrialReport{Since: since, BySource: []models.TrialConversion{}}
+	bySource := make(map[string]*models.TrialConversion)
+	days := make(map[string]float64)
+	var totalDays float64
+	for _, t := range s.data.trials {
+		if t.StartedAt.Before(since) {
+			continue
+		}
+		c, ok := bySource[t.Source]
+		if !ok {
+			c = &models.TrialConversion{Source: t.Source}
+			bySource[t.Source] = c
+		}
+		for _, counts := range []*models.TrialConversion{c, &report.Total} {
+			counts.Started++
+			switch t.Status {
+			case models.TrialActive:
+				counts.Active++
+			case models.TrialConverted:
+				counts.Converted++
+			case models.TrialExpired:
+				counts.Expired++
+			}
+		}
+		if t.Status == models.TrialConverted {
+			d := t.EndedAt.Sub(t.StartedAt).Hours() / 24
+			days[t.Source] += d
+			totalDays += d
+		}
+	}
+	for source, c := range bySource {
+		c.SetRates(days[source])
+		report.BySource = append(report.BySource, *c)
+	}
+	sort.Slice(report.BySource, func(i, j int) bool { return report.BySource[i].Source < report.BySource[j].Source })
+	report.Total.SetRates(totalDays)
+	return report, nil
+}
+
+// Revenue operations
+
+func (s *Store) RecordSubscriptionEvent(ctx context.Context, e *models.SubscriptionEvent) (bool, error) {
+	defer s.lock()()
+	var latest *models.SubscriptionEvent
+	for i := range s.data.subscriptionEvents {
+		existing := &s.data.subscriptionEvents[i]
+		if existing.SubscriptionID == e.SubscriptionID && (latest == nil || !existing.OccurredAt.Before(latest.OccurredAt)) {
+			latest = existing
+		}
+	}
+	if latest != nil && latest.Status == e.Status && latest.VariantID == e.VariantID && latest.MRR == e.MRR {
+		return false, nil
+	}
+	e.ID = s.data.id()
+	s.data.subscriptionEvents = append(s.data.subscriptionEvents, *e)
+	return true, nil
+}
+
+func (s *Store) GetSubscriptionEvents(ctx context.Context, before time.Time) ([]models.SubscriptionEvent, error) {
+	defer s.lock()()
+	var events []models.SubscriptionEvent
+	for _, e := range s.data.subscriptionEvents {
+		if e.OccurredAt.Before(before) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].OccurredAt.Before(events[j].OccurredAt) })
+	return events, nil
+}
+
+func (s *Store) GetPayments(ctx context.Context, from, to time.Time) ([]models.Payment, error) {
+	defer s.lock()()
+	collected := func(status string, at time.Time) bool {
+		return (status == "paid" || status == "refunded" || status == "partial_refund") && !at.Before(from) && at.Before(to)
+	}
+	var payments []models.Payment
+	for _, o := range s.data.orders {
+		if collected(o.Status, o.CreatedAt) {
+			payments = append(payments, models.Payment{
+				UserID:    o.UserID,
+				ProductID: o.ProductID,
+				VariantID: o.VariantID,
+				Amount:    o.Total - o.RefundedAmount,
+				Currency:  o.Currency,
+				PaidAt:    o.CreatedAt,
+			})
+		}
+	}
+	for _, inv := range s.data.invoices {
+		if inv.BillingReason == "initial" || !collected(inv.Status, inv.CreatedAt) {
+			continue
+		}
+		for _, sub := range s.data.subscriptions {
+			if sub.SubscriptionID == strconv.Itoa(inv.SubscriptionID) {
+				payments = append(payments, models.Payment{
+					UserID:    inv.UserID,
+					ProductID: sub.ProductID,
+					VariantID: sub.VariantID,
+					Amount:    inv.Total - inv.RefundedAmount,
+					Currency:  inv.Currency,
+					PaidAt:    inv.CreatedAt,
+				})
+				break
+			}
+		}
+	}
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].PaidAt.Before(payments[j].PaidAt) })
+	return payments, nil
+}
+
+// Dashboard operations
+
+func (s *Store) GetDashboardSummary(ctx context.Context, now time.Time) (*models.DashboardSummary, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	weekAgo := now.AddDate(0, 0, -7)
+	monthAgo := now.AddDate(0, 0, -30)
+
+	summary := &models.DashboardSummary{
+		GeneratedAt:   now,
+		Revenue:       models.RevenueKPIs{MonthStart: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)},
+		Subscriptions: models.SubscriptionKPIs{ByPlan: []models.PlanCount{}},
+		TopPages:      []models.PageCount{},
+		RecentSignups: []models.RecentSignup{},
+	}
+
+	payments, err := s.GetPayments(ctx, summary.Revenue.MonthStart, now)
+	if err != nil {
+		return nil, err
+	}
+	byCurrency := make(map[string]int)
+	for _, p := range payments {
+		byCurrency[p.Currency] += p.Amount
+	}
+	summary.Revenue.ThisMonth = []models.CurrencyAmount{}
+	for currency, amount := range byCurrency {
+		summary.Revenue.ThisMonth = append(summary.Revenue.ThisMonth, models.CurrencyAmount{Currency: currency, Amount: amount})
+	}
+	sort.Slice(summary.Revenue.ThisMonth, func(i, j int) bool {
+		return summary.Revenue.ThisMonth[i].Currency < summary.Revenue.ThisMonth[j].Currency
+	})
+
+	defer s.lock()()
+
+	u := &summary.Users
+	for _, user := range s.data.users {
+		u.Total++
+		if user.EmailVerified {
+			u.Verified++
+		}
+		if !user.CreatedAt.Before(today) {
+			u.NewToday++
+		}
+		if !user.CreatedAt.Before(weekAgo) {
+			u.New7Days++
+		}
+		if !user.CreatedAt.Before(monthAgo) {
+			u.New30Days++
+		}
+		summary.RecentSignups = append(summary.RecentSignups, models.RecentSignup{
+			ID:            user.ID,
+			Email:         user.Email,
+			Name:          user.Name,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
+		})
+	}
+	u.Unverified = u.Total - u.Verified
+	sort.Slice(summary.RecentSignups, func(i, j int) bool {
+		return summary.RecentSignups[i].CreatedAt.After(summary.RecentSignups[j].CreatedAt)
+	})
+	if len(summary.RecentSignups) > database.DashboardRecentSignups {
+		summary.RecentSignups = summary.RecentSignups[:database.DashboardRecentSignups]
+	}
+
+	subs := &summary.Subscriptions
+	plans := make(map[int]*models.PlanCount)
+	for _, sub := range s.data.subscriptions {
+		if sub.Status != "active" && sub.Status != "on_trial" && sub.Status != "past_due" {
+			continue
+		}
+		p, ok := plans[sub.VariantID]
+		if !ok {
+			p = &models.PlanCount{
+				ProductID:   sub.ProductID,
+				VariantID:   sub.VariantID,
+				ProductName: s.data.products[sub.ProductID].Name,
+				VariantName: s.data.variants[sub.VariantID].Name,
+			}
+			plans[sub.VariantID] = p
+		}
+		switch sub.Status {
+		case "active":
+			p.Active++
+			subs.Active++
+		case "on_trial":
+			p.Trialing++
+			subs.Trialing++
+		case "past_due":
+			p.PastDue++
+			subs.PastDue++
+		}
+	}
+	for _, p := range plans {
+		subs.ByPlan = append(subs.ByPlan, *p)
+	}
+	sort.Slice(subs.ByPlan, func(i, j int) bool {
+		a, b := subs.ByPlan[i], subs.ByPlan[j]
+		if total := a.Active + a.Trialing + a.PastDue; total != b.Active+b.Trialing+b.PastDue {
+			return total > b.Active+b.Trialing+b.PastDue
+		}
+		return a.VariantID < b.VariantID
+	})
+	for _, t := range s.data.trials {
+		if t.Source == models.TrialSourceApp && t.Status == models.TrialActive {
+			subs.AppTrials++
+		}
+	}
+
+	for _, e := range s.data.earlyAccess {
+		countGrowth(&summary.Waitlist, e.CreatedAt, weekAgo, monthAgo)
+	}
+	for _, n := range s.data.newsletter {
+		if n.Subscribed {
+			countGrowth(&summary.Newsletter, n.CreatedAt, weekAgo, monthAgo)
+		}
+	}
+
+	byPath := make(map[string]int)
+	for _, v := range s.pageViewsBetween(monthAgo, now, nil) {
+		byPath[v.Path]++
+	}
+	for path, views := range byPath {
+		summary.TopPages = append(summary.TopPages, models.PageCount{Path: path, Views: views})
+	}
+	sort.Slice(summary.TopPages, func(i, j int) bool {
+		if summary.TopPages[i].Views != summary.TopPages[j].Views {
+			return summary.TopPages[i].Views > summary.TopPages[j].Views
+		}
+		return summary.TopPages[i].Path < summary.TopPages[j].Path
+	})
+	if len(summary.TopPages) > database.DashboardTopPages {
+		summary.TopPages = summary.TopPages[:database.DashboardTopPages]
+	}
+
+	return summary, nil
+}
+
+func countGrowth(g *models.GrowthKPIs, createdAt, weekAgo, monthAgo time.Time) {
+	g.Total++
+	if !createdAt.Before(weekAgo) {
+		g.New7Days++
+	}
+	if !createdAt.Before(monthAgo) {
+		g.New30Days++
+	}
+}
+
+// Catalog operations
+
+func (s *Store) UpsertProduct(ctx context.Context, product *models.Product) error {
+	defer s.lock()()
+	s.upsertProduct(product)
+	return nil
+}
+
+func (s *Store) upsertProduct(product *models.Product) {
+	now := time.Now()
+	p := *product
+	p.Variants = nil
+	p.SyncedAt = now
+	s.data.products[p.ID] = p
+	if product.Variants == nil {
+		return
+	}
+
+	keep := make(map[int]bool, len(product.Variants))
+	for _, v := range product.Variants {
+		v.ProductID = p.ID
+		v.SyncedAt = now
+		s.data.variants[v.ID] = v
+		keep[v.ID] = true
+	}
+	for id, v := range s.data.variants {
+		if v.ProductID == p.ID && !keep[id] {
+			delete(s.data.variants, id)
+		}
+	}
+}
+
+func (s *Store) UpsertVariant(ctx context.Context, variant *models.Variant) error {
+	defer s.lock()()
+	if _, ok := s.data.products[variant.ProductID]; !ok {
+		return fmt.Errorf("product %d does not exist", variant.ProductID)
+	}
+	v := *variant
+	v.SyncedAt = time.Now()
+	s.data.variants[v.ID] = v
+	return nil
+}
+
+func (s *Store) DeleteProduct(ctx context.Context, productID int) error {
+	defer s.lock()()
+	s.deleteProduct(productID)
+	return nil
+}
+
+func (s *Store) deleteProduct(productID int) {
+	delete(s.data.products, productID)
+	for id, v := range s.data.variants {
+		if v.ProductID == productID {
+			delete(s.data.variants, id)
+		}
+	}
+}
+
+func (s *Store) DeleteVariant(ctx context.Context, variantID int) error {
+	defer s.lock()()
+	delete(s.data.variants, variantID)
+	return nil
+}
+
+func (s *Store) ReplaceStoreCatalog(ctx context.Context, storeID int, products []models.Product) error {
+	defer s.lock()()
+	keep := make(map[int]bool, len(products))
+	for i := range products {
+		products[i].StoreID = storeID
+		if products[i].Variants == nil {
+			products[i].Variants = []models.Variant{}
+		}
+		s.upsertProduct(&products[i])
+		keep[products[i].ID] = true
+	}
+	for id, p := range s.data.products {
+		if p.StoreID == storeID && !keep[id] {
+			s.deleteProduct(id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetProducts(ctx context.Context, storeID int) ([]models.Product, error) {
+	defer s.lock()()
+	products := []models.Product{}
+	for _, p := range s.data.products {
+		if storeID == 0 || p.StoreID == storeID {
+			products = append(products, s.withVariants(p))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products, nil
+}
+
+func (s *Store) GetProduct(ctx context.Context, productID int) (*models.Product, error) {
+	defer s.lock()()
+	p, ok := s.data.products[productID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	p = s.withVariants(p)
+	return &p, nil
+}
+
+func (s *Store) GetVariant(ctx context.Context, variantID int) (*models.Variant, error) {
+	defer s.lock()()
+	v, ok := s.data.variants[variantID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &v, nil
+}
+
+func (s *Store) withVariants(p models.Product) models.Product {
+	p.Variants = []models.Variant{}
+	for _, v := range s.data.variants {
+		if v.ProductID == p.ID {
+			p.Variants = append(p.Variants, v)
+		}
+	}
+	sort.Slice(p.Variants, func(i, j int) bool {
+		if p.Variants[i].Price != p.Variants[j].Price {
+			return p.Variants[i].Price < p.Variants[j].Price
+		}
+		return p.Variants[i].ID < p.Variants[j].ID
+	})
+	return p
+}
+
+// Marketing operations
+
+func (s *Store) CreateEarlyAccessEntry(ctx context.Context, email, referrer string) error {
+	defer s.lock()()
+	for _, e := range s.data.earlyAccess {
+		if e.Email == email {
+			return fmt.Errorf("early access entry for %s already exists", email)
+		}
+	}
+	now := time.Now()
+	s.data.earlyAccess = append(s.data.earlyAccess, models.EarlyAccess{
+		ID: s.data.id(), Email: email, Referrer: referrer, CreatedAt: now, UpdatedAt: now,
+	})
+	return nil
+}
+
+func (s *Store) EarlyAccessEmailExists(ctx context.Context, email string) (bool, error) {
+	defer s.lock()()
+	for _, e := range s.data.earlyAccess {
+		if e.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) UpdateEarlyAccessReferrer(ctx context.Context, email, referrer string) error {
+	defer s.lock()()
+	for i := range s.data.earlyAccess {
+		if s.data.earlyAccess[i].Email == email {
+			s.data.earlyAccess[i].Referrer = referrer
+			s.data.earlyAccess[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAllEarlyAccessEntries(ctx context.Context) ([]models.EarlyAccess, error) {
+	defer s.lock()()
+	entries := append([]models.EarlyAccess(nil), s.data.earlyAccess...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+func (s *Store) CreateNewsletterSubscription(ctx context.Context, email string) error {
+	defer s.lock()()
+	for _, n := range s.data.newsletter {
+		if n.Email == email {
+			return fmt.Errorf("newsletter subscription for %s already exists", email)
+		}
+	}
+	now := time.Now()
+	s.data.newsletter = append(s.data.newsletter, models.NewsletterSubscription{
+		ID: s.data.id(), Email: email, Subscribed: true, CreatedAt: now, UpdatedAt: now,
+	})
+	return nil
+}
+
+func (s *Store) NewsletterEmailExists(ctx context.Context, email string) (bool, error) {
+	defer s.lock()()
+	for _, n := range s.data.newsletter {
+		if n.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) UpdateNewsletterSubscription(ctx context.Context, email string, subscribed bool) error {
+	defer s.lock()()
+	for i := range s.data.newsletter {
+		if s.data.newsletter[i].Email == email {
+			s.data.newsletter[i].Subscribed = subscribed
+			s.data.newsletter[i].UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAllNewsletterSubscriptions(ctx context.Context) ([]models.NewsletterSubscription, error) {
+	defer s.lock()()
+	subscriptions := append([]models.NewsletterSubscription(nil), s.data.newsletter...)
+	sort.SliceStable(subscriptions, func(i, j int) bool { return subscriptions[i].CreatedAt.After(subscriptions[j].CreatedAt) })
+	return subscriptions, nil
+}
+
+// Analytics operations
+
+func (s *Store) TrackPageView(ctx context.Context, view *analytics.PageView) error {
+	defer s.lock()()
+	s.trackPageView(view)
+	return nil
+}
+
+// TrackPageViews tracks a batch in time order, which assigns sessions the same way
+// as the SQL implementation
+func (s *Store) TrackPageViews(ctx context.Context, views []*analytics.PageView) error {
+	defer s.lock()()
+	sorted := append([]*analytics.PageView(nil), views...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt.Before(sorted[j].CreatedAt) })
+	for _, view := range sorted {
+		s.trackPageView(view)
+	}
+	return nil
+}
+
+func (s *Store) trackPageView(view *analytics.PageView) {
+	var latest *analytics.PageView
+	cutoff := view.CreatedAt.Add(-analytics.SessionTimeout)
+	for i, v := range s.data.pageViews {
+		sameVisitor := v.VisitorID == view.VisitorID || (view.UserID != nil && v.UserID != nil && *v.UserID == *view.UserID)
+		if !sameVisitor || v.SessionID == "" || !v.CreatedAt.After(cutoff) || v.CreatedAt.After(view.CreatedAt) {
+			continue
+		}
+		if latest == nil || v.CreatedAt.After(latest.CreatedAt) {
+			latest = &s.data.pageViews[i]
+		}
+	}
+	if latest != nil {
+		view.SessionID = latest.SessionID
+	}
+	view.ID = int64(s.data.id())
+	s.data.pageViews = append(s.data.pageViews, *view)
+}
+
+func (s *Store) StitchVisitor(ctx context.Context, visitorID string, userID uuid.UUID) (int64, error) {
+	defer s.lock()()
+	var stitched int64
+	for i, v := range s.data.pageViews {
+		if v.VisitorID == visitorID && v.UserID == nil {
+			id := userID
+			s.data.pageViews[i].UserID = &id
+			stitched++
+		}
+	}
+	for i, e := range s.data.events {
+		if e.VisitorID == visitorID && e.UserID == nil {
+			id := userID
+			s.data.events[i].UserID = &id
+			stitched++
+		}
+	}
+	return stitched, nil
+}
+
+func (s *Store) TrackEvent(ctx context.Context, event *analytics.Event) error {
+	defer s.lock()()
+	event.ID = int64(s.data.id())
+	s.data.events = append(s.data.events, *event)
+	return nil
+}
+
+func (s *Store) TrackEvents(ctx context.Context, events []*analytics.Event) error {
+	defer s.lock()()
+	for _, event := range events {
+		event.ID = int64(s.data.id())
+		s.data.events = append(s.data.events, *event)
+	}
+	return nil
+}
+
+func (s *Store) GetEvents(ctx context.Context, names []string, from, to time.Time) ([]analytics.Event, error) {
+	defer s.lock()()
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var events []analytics.Event
+	for _, e := range s.data.events {
+		if wanted[e.Name] && !e.CreatedAt.Before(from) && e.CreatedAt.Before(to) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	return events, nil
+}
+
+func (s *Store) GetOrCreateAnalyticsSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error) {
+	defer s.lock()()
+	key := day.UTC().Format(time.DateOnly)
+	if salt, ok := s.data.analyticsSalts[key]; ok {
+		return salt, nil
+	}
+	s.data.analyticsSalts[key] = candidate
+	return candidate, nil
+}
+
+func (s *Store) DeleteAnalyticsSaltsBefore(ctx context.Context, day time.Time) (int64, error) {
+	defer s.lock()()
+	cutoff := day.UTC().Format(time.DateOnly)
+	var deleted int64
+	for key := range s.data.analyticsSalts {
+		if key < cutoff {
+			delete(s.data.analyticsSalts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// visitorKey identifies who made a page view: the user once known, otherwise the visitor
+func visitorKey(v analytics.PageView) string {
+	if v.UserID != nil {
+		return v.UserID.String()
+	}
+	return v.VisitorID
+}
+
+// pageViewsBetween returns page views created within [startTime, endTime], like SQL BETWEEN
+func (s *Store) pageViewsBetween(startTime, endTime time.Time, keep func(v analytics.PageView) bool) []analytics.PageView {
+	var views []analytics.PageView
+	for _, v := range s.data.pageViews {
+		if v.CreatedAt.Before(startTime) || v.CreatedAt.After(endTime) {
+			continue
+		}
+		if keep == nil || keep(v) {
+			views = append(views, v)
+		}
+	}
+	return views
+}
+
+func (s *Store) GetUserJourney(ctx context.Context, userID uuid.UUID, startTime, endTime time.Time) ([]analytics.PageView, error) {
+	defer s.lock()()
+	views := s.pageViewsBetween(startTime, endTime, func(v analytics.PageView) bool {
+		return v.UserID != nil && *v.UserID == userID
+	})
+	sort.SliceStable(views, func(i, j int) bool { return views[i].CreatedAt.Before(views[j].CreatedAt) })
+	return views, nil
+}
+
+func (s *Store) GetVisitorJourneys(ctx context.Context, startTime, endTime time.Time) ([]analytics.PageView, error) {
+	defer s.lock()()
+	views := s.pageViewsBetween(startTime, endTime, nil)
+	sort.SliceStable(views, func(i, j int) bool {
+		if a, b := visitorKey(views[i]), visitorKey(views[j]); a != b {
+			return a < b
+		}
+		return views[i].CreatedAt.Before(views[j].CreatedAt)
+	})
+	return views, nil
+}
+
+func (s *Store) GetPageViewStats(ctx context.Context, startTime, endTime time.Time) (*analytics.PageViewResponse, error) {
+	defer s.lock()()
+	views := s.pageViewsBetween(startTime, endTime, nil)
+	for _, v := range s.data.rolledUpPageViews {
+		if !v.CreatedAt.Before(startTime) && !v.CreatedAt.After(endTime) {
+			views = append(views, v)
+		}
+	}
+
+	byPath := make(map[string]int)
+	byDay := make(map[string]int)
+	byReferrer := make(map[string]int)
+	for _, v := range views {
+		byPath[v.Path]++
+		day := v.CreatedAt.UTC().Truncate(24 * time.Hour)
+		byDay[day.Format(time.RFC3339)]++
+		byReferrer[v.Referrer]++
+	}
+
+	type session struct {
+		views       int
+		first, last time.Time
+	}
+	sessions := make(map[string]*session)
+	visitors := make(map[string]bool)
+	for _, v := range views {
+		if v.SessionID == "" {
+			continue
+		}
+		visitors[visitorKey(v)] = true
+		ss, ok := sessions[v.SessionID]
+		if !ok {
+			ss = &session{first: v.CreatedAt, last: v.CreatedAt}
+			sessions[v.SessionID] = ss
+		}
+		ss.views++
+		if v.CreatedAt.Before(ss.first) {
+			ss.first = v.CreatedAt
+		}
+		if v.CreatedAt.After(ss.last) {
+			ss.last = v.CreatedAt
+		}
+	}
+
+	response := &analytics.PageViewResponse{TotalViews: len(views), UniquePaths: len(byPath)}
+	response.Sessions.UniqueVisitors = len(visitors)
+	response.Sessions.Sessions = len(sessions)
+	if len(sessions) > 0 {
+		var pages, bounces int
+		var seconds float64
+		for _, ss := range sessions {
+			pages += ss.views
+			seconds += ss.last.Sub(ss.first).Seconds()
+			if ss.views == 1 {
+				bounces++
+			}
+		}
+		response.Sessions.PagesPerSession = float64(pages) / float64(len(sessions))
+		response.Sessions.AvgDurationSecs = seconds / float64(len(sessions))
+		response.Sessions.BounceRate = float64(bounces) / float64(len(sessions))
+	}
+	for path, count := range byPath {
+		response.PageStats = append(response.PageStats, analytics.PageViewStats{Path: path, ViewCount: count})
+	}
+	sort.Slice(response.PageStats, func(i, j int) bool {
+		return response.PageStats[i].ViewCount > response.PageStats[j].ViewCount
+	})
+	for day, count := range byDay {
+		response.DailyStats = append(response.DailyStats, analytics.DailyStats{Date: day, Views: count})
+	}
+	sort.Slice(response.DailyStats, func(i, j int) bool {
+		return response.DailyStats[i].Date < response.DailyStats[j].Date
+	})
+	for referrer, count := range byReferrer {
+		response.ReferrerStats = append(response.ReferrerStats, analytics.ReferrerStats{Referrer: referrer, Count: count})
+	}
+	sort.Slice(response.ReferrerStats, func(i, j int) bool {
+		return response.ReferrerStats[i].Count > response.ReferrerStats[j].Count
+	})
+
+	b := &response.Breakdowns
+	b.Channels = breakdown(views, func(v analytics.PageView) string { return v.Channel })
+	b.Sources = breakdown(views, func(v analytics.PageView) string { return v.Source })
+	b.Campaigns = breakdown(views, func(v analytics.PageView) string { return v.UTM.Campaign })
+	b.Browsers = breakdown(views, func(v analytics.PageView) string { return v.Browser })
+	b.OperatingSystems = breakdown(views, func(v analytics.PageView) string { return v.OS })
+	b.Devices = breakdown(views, func(v analytics.PageView) string { return v.DeviceType })
+	b.Countries = breakdown(views, func(v analytics.PageView) string { return v.Country })
+
+	response.Attribution = s.attribution(startTime, endTime)
+	return response, nil
+}
+
+// breakdown counts views and visitors per value of a dimension, like the SQL GROUP BY
+func breakdown(views []analytics.PageView, value func(v analytics.PageView) string) []analytics.DimensionStats {
+	byValue := make(map[string]*analytics.DimensionStats)
+	visitors := make(map[string]map[string]bool)
+	for _, v := range views {
+		key := value(v)
+		stat, ok := byValue[key]
+		if !ok {
+			stat = &analytics.DimensionStats{Value: key}
+			byValue[key] = stat
+			visitors[key] = make(map[string]bool)
+		}
+		stat.Views++
+		visitors[key][visitorKey(v)] = true
+	}
+
+	stats := []analytics.DimensionStats{}
+	for key, stat := range byValue {
+		stat.Visitors = len(visitors[key])
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Views != stats[j].Views {
+			return stats[i].Views > stats[j].Views
+		}
+		return stats[i].Value < stats[j].Value
+	})
+	if len(stats) > analytics.BreakdownLimit {
+		stats = stats[:analytics.BreakdownLimit]
+	}
+	return stats
+}
+
+// attribution credits conversions within [startTime, endTime] to the preceding visits
+// of the converting user, like the lateral joins of the SQL implementation
+func (s *Store) attribution(startTime, endTime time.Time) []analytics.AttributionStats {
+	type touch struct{ channel, source, campaign string }
+	counts := make(map[analytics.AttributionStats]int)
+	for _, e := range s.data.events {
+		if e.UserID == nil || e.CreatedAt.Before(startTime) || e.CreatedAt.After(endTime) ||
+			!slices.Contains(analytics.AttributionConversions, e.Name) {
+			continue
+		}
+
+		var first, last *analytics.PageView
+		lookback := e.CreatedAt.Add(-analytics.AttributionLookback)
+		for i, v := range s.data.pageViews {
+			if v.UserID == nil || *v.UserID != *e.UserID || v.CreatedAt.After(e.CreatedAt) || !v.CreatedAt.After(lookback) {
+				continue
+			}
+			if first == nil || v.CreatedAt.Before(first.CreatedAt) {
+				first = &s.data.pageViews[i]
+			}
+			direct := v.Channel == "" || v.Channel == analytics.ChannelDirect
+			lastDirect := last == nil || last.Channel == "" || last.Channel == analytics.ChannelDirect
+			if last == nil || (lastDirect && !direct) || (direct == lastDirect && v.CreatedAt.After(last.CreatedAt)) {
+				last = &s.data.pageViews[i]
+			}
+		}
+
+		for model, v := range map[string]*analytics.PageView{
+			analytics.AttributionFirstTouch: first,
+			analytics.AttributionLastTouch:  last,
+		} {
+			t := touch{channel: analytics.ChannelDirect}
+			if v != nil {
+				t = touch{channel: v.Channel, source: v.Source, campaign: v.UTM.Campaign}
+				if t.channel == "" {
+					t.channel = analytics.ChannelDirect
+				}
+			}
+			counts[analytics.AttributionStats{
+				Conversion: e.Name,
+				Model:      model,
+				Channel:    t.channel,
+				Source:     t.source,
+				Campaign:   t.campaign,
+			}]++
+		}
+	}
+
+	stats := []analytics.AttributionStats{}
+	for key, n := range counts {
+		key.Conversions = n
+		stats = append(stats, key)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Conversion != b.Conversion {
+			return a.Conversion < b.Conversion
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		if a.Conversions != b.Conversions {
+			return a.Conversions > b.Conversions
+		}
+		return a.Channel < b.Channel
+	})
+	return stats
+}
+
+func (s *Store) RollUpPageViews(ctx context.Context, rollup string, from, to time.Time) error {
+	if _, ok := analytics.RollupPeriods[rollup]; !ok {
+		return fmt.Errorf("unknown rollup %q", rollup)
+	}
+	defer s.lock()()
+	s.data.rollupWatermarks[rollup] = to
+	return nil
+}
+
+func (s *Store) GetRollupWatermarks(ctx context.Context) (map[string]time.Time, error) {
+	defer s.lock()()
+	watermarks := make(map[string]time.Time, len(s.data.rollupWatermarks))
+	for k, v := range s.data.rollupWatermarks {
+		watermarks[k] = v
+	}
+	return watermarks, nil
+}
+
+func (s *Store) GetOldestPageView(ctx context.Context) (time.Time, error) {
+	defer s.lock()()
+	var oldest time.Time
+	for _, v := range s.data.pageViews {
+		if oldest.IsZero() || v.CreatedAt.Before(oldest) {
+			oldest = v.CreatedAt
+		}
+	}
+	return oldest, nil
+}
+
+// PurgePageViews removes page views like the SQL implementation. Purged views keep
+// counting towards GetPageViewStats, as they would through the rollup tables.
+func (s *Store) PurgePageViews(ctx context.Context, before time.Time, archive bool, limit int) (int64, error) {
+	defer s.lock()()
+	sort.SliceStable(s.data.pageViews, func(i, j int) bool {
+		return s.data.pageViews[i].CreatedAt.Before(s.data.pageViews[j].CreatedAt)
+	})
+	n := 0
+	for n < len(s.data.pageViews) && n < limit && s.data.pageViews[n].CreatedAt.Before(before) {
+		n++
+	}
+	purged := s.data.pageViews[:n]
+	s.data.rolledUpPageViews = append(s.data.rolledUpPageViews, purged...)
+	if archive {
+		s.data.archivedPageViews = append(s.data.archivedPageViews, purged...)
+	}
+	s.data.pageViews = append([]analytics.PageView(nil), s.data.pageViews[n:]...)
+	return int64(n), nil
+}
+
+// Webhook operations
+
+func (s *Store) CreateWebhookEndpoint(ctx context.Context, e *models.WebhookEndpoint) error {
+	defer s.lock()()
+	now := time.Now()
+	e.EventTypes = append([]string{}, e.EventTypes...)
+	e.CreatedAt = now
+	e.UpdatedAt = now
+	s.data.webhookEndpoints = append(s.data.webhookEndpoints, *e)
+	return nil
+}
+
+func (s *Store) GetWebhookEndpoints(ctx context.Context, userID string) ([]models.WebhookEndpoint, error) {
+	defer s.lock()()
+	endpoints := []models.WebhookEndpoint{}
+	for _, e := range s.data.webhookEndpoints {
+		if e.UserID == userID {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, nil
+}
+
+func (s *Store) GetWebhookEndpoint(ctx context.Context, userID, id string) (*models.WebhookEndpoint, error) {
+	defer s.lock()()
+	for _, e := range s.data.webhookEndpoints {
+		if e.ID == id && e.UserID == userID {
+			return &e, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) UpdateWebhookEndpoint(ctx context.Context, e *models.WebhookEndpoint) error {
+	defer s.lock()()
+	for i, existing := range s.data.webhookEndpoints {
+		if existing.ID == e.ID && existing.UserID == e.UserID {
+			e.EventTypes = append([]string{}, e.EventTypes...)
+			e.CreatedAt = existing.CreatedAt
+			e.UpdatedAt = time.Now()
+			s.data.webhookEndpoints[i] = *e
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) DeleteWebhookEndpoint(ctx context.Context, userID, id string) error {
+	defer s.lock()()
+	i := slices.IndexFunc(s.data.webhookEndpoints, func(e models.WebhookEndpoint) bool {
+		return e.ID == id && e.UserID == userID
+	})
+	if i < 0 {
+		return sql.ErrNoRows
+	}
+	s.data.webhookEndpoints = slices.Delete(s.data.webhookEndpoints, i, i+1)
+	s.data.webhookDeliveries = slices.DeleteFunc(s.data.webhookDeliveries, func(d models.WebhookDelivery) bool {
+		return d.EndpointID == id
+	})
+	return nil
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	defer s.lock()()
+	d.CreatedAt = time.Now()
+	s.data.webhookDeliveries = append(s.data.webhookDeliveries, *d)
+	return nil
+}
+
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	defer s.lock()()
+	endpoints := make(map[string]models.WebhookEndpoint, len(s.data.webhookEndpoints))
+	for _, e := range s.data.webhookEndpoints {
+		endpoints[e.ID] = e
+	}
+
+	var due []int
+	for i, d := range s.data.webhookDeliveries {
+		if d.Status == models.WebhookDeliveryPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) &&
+			endpoints[d.EndpointID].Enabled {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return s.data.webhookDeliveries[due[i]].NextAttemptAt.Before(*s.data.webhookDeliveries[due[j]].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, i := range due {
+		d := &s.data.webhookDeliveries[i]
+		d.Attempts++
+		d.NextAttemptAt = &leaseUntil
+		claimed := *d
+		claimed.URL = endpoints[d.EndpointID].URL
+		claimed.Secret = endpoints[d.EndpointID].Secret
+		deliveries = append(deliveries, claimed)
+	}
+	return deliveries, nil
+}
+
+func (s *Store) RecordWebhookAttempt(ctx context.Context, d *models.WebhookDelivery) error {
+	defer s.lock()()
+	for i := range s.data.webhookDeliveries {
+		existing := &s.data.webhookDeliveries[i]
+		if existing.ID == d.ID {
+			existing.Status = d.Status
+			existing.NextAttemptAt = d.NextAttemptAt
+			existing.LastAttemptAt = d.LastAttemptAt
+			existing.ResponseStatus = d.ResponseStatus
+			existing.ResponseBody = d.ResponseBody
+			existing.Error = d.Error
+			existing.DurationMS = d.DurationMS
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetWebhookDeliveries(ctx context.Context, endpointID string, limit int) ([]models.WebhookDelivery, error) {
+	defer s.lock()()
+	deliveries := []models.WebhookDelivery{}
+	for _, d := range s.data.webhookDeliveries {
+		if d.EndpointID == endpointID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt) })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *Store) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock()()
+	n := len(s.data.webhookDeliveries)
+	s.data.webhookDeliveries = slices.DeleteFunc(s.data.webhookDeliveries, func(d models.WebhookDelivery) bool {
+		return d.CreatedAt.Before(before) && d.Status != models.WebhookDeliveryPending
+	})
+	return int64(n - len(s.data.webhookDeliveries)), nil
+}
+
+// API key operations
+
+func (s *Store) CreateAPIKey(ctx context.Context, k *models.APIKey, max int) error {
+	defer s.lock()()
+	now := time.Now()
+	active := 0
+	for _, existing := range s.data.apiKeys {
+		if existing.Prefix == k.Prefix {
+			return fmt.Errorf("api key with prefix %s already exists", k.Prefix)
+		}
+		if existing.UserID == k.UserID && existing.Active(now) {
+			active++
+		}
+	}
+	if active >= max {
+		return database.ErrAPIKeyLimit
+	}
+	k.Scopes = append([]string{}, k.Scopes...)
+	k.CreatedAt = now
+	s.data.apiKeys = append(s.data.apiKeys, *k)
+	return nil
+}
+
+func (s *Store) GetAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	defer s.lock()()
+	keys := []models.APIKey{}
+	for i := len(s.data.apiKeys) - 1; i >= 0; i-- {
+		if s.data.apiKeys[i].UserID == userID {
+			keys = append(keys, s.data.apiKeys[i])
+		}
+	}
+	return keys, nil
+}
+
+func (s *Store) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	defer s.lock()()
+	for _, k := range s.data.apiKeys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, userID, id string, at time.Time) (*models.APIKey, error) {
+	defer s.lock()()
+	for i := range s.data.apiKeys {
+		k := &s.data.apiKeys[i]
+		if k.ID == id && k.UserID == userID {
+			if k.RevokedAt == nil {
+				k.RevokedAt = &at
+			}
+			revoked := *k
+			return &revoked, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, id string, at time.Time, ip string) error {
+	defer s.lock()()
+	for i := range s.data.apiKeys {
+		if s.data.apiKeys[i].ID == id {
+			s.data.apiKeys[i].LastUsedAt = &at
+			s.data.apiKeys[i].LastUsedIP = ip
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"saas-server/database"
+)
+
+func TestWithTx(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name       string
+		fn         func(tx database.Store, userID string) error
+		wantErr    error
+		wantStatus string
+		wantSub    bool
+	}{
+		{
+			name: "commits on success",
+			fn: func(tx database.Store, userID string) error {
+				ctx := context.Background()
+				if err := tx.CreateSubscription(ctx, userID, 1, 10, 100, 1000, 2000, "active", nil, nil, nil); err != nil {
+					return err
+				}
+				return tx.UpdateUserSubscription(ctx, userID, 1, "active", 1000, 2000, nil, nil)
+			},
+			wantStatus: "active",
+			wantSub:    true,
+		},
+		{
+			name: "rolls back every change on error",
+			fn: func(tx database.Store, userID string) error {
+				ctx := context.Background()
+				if err := tx.CreateSubscription(ctx, userID, 1, 10, 100, 1000, 2000, "active", nil, nil, nil); err != nil {
+					return err
+				}
+				if err := tx.UpdateUserSubscription(ctx, userID, 1, "active", 1000, 2000, nil, nil); err != nil {
+					return err
+				}
+				return errFailed
+			},
+			wantErr: errFailed,
+		},
+		{
+			name: "nested transactions join the outer one",
+			fn: func(tx database.Store, userID string) error {
+				ctx := context.Background()
+				if err := tx.WithTx(ctx, func(inner database.Store) error {
+					return inner.CreateSubscription(ctx, userID, 1, 10, 100, 1000, 2000, "active", nil, nil, nil)
+				}); err != nil {
+					return err
+				}
+				return errFailed
+			},
+			wantErr: errFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := New()
+			user, err := s.CreateUser(ctx, "a@example.com", "", "A", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.WithTx(ctx, func(tx database.Store) error { return tt.fn(tx, user.ID) })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WithTx = %v, want %v", err, tt.wantErr)
+			}
+
+			_, err = s.GetSubscriptionByID(ctx, 1)
+			if gotSub := err == nil; gotSub != tt.wantSub {
+				t.Errorf("subscription stored = %v, want %v (%v)", gotSub, tt.wantSub, err)
+			}
+			u, err := s.GetUserByID(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.LatestStatus != tt.wantStatus {
+				t.Errorf("latest status = %q, want %q", u.LatestStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	tests := []struct {
+		name string
+		get  func() error
+	}{
+		{"user by ID", func() error { _, err := s.GetUserByID(ctx, "6f1c0a9e-0000-4000-8000-000000000000"); return err }},
+		{"user by email", func() error { _, err := s.GetUserByEmail(ctx, "nobody@example.com"); return err }},
+		{"subscription", func() error { _, err := s.GetSubscriptionByID(ctx, 404); return err }},
+		{"order", func() error { _, err := s.GetOrder(ctx, 404); return err }},
+		{"API key", func() error { _, err := s.GetAPIKeyByPrefix(ctx, "sk_000000000000"); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.get(); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("error = %v, want sql.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+func TestCreateUserRejectsDuplicateEmail(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if _, err := s.CreateUser(ctx, "a@example.com", "", "A", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(ctx, "a@example.com", "", "B", false); err == nil {
+		t.Error("second user with the same email was created")
+	}
+	exists, err := s.UserExists(ctx, "a@example.com")
+	if err != nil || !exists {
+		t.Errorf("UserExists = %v, %v; want true", exists, err)
+	}
+}
@@ -1,112 +1,472 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"runtime"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of the Postgres advisory lock held while migrating,
+// so replicas starting at the same time apply migrations one after another
+const migrationLockID int64 = 72707367
+
+// migrationFilePattern matches files named <version>_<name>.<up|down>.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// migrationNameSeparators matches runs of characters not allowed in generated migration names
+var migrationNameSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Migration is a single versioned schema change loaded from the migrations directory
+type Migration struct {
+	Version  string
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Version   string
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// Modified is set when the applied checksum differs from the file on disk
+	Modified bool
+	// Missing is set when the database records a version that has no migration file
+	Missing bool
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	checksum  sql.NullString
+	appliedAt time.Time
+}
+
 // MigrationManager handles database migrations
 type MigrationManager struct {
-	db *DB
+	db         *DB
+	migrations []Migration
+	loadErr    error
 }
 
-// NewMigrationManager creates a new migration manager
+// NewMigrationManager creates a new migration manager using the migrations embedded in the binary
 func NewMigrationManager(db *DB) *MigrationManager {
-	return &MigrationManager{db: db}
+	migrations, err := LoadMigrations(migrationFiles)
+	return &MigrationManager{db: db, migrations: migrations, loadErr: err}
 }
 
-// RunMigrations executes all pending migrations in the migrations directory
+// LoadMigrations reads and sorts the migrations found in fsys under "migrations"
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations directory: %v", err)
+	}
+
+	byVersion := make(map[string]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, name, direction := match[1], match[2], match[3]
+
+		content, err := fs.ReadFile(fsys, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("duplicate migration version %s (%s and %s)", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %s_%s has no .up.sql file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return versionLess(migrations[i].Version, migrations[j].Version)
+	})
+	return migrations, nil
+}
+
+// RunMigrations applies all pending migrations
 func (m *MigrationManager) RunMigrations() error {
-	// Create migrations table if it doesn't exist
-	_, err := m.db.Exec(`
+	return m.Up(context.Background())
+}
+
+// Up applies all pending migrations in order
+func (m *MigrationManager) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(applied map[string]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back the n most recently applied migrations
+func (m *MigrationManager) Down(ctx context.Context, n int) error {
+	if n < 1 {
+		return fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+	return m.withLock(ctx, func(applied map[string]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && n > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.rollback(ctx, migration); err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// Goto migrates up or down until version is the latest applied migration.
+// Version "0" rolls back every migration.
+func (m *MigrationManager) Goto(ctx context.Context, version string) error {
+	if version != "0" && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %q", version)
+	}
+	return m.withLock(ctx, func(applied map[string]appliedMigration) error {
+		// Roll back newer migrations first, newest to oldest
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; ok && versionLess(version, migration.Version) {
+				if err := m.rollback(ctx, migration); err != nil {
+					return err
+				}
+			}
+		}
+		// Then apply anything missing up to and including the target
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && !versionLess(version, migration.Version) {
+				if err := m.apply(ctx, migration); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Status reports every known migration and whether it has been applied,
+// including versions recorded in the database that have no migration file
+func (m *MigrationManager) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if m.loadErr != nil {
+		return nil, m.loadErr
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.appliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Modified = record.checksum.Valid && record.checksum.String != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		appliedAt := record.appliedAt
+		statuses = append(statuses, MigrationStatus{Version: version, Applied: true, AppliedAt: &appliedAt, Missing: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return versionLess(statuses[i].Version, statuses[j].Version)
+	})
+	return statuses, nil
+}
+
+// AppliedVersion returns the highest migration version recorded in schema_migrations,
+// or an empty string if no migrations have been applied yet
+func (m *MigrationManager) AppliedVersion(ctx context.Context) (string, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for version := range applied {
+		if latest == "" || versionLess(latest, version) {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// LatestVersion returns the highest migration version embedded in the binary
+func (m *MigrationManager) LatestVersion() (string, error) {
+	if m.loadErr != nil {
+		return "", m.loadErr
+	}
+	if len(m.migrations) == 0 {
+		return "", nil
+	}
+	return m.migrations[len(m.migrations)-1].Version, nil
+}
+
+// CheckUpToDate returns an error if the database schema is behind the available migrations
+func (m *MigrationManager) CheckUpToDate(ctx context.Context) error {
+	latest, err := m.LatestVersion()
+	if err != nil {
+		return err
+	}
+	applied, err := m.AppliedVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if latest != "" && (applied == "" || versionLess(applied, latest)) {
+		return fmt.Errorf("schema at version %q, expected %q", applied, latest)
+	}
+	return nil
+}
+
+// CreateMigration writes an empty up/down migration pair to dir, numbered after
+// the highest version already present there, and returns the created paths
+func CreateMigration(dir, name string) (string, string, error) {
+	name = strings.Trim(migrationNameSeparators.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name must contain letters or digits")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading migrations directory: %v", err)
+	}
+	next := 1
+	for _, entry := range entries {
+		if match := migrationFilePattern.FindStringSubmatch(entry.Name()); match != nil {
+			if n, err := strconv.Atoi(match[1]); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%03d_%s", next, name)
+	upPath := filepath.Join(dir, base+".up.sql")
+	downPath := filepath.Join(dir, base+".down.sql")
+	if err := os.WriteFile(upPath, []byte("-- "+base+" (up)\n"), 0o644); err != nil {
+		return "", "", fmt.Errorf("error writing %s: %v", upPath, err)
+	}
+	if err := os.WriteFile(downPath, []byte("-- "+base+" (down)\n"), 0o644); err != nil {
+		return "", "", fmt.Errorf("error writing %s: %v", downPath, err)
+	}
+	return upPath, downPath, nil
+}
+
+// withLock holds the migration advisory lock while fn runs. Before calling fn it
+// ensures the migrations table exists and verifies the checksums of applied migrations.
+func (m *MigrationManager) withLock(ctx context.Context, fn func(applied map[string]appliedMigration) error) error {
+	if m.loadErr != nil {
+		return m.loadErr
+	}
+
+	// Advisory locks belong to a session, so take and release it on one dedicated connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection for migration lock: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("error acquiring migration lock: %v", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			log.Printf("Error releasing migration lock: %v", err)
+		}
+	}()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.verifyChecksums(ctx, applied); err != nil {
+		return err
+	}
+	return fn(applied)
+}
+
+// ensureTable creates the schema_migrations table, adding the checksum column to older installs
+func (m *MigrationManager) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version VARCHAR(255) PRIMARY KEY,
 			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
+		);
+		ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);
 	`)
 	if err != nil {
 		return fmt.Errorf("error creating migrations table: %v", err)
 	}
+	return nil
+}
 
-	// Get list of applied migrations
-	applied := make(map[string]bool)
-	rows, err := m.db.Query("SELECT version FROM schema_migrations")
+// applied returns the migrations recorded in schema_migrations keyed by version
+func (m *MigrationManager) applied(ctx context.Context) (map[string]appliedMigration, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
 	if err != nil {
-		return fmt.Errorf("error getting applied migrations: %v", err)
+		return nil, fmt.Errorf("error getting applied migrations: %v", err)
 	}
 	defer rows.Close()
 
+	applied := make(map[string]appliedMigration)
 	for rows.Next() {
 		var version string
-		if err := rows.Scan(&version); err != nil {
-			return fmt.Errorf("error scanning migration version: %v", err)
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.checksum, &record.appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning migration version: %v", err)
 		}
-		applied[version] = true
-	}
-
-	// Get the directory containing this file
-	_, filename, _, _ := runtime.Caller(0)
-	baseDir := filepath.Dir(filename)
-
-	// Read migration files
-	files, err := os.ReadDir(filepath.Join(baseDir, "migrations"))
-	if err != nil {
-		return fmt.Errorf("error reading migrations directory: %v", err)
+		applied[version] = record
 	}
+	return applied, rows.Err()
+}
 
-	// Filter and sort migration files
-	var migrations []string
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".up.sql") {
-			version := strings.Split(f.Name(), "_")[0]
-			if !applied[version] {
-				migrations = append(migrations, f.Name())
+// verifyChecksums fails if an applied migration file has changed since it was applied.
+// Rows recorded before checksums were tracked are backfilled from the current files.
+func (m *MigrationManager) verifyChecksums(ctx context.Context, applied map[string]appliedMigration) error {
+	var modified []string
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+		if !record.checksum.Valid {
+			if _, err := m.db.ExecContext(ctx, "UPDATE schema_migrations SET checksum = $1 WHERE version = $2", migration.Checksum, migration.Version); err != nil {
+				return fmt.Errorf("error recording checksum for migration %s: %v", migration.Version, err)
 			}
+			continue
+		}
+		if record.checksum.String != migration.Checksum {
+			modified = append(modified, migration.Version+"_"+migration.Name)
 		}
 	}
-	sort.Strings(migrations)
+	if len(modified) > 0 {
+		return fmt.Errorf("applied migrations have been modified: %s", strings.Join(modified, ", "))
+	}
+	return nil
+}
 
-	// Apply pending migrations
-	for _, migration := range migrations {
-		version := strings.Split(migration, "_")[0]
-		log.Printf("Applying migration: %s", migration)
+// apply runs a migration's up script and records it in a single transaction
+func (m *MigrationManager) apply(ctx context.Context, migration Migration) error {
+	label := migration.Version + "_" + migration.Name
+	log.Printf("Applying migration: %s", label)
 
-		// Read migration file
-		content, err := os.ReadFile(filepath.Join(baseDir, "migrations", migration))
-		if err != nil {
-			return fmt.Errorf("error reading migration %s: %v", migration, err)
-		}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction for %s: %v", label, err)
+	}
+	if _, err := tx.Exec(migration.Up); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error executing migration %s: %v", label, err)
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, checksum) VALUES ($1, $2)", migration.Version, migration.Checksum); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error recording migration %s: %v", label, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %s: %v", label, err)
+	}
 
-		// Start transaction
-		tx, err := m.db.Begin()
-		if err != nil {
-			return fmt.Errorf("error starting transaction for %s: %v", migration, err)
-		}
+	log.Printf("Successfully applied migration: %s", label)
+	return nil
+}
 
-		// Execute migration
-		if _, err := tx.Exec(string(content)); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("error executing migration %s: %v", migration, err)
-		}
+// rollback runs a migration's down script and removes its record in a single transaction
+func (m *MigrationManager) rollback(ctx context.Context, migration Migration) error {
+	label := migration.Version + "_" + migration.Name
+	if migration.Down == "" {
+		return fmt.Errorf("migration %s has no .down.sql file", label)
+	}
+	log.Printf("Rolling back migration: %s", label)
 
-		// Record migration
-		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("error recording migration %s: %v", migration, err)
-		}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction for %s: %v", label, err)
+	}
+	if _, err := tx.Exec(migration.Down); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error rolling back migration %s: %v", label, err)
+	}
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error removing migration record %s: %v", label, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing rollback of %s: %v", label, err)
+	}
 
-		// Commit transaction
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("error committing migration %s: %v", migration, err)
-		}
+	log.Printf("Successfully rolled back migration: %s", label)
+	return nil
+}
 
-		log.Printf("Successfully applied migration: %s", migration)
+// find returns the migration with the given version, accepting versions with or without leading zeros
+func (m *MigrationManager) find(version string) *Migration {
+	for i := range m.migrations {
+		if !versionLess(m.migrations[i].Version, version) && !versionLess(version, m.migrations[i].Version) {
+			return &m.migrations[i]
+		}
 	}
-
 	return nil
 }
+
+// versionLess compares migration versions numerically so "9" sorts before "10"
+func versionLess(a, b string) bool {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	if aErr != nil || bErr != nil {
+		return a < b
+	}
+	return an < bn
+}
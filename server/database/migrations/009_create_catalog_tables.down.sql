@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS variants;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,4 @@
+ALTER TABLE variants
+    DROP COLUMN IF EXISTS billing_interval_count,
+    DROP COLUMN IF EXISTS billing_interval,
+    DROP COLUMN IF EXISTS is_subscription;
@@ -0,0 +1,5 @@
+-- Billing period of subscription variants, needed to estimate prorated plan changes
+ALTER TABLE variants
+    ADD COLUMN IF NOT EXISTS is_subscription BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS billing_interval VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS billing_interval_count INTEGER NOT NULL DEFAULT 0;
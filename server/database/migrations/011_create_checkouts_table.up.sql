@@ -0,0 +1,17 @@
+-- Checkouts started by signed-in users. Rows stay pending until the order webhook
+-- arrives, so pending rows older than a day or so are abandoned checkouts.
+CREATE TABLE IF NOT EXISTS checkouts (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    variant_id INTEGER NOT NULL,
+    discount_code VARCHAR(100) NOT NULL DEFAULT '',
+    provider_checkout_id VARCHAR(100) NOT NULL DEFAULT '',
+    checkout_url TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    order_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_checkouts_user_id ON checkouts(user_id);
+CREATE INDEX IF NOT EXISTS idx_checkouts_status_created_at ON checkouts(status, created_at);
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS subscription_invoices;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS receipt_url,
+    DROP COLUMN IF EXISTS billing_email,
+    DROP COLUMN IF EXISTS billing_name,
+    DROP COLUMN IF EXISTS tax_name,
+    DROP COLUMN IF EXISTS refunded_amount,
+    DROP COLUMN IF EXISTS total,
+    DROP COLUMN IF EXISTS tax,
+    DROP COLUMN IF EXISTS discount_total,
+    DROP COLUMN IF EXISTS subtotal,
+    DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,44 @@
+-- Orders keep integer amounts in the smallest currency unit alongside the formatted
+-- strings, plus the billing details and receipt link needed to render invoices.
+-- The currency of orders recorded before is unknown and stays NULL.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS currency VARCHAR(3),
+    ADD COLUMN IF NOT EXISTS subtotal INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS discount_total INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS total INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS refunded_amount INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_name VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS billing_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS billing_email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS receipt_url TEXT NOT NULL DEFAULT '';
+
+-- One row per subscription charge, recorded from subscription_payment_success events
+CREATE TABLE IF NOT EXISTS subscription_invoices (
+    id SERIAL PRIMARY KEY,
+    invoice_id INTEGER NOT NULL UNIQUE,
+    subscription_id INTEGER NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    customer_id INTEGER NOT NULL,
+    billing_reason VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    subtotal INTEGER NOT NULL DEFAULT 0,
+    discount_total INTEGER NOT NULL DEFAULT 0,
+    tax INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL DEFAULT 0,
+    tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+    refunded BOOLEAN NOT NULL DEFAULT FALSE,
+    refunded_amount INTEGER NOT NULL DEFAULT 0,
+    refunded_at TIMESTAMP WITH TIME ZONE,
+    billing_name VARCHAR(255) NOT NULL DEFAULT '',
+    billing_email VARCHAR(255) NOT NULL DEFAULT '',
+    card_brand VARCHAR(50) NOT NULL DEFAULT '',
+    card_last_four VARCHAR(4) NOT NULL DEFAULT '',
+    invoice_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_invoices_user_id ON subscription_invoices(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_subscription_invoices_subscription_id ON subscription_invoices(subscription_id);
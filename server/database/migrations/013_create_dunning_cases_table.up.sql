@@ -0,0 +1,23 @@
+-- A dunning case follows a subscription from its first failed payment until the
+-- payment is recovered or the subscription ends. Only one case per subscription may
+-- be unresolved at a time.
+CREATE TABLE IF NOT EXISTS dunning_cases (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    grace_ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reminders_sent INTEGER NOT NULL DEFAULT 0,
+    last_reminder_at TIMESTAMP WITH TIME ZONE,
+    update_payment_url TEXT NOT NULL DEFAULT '',
+    downgraded_at TIMESTAMP WITH TIME ZONE,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dunning_cases_unresolved
+    ON dunning_cases(subscription_id) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_dunning_cases_status ON dunning_cases(status);
+CREATE INDEX IF NOT EXISTS idx_dunning_cases_failed_at ON dunning_cases(failed_at);
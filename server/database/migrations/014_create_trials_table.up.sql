@@ -0,0 +1,27 @@
+-- A trial is either managed by the app, granted at signup without a card, or a
+-- Lemon Squeezy subscription that started on trial. It stays active until it
+-- converts to a paid plan or expires.
+CREATE TABLE IF NOT EXISTS trials (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL,
+    subscription_id INTEGER,
+    product_id INTEGER NOT NULL DEFAULT 0,
+    variant_id INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reminder_sent_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Each user gets one app-managed trial; each subscription is tracked once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trials_app_user
+    ON trials(user_id) WHERE source = 'app';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trials_subscription
+    ON trials(subscription_id) WHERE subscription_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_trials_active_ends_at
+    ON trials(ends_at) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_trials_started_at ON trials(started_at);
@@ -0,0 +1,44 @@
+-- History of subscription state changes with the monthly recurring revenue each
+-- state was worth, in the smallest currency unit, for revenue reporting
+CREATE TABLE IF NOT EXISTS subscription_events (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    product_id INTEGER NOT NULL,
+    variant_id INTEGER NOT NULL,
+    mrr INTEGER NOT NULL DEFAULT 0,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_events_subscription
+    ON subscription_events(subscription_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_subscription_events_occurred_at ON subscription_events(occurred_at);
+
+-- Backfill existing subscriptions: each started paying when it was created (unless it
+-- is still on trial) and, if it has since stopped, stopped at its last update
+INSERT INTO subscription_events (subscription_id, user_id, event, status, product_id, variant_id, mrr, occurred_at)
+SELECT s.subscription_id, s.user_id, 'subscription_created',
+       CASE WHEN s.status = 'on_trial' THEN 'on_trial' ELSE 'active' END,
+       s.product_id, s.variant_id,
+       CASE WHEN s.status = 'on_trial' THEN 0 ELSE COALESCE((
+           SELECT ROUND(CASE v.billing_interval
+               WHEN 'year' THEN v.price / (12.0 * GREATEST(v.billing_interval_count, 1))
+               WHEN 'week' THEN v.price * 52 / (12.0 * GREATEST(v.billing_interval_count, 1))
+               WHEN 'day' THEN v.price * 365 / (12.0 * GREATEST(v.billing_interval_count, 1))
+               ELSE v.price / GREATEST(v.billing_interval_count, 1)::NUMERIC
+           END)::INTEGER
+           FROM variants v
+           WHERE v.id = s.variant_id AND v.billing_interval <> ''
+       ), 0) END,
+       s.created_at
+FROM subscriptions s
+WHERE NOT EXISTS (SELECT 1 FROM subscription_events e WHERE e.subscription_id = s.subscription_id);
+
+INSERT INTO subscription_events (subscription_id, user_id, event, status, product_id, variant_id, mrr, occurred_at)
+SELECT s.subscription_id, s.user_id, 'subscription_updated', s.status, s.product_id, s.variant_id, 0, s.updated_at
+FROM subscriptions s
+WHERE s.status NOT IN ('active', 'past_due', 'on_trial')
+  AND (SELECT COUNT(*) FROM subscription_events e WHERE e.subscription_id = s.subscription_id) = 1;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS analytics_salts;
+DROP INDEX IF EXISTS idx_page_views_session_id;
+DROP INDEX IF EXISTS idx_page_views_visitor_created_at;
+ALTER TABLE page_views DROP COLUMN IF EXISTS session_id;
@@ -0,0 +1,19 @@
+-- Group page views into sessions and keep visitor IDs anonymous
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS session_id VARCHAR(64);
+
+-- Finds a visitor's latest page view when deciding whether a session continues
+CREATE INDEX IF NOT EXISTS idx_page_views_visitor_created_at ON page_views(visitor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_page_views_session_id ON page_views(session_id);
+
+-- Daily salts for hashed visitor IDs; each day's salt is deleted once the day is over
+CREATE TABLE IF NOT EXISTS analytics_salts (
+    day DATE PRIMARY KEY,
+    salt BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Addresses recorded before truncation include the client port and cannot be
+-- anonymized reliably, so they are dropped
+UPDATE page_views SET ip_address = NULL WHERE ip_address IS NOT NULL;
+
+COMMENT ON TABLE analytics_salts IS 'Rotating salts used to derive anonymous visitor IDs';
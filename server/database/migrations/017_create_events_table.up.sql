@@ -0,0 +1,16 @@
+-- Create events table for custom and server-side analytics events
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    properties JSONB NOT NULL DEFAULT '{}',
+    user_id UUID,
+    visitor_id VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Funnels load the events of a few names over a date range
+CREATE INDEX IF NOT EXISTS idx_events_name_created_at ON events(name, created_at);
+CREATE INDEX IF NOT EXISTS idx_events_user_id ON events(user_id);
+CREATE INDEX IF NOT EXISTS idx_events_visitor_id ON events(visitor_id);
+
+COMMENT ON TABLE events IS 'Named analytics events sent by the client or emitted by the server';
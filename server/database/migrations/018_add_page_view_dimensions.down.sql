@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_page_views_user_created_at;
+
+ALTER TABLE page_views
+    DROP COLUMN IF EXISTS utm_source,
+    DROP COLUMN IF EXISTS utm_medium,
+    DROP COLUMN IF EXISTS utm_campaign,
+    DROP COLUMN IF EXISTS utm_term,
+    DROP COLUMN IF EXISTS utm_content,
+    DROP COLUMN IF EXISTS source,
+    DROP COLUMN IF EXISTS channel,
+    DROP COLUMN IF EXISTS browser,
+    DROP COLUMN IF EXISTS os,
+    DROP COLUMN IF EXISTS device_type,
+    DROP COLUMN IF EXISTS country;
+
+ALTER TABLE page_views ALTER COLUMN user_agent TYPE VARCHAR(512) USING LEFT(user_agent, 512);
+ALTER TABLE page_views ALTER COLUMN referrer TYPE VARCHAR(255) USING LEFT(referrer, 255);
@@ -0,0 +1,20 @@
+-- Referrers and user agents can exceed the original limits
+ALTER TABLE page_views ALTER COLUMN referrer TYPE TEXT;
+ALTER TABLE page_views ALTER COLUMN user_agent TYPE TEXT;
+
+-- Campaign parameters and the dimensions derived when a view is tracked
+ALTER TABLE page_views
+    ADD COLUMN IF NOT EXISTS utm_source VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS utm_medium VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS utm_campaign VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS utm_term VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS utm_content VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS source VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS channel VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS browser VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS os VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS device_type VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS country CHAR(2);
+
+-- Attribution looks up each converting user's visits before the conversion
+CREATE INDEX IF NOT EXISTS idx_page_views_user_created_at ON page_views(user_id, created_at);
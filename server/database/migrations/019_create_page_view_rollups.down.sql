@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_page_views_archive_created_at;
+DROP TABLE IF EXISTS page_views_archive;
+DROP TABLE IF EXISTS page_view_rollup_state;
+DROP TABLE IF EXISTS page_view_session_rollups;
+DROP TABLE IF EXISTS page_view_rollups_daily;
+DROP TABLE IF EXISTS page_view_rollups_hourly;
@@ -0,0 +1,46 @@
+-- Hourly page view counts by path and referrer
+CREATE TABLE IF NOT EXISTS page_view_rollups_hourly (
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    referrer TEXT NOT NULL,
+    views INTEGER NOT NULL,
+    PRIMARY KEY (hour, path, referrer)
+);
+
+-- Daily views and unique visitors for each value of a reporting dimension.
+-- day is midnight UTC.
+CREATE TABLE IF NOT EXISTS page_view_rollups_daily (
+    day TIMESTAMP WITH TIME ZONE NOT NULL,
+    dimension VARCHAR(50) NOT NULL,
+    value TEXT NOT NULL,
+    views INTEGER NOT NULL,
+    visitors INTEGER NOT NULL,
+    PRIMARY KEY (day, dimension, value)
+);
+
+-- Daily session totals, from which pages per session, average duration and
+-- bounce rate are derived
+CREATE TABLE IF NOT EXISTS page_view_session_rollups (
+    day TIMESTAMP WITH TIME ZONE PRIMARY KEY,
+    visitors INTEGER NOT NULL,
+    sessions INTEGER NOT NULL,
+    session_views INTEGER NOT NULL,
+    duration_seconds DOUBLE PRECISION NOT NULL,
+    bounces INTEGER NOT NULL
+);
+
+-- How far each rollup is complete; page views before rolled_up_to are served
+-- from the rollup and may be removed by the retention job
+CREATE TABLE IF NOT EXISTS page_view_rollup_state (
+    rollup VARCHAR(20) PRIMARY KEY,
+    rolled_up_to TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Raw page views moved out of page_views by the retention job in archive mode.
+-- Columns added to page_views later must be added here too.
+CREATE TABLE IF NOT EXISTS page_views_archive (LIKE page_views);
+CREATE INDEX IF NOT EXISTS idx_page_views_archive_created_at ON page_views_archive(created_at);
+
+COMMENT ON TABLE page_view_rollup_state IS 'Progress of the page view rollups';
+COMMENT ON TABLE page_views_archive IS 'Page views past the retention period';
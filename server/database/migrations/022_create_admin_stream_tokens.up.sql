@@ -0,0 +1,6 @@
+-- Admin stream tokens that have been used. A stream token travels in the URL, where
+-- it may be logged, so each opens the activity stream only once.
+CREATE TABLE IF NOT EXISTS admin_stream_tokens (
+    jti UUID PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -1,13 +1,17 @@
 package database
 
 import (
+	"context"
 	"saas-server/models"
 	"time"
 )
 
 // CreateNewsletterSubscription creates a new newsletter subscription in the database
-func (db *DB) CreateNewsletterSubscription(email string) error {
-	_, err := db.Exec(
+func (db *DB) CreateNewsletterSubscription(ctx context.Context, email string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
 		"INSERT INTO newsletter_subscriptions (email, subscribed, created_at, updated_at) VALUES ($1, $2, $3, $3)",
 		email, true, time.Now(),
 	)
@@ -15,15 +19,21 @@ func (db *DB) CreateNewsletterSubscription(email string) error {
 }
 
 // NewsletterEmailExists checks if an email already exists in the newsletter_subscriptions table
-func (db *DB) NewsletterEmailExists(email string) (bool, error) {
+func (db *DB) NewsletterEmailExists(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM newsletter_subscriptions WHERE email = $1)", email).Scan(&exists)
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM newsletter_subscriptions WHERE email = $1)", email).Scan(&exists)
 	return exists, err
 }
 
 // UpdateNewsletterSubscription updates the subscription status for an existing newsletter subscription
-func (db *DB) UpdateNewsletterSubscription(email string, subscribed bool) error {
-	_, err := db.Exec(
+func (db *DB) UpdateNewsletterSubscription(ctx context.Context, email string, subscribed bool) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx,
 		"UPDATE newsletter_subscriptions SET subscribed = $1, updated_at = $2 WHERE email = $3",
 		subscribed, time.Now(), email,
 	)
@@ -31,8 +41,11 @@ func (db *DB) UpdateNewsletterSubscription(email string, subscribed bool) error
 }
 
 // GetAllNewsletterSubscriptions returns all newsletter subscriptions from the database
-func (db *DB) GetAllNewsletterSubscriptions() ([]models.NewsletterSubscription, error) {
-	rows, err := db.Query(
+func (db *DB) GetAllNewsletterSubscriptions(ctx context.Context) ([]models.NewsletterSubscription, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx,
 		"SELECT id, email, subscribed, created_at, updated_at FROM newsletter_subscriptions ORDER BY created_at DESC",
 	)
 	if err != nil {
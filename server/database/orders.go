@@ -1,62 +1,89 @@
 package database
 
 import (
+	"context"
 	"saas-server/models"
 	"time"
 )
 
+// orderColumns lists the columns scanned by scanOrder, in order
+const orderColumns = `
+		id, order_id, user_id, customer_id, status,
+		refunded_at, product_id, variant_id, COALESCE(currency, ''), subtotal,
+		discount_total, tax, total, refunded_amount, tax_name,
+		subtotal_formatted, tax_formatted, total_formatted, tax_inclusive,
+		COALESCE(refunded_amount_formatted, ''), billing_name, billing_email,
+		receipt_url, created_at, updated_at`
+
 // CreateOrder creates a new order record in the database
-func (db *DB) CreateOrder(userID string, orderID int, customerID int, productID int, variantID int, status string, subtotalFormatted string, taxFormatted string, totalFormatted string, taxInclusive bool) error {
+func (db *DB) CreateOrder(ctx context.Context, order *models.Orders) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO orders (
-			user_id, order_id, customer_id, product_id, variant_id, 
-			status, subtotal_formatted, tax_formatted, total_formatted,
-			tax_inclusive, created_at, updated_at
+			user_id, order_id, customer_id, product_id, variant_id,
+			status, currency, subtotal, discount_total, tax, total, tax_name,
+			subtotal_formatted, tax_formatted, total_formatted, tax_inclusive,
+			billing_name, billing_email, receipt_url, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+		        $17, $18, $19, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id, created_at, updated_at`
 
-	_, err := db.Exec(query, userID, orderID, customerID, productID, variantID,
-		status, subtotalFormatted, taxFormatted, totalFormatted, taxInclusive)
-	return err
+	return db.QueryRowContext(ctx, query, order.UserID, order.OrderID, order.CustomerID,
+		order.ProductID, order.VariantID, order.Status, order.Currency, order.Subtotal,
+		order.DiscountTotal, order.Tax, order.Total, order.TaxName, order.SubtotalFormatted,
+		order.TaxFormatted, order.TotalFormatted, order.TaxInclusive, order.BillingName,
+		order.BillingEmail, order.ReceiptURL,
+	).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
 }
 
 // UpdateOrderStatus updates the status and refund information of an order
-func (db *DB) UpdateOrderStatus(orderID int, status string, refunded bool, refundedAt *time.Time) error {
+func (db *DB) UpdateOrderStatus(ctx context.Context, orderID int, status string, refunded bool, refundedAt *time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE orders 
 		SET status = $1, refunded_at = $2, updated_at = NOW()
 		WHERE order_id = $3`
 
-	_, err := db.Exec(query, status, refundedAt, orderID)
+	_, err := db.ExecContext(ctx, query, status, refundedAt, orderID)
 	return err
 }
 
-// UpdateOrderRefund updates the order's refund status and related information
-func (db *DB) UpdateOrderRefund(orderID int, refundedAt *time.Time, refundedAmountFormatted string) error {
+// UpdateOrderRefund updates the order's refund status and related information.
+// refundedAmount is in the smallest unit of the order's currency.
+func (db *DB) UpdateOrderRefund(ctx context.Context, orderID int, refundedAt *time.Time, refundedAmount int, refundedAmountFormatted string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE orders
 		SET status = 'refunded', 
 		    refunded_at = $1,
-		    refunded_amount_formatted = $2,
+		    refunded_amount = $2,
+		    refunded_amount_formatted = $3,
 		    updated_at = CURRENT_TIMESTAMP
-		WHERE order_id = $3`
+		WHERE order_id = $4`
 
-	_, err := db.Exec(query, refundedAt, refundedAmountFormatted, orderID)
+	_, err := db.ExecContext(ctx, query, refundedAt, refundedAmount, refundedAmountFormatted, orderID)
 	return err
 }
 
 // GetUserOrders retrieves all orders for a given user
-func (db *DB) GetUserOrders(userID string) ([]models.Orders, error) {
+func (db *DB) GetUserOrders(ctx context.Context, userID string) ([]models.Orders, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, order_id, user_id, customer_id, status,
-		       refunded_at, product_id, variant_id, subtotal_formatted,
-		       tax_formatted, total_formatted, tax_inclusive, refunded_amount_formatted,
-		       created_at, updated_at
+		SELECT` + orderColumns + `
 		FROM orders
 		WHERE user_id = $1
 		ORDER BY created_at DESC`
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -64,29 +91,74 @@ func (db *DB) GetUserOrders(userID string) ([]models.Orders, error) {
 
 	var orders []models.Orders
 	for rows.Next() {
-		var order models.Orders
-		err := rows.Scan(
-			&order.ID,
-			&order.OrderID,
-			&order.UserID,
-			&order.CustomerID,
-			&order.Status,
-			&order.RefundedAt,
-			&order.ProductID,
-			&order.VariantID,
-			&order.SubtotalFormatted,
-			&order.TaxFormatted,
-			&order.TotalFormatted,
-			&order.TaxInclusive,
-			&order.RefundedAmountFormatted,
-			&order.CreatedAt,
-			&order.UpdatedAt,
-		)
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, err
 		}
-		orders = append(orders, order)
+		orders = append(orders, *order)
 	}
 
 	return orders, rows.Err()
 }
+
+// GetUserOrder retrieves one of a user's orders by its order number.
+// It returns sql.ErrNoRows if the order does not exist or belongs to someone else.
+func (db *DB) GetUserOrder(ctx context.Context, userID string, orderID int) (*models.Orders, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + orderColumns + `
+		FROM orders
+		WHERE user_id = $1 AND order_id = $2`
+
+	return scanOrder(db.QueryRowContext(ctx, query, userID, orderID))
+}
+
+// GetOrder retrieves an order by its Lemon Squeezy order ID, whoever it belongs to
+func (db *DB) GetOrder(ctx context.Context, orderID int) (*models.Orders, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + orderColumns + `
+		FROM orders
+		WHERE order_id = $1`
+
+	return scanOrder(db.QueryRowContext(ctx, query, orderID))
+}
+
+func scanOrder(row rowScanner) (*models.Orders, error) {
+	var order models.Orders
+	err := row.Scan(
+		&order.ID,
+		&order.OrderID,
+		&order.UserID,
+		&order.CustomerID,
+		&order.Status,
+		&order.RefundedAt,
+		&order.ProductID,
+		&order.VariantID,
+		&order.Currency,
+		&order.Subtotal,
+		&order.DiscountTotal,
+		&order.Tax,
+		&order.Total,
+		&order.RefundedAmount,
+		&order.TaxName,
+		&order.SubtotalFormatted,
+		&order.TaxFormatted,
+		&order.TotalFormatted,
+		&order.TaxInclusive,
+		&order.RefundedAmountFormatted,
+		&order.BillingName,
+		&order.BillingEmail,
+		&order.ReceiptURL,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
@@ -1,37 +1,225 @@
 package database
 
 import (
+	"context"
 	"time"
 
 	"saas-server/pkg/analytics"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-// TrackPageView stores a page view event in the database
-func (db *DB) TrackPageView(view *analytics.PageView) error {
+// pageViewColumns lists the columns scanned by scanPageView, in order
+const pageViewColumns = `
+		id, user_id, COALESCE(visitor_id, ''), COALESCE(session_id, ''), path,
+		COALESCE(referrer, ''), COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at,
+		COALESCE(utm_source, ''), COALESCE(utm_medium, ''), COALESCE(utm_campaign, ''),
+		COALESCE(utm_term, ''), COALESCE(utm_content, ''), COALESCE(source, ''),
+		COALESCE(channel, ''), COALESCE(browser, ''), COALESCE(os, ''),
+		COALESCE(device_type, ''), COALESCE(country, '')`
+
+// TrackPageView stores a page view event in the database. The view joins the
+// visitor's current session if their previous view was less than
+// analytics.SessionTimeout ago; otherwise view.SessionID starts a new one.
+// view.SessionID is set to the session the view was recorded in.
+func (db *DB) TrackPageView(ctx context.Context, view *analytics.PageView) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		INSERT INTO page_views (user_id, visitor_id, path, referrer, user_agent, ip_address, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO page_views (
+			user_id, visitor_id, session_id, path, referrer, user_agent, ip_address, created_at,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+			source, channel, browser, os, device_type, country
+		)
+		VALUES ($1, $2, COALESCE((
+			SELECT session_id
+			FROM page_views
+			WHERE (visitor_id = $2 OR user_id = $1)
+			  AND session_id IS NOT NULL
+			  AND created_at > $9 AND created_at <= $8
+			ORDER BY created_at DESC
+			LIMIT 1
+		), $3), $4, $5, $6, NULLIF($7, ''), $8,
+			NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''),
+			NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), NULLIF($20, ''))
+		RETURNING id, session_id
 	`
-	_, err := db.Exec(query,
-		view.UserID, view.VisitorID, view.Path,
+	return db.QueryRowContext(ctx, query,
+		view.UserID, view.VisitorID, view.SessionID, view.Path,
 		view.Referrer, view.UserAgent, view.IPAddress,
-		view.CreatedAt,
-	)
-	return err
+		view.CreatedAt, view.CreatedAt.Add(-analytics.SessionTimeout),
+		view.UTM.Source, view.UTM.Medium, view.UTM.Campaign, view.UTM.Term, view.UTM.Content,
+		view.Source, view.Channel, view.Browser, view.OS, view.DeviceType, view.Country,
+	).Scan(&view.ID, &view.SessionID)
+}
+
+// pageViewBatchColumns are the columns of the page_view_batch staging table loaded by COPY
+var pageViewBatchColumns = []string{
+	"seq", "user_id", "visitor_id", "session_id", "path", "referrer", "user_agent", "ip_address", "created_at",
+	"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content",
+	"source", "channel", "browser", "os", "device_type", "country",
+}
+
+// TrackPageViews stores a batch of page views, loading them with COPY. Sessions
+// are assigned as TrackPageView would assign them one view at a time: within the
+// batch first, then by continuing each visitor's session from before the batch.
+func (db *DB) TrackPageViews(ctx context.Context, views []*analytics.PageView) error {
+	if len(views) == 0 {
+		return nil
+	}
+	analytics.AssignSessions(views)
+
+	rows := make([][]interface{}, len(views))
+	for i, v := range views {
+		rows[i] = []interface{}{
+			i, v.UserID, v.VisitorID, v.SessionID, v.Path, v.Referrer, v.UserAgent, v.IPAddress, v.CreatedAt,
+			v.UTM.Source, v.UTM.Medium, v.UTM.Campaign, v.UTM.Term, v.UTM.Content,
+			v.Source, v.Channel, v.Browser, v.OS, v.DeviceType, v.Country,
+		}
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return db.inTx(ctx, func(tx *DB) error {
+		_, err := tx.ExecContext(ctx, `
+			CREATE TEMP TABLE page_view_batch (
+				seq INTEGER, user_id UUID, visitor_id TEXT, session_id TEXT, path TEXT,
+				referrer TEXT, user_agent TEXT, ip_address TEXT, created_at TIMESTAMP WITH TIME ZONE,
+				utm_source TEXT, utm_medium TEXT, utm_campaign TEXT, utm_term TEXT, utm_content TEXT,
+				source TEXT, channel TEXT, browser TEXT, os TEXT, device_type TEXT, country TEXT
+			) ON COMMIT DROP
+		`)
+		if err != nil {
+			return err
+		}
+		if err := tx.copyIn(ctx, "page_view_batch", pageViewBatchColumns, rows); err != nil {
+			return err
+		}
+
+		// A session that starts in the batch continues the visitor's previous session
+		// if their last view before it was less than SessionTimeout earlier
+		_, err = tx.ExecContext(ctx, `
+			UPDATE page_view_batch b
+			SET session_id = continued.previous
+			FROM (
+				SELECT starts.session_id, (
+					SELECT p.session_id
+					FROM page_views p
+					WHERE (p.visitor_id = starts.visitor_id OR p.user_id = starts.user_id)
+					  AND p.session_id IS NOT NULL
+					  AND p.created_at > starts.created_at - $1::double precision * INTERVAL '1 second'
+					  AND p.created_at <= starts.created_at
+					ORDER BY p.created_at DESC
+					LIMIT 1
+				) as previous
+				FROM (
+					SELECT DISTINCT ON (session_id) session_id, visitor_id, user_id, created_at
+					FROM page_view_batch
+					ORDER BY session_id, created_at
+				) starts
+			) continued
+			WHERE b.session_id = continued.session_id AND continued.previous IS NOT NULL
+		`, analytics.SessionTimeout.Seconds())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO page_views (
+				user_id, visitor_id, session_id, path, referrer, user_agent, ip_address, created_at,
+				utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+				source, channel, browser, os, device_type, country
+			)
+			SELECT user_id, visitor_id, session_id, path, referrer, user_agent, NULLIF(ip_address, ''), created_at,
+			       NULLIF(utm_source, ''), NULLIF(utm_medium, ''), NULLIF(utm_campaign, ''),
+			       NULLIF(utm_term, ''), NULLIF(utm_content, ''), NULLIF(source, ''), NULLIF(channel, ''),
+			       NULLIF(browser, ''), NULLIF(os, ''), NULLIF(device_type, ''), NULLIF(country, '')
+			FROM page_view_batch
+			ORDER BY seq
+		`)
+		return err
+	})
+}
+
+// StitchVisitor attributes a visitor's anonymous page views and events to the user
+// they signed in as, so their journey before and after signing in reads as one.
+// It returns the number of page views and events updated.
+func (db *DB) StitchVisitor(ctx context.Context, visitorID string, userID uuid.UUID) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var stitched int64
+	err := db.inTx(ctx, func(tx *DB) error {
+		for _, query := range []string{
+			`UPDATE page_views SET user_id = $1 WHERE visitor_id = $2 AND user_id IS NULL`,
+			`UPDATE events SET user_id = $1 WHERE visitor_id = $2 AND user_id IS NULL`,
+		} {
+			result, err := tx.ExecContext(ctx, query, userID, visitorID)
+			if err != nil {
+				return err
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			stitched += rows
+		}
+		return nil
+	})
+	return stitched, err
+}
+
+// GetOrCreateAnalyticsSalt stores candidate as the visitor ID salt of day unless
+// another instance got there first, and returns the salt in use
+func (db *DB) GetOrCreateAnalyticsSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		WITH inserted AS (
+			INSERT INTO analytics_salts (day, salt)
+			VALUES ($1, $2)
+			ON CONFLICT (day) DO NOTHING
+			RETURNING salt
+		)
+		SELECT salt FROM inserted
+		UNION ALL
+		SELECT salt FROM analytics_salts WHERE day = $1
+		LIMIT 1
+	`
+	var salt []byte
+	err := db.QueryRowContext(ctx, query, day, candidate).Scan(&salt)
+	return salt, err
+}
+
+// DeleteAnalyticsSaltsBefore removes the salts of days before day
+func (db *DB) DeleteAnalyticsSaltsBefore(ctx context.Context, day time.Time) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM analytics_salts WHERE day < $1", day)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 // GetUserJourney retrieves the page view history for a specific user within a time range
-func (db *DB) GetUserJourney(userID uuid.UUID, startTime, endTime time.Time) ([]analytics.PageView, error) {
+func (db *DB) GetUserJourney(ctx context.Context, userID uuid.UUID, startTime, endTime time.Time) ([]analytics.PageView, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, user_id, visitor_id, path, referrer, user_agent, ip_address, created_at
+		SELECT` + pageViewColumns + `
 		FROM page_views
 		WHERE user_id = $1 AND created_at BETWEEN $2 AND $3
 		ORDER BY created_at ASC
 	`
 
-	rows, err := db.Query(query, userID, startTime, endTime)
+	rows, err := db.QueryContext(ctx, query, userID, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -39,31 +227,29 @@ func (db *DB) GetUserJourney(userID uuid.UUID, startTime, endTime time.Time) ([]
 
 	var pageViews []analytics.PageView
 	for rows.Next() {
-		var view analytics.PageView
-		err := rows.Scan(
-			&view.ID, &view.UserID, &view.VisitorID,
-			&view.Path, &view.Referrer, &view.UserAgent,
-			&view.IPAddress, &view.CreatedAt,
-		)
+		view, err := scanPageView(rows)
 		if err != nil {
 			return nil, err
 		}
-		pageViews = append(pageViews, view)
+		pageViews = append(pageViews, *view)
 	}
 
 	return pageViews, nil
 }
 
 // GetVisitorJourneys retrieves all visitor page views within a time range
-func (db *DB) GetVisitorJourneys(startTime, endTime time.Time) ([]analytics.PageView, error) {
+func (db *DB) GetVisitorJourneys(ctx context.Context, startTime, endTime time.Time) ([]analytics.PageView, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, user_id, visitor_id, path, referrer, user_agent, ip_address, created_at
+		SELECT` + pageViewColumns + `
 		FROM page_views
 		WHERE created_at BETWEEN $1 AND $2
-		ORDER BY visitor_id, created_at ASC
+		ORDER BY COALESCE(user_id::text, visitor_id), created_at ASC
 	`
 
-	rows, err := db.Query(query, startTime, endTime)
+	rows, err := db.QueryContext(ctx, query, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -71,33 +257,47 @@ func (db *DB) GetVisitorJourneys(startTime, endTime time.Time) ([]analytics.Page
 
 	var pageViews []analytics.PageView
 	for rows.Next() {
-		var view analytics.PageView
-		err := rows.Scan(
-			&view.ID, &view.UserID, &view.VisitorID,
-			&view.Path, &view.Referrer, &view.UserAgent,
-			&view.IPAddress, &view.CreatedAt,
-		)
+		view, err := scanPageView(rows)
 		if err != nil {
 			return nil, err
 		}
-		pageViews = append(pageViews, view)
+		pageViews = append(pageViews, *view)
 	}
 
 	return pageViews, nil
 }
 
-// GetPageViewStats retrieves aggregated page view statistics within a time range
-func (db *DB) GetPageViewStats(startTime, endTime time.Time) (*analytics.PageViewResponse, error) {
+// rawOutsideWindow matches the page views within [$1, $2] that fall outside the
+// rollup window [$3, $4), as two ranges so that the created_at index is used
+const rawOutsideWindow = `((created_at >= $1 AND created_at < $3) OR (created_at >= $4 AND created_at <= $2))`
+
+// GetPageViewStats retrieves aggregated page view statistics within a time range.
+// Whole hours and days that have been rolled up are read from the rollup tables;
+// only the rest of the range is read from page_views.
+func (db *DB) GetPageViewStats(ctx context.Context, startTime, endTime time.Time) (*analytics.PageViewResponse, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	watermarks, err := db.GetRollupWatermarks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hourly := analytics.NewRollupWindow(startTime, endTime, time.Hour, watermarks[analytics.RollupHourly])
+	daily := analytics.NewRollupWindow(startTime, endTime, 24*time.Hour, watermarks[analytics.RollupDaily])
+
 	// Get page stats
 	pageStatsQuery := `
-		SELECT path, COUNT(*) as view_count
-		FROM page_views
-		WHERE created_at BETWEEN $1 AND $2
+		SELECT path, SUM(views) as view_count
+		FROM (
+			SELECT path, views FROM page_view_rollups_hourly WHERE hour >= $3 AND hour < $4
+			UNION ALL
+			SELECT path, COUNT(*) FROM page_views WHERE ` + rawOutsideWindow + ` GROUP BY path
+		) v
 		GROUP BY path
 		ORDER BY view_count DESC
 	`
 
-	pageStatsRows, err := db.Query(pageStatsQuery, startTime, endTime)
+	pageStatsRows, err := db.QueryContext(ctx, pageStatsQuery, startTime, endTime, hourly.From, hourly.To)
 	if err != nil {
 		return nil, err
 	}
@@ -115,14 +315,17 @@ func (db *DB) GetPageViewStats(startTime, endTime time.Time) (*analytics.PageVie
 
 	// Get daily stats
 	dailyStatsQuery := `
-		SELECT DATE(created_at) as date, COUNT(*) as views
-		FROM page_views
-		WHERE created_at BETWEEN $1 AND $2
-		GROUP BY DATE(created_at)
+		SELECT date, SUM(views) as views
+		FROM (
+			SELECT DATE(hour) as date, views FROM page_view_rollups_hourly WHERE hour >= $3 AND hour < $4
+			UNION ALL
+			SELECT DATE(created_at), 1 FROM page_views WHERE ` + rawOutsideWindow + `
+		) v
+		GROUP BY date
 		ORDER BY date ASC
 	`
 
-	dailyStatsRows, err := db.Query(dailyStatsQuery, startTime, endTime)
+	dailyStatsRows, err := db.QueryContext(ctx, dailyStatsQuery, startTime, endTime, hourly.From, hourly.To)
 	if err != nil {
 		return nil, err
 	}
@@ -140,16 +343,19 @@ func (db *DB) GetPageViewStats(startTime, endTime time.Time) (*analytics.PageVie
 
 	// Get referrer stats
 	referrerStatsQuery := `
-		SELECT 
-			COALESCE(referrer, 'direct') as referrer,
-			COUNT(*) as count
-		FROM page_views
-		WHERE created_at BETWEEN $1 AND $2
-		GROUP BY COALESCE(referrer, 'direct')
+		SELECT referrer, SUM(views) as count
+		FROM (
+			SELECT referrer, views FROM page_view_rollups_hourly WHERE hour >= $3 AND hour < $4
+			UNION ALL
+			SELECT COALESCE(referrer, 'direct'), COUNT(*) FROM page_views
+			WHERE ` + rawOutsideWindow + `
+			GROUP BY COALESCE(referrer, 'direct')
+		) v
+		GROUP BY referrer
 		ORDER BY count DESC
 	`
 
-	referrerStatsRows, err := db.Query(referrerStatsQuery, startTime, endTime)
+	referrerStatsRows, err := db.QueryContext(ctx, referrerStatsQuery, startTime, endTime, hourly.From, hourly.To)
 	if err != nil {
 		return nil, err
 	}
@@ -167,15 +373,74 @@ func (db *DB) GetPageViewStats(startTime, endTime time.Time) (*analytics.PageVie
 
 	// Get total views and unique paths
 	totalsQuery := `
-		SELECT 
-			COUNT(*) as total_views,
+		SELECT
+			COALESCE(SUM(views), 0) as total_views,
 			COUNT(DISTINCT path) as unique_paths
-		FROM page_views
-		WHERE created_at BETWEEN $1 AND $2
+		FROM (
+			SELECT path, views FROM page_view_rollups_hourly WHERE hour >= $3 AND hour < $4
+			UNION ALL
+			SELECT path, 1 FROM page_views WHERE ` + rawOutsideWindow + `
+		) v
 	`
 
 	var totalViews, uniquePaths int
-	err = db.QueryRow(totalsQuery, startTime, endTime).Scan(&totalViews, &uniquePaths)
+	err = db.QueryRowContext(ctx, totalsQuery, startTime, endTime, hourly.From, hourly.To).Scan(&totalViews, &uniquePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get session stats; a session with a single page view is a bounce. Visitors
+	// are counted per day in the rollups, so a visitor seen on several rolled up
+	// days counts once for each.
+	sessionsQuery := `
+		SELECT
+			COALESCE(SUM(visitors), 0)::bigint,
+			COALESCE(SUM(sessions), 0)::bigint,
+			COALESCE(SUM(session_views), 0)::bigint,
+			COALESCE(SUM(duration_seconds), 0)::double precision,
+			COALESCE(SUM(bounces), 0)::bigint
+		FROM (
+			SELECT visitors, sessions, session_views, duration_seconds, bounces
+			FROM page_view_session_rollups
+			WHERE day >= $3 AND day < $4
+			UNION ALL
+			SELECT
+				COUNT(DISTINCT COALESCE(user_id, visitor_id)),
+				COUNT(*),
+				COALESCE(SUM(views), 0),
+				COALESCE(SUM(EXTRACT(EPOCH FROM last_view - first_view)), 0),
+				COUNT(*) FILTER (WHERE views = 1)
+			FROM (
+				SELECT session_id, MAX(user_id::text) as user_id, MAX(visitor_id) as visitor_id,
+				       COUNT(*) as views, MIN(created_at) as first_view, MAX(created_at) as last_view
+				FROM page_views
+				WHERE ` + rawOutsideWindow + ` AND session_id IS NOT NULL
+				GROUP BY session_id
+			) sessions
+		) s
+	`
+
+	var sessions analytics.SessionStats
+	var sessionViews, bounces int
+	var duration float64
+	err = db.QueryRowContext(ctx, sessionsQuery, startTime, endTime, daily.From, daily.To).Scan(
+		&sessions.UniqueVisitors, &sessions.Sessions, &sessionViews, &duration, &bounces,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if sessions.Sessions > 0 {
+		sessions.PagesPerSession = float64(sessionViews) / float64(sessions.Sessions)
+		sessions.AvgDurationSecs = duration / float64(sessions.Sessions)
+		sessions.BounceRate = float64(bounces) / float64(sessions.Sessions)
+	}
+
+	breakdowns, err := db.getBreakdowns(ctx, startTime, endTime, daily)
+	if err != nil {
+		return nil, err
+	}
+
+	attribution, err := db.getAttribution(ctx, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
@@ -186,5 +451,139 @@ func (db *DB) GetPageViewStats(startTime, endTime time.Time) (*analytics.PageVie
 		ReferrerStats: referrerStats,
 		TotalViews:    totalViews,
 		UniquePaths:   uniquePaths,
+		Sessions:      sessions,
+		Breakdowns:    *breakdowns,
+		Attribution:   attribution,
 	}, nil
 }
+
+// getBreakdowns counts views and visitors by each reporting dimension, reading the
+// days within window from the daily rollup
+func (db *DB) getBreakdowns(ctx context.Context, startTime, endTime time.Time, window analytics.RollupWindow) (*analytics.Breakdowns, error) {
+	var b analytics.Breakdowns
+	dimensions := []struct {
+		column string
+		stats  *[]analytics.DimensionStats
+	}{
+		{"channel", &b.Channels},
+		{"source", &b.Sources},
+		{"utm_campaign", &b.Campaigns},
+		{"browser", &b.Browsers},
+		{"os", &b.OperatingSystems},
+		{"device_type", &b.Devices},
+		{"country", &b.Countries},
+	}
+
+	for _, d := range dimensions {
+		// The column comes from the fixed list above, never from the request. It
+		// doubles as the dimension name in the daily rollup.
+		query := `
+			SELECT value, SUM(views) as views, SUM(visitors) as visitors
+			FROM (
+				SELECT value, views, visitors
+				FROM page_view_rollups_daily
+				WHERE dimension = $5 AND day >= $3 AND day < $4
+				UNION ALL
+				SELECT COALESCE(` + d.column + `, ''), COUNT(*), COUNT(DISTINCT COALESCE(user_id::text, visitor_id))
+				FROM page_views
+				WHERE ` + rawOutsideWindow + `
+				GROUP BY 1
+			) v
+			GROUP BY value
+			ORDER BY views DESC, value
+			LIMIT $6
+		`
+		rows, err := db.QueryContext(ctx, query, startTime, endTime, window.From, window.To, d.column, analytics.BreakdownLimit)
+		if err != nil {
+			return nil, err
+		}
+		*d.stats = []analytics.DimensionStats{}
+		for rows.Next() {
+			var stat analytics.DimensionStats
+			if err := rows.Scan(&stat.Value, &stat.Views, &stat.Visitors); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			*d.stats = append(*d.stats, stat)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &b, nil
+}
+
+// getAttribution credits the signups and purchases within the range to the visits
+// of the converting user that preceded them, under the first- and last-touch models
+func (db *DB) getAttribution(ctx context.Context, startTime, endTime time.Time) ([]analytics.AttributionStats, error) {
+	query := `
+		WITH conversions AS (
+			SELECT e.name,
+			       ft.channel as first_channel, ft.source as first_source, ft.utm_campaign as first_campaign,
+			       lt.channel as last_channel, lt.source as last_source, lt.utm_campaign as last_campaign
+			FROM events e
+			LEFT JOIN LATERAL (
+				SELECT channel, source, utm_campaign
+				FROM page_views p
+				WHERE p.user_id = e.user_id
+				  AND p.created_at <= e.created_at AND p.created_at > e.created_at - $4::double precision * INTERVAL '1 second'
+				ORDER BY p.created_at ASC
+				LIMIT 1
+			) ft ON true
+			LEFT JOIN LATERAL (
+				SELECT channel, source, utm_campaign
+				FROM page_views p
+				WHERE p.user_id = e.user_id
+				  AND p.created_at <= e.created_at AND p.created_at > e.created_at - $4::double precision * INTERVAL '1 second'
+				ORDER BY (COALESCE(p.channel, $5) <> $5) DESC, p.created_at DESC
+				LIMIT 1
+			) lt ON true
+			WHERE e.name = ANY($3) AND e.user_id IS NOT NULL
+			  AND e.created_at BETWEEN $1 AND $2
+		)
+		SELECT name, $6::text, COALESCE(first_channel, $5), COALESCE(first_source, ''), COALESCE(first_campaign, ''), COUNT(*)
+		FROM conversions
+		GROUP BY 1, 2, 3, 4, 5
+		UNION ALL
+		SELECT name, $7::text, COALESCE(last_channel, $5), COALESCE(last_source, ''), COALESCE(last_campaign, ''), COUNT(*)
+		FROM conversions
+		GROUP BY 1, 2, 3, 4, 5
+		ORDER BY 1, 2, 6 DESC, 3
+	`
+
+	rows, err := db.QueryContext(ctx, query, startTime, endTime, pq.Array(analytics.AttributionConversions),
+		analytics.AttributionLookback.Seconds(), analytics.ChannelDirect,
+		analytics.AttributionFirstTouch, analytics.AttributionLastTouch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []analytics.AttributionStats{}
+	for rows.Next() {
+		var stat analytics.AttributionStats
+		if err := rows.Scan(&stat.Conversion, &stat.Model, &stat.Channel, &stat.Source, &stat.Campaign, &stat.Conversions); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+func scanPageView(row rowScanner) (*analytics.PageView, error) {
+	var view analytics.PageView
+	err := row.Scan(
+		&view.ID, &view.UserID, &view.VisitorID, &view.SessionID, &view.Path,
+		&view.Referrer, &view.UserAgent, &view.IPAddress, &view.CreatedAt,
+		&view.UTM.Source, &view.UTM.Medium, &view.UTM.Campaign,
+		&view.UTM.Term, &view.UTM.Content, &view.Source,
+		&view.Channel, &view.Browser, &view.OS,
+		&view.DeviceType, &view.Country,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"saas-server/models"
+	"time"
+)
+
+// RecordSubscriptionEvent appends a subscription's new state to its history. It
+// returns false without recording anything when the state matches the latest event,
+// as happens when a webhook is redelivered.
+func (db *DB) RecordSubscriptionEvent(ctx context.Context, e *models.SubscriptionEvent) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO subscription_events (
+			subscription_id, user_id, event, status, product_id, variant_id, mrr, occurred_at
+		)
+		SELECT $1::integer, $2::uuid, $3::varchar, $4::varchar, $5::integer, $6::integer, $7::integer, $8::timestamptz
+		WHERE NOT EXISTS (
+			SELECT 1
+			FROM (
+				SELECT status, variant_id, mrr
+				FROM subscription_events
+				WHERE subscription_id = $1
+				ORDER BY occurred_at DESC, id DESC
+				LIMIT 1
+			) latest
+			WHERE latest.status = $4 AND latest.variant_id = $6 AND latest.mrr = $7
+		)
+		RETURNING id`
+
+	err := db.QueryRowContext(ctx, query, e.SubscriptionID, e.UserID, e.Event, e.Status,
+		e.ProductID, e.VariantID, e.MRR, e.OccurredAt).Scan(&e.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetSubscriptionEvents returns the subscription history before the given time, oldest first
+func (db *DB) GetSubscriptionEvents(ctx context.Context, before time.Time) ([]models.SubscriptionEvent, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, subscription_id, user_id, event, status, product_id, variant_id, mrr, occurred_at
+		FROM subscription_events
+		WHERE occurred_at < $1
+		ORDER BY occurred_at, id`
+
+	rows, err := db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.SubscriptionEvent
+	for rows.Next() {
+		var e models.SubscriptionEvent
+		if err := rows.Scan(&e.ID, &e.SubscriptionID, &e.UserID, &e.Event, &e.Status,
+			&e.ProductID, &e.VariantID, &e.MRR, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetPayments returns the money collected in [from, to), net of refunds. Orders cover
+// one-off purchases and the first charge of each subscription; subscription invoices
+// add the later charges. Orders recorded before amounts were stored have no currency
+// and are left out.
+func (db *DB) GetPayments(ctx context.Context, from, to time.Time) ([]models.Payment, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT user_id, product_id, variant_id, total - refunded_amount, currency, created_at
+		FROM orders
+		WHERE status IN ('paid', 'refunded', 'partial_refund')
+		  AND currency IS NOT NULL
+		  AND created_at >= $1 AND created_at < $2
+		UNION ALL
+		SELECT i.user_id::text, s.product_id, s.variant_id, i.total - i.refunded_amount, i.currency, i.created_at
+		FROM subscription_invoices i
+		JOIN subscriptions s ON s.subscription_id = i.subscription_id
+		WHERE i.billing_reason <> 'initial'
+		  AND i.status IN ('paid', 'refunded', 'partial_refund')
+		  AND i.created_at >= $1 AND i.created_at < $2
+		ORDER BY 6`
+
+	rows, err := db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		var p models.Payment
+		if err := rows.Scan(&p.UserID, &p.ProductID, &p.VariantID, &p.Amount, &p.Currency, &p.PaidAt); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
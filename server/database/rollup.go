@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"saas-server/pkg/analytics"
+)
+
+// rollupTable is a table maintained by a rollup. insert aggregates the page views
+// in [$1, $2) into buckets of $3 seconds, aligned to the Unix epoch so that daily
+// buckets start at midnight UTC whatever the database time zone.
+type rollupTable struct {
+	name   string
+	bucket string
+	insert string
+}
+
+// rollupTables lists the tables each rollup rebuilds
+var rollupTables = map[string][]rollupTable{
+	analytics.RollupHourly: {{
+		name:   "page_view_rollups_hourly",
+		bucket: "hour",
+		insert: `
+			INSERT INTO page_view_rollups_hourly (hour, path, referrer, views)
+			SELECT to_timestamp(floor(extract(epoch FROM created_at) / $3::double precision) * $3::double precision),
+			       path, COALESCE(referrer, 'direct'), COUNT(*)
+			FROM page_views
+			WHERE created_at >= $1 AND created_at < $2
+			GROUP BY 1, 2, 3
+		`,
+	}},
+	analytics.RollupDaily: {{
+		name:   "page_view_rollups_daily",
+		bucket: "day",
+		insert: `
+			INSERT INTO page_view_rollups_daily (day, dimension, value, views, visitors)
+			SELECT to_timestamp(floor(extract(epoch FROM p.created_at) / $3::double precision) * $3::double precision),
+			       d.dimension, COALESCE(d.value, ''), COUNT(*),
+			       COUNT(DISTINCT COALESCE(p.user_id::text, p.visitor_id))
+			FROM page_views p
+			CROSS JOIN LATERAL (VALUES
+				('channel', p.channel), ('source', p.source), ('utm_campaign', p.utm_campaign),
+				('browser', p.browser), ('os', p.os), ('device_type', p.device_type), ('country', p.country)
+			) AS d(dimension, value)
+			WHERE p.created_at >= $1 AND p.created_at < $2
+			GROUP BY 1, 2, 3
+		`,
+	}, {
+		name:   "page_view_session_rollups",
+		bucket: "day",
+		insert: `
+			INSERT INTO page_view_session_rollups (day, visitors, sessions, session_views, duration_seconds, bounces)
+			SELECT day, COUNT(DISTINCT visitor), COUNT(*), SUM(views),
+			       SUM(EXTRACT(EPOCH FROM last_view - first_view)), COUNT(*) FILTER (WHERE views = 1)
+			FROM (
+				SELECT to_timestamp(floor(extract(epoch FROM created_at) / $3::double precision) * $3::double precision) as day,
+				       session_id, MAX(COALESCE(user_id::text, visitor_id)) as visitor, COUNT(*) as views,
+				       MIN(created_at) as first_view, MAX(created_at) as last_view
+				FROM page_views
+				WHERE created_at >= $1 AND created_at < $2 AND session_id IS NOT NULL
+				GROUP BY 1, 2
+			) sessions
+			GROUP BY day
+		`,
+	}},
+}
+
+// RollUpPageViews rebuilds a rollup for the page views in [from, to), which must be
+// aligned to the rollup's period, and records that it is complete up to to
+func (db *DB) RollUpPageViews(ctx context.Context, rollup string, from, to time.Time) error {
+	tables, ok := rollupTables[rollup]
+	if !ok {
+		return fmt.Errorf("unknown rollup %q", rollup)
+	}
+	period := analytics.RollupPeriods[rollup].Seconds()
+
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	return db.inTx(ctx, func(tx *DB) error {
+		for _, t := range tables {
+			// Table and column names come from the fixed list above
+			reset := "DELETE FROM " + t.name + " WHERE " + t.bucket + " >= $1 AND " + t.bucket + " < $2"
+			if _, err := tx.ExecContext(ctx, reset, from, to); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, t.insert, from, to, period); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO page_view_rollup_state (rollup, rolled_up_to, updated_at)
+			VALUES ($1, $2, CURRENT_TIMESTAMP)
+			ON CONFLICT (rollup) DO UPDATE SET rolled_up_to = EXCLUDED.rolled_up_to, updated_at = EXCLUDED.updated_at
+		`, rollup, to)
+		return err
+	})
+}
+
+// GetRollupWatermarks returns how far each rollup is complete. Rollups that have
+// never run are missing from the map.
+func (db *DB) GetRollupWatermarks(ctx context.Context) (map[string]time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT rollup, rolled_up_to FROM page_view_rollup_state")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watermarks := make(map[string]time.Time)
+	for rows.Next() {
+		var rollup string
+		var rolledUpTo time.Time
+		if err := rows.Scan(&rollup, &rolledUpTo); err != nil {
+			return nil, err
+		}
+		watermarks[rollup] = rolledUpTo
+	}
+	return watermarks, rows.Err()
+}
+
+// GetOldestPageView returns when the oldest stored page view was made, or the zero
+// time if there are none
+func (db *DB) GetOldestPageView(ctx context.Context) (time.Time, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var oldest sql.NullTime
+	if err := db.QueryRowContext(ctx, "SELECT MIN(created_at) FROM page_views").Scan(&oldest); err != nil {
+		return time.Time{}, err
+	}
+	return oldest.Time, nil
+}
+
+// PurgePageViews removes up to limit of the oldest page views made before before,
+// moving them to page_views_archive if archive is set. It returns the number removed.
+func (db *DB) PurgePageViews(ctx context.Context, before time.Time, archive bool, limit int) (int64, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	purge := `
+		DELETE FROM page_views
+		WHERE id IN (
+			SELECT id FROM page_views
+			WHERE created_at < $1
+			ORDER BY created_at
+			LIMIT $2
+		)
+	`
+	query := purge
+	if archive {
+		query = `
+			WITH purged AS (` + purge + ` RETURNING *)
+			INSERT INTO page_views_archive
+			SELECT * FROM purged
+		`
+	}
+
+	result, err := db.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"saas-server/models"
+	"saas-server/pkg/analytics"
+
+	"github.com/google/uuid"
+)
+
+// UserRepository manages user accounts
+type UserRepository interface {
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	CreateUser(ctx context.Context, email, password, name string, emailVerified bool) (*models.User, error)
+	UpdateUser(ctx context.Context, id, name, email string) error
+	UpdatePassword(ctx context.Context, id, hashedPassword string) error
+	UserExists(ctx context.Context, email string) (bool, error)
+	GetUsers(ctx context.Context, page int, limit int, search string) ([]models.User, int, error)
+}
+
+// TokenRepository manages refresh tokens, revoked access tokens, one-time password
+// reset and email verification tokens and the admin stream tokens already used
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, userID string, tokenHash string, deviceInfo string, ipAddress string, expiresAt time.Time) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	DeleteAllUserRefreshTokens(ctx context.Context, userID string) error
+
+	AddToBlacklist(ctx context.Context, jti string, userID string, expiresAt time.Time) error
+	IsTokenBlacklisted(ctx context.Context, jti string) (bool, error)
+
+	CreatePasswordResetToken(ctx context.Context, userID string, token string, expiresAt time.Time) error
+	GetPasswordResetToken(ctx context.Context, token string) (string, error)
+	MarkPasswordResetTokenUsed(ctx context.Context, token string) error
+
+	StoreEmailVerificationToken(ctx context.Context, token, userID, email string, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, token string) (string, error)
+
+	// UseAdminStreamToken records the use of the admin stream token jti and reports
+	// whether it was the first
+	UseAdminStreamToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+
+	DeleteExpiredTokens(ctx context.Context, before time.Time) (map[string]int64, error)
+}
+
+// BillingRepository manages orders, subscriptions and their invoices, the subscription summary
+// denormalized onto each user and the checkouts that lead to them
+type BillingRepository interface {
+	CreateOrder(ctx context.Context, order *models.Orders) error
+	UpdateOrderStatus(ctx context.Context, orderID int, status string, refunded bool, refundedAt *time.Time) error
+	UpdateOrderRefund(ctx context.Context, orderID int, refundedAt *time.Time, refundedAmount int, refundedAmountFormatted string) error
+	GetUserOrders(ctx context.Context, userID string) ([]models.Orders, error)
+	GetUserOrder(ctx context.Context, userID string, orderID int) (*models.Orders, error)
+	GetOrder(ctx context.Context, orderID int) (*models.Orders, error)
+
+	UpsertSubscriptionInvoice(ctx context.Context, invoice *models.SubscriptionInvoice) error
+	GetUserSubscriptionInvoices(ctx context.Context, userID string) ([]models.SubscriptionInvoice, error)
+	GetUserSubscriptionInvoice(ctx context.Context, userID string, invoiceID int) (*models.SubscriptionInvoice, error)
+
+	CreateSubscription(ctx context.Context, userID string, subscriptionID int, orderID int, customerID int, productID int, variantID int, status string, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error
+	UpdateSubscription(ctx context.Context, subscriptionID int, status string, cancelled bool, productID int, variantID int, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error
+	GetSubscriptionByUserID(ctx context.Context, userID string) (*models.Subscription, error)
+	GetSubscriptionByID(ctx context.Context, subscriptionID int) (*models.Subscription, error)
+
+	UpdateUserSubscription(ctx context.Context, userID string, subscriptionID int, status string, productID int, variantID int, renewalDate *time.Time, endDate *time.Time) error
+	GetUserSubscriptionStatus(ctx context.Context, id string) (*models.UserSubscriptionStatus, error)
+	InvalidateUserCache(ctx context.Context, userID string) error
+
+	CreatePendingCheckout(ctx context.Context, checkout *models.Checkout) error
+	SetCheckoutURL(ctx context.Context, id, providerCheckoutID, checkoutURL string) error
+	DeleteCheckout(ctx context.Context, id string) error
+	CompleteCheckout(ctx context.Context, id string, orderID int) error
+	GetAbandonedCheckouts(ctx context.Context, before time.Time) ([]models.Checkout, error)
+}
+
+// CatalogRepository stores the product catalog mirrored from the payment provider
+type CatalogRepository interface {
+	UpsertProduct(ctx context.Context, product *models.Product) error
+	UpsertVariant(ctx context.Context, variant *models.Variant) error
+	DeleteProduct(ctx context.Context, productID int) error
+	DeleteVariant(ctx context.Context, variantID int) error
+	ReplaceStoreCatalog(ctx context.Context, storeID int, products []models.Product) error
+	GetProducts(ctx context.Context, storeID int) ([]models.Product, error)
+	GetProduct(ctx context.Context, productID int) (*models.Product, error)
+	GetVariant(ctx context.Context, variantID int) (*models.Variant, error)
+}
+
+// DunningRepository tracks subscriptions whose payments are failing
+type DunningRepository interface {
+	OpenDunningCase(ctx context.Context, c *models.DunningCase) (bool, error)
+	GetUnresolvedDunningCase(ctx context.Context, subscriptionID int) (*models.DunningCase, error)
+	GetUnresolvedDunningCases(ctx context.Context) ([]models.DunningCase, error)
+	ClaimDunningReminder(ctx context.Context, id int, sent int, sentAt time.Time, updatePaymentURL string) (bool, error)
+	TransitionDunningCase(ctx context.Context, id int, from, to string, at time.Time) (bool, error)
+	GetDunningStats(ctx context.Context, since time.Time) (*models.DunningStats, error)
+}
+
+// TrialRepository tracks free trials from start to conversion or expiry
+type TrialRepository interface {
+	CreateTrial(ctx context.Context, t *models.Trial) (bool, error)
+	GetUserTrial(ctx context.Context, userID string) (*models.Trial, error)
+	GetSubscriptionTrial(ctx context.Context, subscriptionID int) (*models.Trial, error)
+	GetTrialsEndingBefore(ctx context.Context, before time.Time) ([]models.Trial, error)
+	SetTrialEnd(ctx context.Context, id int, endsAt time.Time) error
+	ClaimTrialReminder(ctx context.Context, id int, at time.Time) (bool, error)
+	EndTrial(ctx context.Context, id int, status string, at time.Time) (bool, error)
+	ConvertUserTrials(ctx context.Context, userID string, at time.Time) (int64, error)
+	GetTrialConversionReport(ctx context.Context, since time.Time) (*models.TrialReport, error)
+}
+
+// RevenueRepository holds the subscription history and payments behind revenue analytics
+type RevenueRepository interface {
+	RecordSubscriptionEvent(ctx context.Context, e *models.SubscriptionEvent) (bool, error)
+	GetSubscriptionEvents(ctx context.Context, before time.Time) ([]models.SubscriptionEvent, error)
+	GetPayments(ctx context.Context, from, to time.Time) ([]models.Payment, error)
+}
+
+// DashboardRepository aggregates the KPIs on the admin dashboard
+type DashboardRepository interface {
+	GetDashboardSummary(ctx context.Context, now time.Time) (*models.DashboardSummary, error)
+}
+
+// MarketingRepository manages the early access waitlist and newsletter subscriptions
+type MarketingRepository interface {
+	CreateEarlyAccessEntry(ctx context.Context, email, referrer string) error
+	EarlyAccessEmailExists(ctx context.Context, email string) (bool, error)
+	UpdateEarlyAccessReferrer(ctx context.Context, email, referrer string) error
+	GetAllEarlyAccessEntries(ctx context.Context) ([]models.EarlyAccess, error)
+
+	CreateNewsletterSubscription(ctx context.Context, email string) error
+	NewsletterEmailExists(ctx context.Context, email string) (bool, error)
+	UpdateNewsletterSubscription(ctx context.Context, email string, subscribed bool) error
+	GetAllNewsletterSubscriptions(ctx context.Context) ([]models.NewsletterSubscription, error)
+}
+
+// AnalyticsRepository stores and aggregates page views and events, maintains the
+// page view rollups and keeps the salts behind anonymous visitor IDs
+type AnalyticsRepository interface {
+	TrackPageView(ctx context.Context, view *analytics.PageView) error
+	TrackPageViews(ctx context.Context, views []*analytics.PageView) error
+	TrackEvent(ctx context.Context, event *analytics.Event) error
+	TrackEvents(ctx context.Context, events []*analytics.Event) error
+	GetEvents(ctx context.Context, names []string, from, to time.Time) ([]analytics.Event, error)
+	StitchVisitor(ctx context.Context, visitorID string, userID uuid.UUID) (int64, error)
+	GetOrCreateAnalyticsSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error)
+	DeleteAnalyticsSaltsBefore(ctx context.Context, day time.Time) (int64, error)
+	GetUserJourney(ctx context.Context, userID uuid.UUID, startTime, endTime time.Time) ([]analytics.PageView, error)
+	GetVisitorJourneys(ctx context.Context, startTime, endTime time.Time) ([]analytics.PageView, error)
+	GetPageViewStats(ctx context.Context, startTime, endTime time.Time) (*analytics.PageViewResponse, error)
+	RollUpPageViews(ctx context.Context, rollup string, from, to time.Time) error
+	GetRollupWatermarks(ctx context.Context) (map[string]time.Time, error)
+	GetOldestPageView(ctx context.Context) (time.Time, error)
+	PurgePageViews(ctx context.Context, before time.Time, archive bool, limit int) (int64, error)
+}
+
+// WebhookRepository manages the outgoing webhook endpoints users register and the
+// deliveries made to them
+type WebhookRepository interface {
+	CreateWebhookEndpoint(ctx context.Context, e *models.WebhookEndpoint) error
+	GetWebhookEndpoints(ctx context.Context, userID string) ([]models.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, userID, id string) (*models.WebhookEndpoint, error)
+	UpdateWebhookEndpoint(ctx context.Context, e *models.WebhookEndpoint) error
+	DeleteWebhookEndpoint(ctx context.Context, userID, id string) error
+
+	CreateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, d *models.WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, endpointID string, limit int) ([]models.WebhookDelivery, error)
+	DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// APIKeyRepository manages the personal API keys users create
+type APIKeyRepository interface {
+	// CreateAPIKey stores k unless its user already holds max active keys, returning
+	// ErrAPIKeyLimit then
+	CreateAPIKey(ctx context.Context, k *models.APIKey, max int) error
+	GetAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string, at time.Time) (*models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, at time.Time, ip string) error
+}
+
+// Store combines every repository with transactional unit-of-work support.
+// It is implemented by *DB for PostgreSQL and by memstore.Store for tests.
+type Store interface {
+	UserRepository
+	TokenRepository
+	BillingRepository
+	DunningRepository
+	TrialRepository
+	RevenueRepository
+	DashboardRepository
+	CatalogRepository
+	MarketingRepository
+	AnalyticsRepository
+	WebhookRepository
+	APIKeyRepository
+
+	// WithTx runs fn in a transaction. Calls made through the Store passed to fn
+	// are committed together when fn returns nil and rolled back otherwise.
+	// Calling WithTx inside fn joins the outer transaction.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+var _ Store = (*DB)(nil)
+
+// WithTx runs fn in a database transaction
+func (db *DB) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return db.inTx(ctx, func(tx *DB) error {
+		return fn(tx)
+	})
+}
+
+// inTx runs fn with a DB bound to a transaction, reusing the current one if already inside a transaction
+func (db *DB) inTx(ctx context.Context, fn func(tx *DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	txDB := *db
+	txDB.tx = tx.Tx
+	if err := fn(&txDB); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
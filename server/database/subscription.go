@@ -1,8 +1,8 @@
 package database
 
 import (
+	"context"
 	"saas-server/models"
-	"sync"
 	"strconv"
 	"time"
 	"database/sql"
@@ -11,14 +11,11 @@ import (
 	"github.com/google/uuid"
 )
 
-// Cache management
-var (
-	subscriptionCache = make(map[string]interface{})
-	cacheMutex        sync.RWMutex
-)
-
 // CreateSubscription creates a new subscription record in the database
-func (db *DB) CreateSubscription(userID string, subscriptionID int, orderID int, customerID int, productID int, variantID int, status string, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error {
+func (db *DB) CreateSubscription(ctx context.Context, userID string, subscriptionID int, orderID int, customerID int, productID int, variantID int, status string, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO subscriptions (
 			subscription_id, user_id, order_id, customer_id, product_id, variant_id,
@@ -26,7 +23,7 @@ func (db *DB) CreateSubscription(userID string, subscriptionID int, orderID int,
 			created_at, updated_at
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
-	_, err := db.Exec(query,
+	_, err := db.ExecContext(ctx, query,
 		subscriptionID, userID, orderID, customerID, productID, variantID,
 		status, renewsAt, endsAt, trialEndsAt,
 	)
@@ -34,7 +31,10 @@ func (db *DB) CreateSubscription(userID string, subscriptionID int, orderID int,
 }
 
 // UpdateSubscription updates an existing subscription record
-func (db *DB) UpdateSubscription(subscriptionID int, status string, cancelled bool, productID int, variantID int, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error {
+func (db *DB) UpdateSubscription(ctx context.Context, subscriptionID int, status string, cancelled bool, productID int, variantID int, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE subscriptions 
 		SET status = $1,
@@ -47,12 +47,15 @@ func (db *DB) UpdateSubscription(subscriptionID int, status string, cancelled bo
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE subscription_id = $8
 	`
-	_, err := db.Exec(query, status, cancelled, productID, variantID, renewsAt, endsAt, trialEndsAt, subscriptionID)
+	_, err := db.ExecContext(ctx, query, status, cancelled, productID, variantID, renewsAt, endsAt, trialEndsAt, subscriptionID)
 	return err
 }
 
 // GetSubscriptionByUserID retrieves a subscription by user ID
-func (db *DB) GetSubscriptionByUserID(userID string) (*models.Subscription, error) {
+func (db *DB) GetSubscriptionByUserID(ctx context.Context, userID string) (*models.Subscription, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var subscription models.Subscription
 	var subscriptionIDInt int
 	query := `
@@ -64,7 +67,7 @@ func (db *DB) GetSubscriptionByUserID(userID string) (*models.Subscription, erro
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
-	err := db.QueryRow(query, userID).Scan(
+	err := db.QueryRowContext(ctx, query, userID).Scan(
 		&subscription.ID,
 		&subscriptionIDInt,
 		&subscription.UserID,
@@ -87,9 +90,45 @@ func (db *DB) GetSubscriptionByUserID(userID string) (*models.Subscription, erro
 	return &subscription, nil
 }
 
+// GetSubscriptionByID retrieves a subscription by its Lemon Squeezy subscription ID
+func (db *DB) GetSubscriptionByID(ctx context.Context, subscriptionID int) (*models.Subscription, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	subscription := models.Subscription{SubscriptionID: strconv.Itoa(subscriptionID)}
+	query := `
+		SELECT id, user_id, order_id, customer_id, product_id, variant_id,
+		       status, cancelled, renews_at, ends_at, trial_ends_at,
+		       created_at, updated_at
+		FROM subscriptions
+		WHERE subscription_id = $1
+	`
+	err := db.QueryRowContext(ctx, query, subscriptionID).Scan(
+		&subscription.ID,
+		&subscription.UserID,
+		&subscription.OrderID,
+		&subscription.CustomerID,
+		&subscription.ProductID,
+		&subscription.VariantID,
+		&subscription.Status,
+		&subscription.Cancelled,
+		&subscription.RenewsAt,
+		&subscription.EndsAt,
+		&subscription.TrialEndsAt,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
 
 // UpdateUserSubscription updates a user's subscription in the database
-func (db *DB) UpdateUserSubscription(userID string, subscriptionID int, status string, productID int, variantID int, renewalDate *time.Time, endDate *time.Time) error {
+func (db *DB) UpdateUserSubscription(ctx context.Context, userID string, subscriptionID int, status string, productID int, variantID int, renewalDate *time.Time, endDate *time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	parsedID, err := uuid.Parse(userID)
 	if err != nil {
 		log.Printf("[DB] Error parsing UUID: %v", err)
@@ -107,7 +146,7 @@ func (db *DB) UpdateUserSubscription(userID string, subscriptionID int, status s
 			updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 
-	result, err := db.Exec(query, parsedID, subscriptionID, status, productID, variantID, renewalDate, endDate)
+	result, err := db.ExecContext(ctx, query, parsedID, subscriptionID, status, productID, variantID, renewalDate, endDate)
 	if err != nil {
 		log.Printf("[DB] Error executing update query: %v", err)
 		return err
@@ -124,12 +163,27 @@ func (db *DB) UpdateUserSubscription(userID string, subscriptionID int, status s
 		return sql.ErrNoRows
 	}
 
-	return nil
+	return db.InvalidateUserCache(ctx, userID)
 }
 
 
-// GetUserSubscriptionStatus retrieves only the subscription-related fields
-func (db *DB) GetUserSubscriptionStatus(id string) (*models.UserSubscriptionStatus, error) {
+// GetUserSubscriptionStatus retrieves only the subscription-related fields,
+// reading through the subscription status cache when it is enabled
+func (db *DB) GetUserSubscriptionStatus(ctx context.Context, id string) (*models.UserSubscriptionStatus, error) {
+	// Inside a transaction the cache could hold a value the transaction has already changed
+	if db.statusCache == nil || db.tx != nil {
+		return db.loadUserSubscriptionStatus(ctx, id)
+	}
+	return db.statusCache.GetOrLoad(id, func() (*models.UserSubscriptionStatus, error) {
+		return db.loadUserSubscriptionStatus(ctx, id)
+	})
+}
+
+// loadUserSubscriptionStatus reads the subscription-related fields from the users table
+func (db *DB) loadUserSubscriptionStatus(ctx context.Context, id string) (*models.UserSubscriptionStatus, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var nullStatus sql.NullString
 	var nullProductID sql.NullInt64
 	var nullVariantID sql.NullInt64
@@ -139,7 +193,7 @@ func (db *DB) GetUserSubscriptionStatus(id string) (*models.UserSubscriptionStat
 		FROM users
 		WHERE id = $1`
 
-	err := db.QueryRow(query, id).Scan(
+	err := db.QueryRowContext(ctx, query, id).Scan(
 		&nullStatus,
 		&nullProductID,
 		&nullVariantID,
@@ -173,10 +227,3 @@ func (db *DB) GetUserSubscriptionStatus(id string) (*models.UserSubscriptionStat
 
 	return status, nil
 }
-
-// InvalidateUserCache removes a user's data from the cache
-func (db *DB) InvalidateUserCache(userID string) {
-	cacheMutex.Lock()
-	delete(subscriptionCache, userID)
-	cacheMutex.Unlock()
-}
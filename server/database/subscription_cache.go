@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"saas-server/models"
+	"saas-server/pkg/cache"
+
+	"github.com/lib/pq"
+)
+
+// subscriptionStatusChannel is the NOTIFY channel carrying the IDs of users whose
+// cached subscription status is stale
+const subscriptionStatusChannel = "subscription_status_invalidated"
+
+// listenerPingInterval is how often an idle invalidation listener checks its connection
+const listenerPingInterval = 90 * time.Second
+
+// newStatusCache creates the subscription status cache, or returns nil if caching is disabled
+func newStatusCache(opts Options) *cache.Cache[string, *models.UserSubscriptionStatus] {
+	if opts.SubscriptionCacheSize <= 0 {
+		return nil
+	}
+	return cache.New[string, *models.UserSubscriptionStatus](opts.SubscriptionCacheSize, opts.SubscriptionCacheTTL)
+}
+
+// InvalidateUserCache drops the user's cached subscription status on this instance and
+// notifies every other instance to do the same. Inside a transaction the notification
+// is only delivered once the transaction commits.
+func (db *DB) InvalidateUserCache(ctx context.Context, userID string) error {
+	if db.statusCache == nil {
+		return nil
+	}
+	db.statusCache.Delete(userID)
+	_, err := db.ExecContext(ctx, "SELECT pg_notify($1, $2)", subscriptionStatusChannel, userID)
+	return err
+}
+
+// ListenForInvalidations subscribes to cache invalidations broadcast by other instances
+// and applies them to the local subscription status cache until ctx is cancelled.
+// If the listener loses its connection the whole cache is purged, since
+// notifications sent while disconnected are lost.
+func (db *DB) ListenForInvalidations(ctx context.Context) error {
+	if db.statusCache == nil {
+		return nil
+	}
+
+	listener := pq.NewListener(db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("[DB] Cache invalidation listener disconnected: %v", err)
+			db.statusCache.Purge()
+		case pq.ListenerEventReconnected:
+			log.Printf("[DB] Cache invalidation listener reconnected")
+			db.statusCache.Purge()
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("[DB] Cache invalidation listener failed to connect: %v", err)
+		}
+	})
+	if err := listener.Listen(subscriptionStatusChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		defer listener.Close()
+		ticker := time.NewTicker(listenerPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification := <-listener.Notify:
+				// A nil notification follows a reconnect; the event callback has already purged
+				if notification != nil {
+					db.statusCache.Delete(notification.Extra)
+				}
+			case <-ticker.C:
+				go listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"saas-server/pkg/telemetry"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tx wraps sql.Tx so that statements executed inside a transaction are traced
+type Tx struct {
+	*sql.Tx
+	ctx  context.Context
+	slow time.Duration
+}
+
+// startQuerySpan starts a client span for a single SQL statement
+func startQuerySpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	return telemetry.Tracer().Start(ctx, "db."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", strings.TrimSpace(query)),
+		),
+	)
+}
+
+// endQuerySpan records the outcome of a SQL statement on its span and ends it,
+// logging the statement if it took longer than the slow query threshold
+func endQuerySpan(span trace.Span, start time.Time, slow time.Duration, query string, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	if elapsed := time.Since(start); slow > 0 && elapsed > slow {
+		log.Printf("[DB] Slow query (%s): %s", elapsed.Round(time.Millisecond), strings.Join(strings.Fields(query), " "))
+	}
+}
+
+// ExecContext executes a statement inside a traced span, joining the current transaction if any
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, "exec", query)
+	start := time.Now()
+	var result sql.Result
+	var err error
+	if db.tx != nil {
+		result, err = db.tx.ExecContext(ctx, query, args...)
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, args...)
+	}
+	endQuerySpan(span, start, db.opts.SlowQueryThreshold, query, err)
+	return result, err
+}
+
+// QueryContext runs a query inside a traced span, joining the current transaction if any
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, "query", query)
+	start := time.Now()
+	var rows *sql.Rows
+	var err error
+	if db.tx != nil {
+		rows, err = db.tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = db.DB.QueryContext(ctx, query, args...)
+	}
+	endQuerySpan(span, start, db.opts.SlowQueryThreshold, query, err)
+	return rows, err
+}
+
+// QueryRowContext runs a single-row query inside a traced span, joining the current transaction if any
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, "query", query)
+	start := time.Now()
+	var row *sql.Row
+	if db.tx != nil {
+		row = db.tx.QueryRowContext(ctx, query, args...)
+	} else {
+		row = db.DB.QueryRowContext(ctx, query, args...)
+	}
+	endQuerySpan(span, start, db.opts.SlowQueryThreshold, query, row.Err())
+	return row
+}
+
+// BeginTx starts a transaction whose statements are traced under the given context
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	_, span := startQuerySpan(ctx, "begin", "BEGIN")
+	start := time.Now()
+	tx, err := db.DB.BeginTx(ctx, opts)
+	endQuerySpan(span, start, db.opts.SlowQueryThreshold, "BEGIN", err)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, ctx: ctx, slow: db.opts.SlowQueryThreshold}, nil
+}
+
+// Exec executes a statement in the transaction inside a traced span
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(tx.ctx, "exec", query)
+	start := time.Now()
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	endQuerySpan(span, start, tx.slow, query, err)
+	return result, err
+}
+
+// QueryRow runs a single-row query in the transaction inside a traced span
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(tx.ctx, "query", query)
+	start := time.Now()
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	endQuerySpan(span, start, tx.slow, query, row.Err())
+	return row
+}
+
+// copyIn bulk loads rows into table with COPY inside a traced span. It must be
+// called on a DB bound to a transaction.
+func (db *DB) copyIn(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+	if db.tx == nil {
+		return errors.New("copyIn requires a transaction")
+	}
+	query := pq.CopyIn(table, columns...)
+	ctx, span := startQuerySpan(ctx, "copy", query)
+	start := time.Now()
+	err := func() error {
+		stmt, err := db.tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if _, err := stmt.ExecContext(ctx, row...); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		// An Exec without arguments ends the COPY and reports any error from the server
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			stmt.Close()
+			return err
+		}
+		return stmt.Close()
+	}()
+	endQuerySpan(span, start, db.opts.SlowQueryThreshold, query, err)
+	return err
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"saas-server/models"
+	"time"
+)
+
+// trialColumns lists the columns scanned by scanTrial, in order
+const trialColumns = `
+		id, user_id, source, subscription_id, product_id, variant_id, status,
+		started_at, ends_at, reminder_sent_at, ended_at, created_at, updated_at`
+
+// CreateTrial records the start of a trial. It returns false without changes if the
+// user already had an app-managed trial or the subscription is already tracked.
+func (db *DB) CreateTrial(ctx context.Context, t *models.Trial) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO trials (
+			user_id, source, subscription_id, product_id, variant_id, status,
+			started_at, ends_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT DO NOTHING
+		RETURNING` + trialColumns
+
+	created, err := scanTrial(db.QueryRowContext(ctx, query, t.UserID, t.Source, t.SubscriptionID,
+		t.ProductID, t.VariantID, models.TrialActive, t.StartedAt, t.EndsAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	*t = *created
+	return true, nil
+}
+
+// GetUserTrial returns the user's active trial, or sql.ErrNoRows if they have none
+func (db *DB) GetUserTrial(ctx context.Context, userID string) (*models.Trial, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + trialColumns + `
+		FROM trials
+		WHERE user_id = $1 AND status = $2
+		ORDER BY ends_at DESC
+		LIMIT 1`
+
+	return scanTrial(db.QueryRowContext(ctx, query, userID, models.TrialActive))
+}
+
+// GetSubscriptionTrial returns the trial a subscription started with, or sql.ErrNoRows
+func (db *DB) GetSubscriptionTrial(ctx context.Context, subscriptionID int) (*models.Trial, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + trialColumns + `
+		FROM trials
+		WHERE subscription_id = $1`
+
+	return scanTrial(db.QueryRowContext(ctx, query, subscriptionID))
+}
+
+// GetTrialsEndingBefore returns the active trials that end before the given time, soonest first
+func (db *DB) GetTrialsEndingBefore(ctx context.Context, before time.Time) ([]models.Trial, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + trialColumns + `
+		FROM trials
+		WHERE status = $1 AND ends_at < $2
+		ORDER BY ends_at`
+
+	rows, err := db.QueryContext(ctx, query, models.TrialActive, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trials []models.Trial
+	for rows.Next() {
+		t, err := scanTrial(rows)
+		if err != nil {
+			return nil, err
+		}
+		trials = append(trials, *t)
+	}
+	return trials, rows.Err()
+}
+
+// SetTrialEnd moves the end of an active trial, e.g. when the provider extends it.
+// A reminder already sent for the old end date is sent again for the new one.
+func (db *DB) SetTrialEnd(ctx context.Context, id int, endsAt time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE trials
+		SET ends_at = $1,
+		    reminder_sent_at = CASE WHEN ends_at = $1 THEN reminder_sent_at END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3`
+
+	_, err := db.ExecContext(ctx, query, endsAt, id, models.TrialActive)
+	return err
+}
+
+// ClaimTrialReminder marks the expiry reminder of a trial as sent. It returns false if
+// it was already claimed, so that each reminder is emailed at most once.
+func (db *DB) ClaimTrialReminder(ctx context.Context, id int, at time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE trials
+		SET reminder_sent_at = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3 AND reminder_sent_at IS NULL`
+
+	result, err := db.ExecContext(ctx, query, at, id, models.TrialActive)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// EndTrial moves an active trial to status (converted or expired). It returns false
+// if the trial had already ended.
+func (db *DB) EndTrial(ctx context.Context, id int, status string, at time.Time) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE trials
+		SET status = $1, ended_at = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = $4`
+
+	result, err := db.ExecContext(ctx, query, status, at, id, models.TrialActive)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// ConvertUserTrials marks every active trial of a user as converted to a paid plan
+func (db *DB) ConvertUserTrials(ctx context.Context, userID string, at time.Time) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE trials
+		SET status = $1, ended_at = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $3 AND status = $4`
+
+	result, err := db.ExecContext(ctx, query, models.TrialConverted, at, userID, models.TrialActive)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetTrialConversionReport counts the outcomes of trials started since the given time,
+// per source and in total
+func (db *DB) GetTrialConversionReport(ctx context.Context, since time.Time) (*models.TrialReport, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT source,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE status = $2),
+		       COUNT(*) FILTER (WHERE status = $3),
+		       COUNT(*) FILTER (WHERE status = $4),
+		       COALESCE(SUM(EXTRACT(EPOCH FROM ended_at - started_at) / 86400)
+		                FILTER (WHERE status = $3), 0)
+		FROM trials
+		WHERE started_at >= $1
+		GROUP BY source
+		ORDER BY source`
+
+	rows, err := db.QueryContext(ctx, query, since, models.TrialActive, models.TrialConverted, models.TrialExpired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &models.TrialReport{Since: since, BySource: []models.TrialConversion{}}
+	var totalDays float64
+	for rows.Next() {
+		var c models.TrialConversion
+		var days float64
+		if err := rows.Scan(&c.Source, &c.Started, &c.Active, &c.Converted, &c.Expired, &days); err != nil {
+			return nil, err
+		}
+		totalDays += days
+		report.Total.Started += c.Started
+		report.Total.Active += c.Active
+		report.Total.Converted += c.Converted
+		report.Total.Expired += c.Expired
+		c.SetRates(days)
+		report.BySource = append(report.BySource, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	report.Total.SetRates(totalDays)
+	return report, nil
+}
+
+func scanTrial(row rowScanner) (*models.Trial, error) {
+	var t models.Trial
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Source,
+		&t.SubscriptionID,
+		&t.ProductID,
+		&t.VariantID,
+		&t.Status,
+		&t.StartedAt,
+		&t.EndsAt,
+		&t.ReminderSentAt,
+		&t.EndedAt,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
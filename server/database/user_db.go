@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"saas-server/models"
@@ -10,9 +11,12 @@ import (
 )
 
 // CreateUser creates a new user in the database with the given details
-func (db *DB) CreateUser(email, password, name string, emailVerified bool) (*models.User, error) {
+func (db *DB) CreateUser(ctx context.Context, email, password, name string, emailVerified bool) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	// Check if user already exists
-	exists, err := db.UserExists(email)
+	exists, err := db.UserExists(ctx, email)
 	if err != nil {
 		return nil, err
 	}
@@ -29,7 +33,7 @@ func (db *DB) CreateUser(email, password, name string, emailVerified bool) (*mod
 		RETURNING id, email, password, name, email_verified, created_at, updated_at`
 
 	var user models.User
-	err = db.QueryRow(
+	err = db.QueryRowContext(ctx,
 		query,
 		id,
 		email,
@@ -54,14 +58,17 @@ func (db *DB) CreateUser(email, password, name string, emailVerified bool) (*mod
 }
 
 // GetUserByEmail retrieves a user by their email address
-func (db *DB) GetUserByEmail(email string) (*models.User, error) {
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var user models.User
 	query := `
 		SELECT id, email, password, name, email_verified, created_at, updated_at
 		FROM users
 		WHERE email = $1`
 
-	err := db.QueryRow(query, email).Scan(
+	err := db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
@@ -77,7 +84,10 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 }
 
 // GetUserByID retrieves all user details by their unique identifier
-func (db *DB) GetUserByID(id string) (*models.User, error) {
+func (db *DB) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var user models.User
 	var latestStatus sql.NullString
 	var latestProductID sql.NullInt64
@@ -93,7 +103,7 @@ func (db *DB) GetUserByID(id string) (*models.User, error) {
 		FROM users
 		WHERE id = $1`
 
-	err := db.QueryRow(query, id).Scan(
+	err := db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
@@ -135,14 +145,17 @@ func (db *DB) GetUserByID(id string) (*models.User, error) {
 }
 
 // UserExists checks if a user with the given email already exists
-func (db *DB) UserExists(email string) (bool, error) {
+func (db *DB) UserExists(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `
 		SELECT EXISTS(
 			SELECT 1 FROM users WHERE email = $1
 		)`
 
-	err := db.QueryRow(query, email).Scan(&exists)
+	err := db.QueryRowContext(ctx, query, email).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
@@ -150,7 +163,10 @@ func (db *DB) UserExists(email string) (bool, error) {
 }
 
 // UpdateUser updates a user's profile information in the database
-func (db *DB) UpdateUser(id, name, email string) error {
+func (db *DB) UpdateUser(ctx context.Context, id, name, email string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	parsedID, err := uuid.Parse(id)
 	if err != nil {
 		return err
@@ -161,7 +177,7 @@ func (db *DB) UpdateUser(id, name, email string) error {
 		SET name = $2, email = $3, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 
-	result, err := db.Exec(query, parsedID, name, email)
+	result, err := db.ExecContext(ctx, query, parsedID, name, email)
 	if err != nil {
 		return err
 	}
@@ -179,7 +195,10 @@ func (db *DB) UpdateUser(id, name, email string) error {
 }
 
 // UpdatePassword updates a user's password in the database
-func (db *DB) UpdatePassword(id, hashedPassword string) error {
+func (db *DB) UpdatePassword(ctx context.Context, id, hashedPassword string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
 	parsedID, err := uuid.Parse(id)
 	if err != nil {
 		return err
@@ -190,7 +209,7 @@ func (db *DB) UpdatePassword(id, hashedPassword string) error {
 		SET password = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1`
 
-	result, err := db.Exec(query, parsedID, hashedPassword)
+	result, err := db.ExecContext(ctx, query, parsedID, hashedPassword)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"saas-server/models"
+
+	"github.com/lib/pq"
+)
+
+// webhookEndpointColumns lists the columns scanned by scanWebhookEndpoint, in order
+const webhookEndpointColumns = `
+		id, user_id, url, description, event_types, secret, enabled, created_at, updated_at`
+
+// webhookDeliveryColumns lists the columns scanned by scanWebhookDelivery, in order
+const webhookDeliveryColumns = `
+		id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+		last_attempt_at, response_status, response_body, error, duration_ms, created_at`
+
+// CreateWebhookEndpoint registers an endpoint with the ID and secret already set on e
+func (db *DB) CreateWebhookEndpoint(ctx context.Context, e *models.WebhookEndpoint) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO webhook_endpoints (id, user_id, url, description, event_types, secret, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING created_at, updated_at`
+
+	return db.QueryRowContext(ctx, query, e.ID, e.UserID, e.URL, e.Description,
+		pq.Array(e.EventTypes), e.Secret, e.Enabled).Scan(&e.CreatedAt, &e.UpdatedAt)
+}
+
+// GetWebhookEndpoints returns a user's endpoints, oldest first
+func (db *DB) GetWebhookEndpoints(ctx context.Context, userID string) ([]models.WebhookEndpoint, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE user_id = $1
+		ORDER BY created_at`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []models.WebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, *e)
+	}
+	return endpoints, rows.Err()
+}
+
+// GetWebhookEndpoint returns one of a user's endpoints, or sql.ErrNoRows if the user
+// has no endpoint with that ID
+func (db *DB) GetWebhookEndpoint(ctx context.Context, userID, id string) (*models.WebhookEndpoint, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE id = $1 AND user_id = $2`
+
+	return scanWebhookEndpoint(db.QueryRowContext(ctx, query, id, userID))
+}
+
+// UpdateWebhookEndpoint saves the URL, description, event types, secret and enabled
+// flag of an endpoint owned by e.UserID, or returns sql.ErrNoRows if there is none
+func (db *DB) UpdateWebhookEndpoint(ctx context.Context, e *models.WebhookEndpoint) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE webhook_endpoints
+		SET url = $1, description = $2, event_types = $3, secret = $4, enabled = $5,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6 AND user_id = $7
+		RETURNING updated_at`
+
+	return db.QueryRowContext(ctx, query, e.URL, e.Description, pq.Array(e.EventTypes),
+		e.Secret, e.Enabled, e.ID, e.UserID).Scan(&e.UpdatedAt)
+}
+
+// DeleteWebhookEndpoint removes one of a user's endpoints with its deliveries, or
+// returns sql.ErrNoRows if the user has no endpoint with that ID
+func (db *DB) DeleteWebhookEndpoint(ctx context.Context, userID, id string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// CreateWebhookDelivery records a delivery with the ID, event, status and schedule set on d
+func (db *DB) CreateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO webhook_deliveries (
+			id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP)
+		RETURNING created_at`
+
+	return db.QueryRowContext(ctx, query, d.ID, d.EndpointID, d.EventID, d.EventType, []byte(d.Payload),
+		d.Status, d.Attempts, d.NextAttemptAt).Scan(&d.CreatedAt)
+}
+
+// ClaimWebhookDeliveries picks up to limit pending deliveries to enabled endpoints that
+// are due at now, counts an attempt for each and holds them until leaseUntil, so that
+// other instances skip them while they are sent. The endpoint URL and secret are filled in.
+func (db *DB) ClaimWebhookDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		WITH due AS (
+			SELECT d.id
+			FROM webhook_deliveries d
+			JOIN webhook_endpoints e ON e.id = d.endpoint_id
+			WHERE d.status = $1 AND d.next_attempt_at <= $2 AND e.enabled
+			ORDER BY d.next_attempt_at
+			LIMIT $4
+			FOR UPDATE OF d SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d
+			SET attempts = d.attempts + 1, next_attempt_at = $3
+			FROM due
+			WHERE d.id = due.id
+			RETURNING d.*
+		)
+		SELECT` + webhookDeliveryColumns + `, url, secret
+		FROM claimed
+		JOIN (SELECT id AS endpoint_id, url, secret FROM webhook_endpoints) e USING (endpoint_id)`
+
+	rows, err := db.QueryContext(ctx, query, models.WebhookDeliveryPending, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt saves the outcome of the latest attempt of a delivery: its
+// status, when it is next attempted if still pending, and the endpoint's response
+func (db *DB) RecordWebhookAttempt(ctx context.Context, d *models.WebhookDelivery) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, next_attempt_at = $2, last_attempt_at = $3, response_status = $4,
+		    response_body = $5, error = $6, duration_ms = $7
+		WHERE id = $8`
+
+	_, err := db.ExecContext(ctx, query, d.Status, d.NextAttemptAt, d.LastAttemptAt, d.ResponseStatus,
+		d.ResponseBody, d.Error, d.DurationMS, d.ID)
+	return err
+}
+
+// GetWebhookDeliveries returns the latest deliveries to an endpoint, newest first
+func (db *DB) GetWebhookDeliveries(ctx context.Context, endpointID string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`
+
+	rows, err := db.QueryContext(ctx, query, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// DeleteWebhookDeliveriesBefore removes the finished deliveries created before the
+// given time and returns how many were removed
+func (db *DB) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := db.withReportTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE created_at < $1 AND status <> $2`,
+		before, models.WebhookDeliveryPending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanWebhookEndpoint(row rowScanner) (*models.WebhookEndpoint, error) {
+	var e models.WebhookEndpoint
+	err := row.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.URL,
+		&e.Description,
+		pq.Array(&e.EventTypes),
+		&e.Secret,
+		&e.Enabled,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// scanWebhookDelivery scans webhookDeliveryColumns, followed by the endpoint URL and
+// secret when withEndpoint is set
+func scanWebhookDelivery(row rowScanner, withEndpoint bool) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload []byte
+	dest := []interface{}{
+		&d.ID,
+		&d.EndpointID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastAttemptAt,
+		&d.ResponseStatus,
+		&d.ResponseBody,
+		&d.Error,
+		&d.DurationMS,
+		&d.CreatedAt,
+	}
+	if withEndpoint {
+		dest = append(dest, &d.URL, &d.Secret)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+	return &d, nil
+}
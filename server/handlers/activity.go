@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"saas-server/pkg/activity"
+)
+
+// activityHeartbeat is how often an idle stream is written to, keeping proxies from
+// closing it and refreshing the number of visitors online
+const activityHeartbeat = 15 * time.Second
+
+// ActivityHandler streams live activity to admins
+type ActivityHandler struct {
+	hub *activity.Hub
+}
+
+// NewActivityHandler creates a handler streaming the events published to hub
+func NewActivityHandler(hub *activity.Hub) *ActivityHandler {
+	return &ActivityHandler{hub: hub}
+}
+
+// Stream handles GET /admin/stream?types=signup,order with Server-Sent Events. Each
+// event is sent with its type as the event name and its data as JSON; without
+// types every event is sent. Clients reconnecting with Last-Event-ID, or with
+// ?last_event_id= when opening a new EventSource, receive the recent events they missed.
+func (h *ActivityHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var types []string
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !slices.Contains(activity.Types, t) {
+			http.Error(w, fmt.Sprintf("Unknown event type %q; expected any of %s", t, strings.Join(activity.Types, ", ")), http.StatusBadRequest)
+			return
+		}
+		types = append(types, t)
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[Activity] Error clearing write deadline: %v", err)
+	}
+
+	sub := h.hub.Subscribe(types, lastID)
+	defer h.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Start with the current number of visitors online
+	wantsVisitors := len(types) == 0 || slices.Contains(types, activity.TypeVisitors)
+	if wantsVisitors {
+		fmt.Fprintf(w, "event: %s\ndata: {\"online\":%d}\n\n", activity.TypeVisitors, h.hub.Online())
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("[Activity] Streaming not supported: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(activityHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				log.Printf("[Activity] Error encoding %s event: %v", e.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		case <-heartbeat.C:
+			// Publishes the count to every stream if visitors went offline
+			h.hub.Online()
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
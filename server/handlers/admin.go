@@ -3,22 +3,30 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"os"
+	"saas-server/config"
 	"saas-server/database"
+	"saas-server/middleware"
 	"saas-server/models"
 	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// adminStreamTokenTTL is how long a stream token may be used, once, to open the activity
+// stream; an open stream is not closed when its token expires
+const adminStreamTokenTTL = time.Minute
+
 type AdminHandler struct {
-	db database.DBInterface
+	db    database.UserRepository
+	admin config.AdminConfig
 }
 
-func NewAdminHandler(db database.DBInterface) *AdminHandler {
+func NewAdminHandler(db database.UserRepository, admin config.AdminConfig) *AdminHandler {
 	return &AdminHandler{
-		db: db,
+		db:    db,
+		admin: admin,
 	}
 }
 
@@ -31,6 +39,11 @@ type AdminLoginResponse struct {
 	Token string `json:"token"`
 }
 
+type AdminStreamTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type GetUsersResponse struct {
 	Users []models.User `json:"users"`
 	Total int           `json:"total"`
@@ -51,7 +64,7 @@ func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate admin credentials
-	if req.Username != os.Getenv("ADMIN_USERNAME") || req.Password != os.Getenv("ADMIN_PASSWORD") {
+	if req.Username != h.admin.Username || req.Password != h.admin.Password {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
@@ -63,7 +76,7 @@ func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
 		"role": "admin",
 	})
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("ADMIN_JWT_SECRET")))
+	tokenString, err := token.SignedString([]byte(h.admin.JWTSecret))
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -73,6 +86,33 @@ func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(AdminLoginResponse{Token: tokenString})
 }
 
+// StreamToken handles POST /admin/stream/token, issuing a short-lived token that opens
+// the activity stream with /admin/stream?token=, for browsers' EventSource
+func (h *AdminHandler) StreamToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	expiresAt := time.Now().Add(adminStreamTokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  "admin",
+		"exp":  expiresAt.Unix(),
+		"role": middleware.AdminStreamRole,
+		// The middleware records the jti so that the token opens the stream only once
+		"jti": uuid.NewString(),
+	})
+
+	tokenString, err := token.SignedString([]byte(h.admin.JWTSecret))
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminStreamTokenResponse{Token: tokenString, ExpiresAt: expiresAt})
+}
+
 func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -93,7 +133,7 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	search := r.URL.Query().Get("search")
 
 	// Get users from database
-	users, total, err := h.db.GetUsers(page, limit, search)
+	users, total, err := h.db.GetUsers(r.Context(), page, limit, search)
 	if err != nil {
 		http.Error(w, "Error retrieving users", http.StatusInternalServerError)
 		return
@@ -1,25 +1,73 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
+	"saas-server/database"
+	"saas-server/middleware"
+	"saas-server/pkg/activity"
 	"saas-server/pkg/analytics"
+	"saas-server/pkg/cache"
+	"saas-server/pkg/ingest"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+const (
+	// maxBatchBytes bounds the body of a tracking request, properties included
+	maxBatchBytes = 64 << 10
+	// maxBatchItems bounds the page views and events sent in one request
+	maxBatchItems = 50
+	// maxClientDelay is how far in the past a client may date a batched item. It is
+	// shorter than analytics.RollupDelay so that items land before their hour is rolled up.
+	maxClientDelay = 10 * time.Minute
+	// maxFunnelSteps bounds the number of events in a funnel
+	maxFunnelSteps = 10
+	// defaultFunnelDays is the funnel range used when none is requested
+	defaultFunnelDays = 30
+)
+
+// stitchCacheSize bounds the visitor and user pairs remembered as already stitched
+const stitchCacheSize = 10000
+
 type AnalyticsHandler struct {
-	pageViewService analytics.PageViewService
+	pageViews database.AnalyticsRepository
+	ingest    *ingest.Pipeline
+	jwtSecret []byte
+	visitors  *analytics.Identifier
+	enricher  *analytics.Enricher
+	clientIPs *middleware.ClientIPResolver
+	activity  *activity.Hub
+	// stitched remembers the visitors already linked to a user on this instance,
+	// so only the first tracked view after signing in updates their history
+	stitched *cache.Cache[string, bool]
 }
 
 type PageViewRequest struct {
 	Path     string `json:"path"`
 	Referrer string `json:"referrer,omitempty"`
+	// Timestamp is when the view happened, for views queued by the client and sent later
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+type EventRequest struct {
+	Name       string         `json:"name"`
+	Properties map[string]any `json:"properties,omitempty"`
+	Timestamp  *time.Time     `json:"timestamp,omitempty"`
+}
+
+// CollectRequest is a batch of page views and events from one visitor
+type CollectRequest struct {
+	PageViews []PageViewRequest `json:"pageviews,omitempty"`
+	Events    []EventRequest    `json:"events,omitempty"`
 }
 
 type JourneyRequest struct {
@@ -29,64 +77,315 @@ type JourneyRequest struct {
 	VisitorID string    `json:"visitor_id,omitempty"`
 }
 
-func NewAnalyticsHandler(pageViewService analytics.PageViewService) *AnalyticsHandler {
-	return &AnalyticsHandler{pageViewService: pageViewService}
+func NewAnalyticsHandler(pageViews database.AnalyticsRepository, pipeline *ingest.Pipeline, jwtSecret string, visitors *analytics.Identifier, enricher *analytics.Enricher, clientIPs *middleware.ClientIPResolver, hub *activity.Hub) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		pageViews: pageViews,
+		ingest:    pipeline,
+		jwtSecret: []byte(jwtSecret),
+		visitors:  visitors,
+		enricher:  enricher,
+		clientIPs: clientIPs,
+		activity:  hub,
+		stitched:  cache.New[string, bool](stitchCacheSize, 24*time.Hour),
+	}
 }
 
-// TrackPageView handles the POST request for tracking page views
+// TrackPageView handles POST /api/analytics/pageview with one page view or an array of them
 func (h *AnalyticsHandler) TrackPageView(w http.ResponseWriter, r *http.Request) {
-	// Parse request body
-	var req PageViewRequest
+	views, ok := decodeOneOrMany[PageViewRequest](w, r)
+	if !ok {
+		return
+	}
+	h.collect(w, r, CollectRequest{PageViews: views})
+}
+
+// TrackEvent handles POST /api/analytics/event with one event or an array of them, each
+// with a name and optional properties. Names used by server-side events are rejected
+// so funnels cannot be skewed by clients.
+func (h *AnalyticsHandler) TrackEvent(w http.ResponseWriter, r *http.Request) {
+	events, ok := decodeOneOrMany[EventRequest](w, r)
+	if !ok {
+		return
+	}
+	h.collect(w, r, CollectRequest{Events: events})
+}
+
+// Collect handles POST /api/analytics/collect with a batch of page views and events,
+// as sent by navigator.sendBeacon when a page is hidden
+func (h *AnalyticsHandler) Collect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CollectRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBytes)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	h.collect(w, r, req)
+}
+
+// decodeOneOrMany reads a JSON object or an array of objects from a POST body. The
+// Content-Type is not checked, since sendBeacon sends strings as text/plain.
+func decodeOneOrMany[T any](w http.ResponseWriter, r *http.Request) ([]T, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBytes))
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	body = bytes.TrimSpace(body)
+
+	var items []T
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &items)
+	} else {
+		var item T
+		err = json.Unmarshal(body, &item)
+		items = []T{item}
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return items, true
+}
+
+// collect validates a batch, drops it if it comes from a bot, and queues it for
+// writing. The whole batch is rejected if any item is invalid or the queue is full.
+func (h *AnalyticsHandler) collect(w http.ResponseWriter, r *http.Request, req CollectRequest) {
+	count := len(req.PageViews) + len(req.Events)
+	if count == 0 {
+		http.Error(w, "No page views or events", http.StatusBadRequest)
+		return
+	}
+	if count > maxBatchItems {
+		http.Error(w, fmt.Sprintf("At most %d page views and events may be sent at once", maxBatchItems), http.StatusBadRequest)
+		return
+	}
+	for _, e := range req.Events {
+		if !analytics.ValidEventName(e.Name) {
+			http.Error(w, "Event name must be 1-100 letters, digits or _.:-", http.StatusBadRequest)
+			return
+		}
+		if analytics.ServerEvent(e.Name) {
+			http.Error(w, "Event name is reserved", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Accept bot traffic without recording it, so that it is not retried
+	if analytics.IsBot(r.UserAgent()) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 
 	// Get user ID from access token cookie
-	var userIDPtr *uuid.UUID
-	if cookie, err := r.Cookie("access_token"); err == nil {
-		token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err == nil && token.Valid {
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				if userIDStr, ok := claims["sub"].(string); ok {
-					if userID, err := uuid.Parse(userIDStr); err == nil {
-						userIDPtr = &userID
-					}
-				}
-			}
+	userIDPtr := h.cookieUserID(r)
+
+	// Identify the visitor anonymously, whether or not they are signed in, so that
+	// their views before signing in can be linked to the account
+	visitorID, err := h.visitors.VisitorID(r.Context(), w, r)
+	if err != nil {
+		log.Printf("[Analytics] Error identifying visitor: %v", err)
+		http.Error(w, "Failed to identify visitor", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	items := make([]ingest.Item, 0, count+1)
+	for _, v := range req.PageViews {
+		if v.Path == "" {
+			http.Error(w, "Path is required", http.StatusBadRequest)
+			return
+		}
+		// Each view gets a new session ID, used only if the visitor has no current session
+		pageView := analytics.NewPageView(
+			userIDPtr,
+			visitorID,
+			v.Path,
+			v.Referrer,
+			r.UserAgent(),
+			h.clientIPs.ClientIP(r),
+		)
+		pageView.CreatedAt = clientTime(v.Timestamp, now)
+		pageView.SessionID = uuid.NewString()
+		h.enricher.Enrich(pageView, r)
+		if len(pageView.Path) > analytics.MaxPathLength {
+			http.Error(w, fmt.Sprintf("Path must be at most %d characters", analytics.MaxPathLength), http.StatusBadRequest)
+			return
 		}
+		items = append(items, ingest.Item{PageView: pageView})
 	}
+	for _, e := range req.Events {
+		if e.Properties == nil {
+			e.Properties = map[string]any{}
+		}
+		items = append(items, ingest.Item{Event: &analytics.Event{
+			Name:       e.Name,
+			Properties: e.Properties,
+			UserID:     userIDPtr,
+			VisitorID:  visitorID,
+			CreatedAt:  clientTime(e.Timestamp, now),
+		}})
+	}
+
+	// Link the visitor's anonymous history once they are signed in; the link is
+	// made after the items queued before it are written
+	stitchKey := ""
+	if userIDPtr != nil {
+		stitchKey = visitorID + ":" + userIDPtr.String()
+		if _, ok := h.stitched.Get(stitchKey); ok {
+			stitchKey = ""
+		} else {
+			items = append(items, ingest.Item{Stitch: &ingest.Stitch{VisitorID: visitorID, UserID: *userIDPtr}})
+		}
+	}
+
+	if err := h.ingest.Enqueue(items...); err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Analytics is busy, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	if stitchKey != "" {
+		h.stitched.Set(stitchKey, true)
+	}
+
+	for _, item := range items {
+		if v := item.PageView; v != nil {
+			h.activity.Publish(activity.TypePageView, map[string]any{
+				"path":        v.Path,
+				"channel":     v.Channel,
+				"source":      v.Source,
+				"country":     v.Country,
+				"device_type": v.DeviceType,
+				"browser":     v.Browser,
+				"signed_in":   v.UserID != nil,
+			})
+		}
+	}
+	if len(req.PageViews) > 0 {
+		h.activity.Visit(visitorID)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// clientTime returns the time a client gave for a batched item, limited to the
+// last maxClientDelay, or now if it gave none
+func clientTime(t *time.Time, now time.Time) time.Time {
+	switch {
+	case t == nil || t.After(now):
+		return now
+	case t.Before(now.Add(-maxClientDelay)):
+		return now.Add(-maxClientDelay)
+	}
+	return *t
+}
 
-	// Use visitor ID from header only if user is not authenticated
-	var visitorID string
-	if userIDPtr == nil {
-		// Generate time-based visitor ID if not provided
-		visitorID = fmt.Sprintf("v_%d", time.Now().UnixNano())
+// GetFunnel handles GET /admin/analytics/funnel?steps=signup,email_verified,checkout_started&from=2025-01-01&to=2025-01-31
+// The range defaults to the last 30 days.
+func (h *AnalyticsHandler) GetFunnel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var steps []string
+	for _, step := range strings.Split(query.Get("steps"), ",") {
+		if step = strings.TrimSpace(step); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) < 2 || len(steps) > maxFunnelSteps {
+		http.Error(w, fmt.Sprintf("steps must list 2 to %d comma-separated event names", maxFunnelSteps), http.StatusBadRequest)
+		return
+	}
+	for _, step := range steps {
+		if !analytics.ValidEventName(step) {
+			http.Error(w, fmt.Sprintf("Invalid event name %q", step), http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Create page view
-	pageView := analytics.NewPageView(
-		userIDPtr,
-		visitorID,
-		req.Path,
-		req.Referrer,
-		r.UserAgent(),
-		r.RemoteAddr,
-	)
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"), defaultFunnelDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Track the page view
-	if err := h.pageViewService.TrackPageView(pageView); err != nil {
-		http.Error(w, "Failed to track page view", http.StatusInternalServerError)
+	events, err := h.pageViews.GetEvents(r.Context(), steps, from, to)
+	if err != nil {
+		log.Printf("[Analytics] Error loading funnel events: %v", err)
+		http.Error(w, "Failed to compute funnel", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analytics.BuildFunnel(events, steps, from, to))
+}
+
+// cookieUserID returns the signed-in user from the access token cookie, or nil for
+// anonymous visitors
+func (h *AnalyticsHandler) cookieUserID(r *http.Request) *uuid.UUID {
+	cookie, err := r.Cookie("access_token")
+	if err != nil {
+		return nil
+	}
+	token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return h.jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	userIDStr, ok := claims["sub"].(string)
+	if !ok {
+		return nil
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil
+	}
+	return &userID
+}
+
+// parseDateRange reads inclusive UTC days from and to, defaulting to the last
+// defaultDays days, and returns the half-open range [from, to)
+func parseDateRange(rawFrom, rawTo string, defaultDays int) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -defaultDays)
+	if rawFrom != "" {
+		t, err := time.Parse(time.DateOnly, rawFrom)
+		if err != nil {
+			return from, to, fmt.Errorf("from must be a date like 2006-01-02")
+		}
+		from = t
+	}
+	if rawTo != "" {
+		t, err := time.Parse(time.DateOnly, rawTo)
+		if err != nil {
+			return from, to, fmt.Errorf("to must be a date like 2006-01-02")
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
 }
 
 // GetUserJourney handles the GET request for retrieving a user's journey
@@ -111,7 +410,7 @@ func (h *AnalyticsHandler) GetUserJourney(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get user journey
-	journey, err := h.pageViewService.GetUserJourney(userID, req.StartTime, req.EndTime)
+	journey, err := h.pageViews.GetUserJourney(r.Context(), userID, req.StartTime, req.EndTime)
 	if err != nil {
 		http.Error(w, "Failed to retrieve user journey", http.StatusInternalServerError)
 		return
@@ -131,7 +430,7 @@ func (h *AnalyticsHandler) GetVisitorJourney(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Get all visitor journeys for the time period
-	journeys, err := h.pageViewService.GetVisitorJourneys(req.StartTime, req.EndTime)
+	journeys, err := h.pageViews.GetVisitorJourneys(r.Context(), req.StartTime, req.EndTime)
 	if err != nil {
 		http.Error(w, "Failed to retrieve visitor journeys", http.StatusInternalServerError)
 		return
@@ -151,7 +450,7 @@ func (h *AnalyticsHandler) GetPageViewStats(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Get page view statistics
-	stats, err := h.pageViewService.GetPageViewStats(req.StartTime, req.EndTime)
+	stats, err := h.pageViews.GetPageViewStats(r.Context(), req.StartTime, req.EndTime)
 	if err != nil {
 		http.Error(w, "Failed to retrieve page view statistics", http.StatusInternalServerError)
 		return
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"saas-server/database"
+	"saas-server/middleware"
+	"saas-server/models"
+	"saas-server/pkg/apikeys"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAPIKeys is the number of active keys a user may hold
+	maxAPIKeys = 25
+	// maxAPIKeyNameLength matches the name column
+	maxAPIKeyNameLength = 100
+	// maxAPIKeyLifetimeDays is the longest expiry a key may be given
+	maxAPIKeyLifetimeDays = 365
+)
+
+// APIKeysHandler lets users create, list and revoke personal API keys
+type APIKeysHandler struct {
+	db database.Store
+}
+
+// NewAPIKeysHandler creates a handler for the signed-in user's API keys
+func NewAPIKeysHandler(db database.Store) *APIKeysHandler {
+	return &APIKeysHandler{db: db}
+}
+
+// APIKeyRequest is the body of POST /api/user/api-keys. Scopes default to read
+// only; a key without ExpiresInDays never expires.
+type APIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// apiKeyWithSecret shows a key in full, which only happens when it is created
+type apiKeyWithSecret struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// Keys handles GET and POST /api/user/api-keys, listing and creating keys
+func (h *APIKeysHandler) Keys(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := h.db.GetAPIKeys(r.Context(), userID)
+		if err != nil {
+			log.Printf("[API Keys] Error loading keys for user %s: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, keys)
+
+	case http.MethodPost:
+		h.createKey(w, r, userID)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Key handles DELETE /api/user/api-keys/{id}, revoking a key. Revoked keys stay
+// listed with their revocation time.
+func (h *APIKeysHandler) Key(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/user/api-keys/")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	key, err := h.db.RevokeAPIKey(r.Context(), userID, id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[API Keys] Error revoking key %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[API Keys] User %s revoked key %s", userID, key.Prefix)
+	sendJSONResponse(w, http.StatusOK, key)
+}
+
+func (h *APIKeysHandler) createKey(w http.ResponseWriter, r *http.Request, userID string) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxAPIKeyNameLength {
+		http.Error(w, fmt.Sprintf("name is required and may be up to %d characters", maxAPIKeyNameLength), http.StatusBadRequest)
+		return
+	}
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apikeys.Scopes, scope) {
+			http.Error(w, fmt.Sprintf("Unknown scope %q; expected any of %s", scope, strings.Join(apikeys.Scopes, ", ")), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = append(scopes, apikeys.ScopeRead)
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyLifetimeDays {
+		http.Error(w, fmt.Sprintf("expires_in_days must be between 1 and %d, or omitted for a key that does not expire", maxAPIKeyLifetimeDays), http.StatusBadRequest)
+		return
+	}
+
+	secret, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		log.Printf("[API Keys] Error generating key: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	key := &models.APIKey{
+		ID:      uuid.NewString(),
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		KeyHash: hash,
+		Scopes:  scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	err = h.db.CreateAPIKey(r.Context(), key, maxAPIKeys)
+	if errors.Is(err, database.ErrAPIKeyLimit) {
+		http.Error(w, fmt.Sprintf("At most %d active API keys may be held", maxAPIKeys), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[API Keys] Error creating key for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[API Keys] User %s created key %s", userID, key.Prefix)
+	sendJSONResponse(w, http.StatusCreated, apiKeyWithSecret{key, secret})
+}
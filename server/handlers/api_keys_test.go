@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"saas-server/database/memstore"
+	"saas-server/middleware"
+	"saas-server/models"
+	"saas-server/pkg/apikeys"
+)
+
+// asUser returns r as if made by the signed-in user
+func asUser(r *http.Request, userID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, userID))
+}
+
+func TestAPIKeysCreate(t *testing.T) {
+	store := memstore.New()
+	user, err := store.CreateUser(context.Background(), "dev@example.com", "", "Dev", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		want       int
+		wantScopes []string
+	}{
+		{"defaults to read only", `{"name":"CI"}`, http.StatusCreated, []string{apikeys.ScopeRead}},
+		{"duplicate scopes are dropped", `{"name":"Deploy","scopes":["write","read","write"]}`, http.StatusCreated, []string{apikeys.ScopeWrite, apikeys.ScopeRead}},
+		{"expiring key", `{"name":"Temp","expires_in_days":30}`, http.StatusCreated, []string{apikeys.ScopeRead}},
+		{"name of 100 accented letters", `{"name":"` + strings.Repeat("é", 100) + `"}`, http.StatusCreated, []string{apikeys.ScopeRead}},
+		{"name too long", `{"name":"` + strings.Repeat("é", 101) + `"}`, http.StatusBadRequest, nil},
+		{"missing name", `{"name":"  "}`, http.StatusBadRequest, nil},
+		{"unknown scope", `{"name":"Admin","scopes":["admin"]}`, http.StatusBadRequest, nil},
+		{"negative expiry", `{"name":"Old","expires_in_days":-1}`, http.StatusBadRequest, nil},
+		{"expiry too long", `{"name":"Forever","expires_in_days":366}`, http.StatusBadRequest, nil},
+		{"invalid body", `{`, http.StatusBadRequest, nil},
+	}
+
+	h := NewAPIKeysHandler(store)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := asUser(httptest.NewRequest(http.MethodPost, "/api/user/api-keys", strings.NewReader(tt.body)), user.ID)
+			rec := httptest.NewRecorder()
+			h.Keys(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+
+			var created struct {
+				models.APIKey
+				Key string `json:"key"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+				t.Fatal(err)
+			}
+			if prefix, ok := apikeys.Prefix(created.Key); !ok || prefix != created.Prefix {
+				t.Errorf("key %q does not carry prefix %q", created.Key, created.Prefix)
+			}
+			if strings.Join(created.Scopes, ",") != strings.Join(tt.wantScopes, ",") {
+				t.Errorf("scopes = %v, want %v", created.Scopes, tt.wantScopes)
+			}
+			stored, err := store.GetAPIKeyByPrefix(context.Background(), created.Prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !apikeys.Matches(created.Key, stored.KeyHash) {
+				t.Error("stored hash does not match the returned key")
+			}
+		})
+	}
+}
+
+func TestAPIKeysLimit(t *testing.T) {
+	store := memstore.New()
+	user, err := store.CreateUser(context.Background(), "dev@example.com", "", "Dev", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewAPIKeysHandler(store)
+	create := func() int {
+		rec := httptest.NewRecorder()
+		h.Keys(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/user/api-keys", strings.NewReader(`{"name":"CI"}`)), user.ID))
+		return rec.Code
+	}
+	for i := 0; i < maxAPIKeys; i++ {
+		if code := create(); code != http.StatusCreated {
+			t.Fatalf("key %d: status = %d, want %d", i+1, code, http.StatusCreated)
+		}
+	}
+	if code := create(); code != http.StatusConflict {
+		t.Errorf("key over the limit: status = %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestAPIKeysRevoke(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	owner, err := store.CreateUser(ctx, "owner@example.com", "", "Owner", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.CreateUser(ctx, "other@example.com", "", "Other", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewAPIKeysHandler(store)
+	rec := httptest.NewRecorder()
+	h.Keys(rec, asUser(httptest.NewRequest(http.MethodPost, "/api/user/api-keys", strings.NewReader(`{"name":"CI"}`)), owner.ID))
+	var created models.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID string
+		method string
+		id     string
+		want   int
+	}{
+		{"other users cannot revoke it", other.ID, http.MethodDelete, created.ID, http.StatusNotFound},
+		{"malformed ID", owner.ID, http.MethodDelete, "nope", http.StatusNotFound},
+		{"wrong method", owner.ID, http.MethodGet, created.ID, http.StatusMethodNotAllowed},
+		{"owner revokes it", owner.ID, http.MethodDelete, created.ID, http.StatusOK},
+		{"revoking again is harmless", owner.ID, http.MethodDelete, created.ID, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := asUser(httptest.NewRequest(tt.method, "/api/user/api-keys/"+tt.id, nil), tt.userID)
+			rec := httptest.NewRecorder()
+			h.Key(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	stored, err := store.GetAPIKeyByPrefix(ctx, created.Prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RevokedAt == nil {
+		t.Error("key was not revoked")
+	}
+}
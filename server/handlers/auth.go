@@ -5,12 +5,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -20,18 +19,26 @@ import (
 	googleauth "google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
 
+	"saas-server/config"
 	"saas-server/database"
 	"saas-server/middleware"
-	"saas-server/models"
+	"saas-server/pkg/activity"
+	"saas-server/pkg/analytics"
+	"saas-server/pkg/plunk"
+	"saas-server/pkg/trial"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	db                 database.DBInterface
+	db                 database.Store
+	mailer             *plunk.Client
+	trials             *trial.Service
+	activity           *activity.Hub
 	jwtSecret          []byte
 	jwtRefreshSecret   []byte
 	authLimiter        *middleware.RateLimiter
+	frontendURL        string
 	googleClientID     string
 	googleClientSecret string
 	googleRedirectURL  string
@@ -84,34 +91,32 @@ type ResetPasswordRequest struct {
 	NewPassword string `json:"password"` // New password to set
 }
 
-// Cache for subscription status to reduce database load
-var (
-	subscriptionCache = make(map[string]*models.UserSubscriptionStatus)
-	cacheMutex        sync.RWMutex
-	cacheExpiry       = 5 * time.Minute
-)
-
 // GithubAuthRequest represents the request body for GitHub OAuth authentication
 type GithubAuthRequest struct {
 	Code string `json:"code"` // Authorization code from GitHub OAuth
 }
 
-// NewAuthHandler creates a new AuthHandler instance with the given database connection and JWT secret
-func NewAuthHandler(db database.DBInterface, jwtSecret string) *AuthHandler {
+// NewAuthHandler creates a new AuthHandler instance with the given database connection, configuration and mailer.
+// New accounts are granted a trial through trials.
+func NewAuthHandler(db database.Store, cfg *config.Config, mailer *plunk.Client, trials *trial.Service, hub *activity.Hub) *AuthHandler {
 	// Create rate limiter for auth endpoints - 5 attempts per minute
 	authLimiter := middleware.NewRateLimiter(time.Minute, 5)
 
 	return &AuthHandler{
 		db:                 db,
-		jwtSecret:          []byte(jwtSecret),
-		jwtRefreshSecret:   []byte(jwtSecret), // Using same secret for now, could be different in production
+		mailer:             mailer,
+		trials:             trials,
+		activity:           hub,
+		jwtSecret:          []byte(cfg.Auth.JWTSecret),
+		jwtRefreshSecret:   []byte(cfg.Auth.JWTSecret), // Using same secret for now, could be different in production
 		authLimiter:        authLimiter,
-		googleClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		googleClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		googleRedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-		githubClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-		githubClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-		githubRedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
+		frontendURL:        cfg.Server.FrontendURL,
+		googleClientID:     cfg.Google.ClientID,
+		googleClientSecret: cfg.Google.ClientSecret,
+		googleRedirectURL:  cfg.Google.RedirectURL,
+		githubClientID:     cfg.GitHub.ClientID,
+		githubClientSecret: cfg.GitHub.ClientSecret,
+		githubRedirectURL:  cfg.GitHub.RedirectURL,
 	}
 }
 
@@ -135,8 +140,11 @@ func (h *AuthHandler) GoogleAuth(w http.ResponseWriter, r *http.Request) {
 		Endpoint: google.Endpoint,
 	}
 
+	// Route the OAuth exchange and user info calls through the traced client
+	ctx := context.WithValue(r.Context(), goauth.HTTPClient, httpClient)
+
 	// Exchange authorization code for token
-	token, err := config.Exchange(context.Background(), req.Code)
+	token, err := config.Exchange(ctx, req.Code)
 	log.Printf("[Auth] Exchanging code with redirect URI: %s", config.RedirectURL)
 	if err != nil {
 		log.Printf("[Auth] Failed to exchange auth code: %v", err)
@@ -145,14 +153,14 @@ func (h *AuthHandler) GoogleAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user info using oauth2 service
-	oauth2Service, err := googleauth.NewService(context.Background(), option.WithTokenSource(config.TokenSource(context.Background(), token)))
+	oauth2Service, err := googleauth.NewService(ctx, option.WithHTTPClient(config.Client(ctx, token)))
 	if err != nil {
 		log.Printf("[Auth] Failed to create OAuth2 service: %v", err)
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify Google credentials")
 		return
 	}
 
-	userInfo, err := oauth2Service.Userinfo.Get().Do()
+	userInfo, err := oauth2Service.Userinfo.Get().Context(ctx).Do()
 	if err != nil {
 		log.Printf("[Auth] Failed to get user info: %v", err)
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get user information")
@@ -160,11 +168,11 @@ func (h *AuthHandler) GoogleAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the user exists or create a new one
-	user, err := h.db.GetUserByEmail(userInfo.Email)
+	user, err := h.db.GetUserByEmail(r.Context(), userInfo.Email)
 	if err != nil {
 		if err == database.ErrNotFound || err.Error() == "sql: no rows in result set" {
 			// Create new user with Google provider and verified email
-			user, err = h.db.CreateUser(userInfo.Email, "", userInfo.Name, true)
+			user, err = h.db.CreateUser(r.Context(), userInfo.Email, "", userInfo.Name, true)
 			if err != nil {
 				log.Printf("[Auth] Failed to create user: %v", err)
 				sendErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
@@ -172,10 +180,17 @@ func (h *AuthHandler) GoogleAuth(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Track user signup with Plunk for new users
-			if err := trackUserSignup(user.Email, user.Name); err != nil {
+			if err := trackUserSignup(r.Context(), h.mailer, user.Email, user.Name); err != nil {
 				log.Printf("[Auth] Error tracking user signup: %v", err)
 				// Continue even if tracking fails
 			}
+			analytics.Emit(r.Context(), h.db, analytics.EventSignup, user.ID, map[string]any{"method": "google"})
+			h.publishSignup(user, "google")
+
+			// Grant the free trial, if one is configured
+			if err := h.trials.StartAppTrial(r.Context(), user); err != nil {
+				log.Printf("[Auth] Error starting trial: %v", err)
+			}
 		} else {
 			log.Printf("[Auth] Database error while checking user: %v", err)
 			sendErrorResponse(w, http.StatusInternalServerError, "Internal server error")
@@ -225,7 +240,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user already exists
-	existingUser, err := h.db.GetUserByEmail(req.Email)
+	existingUser, err := h.db.GetUserByEmail(r.Context(), req.Email)
 	if err == nil && existingUser != nil {
 		http.Error(w, "Email already registered", http.StatusConflict)
 		return
@@ -240,7 +255,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create new user with email_verified set to false for regular registration
-	user, err := h.db.CreateUser(req.Email, string(hashedPassword), req.Name, false)
+	user, err := h.db.CreateUser(r.Context(), req.Email, string(hashedPassword), req.Name, false)
 	if err != nil {
 		log.Printf("[Auth] Error creating user: %v", err)
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
@@ -248,10 +263,17 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Track user signup with Plunk
-	if err := trackUserSignup(user.Email, user.Name); err != nil {
+	if err := trackUserSignup(r.Context(), h.mailer, user.Email, user.Name); err != nil {
 		log.Printf("[Auth] Error tracking user signup: %v", err)
 		// Continue even if tracking fails
 	}
+	analytics.Emit(r.Context(), h.db, analytics.EventSignup, user.ID, map[string]any{"method": "password"})
+	h.publishSignup(user, "password")
+
+	// Grant the free trial, if one is configured
+	if err := h.trials.StartAppTrial(r.Context(), user); err != nil {
+		log.Printf("[Auth] Error starting trial: %v", err)
+	}
 
 	// Send success response
 	w.WriteHeader(http.StatusCreated)
@@ -279,7 +301,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.db.GetUserByEmail(req.Email)
+	user, err := h.db.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		sendErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
 		return
@@ -307,7 +329,7 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 		// Try to blacklist old access token if present
 		if accessCookie, err := r.Cookie("access_token"); err == nil && accessCookie.Value != "" {
-			if _, err := h.validateAndBlacklistToken(accessCookie.Value); err != nil {
+			if _, err := h.validateAndBlacklistToken(r.Context(), accessCookie.Value); err != nil {
 				log.Printf("[Auth] Error blacklisting old access token: %v", err)
 				// Continue even if blacklisting fails
 			}
@@ -328,7 +350,7 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Validate refresh token and get user ID
-		userID, err := h.validateRefreshToken(cookie.Value)
+		userID, err := h.validateRefreshToken(r.Context(), cookie.Value)
 		if err != nil {
 			log.Printf("[Auth] Refresh token validation failed: %v", err)
 			sendErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
@@ -336,7 +358,7 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Get user details
-		user, err := h.db.GetUserByID(userID)
+		user, err := h.db.GetUserByID(r.Context(), userID)
 		if err != nil {
 			log.Printf("[Auth] Error fetching user details: %v", err)
 			sendErrorResponse(w, http.StatusInternalServerError, "Error fetching user details")
@@ -365,7 +387,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate and blacklist token
-	token, err := h.validateAndBlacklistToken(accessCookie.Value)
+	token, err := h.validateAndBlacklistToken(r.Context(), accessCookie.Value)
 	if err != nil {
 		sendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
 		return
@@ -374,7 +396,7 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID and invalidate refresh tokens
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		userID := claims["sub"].(string)
-		if err := h.db.DeleteAllUserRefreshTokens(userID); err != nil {
+		if err := h.db.DeleteAllUserRefreshTokens(r.Context(), userID); err != nil {
 			log.Printf("[Auth] Error invalidating refresh tokens: %v", err)
 		}
 	}
@@ -400,7 +422,7 @@ func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get user by email
-	user, err := h.db.GetUserByEmail(req.Email)
+	user, err := h.db.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		// Don't reveal whether the email exists
 		w.WriteHeader(http.StatusOK)
@@ -415,14 +437,14 @@ func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Reques
 	expiresAt := time.Now().Add(1 * time.Hour)
 
 	// Save reset token
-	if err := h.db.CreatePasswordResetToken(user.ID, token, expiresAt); err != nil {
+	if err := h.db.CreatePasswordResetToken(r.Context(), user.ID, token, expiresAt); err != nil {
 		http.Error(w, "Error creating password reset token", http.StatusInternalServerError)
 		return
 	}
 
 	// Send email with reset link
-	resetLink := fmt.Sprintf("%s/auth/reset-password?token=%s", os.Getenv("FRONTEND_URL"), token)
-	if err := sendPasswordResetEmail(user.Email, resetLink); err != nil {
+	resetLink := fmt.Sprintf("%s/auth/reset-password?token=%s", h.frontendURL, token)
+	if err := sendPasswordResetEmail(r.Context(), h.mailer, user.Email, resetLink); err != nil {
 		log.Printf("[Auth] Error sending password reset email: %v", err)
 		// Don't expose the error to the client for security
 		w.WriteHeader(http.StatusOK)
@@ -458,14 +480,14 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user ID from reset token
-	userID, err := h.db.GetPasswordResetToken(req.Token)
+	userID, err := h.db.GetPasswordResetToken(r.Context(), req.Token)
 	if err != nil {
 		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
 		return
 	}
 
 	// Mark token as used
-	if err := h.db.MarkPasswordResetTokenUsed(req.Token); err != nil {
+	if err := h.db.MarkPasswordResetTokenUsed(r.Context(), req.Token); err != nil {
 		http.Error(w, "Token has already been used", http.StatusBadRequest)
 		return
 	}
@@ -478,13 +500,13 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update password
-	if err := h.db.UpdatePassword(userID, string(hashedPassword)); err != nil {
+	if err := h.db.UpdatePassword(r.Context(), userID, string(hashedPassword)); err != nil {
 		http.Error(w, "Error updating password", http.StatusInternalServerError)
 		return
 	}
 
 	// Invalidate all refresh tokens for this user
-	if err := h.db.DeleteAllUserRefreshTokens(userID); err != nil {
+	if err := h.db.DeleteAllUserRefreshTokens(r.Context(), userID); err != nil {
 		log.Printf("[Auth] Error invalidating refresh tokens: %v", err)
 		// Don't return error here as the password is already updated
 	}
@@ -525,7 +547,7 @@ func (h *AuthHandler) AccountPasswordReset(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get user from database
-	user, err := h.db.GetUserByID(userID)
+	user, err := h.db.GetUserByID(r.Context(), userID)
 	if err != nil {
 		log.Printf("[Auth] User not found: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
@@ -548,14 +570,14 @@ func (h *AuthHandler) AccountPasswordReset(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Update password in database
-	if err := h.db.UpdatePassword(userID, string(hashedPassword)); err != nil {
+	if err := h.db.UpdatePassword(r.Context(), userID, string(hashedPassword)); err != nil {
 		log.Printf("[Auth] Failed to update password: %v", err)
 		http.Error(w, "Error updating password", http.StatusInternalServerError)
 		return
 	}
 
 	// Invalidate all refresh tokens for this user
-	if err := h.db.DeleteAllUserRefreshTokens(userID); err != nil {
+	if err := h.db.DeleteAllUserRefreshTokens(r.Context(), userID); err != nil {
 		log.Printf("[Auth] Error invalidating refresh tokens: %v", err)
 		// Don't return error here as the password is already updated
 	}
@@ -575,54 +597,21 @@ func (h *AuthHandler) VerifyUser(w http.ResponseWriter, r *http.Request) {
 	return
 	}
 
-	// Try to get status from cache first
-	cacheMutex.RLock()
-	if status, exists := subscriptionCache[userID]; exists {
-		cacheMutex.RUnlock()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(status)
-		return
-	}
-	cacheMutex.RUnlock()
-
-	// Create a channel for the database response
-	statusChan := make(chan *models.UserSubscriptionStatus, 1)
-	errChan := make(chan error, 1)
-
-	// Query database in a goroutine
-	go func() {
-		status, err := h.db.GetUserSubscriptionStatus(userID)
-		if err != nil {
-			errChan <- err
+	// Subscription status is served through the shared read-through cache
+	status, err := h.db.GetUserSubscriptionStatus(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("[Auth] Timeout getting subscription status for user: %s", userID)
+			http.Error(w, "Request timeout", http.StatusGatewayTimeout)
 			return
 		}
-		statusChan <- status
-
-		// Update cache in background
-		cacheMutex.Lock()
-		subscriptionCache[userID] = status
-		cacheMutex.Unlock()
-
-		// Set up cache expiry
-		time.AfterFunc(cacheExpiry, func() {
-			cacheMutex.Lock()
-			delete(subscriptionCache, userID)
-			cacheMutex.Unlock()
-		})
-	}()
-
-	// Wait for result with timeout
-	select {
-	case status := <-statusChan:
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(status)
-	case err := <-errChan:
 		log.Printf("[Auth] Error getting subscription status: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	case <-time.After(5 * time.Second):
-		log.Printf("[Auth] Timeout getting subscription status for user: %s", userID)
-		http.Error(w, "Request timeout", http.StatusGatewayTimeout)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
 }
 
 func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
@@ -648,8 +637,11 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	// Route the OAuth exchange through the traced client
+	ctx := context.WithValue(r.Context(), goauth.HTTPClient, httpClient)
+
 	// Exchange authorization code for token
-	token, err := config.Exchange(context.Background(), req.Code)
+	token, err := config.Exchange(ctx, req.Code)
 	if err != nil {
 		log.Printf("[Auth] Failed to exchange auth code: %v", err)
 		sendErrorResponse(w, http.StatusUnauthorized, "Failed to authenticate with GitHub")
@@ -657,8 +649,7 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user info from GitHub API
-	client := &http.Client{}
-	userReq, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	userReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user", nil)
 	if err != nil {
 		log.Printf("[Auth] Failed to create GitHub API request: %v", err)
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get user information")
@@ -667,7 +658,7 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 	userReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	userReq.Header.Set("Accept", "application/json")
 
-	resp, err := client.Do(userReq)
+	resp, err := httpClient.Do(userReq)
 	if err != nil {
 		log.Printf("[Auth] Failed to get user info from GitHub: %v", err)
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get user information")
@@ -690,7 +681,7 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 
 	// If email is not public, fetch user's primary email
 	if githubUser.Email == "" {
-		emailReq, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
+		emailReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user/emails", nil)
 		if err != nil {
 			log.Printf("[Auth] Failed to create GitHub emails request: %v", err)
 			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get user email")
@@ -699,7 +690,7 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 		emailReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 		emailReq.Header.Set("Accept", "application/json")
 
-		emailResp, err := client.Do(emailReq)
+		emailResp, err := httpClient.Do(emailReq)
 		if err != nil {
 			log.Printf("[Auth] Failed to get user emails from GitHub: %v", err)
 			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get user email")
@@ -751,12 +742,12 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the user exists or create a new one
-	user, err := h.db.GetUserByEmail(githubUser.Email)
+	user, err := h.db.GetUserByEmail(r.Context(), githubUser.Email)
 	if err != nil {
 		if err == database.ErrNotFound || err.Error() == "sql: no rows in result set" {
 
 			// Create new user with email_verified set to true for GitHub auth
-			user, err = h.db.CreateUser(githubUser.Email, "", githubUser.Name, true)
+			user, err = h.db.CreateUser(r.Context(), githubUser.Email, "", githubUser.Name, true)
 			if err != nil {
 				log.Printf("[Auth] Failed to create user: %v", err)
 				sendErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
@@ -764,10 +755,17 @@ func (h *AuthHandler) GithubAuth(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Track user signup with Plunk for new users
-			if err := trackUserSignup(user.Email, user.Name); err != nil {
+			if err := trackUserSignup(r.Context(), h.mailer, user.Email, user.Name); err != nil {
 				log.Printf("[Auth] Error tracking user signup: %v", err)
 				// Continue even if tracking fails
 			}
+			analytics.Emit(r.Context(), h.db, analytics.EventSignup, user.ID, map[string]any{"method": "github"})
+			h.publishSignup(user, "github")
+
+			// Grant the free trial, if one is configured
+			if err := h.trials.StartAppTrial(r.Context(), user); err != nil {
+				log.Printf("[Auth] Error starting trial: %v", err)
+			}
 		} else {
 			log.Printf("[Auth] Database error while checking user: %v", err)
 			sendErrorResponse(w, http.StatusInternalServerError, "Internal server error")
@@ -2,12 +2,11 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"regexp"
 	"time"
 
@@ -16,6 +15,8 @@ import (
 
 	"saas-server/middleware"
 	"saas-server/models"
+	"saas-server/pkg/activity"
+	"saas-server/pkg/plunk"
 )
 
 // Common response types
@@ -66,13 +67,13 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[Auth] Updating profile for user: %s", userID)
-	if err := h.db.UpdateUser(userID, req.Name, req.Email); err != nil {
+	if err := h.db.UpdateUser(r.Context(), userID, req.Name, req.Email); err != nil {
 		log.Printf("[Auth] Failed to update profile: %v", err)
 		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return
 	}
 
-	user, err := h.db.GetUserByID(userID)
+	user, err := h.db.GetUserByID(r.Context(), userID)
 	if err != nil {
 		log.Printf("[Auth] Failed to get updated user: %v", err)
 		http.Error(w, "Failed to get updated user", http.StatusInternalServerError)
@@ -231,8 +232,8 @@ func (h *AuthHandler) sendAuthResponse(w http.ResponseWriter, user *models.User)
 }
 
 // Token validation and blacklisting helpers
-func (h *AuthHandler) validateAndBlacklistToken(tokenString string) (*jwt.Token, error) {
-	token, err := h.validateToken(tokenString)
+func (h *AuthHandler) validateAndBlacklistToken(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	token, err := h.validateToken(ctx, tokenString)
 	if err != nil {
 		return nil, err
 	}
@@ -257,7 +258,7 @@ func (h *AuthHandler) validateAndBlacklistToken(tokenString string) (*jwt.Token,
 		return nil, fmt.Errorf("missing exp claim")
 	}
 
-	if err := h.db.AddToBlacklist(jti, userID, time.Unix(int64(exp), 0)); err != nil {
+	if err := h.db.AddToBlacklist(ctx, jti, userID, time.Unix(int64(exp), 0)); err != nil {
 		return nil, fmt.Errorf("error blacklisting token: %w", err)
 	}
 
@@ -265,7 +266,7 @@ func (h *AuthHandler) validateAndBlacklistToken(tokenString string) (*jwt.Token,
 }
 
 // validateToken validates a JWT token and returns the parsed token if valid
-func (h *AuthHandler) validateToken(tokenString string) (*jwt.Token, error) {
+func (h *AuthHandler) validateToken(ctx context.Context, tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -283,7 +284,7 @@ func (h *AuthHandler) validateToken(tokenString string) (*jwt.Token, error) {
 			return nil, fmt.Errorf("missing jti claim")
 		}
 
-		blacklisted, err := h.db.IsTokenBlacklisted(jti)
+		blacklisted, err := h.db.IsTokenBlacklisted(ctx, jti)
 		if err != nil {
 			return nil, fmt.Errorf("error checking token blacklist: %w", err)
 		}
@@ -327,7 +328,7 @@ func getDeviceInfo(r *http.Request) (string, string) {
 }
 
 // Token validation helpers
-func (h *AuthHandler) validateRefreshToken(tokenString string) (string, error) {
+func (h *AuthHandler) validateRefreshToken(ctx context.Context, tokenString string) (string, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -351,7 +352,7 @@ func (h *AuthHandler) validateRefreshToken(tokenString string) (string, error) {
 	}
 
 	// Verify refresh token in database using the JTI
-	storedToken, err := h.db.GetRefreshToken(jti)
+	storedToken, err := h.db.GetRefreshToken(ctx, jti)
 	if err != nil {
 		return "", fmt.Errorf("error verifying refresh token: %w", err)
 	}
@@ -392,7 +393,7 @@ func (h *AuthHandler) GenerateAuthResponse(w http.ResponseWriter, r *http.Reques
 	userAgent, ipAddress := getDeviceInfo(r)
 
 	// Store refresh token
-	if err := h.db.CreateRefreshToken(user.ID, tokens.RefreshJTI, userAgent, ipAddress, tokens.ExpiresAt); err != nil {
+	if err := h.db.CreateRefreshToken(r.Context(), user.ID, tokens.RefreshJTI, userAgent, ipAddress, tokens.ExpiresAt); err != nil {
 		return fmt.Errorf("error storing refresh token: %w", err)
 	}
 
@@ -405,55 +406,23 @@ func (h *AuthHandler) GenerateAuthResponse(w http.ResponseWriter, r *http.Reques
 }
 
 // Track user signup with Plunk
-func trackUserSignup(email string, name string) error {
-	plunkAPIKey := os.Getenv("PLUNK_SECRET_API_KEY")
-	if plunkAPIKey == "" {
-		return fmt.Errorf("PLUNK_SECRET_API_KEY not set")
-	}
-
-	type UserData struct {
-		Name string `json:"name"`
-	}
-
-	type TrackRequest struct {
-		Event     string   `json:"event"`
-		Email     string   `json:"email"`
-		Subscribed bool     `json:"subscribed"` // Added subscribed field
-		Data      UserData `json:"data"`
-	}
-
-	trackReq := TrackRequest{
-		Event:     "user-signup",
-		Email:     email,
-		Subscribed: true, // Set subscribed to true
-		Data: UserData{
-			Name: name,
+func trackUserSignup(ctx context.Context, mailer *plunk.Client, email string, name string) error {
+	return mailer.Track(ctx, plunk.Event{
+		Event:      "user-signup",
+		Email:      email,
+		Subscribed: true,
+		Data: map[string]interface{}{
+			"name": name,
 		},
-	}
-
-	jsonData, err := json.Marshal(trackReq)
-	if err != nil {
-		return fmt.Errorf("error marshaling track request: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.useplunk.com/v1/track", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+plunkAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error tracking signup: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error response from Plunk API: %d", resp.StatusCode)
-	}
+	})
+}
 
-	return nil
+// publishSignup shows a new account in the admin activity stream
+func (h *AuthHandler) publishSignup(user *models.User, method string) {
+	h.activity.Publish(activity.TypeSignup, map[string]any{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"name":    user.Name,
+		"method":  method,
+	})
 }
@@ -1,31 +1,57 @@
 package handlers
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"saas-server/database"
+	"saas-server/middleware"
+	"saas-server/models"
+	"saas-server/pkg/analytics"
 	"saas-server/pkg/lemonsqueezy"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Keys of the custom data attached to checkouts and echoed back in webhooks
+const (
+	customDataUserID     = "user_id"
+	customDataCheckoutID = "checkout_id"
+	customDataSignature  = "signature"
 )
 
+// defaultAbandonedAfter is how long a checkout may stay pending before it is reported as abandoned
+const defaultAbandonedAfter = 24 * time.Hour
+
 type CheckoutHandler struct {
-	client *lemonsqueezy.Client
-	db     database.DBInterface
+	client         *lemonsqueezy.Client
+	db             database.Store
+	secret         string
+	allowedOrigins []string
 }
 
 type CheckoutRequest struct {
-	ProductID string `json:"productId"`
-	VariantID string `json:"variantId"`
-	Email     string `json:"email"`
-	UserID    string `json:"userId"`
+	VariantID    string `json:"variantId"`
+	DiscountCode string `json:"discountCode"`
+	RedirectURL  string `json:"redirectUrl"`
 }
 
-func NewCheckoutHandler(db database.DBInterface) *CheckoutHandler {
-	return &CheckoutHandler{client: lemonsqueezy.NewClient(), db: db}
+// NewCheckoutHandler creates a checkout handler. secret signs the custom data attached
+// to checkouts; redirect URLs must belong to one of allowedOrigins.
+func NewCheckoutHandler(db database.Store, client *lemonsqueezy.Client, secret string, allowedOrigins []string) *CheckoutHandler {
+	return &CheckoutHandler{client: client, db: db, secret: secret, allowedOrigins: allowedOrigins}
 }
 
-// CreateCheckout handles POST /api/checkout
+// CreateCheckout handles POST /api/checkout for the signed-in user
 func (h *CheckoutHandler) CreateCheckout(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -37,12 +63,34 @@ func (h *CheckoutHandler) CreateCheckout(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	variantID, err := strconv.Atoi(req.VariantID)
+	if err != nil {
+		http.Error(w, "Valid variantId is required", http.StatusBadRequest)
+		return
+	}
+	req.DiscountCode = strings.TrimSpace(req.DiscountCode)
+	if len(req.DiscountCode) > 100 {
+		http.Error(w, "Invalid discount code", http.StatusBadRequest)
+		return
+	}
+	if req.RedirectURL != "" && !h.allowedRedirect(req.RedirectURL) {
+		http.Error(w, "Redirect URL is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	// The buyer is always the signed-in user, never someone named in the request
+	userID := middleware.GetUserID(r.Context())
+	user, err := h.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
 
 	// Check if user already has a subscription
-	subscription, err := h.db.GetSubscriptionByUserID(req.UserID)
+	subscription, err := h.db.GetSubscriptionByUserID(r.Context(), user.ID)
 	if err == nil && subscription != nil {
 		// User has an active subscription, get their customer portal URL
-		customer, err := h.client.GetCustomer(strconv.Itoa(subscription.CustomerID))
+		customer, err := h.client.GetCustomer(r.Context(), strconv.Itoa(subscription.CustomerID))
 		if err != nil {
 			http.Error(w, "Failed to fetch customer portal", http.StatusInternalServerError)
 			return
@@ -54,39 +102,134 @@ func (h *CheckoutHandler) CreateCheckout(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[Checkout] Error loading subscription for user %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-	// Get and validate required environment variables
-	storeIDStr := os.Getenv("LEMON_SQUEEZY_STORE_ID")
-	signingSecret := os.Getenv("LEMON_SQUEEZY_SIGNING_SECRET")
-
-	if storeIDStr == "" || signingSecret == "" {
-		http.Error(w, "Missing required environment configuration", http.StatusInternalServerError)
+	// Record the checkout first so its ID can be bound into the signed custom data
+	checkout := &models.Checkout{
+		ID:           uuid.New().String(),
+		UserID:       user.ID,
+		VariantID:    variantID,
+		DiscountCode: req.DiscountCode,
+	}
+	if err := h.db.CreatePendingCheckout(r.Context(), checkout); err != nil {
+		log.Printf("[Checkout] Error recording checkout for user %s: %v", user.ID, err)
+		http.Error(w, "Failed to create checkout", http.StatusInternalServerError)
 		return
 	}
 
-	checkout, err := h.client.CreateCheckout(
-		storeIDStr,
-		req.VariantID,
-		map[string]interface{}{
-			"email": req.Email,
-			"checkout_data": lemonsqueezy.CheckoutData{
-				Custom: map[string]interface{}{
-					"user_id": req.UserID,
-				},
-			},
+	options := map[string]interface{}{
+		"email": user.Email,
+		"name":  user.Name,
+		"checkout_data": lemonsqueezy.CheckoutData{
+			DiscountCode: req.DiscountCode,
+			Custom:       signCustomData(h.secret, user.ID, checkout.ID),
 		},
-	)
+	}
+	if req.RedirectURL != "" {
+		options["product_options"] = lemonsqueezy.ProductOptions{RedirectURL: req.RedirectURL}
+	}
 
+	result, err := h.client.CreateCheckout(r.Context(), h.client.StoreID(), req.VariantID, options)
 	if err != nil {
+		log.Printf("[Checkout] Error creating checkout for user %s: %v", user.ID, err)
+		if err := h.db.DeleteCheckout(r.Context(), checkout.ID); err != nil {
+			log.Printf("[Checkout] Error removing failed checkout %s: %v", checkout.ID, err)
+		}
 		http.Error(w, "Failed to create checkout", http.StatusInternalServerError)
 		return
 	}
 
 	// Extract checkout URL from the response
-	checkoutURL := checkout.Data.Attributes.URL
+	checkoutURL := result.Data.Attributes.URL
+	if err := h.db.SetCheckoutURL(r.Context(), checkout.ID, result.Data.ID, checkoutURL); err != nil {
+		log.Printf("[Checkout] Error saving URL of checkout %s: %v", checkout.ID, err)
+	}
+	analytics.Emit(r.Context(), h.db, analytics.EventCheckoutStarted, user.ID, map[string]any{
+		"checkout_id": checkout.ID,
+		"variant_id":  variantID,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"checkoutURL": checkoutURL,
 	})
 }
+
+// GetAbandonedCheckouts handles GET /admin/checkouts/abandoned?olderThan=24h
+func (h *CheckoutHandler) GetAbandonedCheckouts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	olderThan := defaultAbandonedAfter
+	if raw := r.URL.Query().Get("olderThan"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid olderThan duration", http.StatusBadRequest)
+			return
+		}
+		olderThan = d
+	}
+
+	checkouts, err := h.db.GetAbandonedCheckouts(r.Context(), time.Now().Add(-olderThan))
+	if err != nil {
+		log.Printf("[Checkout] Error loading abandoned checkouts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"checkouts": checkouts,
+		"total":     len(checkouts),
+	})
+}
+
+// allowedRedirect reports whether a post-purchase redirect points at one of our own origins
+func (h *CheckoutHandler) allowedRedirect(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range h.allowedOrigins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// signCustomData builds the custom data for a checkout, signed so that the webhook
+// can trust which user and checkout an order belongs to
+func signCustomData(secret, userID, checkoutID string) map[string]interface{} {
+	return map[string]interface{}{
+		customDataUserID:     userID,
+		customDataCheckoutID: checkoutID,
+		customDataSignature:  customDataMAC(secret, userID, checkoutID),
+	}
+}
+
+// verifyCustomData returns the user ID from webhook custom data if its signature is valid
+func verifyCustomData(secret string, data map[string]string) (string, bool) {
+	userID, checkoutID := data[customDataUserID], data[customDataCheckoutID]
+	if secret == "" || userID == "" || checkoutID == "" {
+		return "", false
+	}
+	expected := customDataMAC(secret, userID, checkoutID)
+	if !hmac.Equal([]byte(data[customDataSignature]), []byte(expected)) {
+		return "", false
+	}
+	return userID, true
+}
+
+func customDataMAC(secret, userID, checkoutID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(customDataUserID + "=" + userID + "&" + customDataCheckoutID + "=" + checkoutID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
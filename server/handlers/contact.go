@@ -1,16 +1,20 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
-	"io"
 	"log"
 	"net/http"
-	"os"
+
+	"saas-server/pkg/activity"
+	"saas-server/pkg/plunk"
 )
 
 // ContactHandler handles requests related to contact form submissions
-type ContactHandler struct{}
+type ContactHandler struct {
+	mailer     *plunk.Client
+	adminEmail string
+	activity   *activity.Hub
+}
 
 // ContactFormRequest represents the data submitted from the contact form
 type ContactFormRequest struct {
@@ -20,9 +24,9 @@ type ContactFormRequest struct {
 	Message string `json:"message"`
 }
 
-// NewContactHandler creates a new instance of ContactHandler
-func NewContactHandler() *ContactHandler {
-	return &ContactHandler{}
+// NewContactHandler creates a new instance of ContactHandler that delivers messages to adminEmail
+func NewContactHandler(mailer *plunk.Client, adminEmail string, hub *activity.Hub) *ContactHandler {
+	return &ContactHandler{mailer: mailer, adminEmail: adminEmail, activity: hub}
 }
 
 // SendContactEmail handles the contact form submission and sends an email to the admin
@@ -47,14 +51,6 @@ func (h *ContactHandler) SendContactEmail(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get admin email from environment variables
-	adminEmail := os.Getenv("ADMIN_EMAIL")
-	if adminEmail == "" {
-		log.Println("[ContactHandler] Admin email not configured")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
 	// Set default subject if empty
 	subject := "Contact Form Submission"
 	if req.Subject != "" {
@@ -70,65 +66,23 @@ func (h *ContactHandler) SendContactEmail(w http.ResponseWriter, r *http.Request
 <p>` + req.Message + `</p>
 `
 
-	// Create email request for Plunk API
-	emailReq := map[string]interface{}{
-		"to":      adminEmail,
-		"subject": "Contact Form: " + subject,
-		"body":    emailContent,
-		"reply":   req.Email, // Set reply-to to the contact form submitter's email
-	}
-
-	// Send email using Plunk API
-	jsonData, err := json.Marshal(emailReq)
-	if err != nil {
-		log.Printf("[ContactHandler] Error marshaling email request: %v", err)
-		http.Error(w, "Error sending email", http.StatusInternalServerError)
-		return
-	}
-
-	plunkAPIKey := os.Getenv("PLUNK_SECRET_API_KEY")
-	if plunkAPIKey == "" {
-		log.Printf("[ContactHandler] PLUNK_SECRET_API_KEY not set")
-		http.Error(w, "Error sending email", http.StatusInternalServerError)
-		return
-	}
-
-	// Create HTTP request to Plunk API
-	plunkReq, err := http.NewRequest("POST", "https://api.useplunk.com/v1/send", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("[ContactHandler] Error creating request: %v", err)
-		http.Error(w, "Error sending email", http.StatusInternalServerError)
-		return
-	}
-
-	// Set headers
-	plunkReq.Header.Set("Content-Type", "application/json")
-	plunkReq.Header.Set("Authorization", "Bearer "+plunkAPIKey)
-
-	// Add reply-to header via Plunk API custom headers
-	// Note: Plunk doesn't directly support reply-to in their basic API
-	// Consider adding custom headers if Plunk supports it in the future
-
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(plunkReq)
-	if err != nil {
+	// Send email using Plunk API, with reply-to set to the contact form submitter's email
+	if err := h.mailer.Send(r.Context(), plunk.Email{
+		To:      h.adminEmail,
+		Subject: "Contact Form: " + subject,
+		Body:    emailContent,
+		Reply:   req.Email,
+	}); err != nil {
 		log.Printf("[ContactHandler] Error sending email: %v", err)
 		http.Error(w, "Error sending email", http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
-
-	// Read and log the response body for debugging
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("[ContactHandler] Plunk API response: %s", string(respBody))
 
-	// Check response
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[ContactHandler] Error response from Plunk API: %d - %s", resp.StatusCode, string(respBody))
-		http.Error(w, "Error sending email", http.StatusInternalServerError)
-		return
-	}
+	h.activity.Publish(activity.TypeContact, map[string]any{
+		"name":    req.Name,
+		"email":   req.Email,
+		"subject": subject,
+	})
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/cache"
+	"time"
+)
+
+// dashboardCacheTTL is how long the dashboard KPIs are served before being recomputed
+const dashboardCacheTTL = time.Minute
+
+// DashboardHandler serves the admin dashboard KPIs. The aggregates scan whole
+// tables, so the result is cached briefly rather than recomputed on every load.
+type DashboardHandler struct {
+	db    database.DashboardRepository
+	cache *cache.Cache[string, *models.DashboardSummary]
+}
+
+func NewDashboardHandler(db database.DashboardRepository) *DashboardHandler {
+	return &DashboardHandler{
+		db:    db,
+		cache: cache.New[string, *models.DashboardSummary](1, dashboardCacheTTL),
+	}
+}
+
+// GetDashboard handles GET /admin/dashboard. Add refresh=true to bypass the cache.
+func (h *DashboardHandler) GetDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("refresh") == "true" {
+		h.cache.Purge()
+	}
+
+	summary, err := h.cache.GetOrLoad("summary", func() (*models.DashboardSummary, error) {
+		return h.db.GetDashboardSummary(r.Context(), time.Now())
+	})
+	if err != nil {
+		log.Printf("[Dashboard] Error loading dashboard summary: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	json.NewEncoder(w).Encode(summary)
+}
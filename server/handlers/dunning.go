@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"saas-server/database"
+	"strconv"
+	"time"
+)
+
+// defaultDunningStatsDays is the reporting window used when none is requested
+const defaultDunningStatsDays = 30
+
+// DunningHandler reports how failed subscription payments are being recovered
+type DunningHandler struct {
+	db database.DunningRepository
+}
+
+func NewDunningHandler(db database.DunningRepository) *DunningHandler {
+	return &DunningHandler{db: db}
+}
+
+// GetDunningStats handles GET /admin/dunning/stats?days=30
+func (h *DunningHandler) GetDunningStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultDunningStatsDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	stats, err := h.db.GetDunningStats(r.Context(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("[Dunning] Error loading dunning stats: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -13,11 +13,11 @@ import (
 
 // EarlyAccessHandler handles early access waiting list requests
 type EarlyAccessHandler struct {
-	DB *database.DB
+	DB database.MarketingRepository
 }
 
 // NewEarlyAccessHandler creates a new early access handler
-func NewEarlyAccessHandler(db *database.DB) *EarlyAccessHandler {
+func NewEarlyAccessHandler(db database.MarketingRepository) *EarlyAccessHandler {
 	return &EarlyAccessHandler{DB: db}
 }
 
@@ -47,7 +47,7 @@ func (h *EarlyAccessHandler) Register(w http.ResponseWriter, r *http.Request) {
 	req.Referrer = sanitizeReferrer(req.Referrer)
 
 	// Check if email already exists
-	exists, err := h.DB.EarlyAccessEmailExists(req.Email)
+	exists, err := h.DB.EarlyAccessEmailExists(r.Context(), req.Email)
 	if err != nil {
 		log.Printf("[EarlyAccessHandler] Error checking for existing email: %v", err)
 		http.Error(w, "Failed to process request", http.StatusInternalServerError)
@@ -57,7 +57,7 @@ func (h *EarlyAccessHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if exists {
 		// If email exists, just update the referrer if provided
 		if req.Referrer != "" {
-			err := h.DB.UpdateEarlyAccessReferrer(req.Email, req.Referrer)
+			err := h.DB.UpdateEarlyAccessReferrer(r.Context(), req.Email, req.Referrer)
 			if err != nil {
 				log.Printf("[EarlyAccessHandler] Error updating referrer: %v", err)
 				// Don't return an error to the client, just log it
@@ -73,7 +73,7 @@ func (h *EarlyAccessHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert new early access record
-	err = h.DB.CreateEarlyAccessEntry(req.Email, req.Referrer)
+	err = h.DB.CreateEarlyAccessEntry(r.Context(), req.Email, req.Referrer)
 	if err != nil {
 		log.Printf("[EarlyAccessHandler] Error inserting record: %v", err)
 		http.Error(w, "Failed to register for early access", http.StatusInternalServerError)
@@ -135,7 +135,7 @@ func (h *EarlyAccessHandler) GetAllEarlyAccessRegistrations(w http.ResponseWrite
 	}
 
 	// Query database for all registrations
-	registrations, err := h.DB.GetAllEarlyAccessEntries()
+	registrations, err := h.DB.GetAllEarlyAccessEntries(r.Context())
 	if err != nil {
 		log.Printf("[EarlyAccessHandler] Error querying registrations: %v", err)
 		http.Error(w, "Failed to retrieve registrations", http.StatusInternalServerError)
@@ -1,20 +1,18 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
+
+	"saas-server/pkg/plunk"
+	"saas-server/pkg/telemetry"
 )
 
-type PlunkEmailRequest struct {
-	To      string `json:"to"`
-	Subject string `json:"subject"`
-	Body    string `json:"body"`
-}
+// httpClient is shared by all outbound calls to third-party APIs so that each call is traced
+var httpClient = telemetry.NewHTTPClient()
 
 // AdminEmailRequest represents the request structure for admin to send an email
 type AdminEmailRequest struct {
@@ -23,12 +21,8 @@ type AdminEmailRequest struct {
 	Body    string `json:"body"`
 }
 
-func sendPasswordResetEmail(email, resetLink string) error {
-	plunkAPIKey := os.Getenv("PLUNK_SECRET_API_KEY")
-	if plunkAPIKey == "" {
-		return fmt.Errorf("PLUNK_SECRET_API_KEY not set")
-	}
-
+// sendPasswordResetEmail sends the password reset link to the user
+func sendPasswordResetEmail(ctx context.Context, mailer *plunk.Client, email, resetLink string) error {
 	htmlBody := fmt.Sprintf(`
 		<!DOCTYPE html>
 		<html>
@@ -67,37 +61,11 @@ func sendPasswordResetEmail(email, resetLink string) error {
 		</html>
 	`, resetLink, resetLink)
 
-	emailReq := PlunkEmailRequest{
+	return mailer.Send(ctx, plunk.Email{
 		To:      email,
 		Subject: "Reset Your Password",
 		Body:    htmlBody,
-	}
-
-	jsonData, err := json.Marshal(emailReq)
-	if err != nil {
-		return fmt.Errorf("error marshaling email request: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.useplunk.com/v1/send", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+plunkAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending email: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error response from Plunk API: %d", resp.StatusCode)
-	}
-
-	return nil
+	})
 }
 
 // AdminSendEmailHandler handles the request to send an email from admin to a user
@@ -122,7 +90,13 @@ func (h *Handler) AdminSendEmailHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Send the email using Plunk API
-	if err := sendAdminEmail(req); err != nil {
+	if err := h.Mailer.Send(r.Context(), plunk.Email{
+		To:      req.To,
+		Subject: req.Subject,
+		Body:    req.Body,
+		Type:    "html",
+	}); err != nil {
+		log.Printf("[Email] Error sending admin email: %v", err)
 		http.Error(w, "Failed to send email: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -132,51 +106,3 @@ func (h *Handler) AdminSendEmailHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Email sent successfully"})
 }
-
-// sendAdminEmail sends an email using the Plunk API
-func sendAdminEmail(req AdminEmailRequest) error {
-	plunkAPIKey := os.Getenv("PLUNK_SECRET_API_KEY")
-	if plunkAPIKey == "" {
-		return fmt.Errorf("PLUNK_SECRET_API_KEY not set")
-	}
-
-	// Create the email payload
-	emailPayload := map[string]interface{}{
-		"to":      req.To,
-		"subject": req.Subject,
-		"body":    req.Body,
-		"type":    "html", // Explicitly set the type to HTML
-	}
-
-	jsonData, err := json.Marshal(emailPayload)
-	if err != nil {
-		return fmt.Errorf("error marshaling email request: %v", err)
-	}
-
-	log.Printf("Sending email payload: %s", string(jsonData))
-
-	httpReq, err := http.NewRequest("POST", "https://api.useplunk.com/v1/send", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+plunkAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("error sending email: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Read and log the response body for debugging
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Plunk API response: %s", string(respBody))
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error response from Plunk API: %d - %s", resp.StatusCode, string(respBody))
-	}
-
-	return nil
-}
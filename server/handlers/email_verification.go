@@ -1,13 +1,14 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"saas-server/middleware"
+	"saas-server/pkg/activity"
+	"saas-server/pkg/analytics"
+	"saas-server/pkg/plunk"
 	"time"
 
 	"github.com/google/uuid"
@@ -36,7 +37,7 @@ func (h *AuthHandler) SendVerificationEmail(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Get user details
-	user, err := h.db.GetUserByID(userID)
+	user, err := h.db.GetUserByID(r.Context(), userID)
 	if err != nil {
 		log.Printf("Error getting user: %v", err)
 		http.Error(w, "Error getting user details", http.StatusInternalServerError)
@@ -54,7 +55,7 @@ func (h *AuthHandler) SendVerificationEmail(w http.ResponseWriter, r *http.Reque
 	expiresAt := time.Now().Add(24 * time.Hour)
 
 	// Store verification token in database
-	err = h.db.StoreEmailVerificationToken(token, userID, user.Email, expiresAt)
+	err = h.db.StoreEmailVerificationToken(r.Context(), token, userID, user.Email, expiresAt)
 	if err != nil {
 		log.Printf("Error storing verification token: %v", err)
 		http.Error(w, "Error generating verification token", http.StatusInternalServerError)
@@ -62,11 +63,7 @@ func (h *AuthHandler) SendVerificationEmail(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Generate verification link
-	clientURL := os.Getenv("FRONTEND_URL")
-	if clientURL == "" {
-		clientURL = "http://localhost:3000" // Default for development
-	}
-	verificationLink := fmt.Sprintf("%s/auth/verify-email?token=%s", clientURL, token)
+	verificationLink := fmt.Sprintf("%s/auth/verify-email?token=%s", h.frontendURL, token)
 
 	// Send verification email
 	htmlBody := fmt.Sprintf(`
@@ -107,48 +104,13 @@ func (h *AuthHandler) SendVerificationEmail(w http.ResponseWriter, r *http.Reque
 		</html>
 	`, verificationLink, verificationLink)
 
-	emailReq := PlunkEmailRequest{
+	// Send email using Plunk
+	if err := h.mailer.Send(r.Context(), plunk.Email{
 		To:      user.Email,
 		Subject: "Verify Your Email Address",
 		Body:    htmlBody,
-	}
-
-	// Send email using Plunk
-	jsonData, err := json.Marshal(emailReq)
-	if err != nil {
-		log.Printf("Error marshaling email request: %v", err)
-		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
-		return
-	}
-
-	plunkAPIKey := os.Getenv("PLUNK_SECRET_API_KEY")
-	if plunkAPIKey == "" {
-		log.Printf("PLUNK_SECRET_API_KEY not set")
-		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
-		return
-	}
-
-	req, err := http.NewRequest("POST", "https://api.useplunk.com/v1/send", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Error creating request: %v", err)
-		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+plunkAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error sending email: %v", err)
-		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error response from Plunk API: %d", resp.StatusCode)
+	}); err != nil {
+		log.Printf("Error sending verification email: %v", err)
 		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
 		return
 	}
@@ -186,12 +148,16 @@ func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify token and update user's email verification status
-	err := h.db.VerifyEmail(req.Token)
+	userID, err := h.db.VerifyEmail(r.Context(), req.Token)
 	if err != nil {
 		log.Printf("[Email Verification] Token verification failed: %v", err)
 		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
 		return
 	}
+	if userID != "" {
+		analytics.Emit(r.Context(), h.db, analytics.EventEmailVerified, userID, nil)
+		h.activity.Publish(activity.TypeEmailVerified, map[string]any{"user_id": userID})
+	}
 
 	log.Printf("[Email Verification] Email verified successfully for token: %s", req.Token)
 	w.Header().Set("Content-Type", "application/json")
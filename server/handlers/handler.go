@@ -1,12 +1,16 @@
 // Package handlers provides HTTP request handlers for the SaaS platform's API endpoints.
 package handlers
 
-import "saas-server/database"
+import (
+	"saas-server/database"
+	"saas-server/pkg/plunk"
+)
 
 // Handler is a base handler struct that contains common dependencies
 // for all handler types. It provides access to the database connection
 // and other shared resources that may be needed across different handlers.
 type Handler struct {
 	*WebhookHandler
-	DB database.DBInterface
+	DB     database.Store
+	Mailer *plunk.Client
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheck reports whether a single dependency is usable.
+// It should return quickly and honour the context deadline.
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves the liveness and readiness probes used by orchestrators
+type HealthHandler struct {
+	checks   map[string]HealthCheck
+	order    []string
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// CheckResult is the outcome of a single readiness check
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResponse represents the body returned by the readiness probe
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// NewHealthHandler creates a new HealthHandler with no registered checks
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{
+		checks:  make(map[string]HealthCheck),
+		timeout: 2 * time.Second,
+	}
+}
+
+// AddCheck registers a named readiness check. Checks must be registered before serving traffic.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	if _, exists := h.checks[name]; !exists {
+		h.order = append(h.order, name)
+	}
+	h.checks[name] = check
+}
+
+// SetDraining marks the server as shutting down so that readiness fails
+// and load balancers stop routing new requests to this instance
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Liveness handles GET /healthz
+// It only reports that the process is up and serving HTTP.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readiness handles GET /readyz
+// It runs every registered check and returns 503 if any of them fails or the server is draining.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	response := ReadinessResponse{
+		Status: "ok",
+		Checks: make(map[string]CheckResult, len(h.checks)),
+	}
+
+	for _, name := range h.order {
+		if err := h.checks[name](ctx); err != nil {
+			response.Status = "unavailable"
+			response.Checks[name] = CheckResult{Status: "fail", Error: err.Error()}
+			continue
+		}
+		response.Checks[name] = CheckResult{Status: "ok"}
+	}
+
+	if h.draining.Load() {
+		response.Status = "draining"
+	}
+
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	sendJSONResponse(w, status, response)
+}
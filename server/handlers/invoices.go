@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"saas-server/database"
+	"saas-server/middleware"
+	"saas-server/models"
+	"saas-server/pkg/invoice"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InvoicesHandler serves a user's billing history: one-off orders and subscription
+// charges, each downloadable as a branded PDF
+type InvoicesHandler struct {
+	db    database.Store
+	brand invoice.Brand
+}
+
+func NewInvoicesHandler(db database.Store, brand invoice.Brand) *InvoicesHandler {
+	return &InvoicesHandler{db: db, brand: brand}
+}
+
+// GetInvoices handles GET /api/user/invoices
+func (h *InvoicesHandler) GetInvoices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	orders, err := h.db.GetUserOrders(r.Context(), userID)
+	if err != nil {
+		log.Printf("[Invoices] Error loading orders for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	charges, err := h.db.GetUserSubscriptionInvoices(r.Context(), userID)
+	if err != nil {
+		log.Printf("[Invoices] Error loading subscription invoices for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	invoices := make([]models.Invoice, 0, len(orders)+len(charges))
+	descriptions := make(map[[2]int]string)
+	for _, o := range orders {
+		key := [2]int{o.ProductID, o.VariantID}
+		if _, ok := descriptions[key]; !ok {
+			descriptions[key] = h.orderDescription(r.Context(), o)
+		}
+		invoices = append(invoices, orderInvoice(o, descriptions[key]))
+	}
+	for _, c := range charges {
+		invoices = append(invoices, subscriptionInvoice(c))
+	}
+	sort.SliceStable(invoices, func(i, j int) bool { return invoices[i].CreatedAt.After(invoices[j].CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoices)
+}
+
+// DownloadInvoice handles GET /api/user/invoices/{id}/pdf
+func (h *InvoicesHandler) DownloadInvoice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the invoice ID, "<kind>-<number>", from the URL path
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/invoices/"), "/pdf")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	kind, rawNumber, _ := strings.Cut(id, "-")
+	number, err := strconv.Atoi(rawNumber)
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	var doc invoice.Document
+	switch kind {
+	case models.InvoiceKindOrder:
+		var order *models.Orders
+		order, err = h.db.GetUserOrder(r.Context(), userID, number)
+		if err == nil {
+			doc = h.orderDocument(r.Context(), order, user)
+		}
+	case models.InvoiceKindSubscription:
+		var charge *models.SubscriptionInvoice
+		charge, err = h.db.GetUserSubscriptionInvoice(r.Context(), userID, number)
+		if err == nil {
+			doc = h.subscriptionDocument(charge, user)
+		}
+	default:
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Invoices] Error loading invoice %s for user %s: %v", id, userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Render fully before writing so a failure can still be reported as an error
+	var buf bytes.Buffer
+	if err := invoice.Render(&buf, doc); err != nil {
+		log.Printf("[Invoices] Error rendering invoice %s: %v", id, err)
+		http.Error(w, "Failed to generate invoice", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%s.pdf"`, id))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(buf.Bytes())
+}
+
+// orderDescription names the product bought in an order from the local catalog
+func (h *InvoicesHandler) orderDescription(ctx context.Context, o models.Orders) string {
+	product, err := h.db.GetProduct(ctx, o.ProductID)
+	if err != nil {
+		return fmt.Sprintf("Order #%d", o.OrderID)
+	}
+	for _, v := range product.Variants {
+		if v.ID == o.VariantID && v.Name != "" && !strings.EqualFold(v.Name, "default") {
+			return product.Name + " - " + v.Name
+		}
+	}
+	return product.Name
+}
+
+func (h *InvoicesHandler) orderDocument(ctx context.Context, o *models.Orders, user *models.User) invoice.Document {
+	return invoice.Document{
+		Brand:        h.brand,
+		Number:       fmt.Sprintf("ORD-%d", o.OrderID),
+		IssuedAt:     o.CreatedAt,
+		Status:       o.Status,
+		BillTo:       billTo(o.BillingName, o.BillingEmail, "", "", user),
+		Items:        []invoice.Item{{Description: h.orderDescription(ctx, *o), Amount: o.Subtotal}},
+		Currency:     o.Currency,
+		Subtotal:     o.Subtotal,
+		Discount:     o.DiscountTotal,
+		Tax:          o.Tax,
+		TaxName:      o.TaxName,
+		TaxInclusive: o.TaxInclusive,
+		Total:        o.Total,
+		Refunded:     o.RefundedAmount,
+	}
+}
+
+func (h *InvoicesHandler) subscriptionDocument(c *models.SubscriptionInvoice, user *models.User) invoice.Document {
+	return invoice.Document{
+		Brand:        h.brand,
+		Number:       fmt.Sprintf("SUB-%d", c.InvoiceID),
+		IssuedAt:     c.CreatedAt,
+		Status:       c.Status,
+		BillTo:       billTo(c.BillingName, c.BillingEmail, c.CardBrand, c.CardLastFour, user),
+		Items:        []invoice.Item{{Description: chargeDescription(c.BillingReason), Amount: c.Subtotal}},
+		Currency:     c.Currency,
+		Subtotal:     c.Subtotal,
+		Discount:     c.DiscountTotal,
+		Tax:          c.Tax,
+		TaxInclusive: c.TaxInclusive,
+		Total:        c.Total,
+		Refunded:     c.RefundedAmount,
+	}
+}
+
+// billTo prefers the details entered at checkout and falls back to the account
+func billTo(name, email, cardBrand, cardLastFour string, user *models.User) invoice.Party {
+	party := invoice.Party{Name: name, Email: email}
+	if party.Name == "" {
+		party.Name = user.Name
+	}
+	if party.Email == "" {
+		party.Email = user.Email
+	}
+	if cardLastFour != "" {
+		brand := cardBrand
+		if brand == "" {
+			brand = "Card"
+		}
+		party.PaymentMethod = fmt.Sprintf("%s ending in %s", strings.ToUpper(brand[:1])+brand[1:], cardLastFour)
+	}
+	return party
+}
+
+func orderInvoice(o models.Orders, description string) models.Invoice {
+	return models.Invoice{
+		ID:             fmt.Sprintf("%s-%d", models.InvoiceKindOrder, o.OrderID),
+		Kind:           models.InvoiceKindOrder,
+		Number:         o.OrderID,
+		Description:    description,
+		Status:         o.Status,
+		Currency:       o.Currency,
+		Subtotal:       o.Subtotal,
+		DiscountTotal:  o.DiscountTotal,
+		Tax:            o.Tax,
+		Total:          o.Total,
+		TaxInclusive:   o.TaxInclusive,
+		RefundedAmount: o.RefundedAmount,
+		RefundedAt:     o.RefundedAt,
+		ReceiptURL:     o.ReceiptURL,
+		CreatedAt:      o.CreatedAt,
+	}
+}
+
+func subscriptionInvoice(c models.SubscriptionInvoice) models.Invoice {
+	return models.Invoice{
+		ID:             fmt.Sprintf("%s-%d", models.InvoiceKindSubscription, c.InvoiceID),
+		Kind:           models.InvoiceKindSubscription,
+		Number:         c.InvoiceID,
+		Description:    chargeDescription(c.BillingReason),
+		Status:         c.Status,
+		Currency:       c.Currency,
+		Subtotal:       c.Subtotal,
+		DiscountTotal:  c.DiscountTotal,
+		Tax:            c.Tax,
+		Total:          c.Total,
+		TaxInclusive:   c.TaxInclusive,
+		RefundedAmount: c.RefundedAmount,
+		RefundedAt:     c.RefundedAt,
+		ReceiptURL:     c.InvoiceURL,
+		CreatedAt:      c.CreatedAt,
+	}
+}
+
+// chargeDescription describes a subscription charge by the reason it was billed
+func chargeDescription(billingReason string) string {
+	switch billingReason {
+	case "initial":
+		return "Subscription"
+	case "renewal":
+		return "Subscription renewal"
+	case "updated":
+		return "Subscription change"
+	default:
+		return "Subscription payment"
+	}
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"os"
 
 	"saas-server/pkg/lemonsqueezy"
 )
@@ -12,9 +11,9 @@ type LemonSqueezyHandler struct {
 	client *lemonsqueezy.Client
 }
 
-func NewLemonSqueezyHandler() *LemonSqueezyHandler {
+func NewLemonSqueezyHandler(client *lemonsqueezy.Client) *LemonSqueezyHandler {
 	return &LemonSqueezyHandler{
-		client: lemonsqueezy.NewClient(),
+		client: client,
 	}
 }
 
@@ -25,8 +24,7 @@ func (h *LemonSqueezyHandler) GetProducts(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	storeID := os.Getenv("LEMON_SQUEEZY_STORE_ID")
-	products, err := h.client.GetProducts(storeID)
+	products, err := h.client.GetProducts(r.Context(), h.client.StoreID())
 	if err != nil {
 		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
 		return
@@ -50,7 +48,7 @@ func (h *LemonSqueezyHandler) GetProduct(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	product, err := h.client.GetProduct(productID)
+	product, err := h.client.GetProduct(r.Context(), productID)
 	if err != nil {
 		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
 		return
@@ -83,7 +81,7 @@ func (h *LemonSqueezyHandler) CreateCheckout(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	storeID := os.Getenv("LEMON_SQUEEZY_STORE_ID")
+	storeID := h.client.StoreID()
 	options := map[string]interface{}{
 		"email": req.Email,
 	}
@@ -108,7 +106,7 @@ func (h *LemonSqueezyHandler) CreateCheckout(w http.ResponseWriter, r *http.Requ
 		options["preview"] = req.Preview
 	}
 
-	checkout, err := h.client.CreateCheckout(storeID, req.VariantID, options)
+	checkout, err := h.client.CreateCheckout(r.Context(), storeID, req.VariantID, options)
 	if err != nil {
 		http.Error(w, "Failed to create checkout", http.StatusInternalServerError)
 		return
@@ -1,26 +1,26 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 
 	"saas-server/database"
 	"saas-server/models"
+	"saas-server/pkg/plunk"
 )
 
 // NewsletterHandler handles newsletter subscription requests
 type NewsletterHandler struct {
-	DB *database.DB
+	DB     database.MarketingRepository
+	Mailer *plunk.Client
 }
 
 // NewNewsletterHandler creates a new newsletter handler
-func NewNewsletterHandler(db *database.DB) *NewsletterHandler {
-	return &NewsletterHandler{DB: db}
+func NewNewsletterHandler(db database.MarketingRepository, mailer *plunk.Client) *NewsletterHandler {
+	return &NewsletterHandler{DB: db, Mailer: mailer}
 }
 
 // Subscribe handles newsletter subscription requests
@@ -49,7 +49,7 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	email := strings.TrimSpace(strings.ToLower(req.Email))
 
 	// Check if email already exists
-	exists, err := h.DB.NewsletterEmailExists(email)
+	exists, err := h.DB.NewsletterEmailExists(r.Context(), email)
 	if err != nil {
 		log.Printf("[NewsletterHandler] Error checking for existing email: %v", err)
 		http.Error(w, "Failed to process request", http.StatusInternalServerError)
@@ -58,7 +58,7 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 
 	if exists {
 		// If email exists, update the subscription status to true
-		err := h.DB.UpdateNewsletterSubscription(email, true)
+		err := h.DB.UpdateNewsletterSubscription(r.Context(), email, true)
 		if err != nil {
 			log.Printf("[NewsletterHandler] Error updating subscription: %v", err)
 			// Don't return an error to the client, just log it
@@ -73,7 +73,7 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert new newsletter subscription
-	err = h.DB.CreateNewsletterSubscription(email)
+	err = h.DB.CreateNewsletterSubscription(r.Context(), email)
 	if err != nil {
 		log.Printf("[NewsletterHandler] Error inserting record: %v", err)
 		http.Error(w, "Failed to subscribe to newsletter", http.StatusInternalServerError)
@@ -81,7 +81,7 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Track newsletter subscription with Plunk
-	err = trackNewsletterSubscription(email)
+	err = trackNewsletterSubscription(r.Context(), h.Mailer, email)
 	if err != nil {
 		// Log the error but don't fail the request
 		log.Printf("[NewsletterHandler] Error tracking subscription with Plunk: %v", err)
@@ -104,7 +104,7 @@ func (h *NewsletterHandler) GetAllNewsletterSubscriptions(w http.ResponseWriter,
 	}
 
 	// Query database for all subscriptions
-	subscriptions, err := h.DB.GetAllNewsletterSubscriptions()
+	subscriptions, err := h.DB.GetAllNewsletterSubscriptions(r.Context())
 	if err != nil {
 		log.Printf("[NewsletterHandler] Error querying subscriptions: %v", err)
 		http.Error(w, "Failed to retrieve subscriptions", http.StatusInternalServerError)
@@ -117,48 +117,10 @@ func (h *NewsletterHandler) GetAllNewsletterSubscriptions(w http.ResponseWriter,
 }
 
 // Track newsletter subscription with Plunk
-func trackNewsletterSubscription(email string) error {
-	plunkAPIKey := os.Getenv("PLUNK_SECRET_API_KEY")
-	if plunkAPIKey == "" {
-		return fmt.Errorf("PLUNK_SECRET_API_KEY not set")
-	}
-
-	// Create the track request
-	type TrackRequest struct {
-		Event      string `json:"event"`
-		Email      string `json:"email"`
-		Subscribed bool   `json:"subscribed"`
-	}
-
-	trackReq := TrackRequest{
+func trackNewsletterSubscription(ctx context.Context, mailer *plunk.Client, email string) error {
+	return mailer.Track(ctx, plunk.Event{
 		Event:      "newsletter-subscription",
 		Email:      email,
 		Subscribed: true,
-	}
-
-	jsonData, err := json.Marshal(trackReq)
-	if err != nil {
-		return fmt.Errorf("error marshaling track request: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.useplunk.com/v1/track", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+plunkAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error tracking subscription: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error response from Plunk API: %d", resp.StatusCode)
-	}
-
-	return nil
+	})
 }
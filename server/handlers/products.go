@@ -1,20 +1,33 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"saas-server/pkg/lemonsqueezy"
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/catalog"
 )
 
+// ProductsHandler serves the product catalog from the local database. The catalog is
+// kept current by the sync service and product webhooks, so these endpoints keep
+// working while the Lemon Squeezy API is unavailable.
 type ProductsHandler struct {
-	client *lemonsqueezy.Client
+	catalog database.CatalogRepository
+	sync    *catalog.SyncService
 }
 
-func NewProductsHandler() *ProductsHandler {
+func NewProductsHandler(catalog database.CatalogRepository, sync *catalog.SyncService) *ProductsHandler {
 	return &ProductsHandler{
-		client: lemonsqueezy.NewClient(),
+		catalog: catalog,
+		sync:    sync,
 	}
 }
 
@@ -25,37 +38,14 @@ func (h *ProductsHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get products from Lemon Squeezy
-	products, err := h.client.GetProducts("")
+	products, err := h.catalog.GetProducts(r.Context(), 0)
 	if err != nil {
-		fmt.Printf("Error fetching products: %v\n", err)
-		http.Error(w, fmt.Sprintf("Failed to fetch products: %v", err), http.StatusInternalServerError)
+		log.Printf("[Products] Error loading products: %v", err)
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
 		return
 	}
 
-	// Get variants for each product
-	for i, product := range products.Data {
-		variants, err := h.client.GetVariants(product.ID)
-		if err != nil {
-			fmt.Printf("Error fetching variants for product %s: %v\n", product.ID, err)
-			continue
-		}
-
-		// Create a new relationship data structure and assign the variants
-		products.Data[i].Relationships.Variants = lemonsqueezy.VariantRelationship{
-			Links: lemonsqueezy.Links{
-				Href: fmt.Sprintf("https://api.lemonsqueezy.com/v1/products/%s/relationships/variants", product.ID),
-			},
-			Data: variants.Data,
-		}
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(products); err != nil {
-		fmt.Printf("Error encoding response: %v\n", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
+	writeCatalog(w, r, catalog.ResponseFromProducts(products))
 }
 
 // GetProduct handles GET /api/products/{id}
@@ -71,31 +61,24 @@ func (h *ProductsHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Product ID is required", http.StatusBadRequest)
 		return
 	}
-
-	// Get product from Lemon Squeezy
-	product, err := h.client.GetProduct(productID)
+	id, err := strconv.Atoi(productID)
 	if err != nil {
-		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
 		return
 	}
 
-	// Get variants for this product
-	variants, err := h.client.GetVariants(productID)
-	if err != nil {
-		http.Error(w, "Failed to fetch variants", http.StatusInternalServerError)
+	product, err := h.catalog.GetProduct(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
-
-	// Add variants to product relationships
-	product.Data[0].Relationships.Variants = lemonsqueezy.VariantRelationship{
-		Links: lemonsqueezy.Links{
-			Href: fmt.Sprintf("https://api.lemonsqueezy.com/v1/products/%s/relationships/variants", productID),
-		},
-		Data: variants.Data,
+	if err != nil {
+		log.Printf("[Products] Error loading product %d: %v", id, err)
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(product)
+	writeCatalog(w, r, catalog.ResponseFromProducts([]models.Product{*product}))
 }
 
 // GetProductsByStore handles GET /api/products/store/{storeId}
@@ -111,30 +94,72 @@ func (h *ProductsHandler) GetProductsByStore(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "Store ID is required", http.StatusBadRequest)
 		return
 	}
+	id, err := strconv.Atoi(storeID)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
 
-	// Get products from Lemon Squeezy with store filter
-	products, err := h.client.GetProducts(storeID)
+	products, err := h.catalog.GetProducts(r.Context(), id)
 	if err != nil {
+		log.Printf("[Products] Error loading products for store %d: %v", id, err)
 		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
 		return
 	}
 
-	// Get variants for each product
-	for i, product := range products.Data {
-		variants, err := h.client.GetVariants(product.ID)
-		if err != nil {
-			continue
-		}
+	writeCatalog(w, r, catalog.ResponseFromProducts(products))
+}
 
-		// Create a new relationship data structure and assign the variants
-		products.Data[i].Relationships.Variants = lemonsqueezy.VariantRelationship{
-			Links: lemonsqueezy.Links{
-				Href: fmt.Sprintf("https://api.lemonsqueezy.com/v1/products/%s/relationships/variants", product.ID),
-			},
-			Data: variants.Data,
-		}
+// SyncCatalog handles POST /admin/products/sync, refreshing the local catalog from Lemon Squeezy
+func (h *ProductsHandler) SyncCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := h.sync.Sync(r.Context())
+	if err != nil {
+		log.Printf("[Products] Manual catalog sync failed: %v", err)
+		http.Error(w, "Failed to sync product catalog", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeCatalog writes v as JSON with an ETag derived from its content, answering
+// 304 Not Modified when the client already holds the current representation
+func writeCatalog(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[Products] Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+	w.Write(body)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using the weak
+// comparison required for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
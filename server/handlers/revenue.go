@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/revenue"
+	"strconv"
+	"time"
+)
+
+// defaultRevenueMonths is the number of months reported when no range is requested
+const defaultRevenueMonths = 12
+
+// RevenueHandler serves subscription revenue analytics to admins
+type RevenueHandler struct {
+	db database.RevenueRepository
+}
+
+func NewRevenueHandler(db database.RevenueRepository) *RevenueHandler {
+	return &RevenueHandler{db: db}
+}
+
+// GetRevenue handles GET /admin/analytics/revenue?from=2025-01-01&to=2025-12-31&product_id=&variant_id=
+// Add format=csv to download the monthly metrics, or format=csv&table=cohorts for cohort retention.
+func (h *RevenueHandler) GetRevenue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseRevenueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The whole history is needed to know each customer's MRR when the range opens
+	events, err := h.db.GetSubscriptionEvents(r.Context(), filter.To)
+	if err != nil {
+		log.Printf("[Revenue] Error loading subscription history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	payments, err := h.db.GetPayments(r.Context(), filter.From, filter.To)
+	if err != nil {
+		log.Printf("[Revenue] Error loading payments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	report := revenue.BuildReport(events, payments, filter)
+
+	query := r.URL.Query()
+	switch query.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	case "csv":
+		switch query.Get("table") {
+		case "", "periods":
+			writeCSV(w, "revenue.csv", revenuePeriodRows(report.Periods))
+		case "cohorts":
+			writeCSV(w, "revenue-cohorts.csv", cohortRows(report.Cohorts))
+		default:
+			http.Error(w, `table must be "periods" or "cohorts"`, http.StatusBadRequest)
+		}
+	default:
+		http.Error(w, `format must be "json" or "csv"`, http.StatusBadRequest)
+	}
+}
+
+// parseRevenueFilter reads the date range and plan filters. Dates are inclusive days
+// in UTC; the range defaults to the last twelve months.
+func parseRevenueFilter(r *http.Request) (revenue.Filter, error) {
+	query := r.URL.Query()
+	now := time.Now().UTC()
+	f := revenue.Filter{
+		From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1-defaultRevenueMonths, 0),
+		To:   now,
+	}
+
+	if raw := query.Get("from"); raw != "" {
+		from, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return f, fmt.Errorf("from must be a date like 2006-01-02")
+		}
+		f.From = from
+	}
+	if raw := query.Get("to"); raw != "" {
+		to, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return f, fmt.Errorf("to must be a date like 2006-01-02")
+		}
+		f.To = to.AddDate(0, 0, 1)
+	}
+	if !f.From.Before(f.To) {
+		return f, fmt.Errorf("from must be before to")
+	}
+
+	for name, target := range map[string]*int{"product_id": &f.ProductID, "variant_id": &f.VariantID} {
+		if raw := query.Get(name); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id <= 0 {
+				return f, fmt.Errorf("invalid %s", name)
+			}
+			*target = id
+		}
+	}
+	return f, nil
+}
+
+func revenuePeriodRows(periods []models.RevenuePeriod) [][]string {
+	rows := [][]string{{
+		"period", "mrr", "arr", "new_mrr", "expansion_mrr", "contraction_mrr", "churned_mrr",
+		"reactivation_mrr", "net_new_mrr", "customers", "new_customers", "churned_customers",
+		"reactivated_customers", "logo_churn_rate", "revenue_churn_rate", "arpu", "ltv", "revenue",
+	}}
+	for _, p := range periods {
+		rows = append(rows, []string{
+			p.Period,
+			strconv.Itoa(p.MRR),
+			strconv.Itoa(p.ARR),
+			strconv.Itoa(p.NewMRR),
+			strconv.Itoa(p.ExpansionMRR),
+			strconv.Itoa(p.ContractionMRR),
+			strconv.Itoa(p.ChurnedMRR),
+			strconv.Itoa(p.ReactivationMRR),
+			strconv.Itoa(p.NetNewMRR),
+			strconv.Itoa(p.Customers),
+			strconv.Itoa(p.NewCustomers),
+			strconv.Itoa(p.ChurnedCustomers),
+			strconv.Itoa(p.ReactivatedCustomers),
+			strconv.FormatFloat(p.LogoChurnRate, 'f', 4, 64),
+			strconv.FormatFloat(p.RevenueChurnRate, 'f', 4, 64),
+			strconv.FormatFloat(p.ARPU, 'f', 2, 64),
+			strconv.FormatFloat(p.LTV, 'f', 2, 64),
+			strconv.Itoa(p.Revenue),
+		})
+	}
+	return rows
+}
+
+// cohortRows lays cohorts out as a triangle: one row per cohort, one column per month since it started
+func cohortRows(cohorts []models.CohortRetention) [][]string {
+	months := 0
+	for _, c := range cohorts {
+		months = max(months, len(c.Retention))
+	}
+	header := []string{"cohort", "customers"}
+	for i := 0; i < months; i++ {
+		header = append(header, "month_"+strconv.Itoa(i))
+	}
+
+	rows := [][]string{header}
+	for _, c := range cohorts {
+		row := []string{c.Cohort, strconv.Itoa(c.Customers)}
+		for _, rate := range c.Retention {
+			row = append(row, strconv.FormatFloat(rate, 'f', 4, 64))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writeCSV sends rows as a CSV attachment
+func writeCSV(w http.ResponseWriter, filename string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		log.Printf("[Revenue] Error writing %s: %v", filename, err)
+	}
+}
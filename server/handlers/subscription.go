@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"saas-server/database"
+	"saas-server/middleware"
+	"saas-server/models"
+	"saas-server/pkg/billing"
+	"saas-server/pkg/lemonsqueezy"
+)
+
+// SubscriptionHandler lets users manage their own subscription without leaving the app.
+// Every change is made through the payment provider and the local subscription is
+// updated from its response straight away instead of waiting for the webhook.
+type SubscriptionHandler struct {
+	db     database.Store
+	client *lemonsqueezy.Client
+}
+
+func NewSubscriptionHandler(db database.Store, client *lemonsqueezy.Client) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		db:     db,
+		client: client,
+	}
+}
+
+type ChangePlanRequest struct {
+	VariantID          int  `json:"variantId"`
+	InvoiceImmediately bool `json:"invoiceImmediately"`
+	DisableProrations  bool `json:"disableProrations"`
+}
+
+type PauseSubscriptionRequest struct {
+	Mode      string     `json:"mode"`
+	ResumesAt *time.Time `json:"resumesAt"`
+}
+
+type PlanChangePreview struct {
+	CurrentVariantID int               `json:"current_variant_id"`
+	NewVariantID     int               `json:"new_variant_id"`
+	CurrentPrice     int               `json:"current_price"`
+	NewPrice         int               `json:"new_price"`
+	Proration        billing.Proration `json:"proration"`
+}
+
+// PreviewPlanChange handles GET /api/user/subscription/plan/preview?variantId=
+// It estimates the prorated amount of a plan change from the local catalog; the
+// provider calculates the final amount when the change is made.
+func (h *SubscriptionHandler) PreviewPlanChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	variantID, err := strconv.Atoi(r.URL.Query().Get("variantId"))
+	if err != nil {
+		http.Error(w, "Valid variantId is required", http.StatusBadRequest)
+		return
+	}
+
+	subscription, ok := h.currentSubscription(w, r)
+	if !ok {
+		return
+	}
+	current, target, ok := h.planVariants(w, r, subscription, variantID)
+	if !ok {
+		return
+	}
+	if subscription.RenewsAt == nil {
+		http.Error(w, "Subscription has no upcoming renewal", http.StatusConflict)
+		return
+	}
+
+	periodEnd := *subscription.RenewsAt
+	periodStart := billing.PeriodStart(periodEnd, current.Interval, current.IntervalCount)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PlanChangePreview{
+		CurrentVariantID: current.ID,
+		NewVariantID:     target.ID,
+		CurrentPrice:     current.Price,
+		NewPrice:         target.Price,
+		Proration:        billing.Prorate(current.Price, target.Price, periodStart, periodEnd, time.Now()),
+	})
+}
+
+// ChangePlan handles POST /api/user/subscription/plan
+func (h *SubscriptionHandler) ChangePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ChangePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.VariantID == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription, ok := h.currentSubscription(w, r)
+	if !ok {
+		return
+	}
+	if _, _, ok := h.planVariants(w, r, subscription, req.VariantID); !ok {
+		return
+	}
+
+	resp, err := h.client.UpdateSubscription(r.Context(), subscription.SubscriptionID, lemonsqueezy.UpdateSubscriptionRequest{
+		VariantID:          req.VariantID,
+		InvoiceImmediately: req.InvoiceImmediately,
+		DisableProrations:  req.DisableProrations,
+	})
+	h.finish(w, r, subscription, resp, err, "change plan")
+}
+
+// CancelSubscription handles POST /api/user/subscription/cancel
+// The subscription stays active until the end of the current billing period.
+func (h *SubscriptionHandler) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	subscription, ok := h.currentSubscription(w, r)
+	if !ok {
+		return
+	}
+	if subscription.Cancelled {
+		http.Error(w, "Subscription is already cancelled", http.StatusConflict)
+		return
+	}
+
+	resp, err := h.client.CancelSubscription(r.Context(), subscription.SubscriptionID)
+	h.finish(w, r, subscription, resp, err, "cancel subscription")
+}
+
+// ResumeSubscription handles POST /api/user/subscription/resume
+// It unpauses a paused subscription or reverses a cancellation during the grace period.
+func (h *SubscriptionHandler) ResumeSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	subscription, ok := h.currentSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	var resp *lemonsqueezy.SubscriptionResponse
+	var err error
+	switch {
+	case subscription.Status == "paused" || subscription.Status == "pause":
+		resp, err = h.client.UnpauseSubscription(r.Context(), subscription.SubscriptionID)
+	case subscription.Cancelled && subscription.Status != "expired":
+		resp, err = h.client.ResumeSubscription(r.Context(), subscription.SubscriptionID)
+	default:
+		http.Error(w, "Subscription is neither paused nor cancelled", http.StatusConflict)
+		return
+	}
+	h.finish(w, r, subscription, resp, err, "resume subscription")
+}
+
+// PauseSubscription handles POST /api/user/subscription/pause
+func (h *SubscriptionHandler) PauseSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PauseSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = lemonsqueezy.PauseModeVoid
+	}
+	if req.Mode != lemonsqueezy.PauseModeVoid && req.Mode != lemonsqueezy.PauseModeFree {
+		http.Error(w, "Pause mode must be \"void\" or \"free\"", http.StatusBadRequest)
+		return
+	}
+	if req.ResumesAt != nil && !req.ResumesAt.After(time.Now()) {
+		http.Error(w, "resumesAt must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	subscription, ok := h.currentSubscription(w, r)
+	if !ok {
+		return
+	}
+	if subscription.Status != "active" {
+		http.Error(w, "Only active subscriptions can be paused", http.StatusConflict)
+		return
+	}
+
+	resp, err := h.client.PauseSubscription(r.Context(), subscription.SubscriptionID, req.Mode, req.ResumesAt)
+	h.finish(w, r, subscription, resp, err, "pause subscription")
+}
+
+// currentSubscription loads the session user's latest subscription, writing an error response if there is none
+func (h *SubscriptionHandler) currentSubscription(w http.ResponseWriter, r *http.Request) (*models.Subscription, bool) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	subscription, err := h.db.GetSubscriptionByUserID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No subscription found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("[Subscription] Error loading subscription for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return subscription, true
+}
+
+// planVariants loads the subscription's current variant and the published variant it
+// should move to, writing an error response if the change is not possible
+func (h *SubscriptionHandler) planVariants(w http.ResponseWriter, r *http.Request, subscription *models.Subscription, variantID int) (*models.Variant, *models.Variant, bool) {
+	if variantID == subscription.VariantID {
+		http.Error(w, "Subscription is already on this plan", http.StatusConflict)
+		return nil, nil, false
+	}
+
+	target, err := h.db.GetVariant(r.Context(), variantID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (target.Status != "published" || !target.IsSubscription)) {
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("[Subscription] Error loading variant %d: %v", variantID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	current, err := h.db.GetVariant(r.Context(), subscription.VariantID)
+	if err != nil {
+		log.Printf("[Subscription] Error loading current variant %d: %v", subscription.VariantID, err)
+		http.Error(w, "Current plan is not in the catalog", http.StatusConflict)
+		return nil, nil, false
+	}
+	return current, target, true
+}
+
+// finish reconciles the local subscription with the provider's response and writes it back
+func (h *SubscriptionHandler) finish(w http.ResponseWriter, r *http.Request, subscription *models.Subscription, resp *lemonsqueezy.SubscriptionResponse, err error, action string) {
+	if err != nil {
+		log.Printf("[Subscription] Failed to %s %s: %v", action, subscription.SubscriptionID, err)
+		var apiErr *lemonsqueezy.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests {
+			http.Error(w, "The payment provider rejected the request", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Payment provider unavailable, please try again later", http.StatusBadGateway)
+		return
+	}
+
+	if err := reconcileSubscription(r.Context(), h.db, subscription.UserID, resp.Data); err != nil {
+		// The provider has applied the change; the webhook will bring the local copy up to date
+		log.Printf("[Subscription] Error reconciling subscription %s after %s: %v", subscription.SubscriptionID, action, err)
+	}
+	log.Printf("[Subscription] User %s: %s succeeded for subscription %s", subscription.UserID, action, subscription.SubscriptionID)
+
+	updated, err := h.db.GetSubscriptionByUserID(r.Context(), subscription.UserID)
+	if err != nil {
+		updated = subscription
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// reconcileSubscription writes the provider's view of a subscription to the local
+// subscription row and the user's subscription summary
+func reconcileSubscription(ctx context.Context, db database.Store, userID string, data lemonsqueezy.SubscriptionData) error {
+	subscriptionID, err := strconv.Atoi(data.ID)
+	if err != nil {
+		return err
+	}
+	attrs := data.Attributes
+
+	return db.WithTx(ctx, func(tx database.Store) error {
+		if err := tx.UpdateSubscription(ctx, subscriptionID, attrs.Status, attrs.Cancelled,
+			attrs.ProductID, attrs.VariantID, attrs.RenewsAt, attrs.EndsAt, attrs.TrialEndsAt); err != nil {
+			return err
+		}
+		return tx.UpdateUserSubscription(ctx, userID, subscriptionID, attrs.Status,
+			attrs.ProductID, attrs.VariantID, attrs.RenewsAt, attrs.EndsAt)
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"saas-server/database"
+	"strconv"
+	"time"
+)
+
+// defaultTrialReportDays is the reporting window used when none is requested
+const defaultTrialReportDays = 90
+
+// TrialHandler reports how free trials convert to paid plans
+type TrialHandler struct {
+	db database.TrialRepository
+}
+
+func NewTrialHandler(db database.TrialRepository) *TrialHandler {
+	return &TrialHandler{db: db}
+}
+
+// GetConversionReport handles GET /admin/trials/conversions?days=90
+func (h *TrialHandler) GetConversionReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultTrialReportDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	report, err := h.db.GetTrialConversionReport(r.Context(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("[Trial] Error loading trial conversion report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -1,25 +1,35 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"saas-server/database"
 	"saas-server/middleware"
 	"saas-server/models"
+	"saas-server/pkg/dunning"
 	"saas-server/pkg/lemonsqueezy"
+	"saas-server/pkg/trial"
+	"strconv"
+	"time"
 )
 
 type UserDataHandler struct {
-	DB     database.DBInterface
-	client *lemonsqueezy.Client
+	DB      database.Store
+	client  *lemonsqueezy.Client
+	dunning *dunning.Service
+	trials  *trial.Service
 }
 
-func NewUserDataHandler(db database.DBInterface) *UserDataHandler {
+func NewUserDataHandler(db database.Store, client *lemonsqueezy.Client, dunningService *dunning.Service, trials *trial.Service) *UserDataHandler {
 	return &UserDataHandler{
-		DB:     db,
-		client: lemonsqueezy.NewClient(),
+		DB:      db,
+		client:  client,
+		dunning: dunningService,
+		trials:  trials,
 	}
 }
 
@@ -41,7 +51,7 @@ func (h *UserDataHandler) GetUserOrders(w http.ResponseWriter, r *http.Request)
 	log.Printf("[UserData] Validated user ID: %s", userID)
 
 	// Verify user exists
-	_, err := h.DB.GetUserByID(userID)
+	_, err := h.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
 		log.Printf("[UserData] User not found in database: %v", err)
 		http.Error(w, "Invalid session", http.StatusUnauthorized)
@@ -52,7 +62,7 @@ func (h *UserDataHandler) GetUserOrders(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get orders from database
-	orders, err := h.DB.GetUserOrders(userID)
+	orders, err := h.DB.GetUserOrders(r.Context(), userID)
 	if err != nil {
 		// Return empty array for any database error (no rows, table doesn't exist, or other errors)
 		json.NewEncoder(w).Encode([]models.Orders{})
@@ -77,7 +87,7 @@ func (h *UserDataHandler) GetUserSubscription(w http.ResponseWriter, r *http.Req
 	}
 
 	// Verify user exists
-	_, err := h.DB.GetUserByID(userID)
+	_, err := h.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
 		http.Error(w, "Invalid session", http.StatusUnauthorized)
 		return
@@ -87,7 +97,29 @@ func (h *UserDataHandler) GetUserSubscription(w http.ResponseWriter, r *http.Req
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get subscription from database
-	subscription, err := h.DB.GetSubscriptionByUserID(userID)
+	subscription, err := h.DB.GetSubscriptionByUserID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A user on the app-managed trial has no subscription yet, so describe the trial instead
+		t, err := h.trials.UserTrial(r.Context(), userID)
+		if err != nil {
+			log.Printf("[UserData] Error getting trial for user %s: %v", userID, err)
+		}
+		if t == nil {
+			json.NewEncoder(w).Encode([]models.Subscription{})
+			return
+		}
+		json.NewEncoder(w).Encode([]models.Subscription{{
+			UserID:      userID,
+			ProductID:   t.ProductID,
+			VariantID:   t.VariantID,
+			Status:      trial.StatusOnTrial,
+			TrialEndsAt: &t.EndsAt,
+			CreatedAt:   t.StartedAt,
+			UpdatedAt:   t.UpdatedAt,
+			Trial:       trial.Info(t.Source, t.EndsAt, time.Now()),
+		}})
+		return
+	}
 	if err != nil {
 		log.Printf("[UserData] Error getting subscription for user %s: %v", userID, err)
 		// Return empty array for any database error (no rows, table doesn't exist, or other errors)
@@ -95,6 +127,18 @@ func (h *UserDataHandler) GetUserSubscription(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if subscription.Status == trial.StatusOnTrial && subscription.TrialEndsAt != nil {
+		subscription.Trial = trial.Info(models.TrialSourceLemonSqueezy, *subscription.TrialEndsAt, time.Now())
+	}
+
+	// Surface a failing payment so the app can prompt for a new payment method
+	if id, err := strconv.Atoi(subscription.SubscriptionID); err == nil {
+		subscription.Dunning, err = h.dunning.Banner(r.Context(), id)
+		if err != nil {
+			log.Printf("[UserData] Error loading dunning status for subscription %d: %v", id, err)
+		}
+	}
+
 	json.NewEncoder(w).Encode([]models.Subscription{*subscription})
 }
 
@@ -113,7 +157,11 @@ func (h *UserDataHandler) GetBillingPortal(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get customer from LemonSqueezy
-	customer, err := h.client.GetCustomer(customerID)
+	customer, err := h.client.GetCustomer(r.Context(), customerID)
+	if lemonsqueezy.IsNotFound(err) {
+		http.Error(w, "Customer not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		fmt.Printf("Error fetching customer: %v\n", err)
 		http.Error(w, "Failed to fetch customer", http.StatusInternalServerError)
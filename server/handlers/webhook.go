@@ -3,13 +3,24 @@ package handlers
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"saas-server/database"
 	"saas-server/models"
+	"saas-server/pkg/activity"
+	"saas-server/pkg/analytics"
+	"saas-server/pkg/catalog"
+	"saas-server/pkg/dunning"
+	"saas-server/pkg/lemonsqueezy"
+	"saas-server/pkg/revenue"
+	"saas-server/pkg/trial"
+	"saas-server/pkg/webhooks"
 	"strconv"
 	"time"
 
@@ -50,6 +61,13 @@ type OrderAttributes struct {
 	RefundedAt              *time.Time `json:"refunded_at"`
 	CreatedAt               time.Time  `json:"created_at"`
 	UpdatedAt               time.Time  `json:"updated_at"`
+	Currency                string     `json:"currency"`
+	Subtotal                int        `json:"subtotal"`
+	DiscountTotal           int        `json:"discount_total"`
+	Tax                     int        `json:"tax"`
+	Total                   int        `json:"total"`
+	RefundedAmount          int        `json:"refunded_amount"`
+	TaxName                 string     `json:"tax_name"`
 	SubtotalFormatted       string     `json:"subtotal_formatted"`
 	TaxFormatted            string     `json:"tax_formatted"`
 	TotalFormatted          string     `json:"total_formatted"`
@@ -114,25 +132,19 @@ func validateWebhookSignature(payload []byte, signature string, secret string) b
 	return hmac.Equal([]byte(signature), []byte(expectedSignature))
 }
 
-// Database defines the minimal database operations required by the webhook handler
-// Implemented by database.DBInterface
-type Database interface {
-	// Order operations
-	CreateOrder(userID string, orderID int, customerID int, productID int, variantID int, status string, subtotalFormatted string, taxFormatted string, totalFormatted string, taxInclusive bool) error
-	UpdateOrderRefund(orderID int, refundedAt *time.Time, refundedAmountFormatted string) error
-
-	// Subscription operations
-	GetSubscriptionByUserID(userID string) (*models.Subscription, error)
-	CreateSubscription(userID string, subscriptionID int, orderID int, customerID int, productID int, variantID int, status string, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error
-	UpdateSubscription(subscriptionID int, status string, cancelled bool, productID int, variantID int, renewsAt *time.Time, endsAt *time.Time, trialEndsAt *time.Time) error
-	UpdateUserSubscription(userID string, subscriptionID int, status string, productID int, variantID int, renewalDate *time.Time, endDate *time.Time) error
-
-	// Cache operations
-	InvalidateUserCache(userID string)
-}
-
 type WebhookHandler struct {
-	DB Database
+	DB            database.Store
+	SigningSecret string
+	// CheckoutSecret verifies the custom data signed by CheckoutHandler
+	CheckoutSecret string
+	// Dunning chases failed subscription payments
+	Dunning *dunning.Service
+	// Trials records trial starts and conversions
+	Trials *trial.Service
+	// Activity shows orders, payments and subscription changes to admins as they happen
+	Activity *activity.Hub
+	// Webhooks notifies the endpoints users registered of their orders, payments and subscription changes
+	Webhooks *webhooks.Service
 }
 
 func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
@@ -154,7 +166,7 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate signature
-	if !validateWebhookSignature(body, signature, os.Getenv("LEMON_SQUEEZY_SIGNING_SECRET")) {
+	if !validateWebhookSignature(body, signature, h.SigningSecret) {
 		log.Printf("[Webhook] Invalid signature received")
 		http.Error(w, "Invalid signature", http.StatusForbidden)
 		return
@@ -173,10 +185,14 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	// Parse attributes based on event type
 	var orderAttrs OrderAttributes
 	var subscriptionAttrs SubscriptionAttributes
+	var invoiceAttrs lemonsqueezy.SubscriptionInvoiceAttributes
 	var err2 error
 
 	// Convert attributes to appropriate type based on event
 	switch payload.Meta.EventName {
+	case "product_created", "product_updated", "product_deleted",
+		"variant_created", "variant_updated", "variant_deleted":
+		// Catalog events are decoded by handleCatalogEvent
 	case "order_created", "order_refunded":
 		attrsBytes, err := json.Marshal(payload.Data.Attributes)
 		if err != nil {
@@ -189,6 +205,19 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid payload attributes", http.StatusBadRequest)
 			return
 		}
+	case "subscription_payment_success", "subscription_payment_refunded",
+		"subscription_payment_failed", "subscription_payment_recovered":
+		attrsBytes, err := json.Marshal(payload.Data.Attributes)
+		if err != nil {
+			log.Printf("[Webhook] Error marshaling attributes: %v", err)
+			http.Error(w, "Invalid payload attributes", http.StatusBadRequest)
+			return
+		}
+		if err := json.Unmarshal(attrsBytes, &invoiceAttrs); err != nil {
+			log.Printf("[Webhook] Error unmarshaling subscription invoice attributes: %v", err)
+			http.Error(w, "Invalid payload attributes", http.StatusBadRequest)
+			return
+		}
 	default:
 		attrsBytes, err := json.Marshal(payload.Data.Attributes)
 		if err != nil {
@@ -205,47 +234,109 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[Webhook] Event: %s", payload.Meta.EventName)
 
+	// Only custom data signed at checkout creation may link a purchase to an account
+	verifiedUserID, verified := verifyCustomData(h.CheckoutSecret, payload.Meta.CustomData)
+	if len(payload.Meta.CustomData) > 0 && !verified {
+		log.Printf("[Webhook] Ignoring unsigned or tampered custom data for event %s", payload.Meta.EventName)
+	}
+
 	// Handle different webhook events
 	switch payload.Meta.EventName {
 	case "order_created":
 		log.Printf("[Webhook] Processing order creation")
-		if len(payload.Meta.CustomData) == 0 {
-			log.Printf("[Webhook] Error: No user ID provided in CustomData")
-			http.Error(w, "Missing user ID in CustomData", http.StatusBadRequest)
+		if !verified {
+			log.Printf("[Webhook] Error: No verified user ID in CustomData")
+			http.Error(w, "Missing or invalid signed CustomData", http.StatusBadRequest)
 			return
 		}
-		err2 = h.DB.CreateOrder(
-			payload.Meta.CustomData["user_id"],
-			orderAttrs.OrderID,
-			orderAttrs.CustomerID,
-			orderAttrs.FirstOrderItem.ProductID,
-			orderAttrs.FirstOrderItem.VariantID,
-			orderAttrs.Status,
-			orderAttrs.SubtotalFormatted,
-			orderAttrs.TaxFormatted,
-			orderAttrs.TotalFormatted,
-			orderAttrs.TaxInclusive,
-		)
+		order := &models.Orders{
+			UserID:            verifiedUserID,
+			OrderID:           orderAttrs.OrderID,
+			CustomerID:        orderAttrs.CustomerID,
+			ProductID:         orderAttrs.FirstOrderItem.ProductID,
+			VariantID:         orderAttrs.FirstOrderItem.VariantID,
+			Status:            orderAttrs.Status,
+			Currency:          orderAttrs.Currency,
+			Subtotal:          orderAttrs.Subtotal,
+			DiscountTotal:     orderAttrs.DiscountTotal,
+			Tax:               orderAttrs.Tax,
+			Total:             orderAttrs.Total,
+			TaxName:           orderAttrs.TaxName,
+			SubtotalFormatted: orderAttrs.SubtotalFormatted,
+			TaxFormatted:      orderAttrs.TaxFormatted,
+			TotalFormatted:    orderAttrs.TotalFormatted,
+			TaxInclusive:      orderAttrs.TaxInclusive,
+			BillingName:       orderAttrs.UserName,
+			BillingEmail:      orderAttrs.UserEmail,
+			ReceiptURL:        orderAttrs.URLs.Receipt,
+		}
+		err2 = h.DB.CreateOrder(r.Context(), order)
+		if err2 == nil {
+			checkoutID := payload.Meta.CustomData[customDataCheckoutID]
+			if err := h.DB.CompleteCheckout(r.Context(), checkoutID, orderAttrs.OrderID); err != nil {
+				log.Printf("[Webhook] Error completing checkout %s: %v", checkoutID, err)
+			}
+			h.Activity.Publish(activity.TypeOrder, map[string]any{
+				"event":           payload.Meta.EventName,
+				"order_id":        orderAttrs.OrderID,
+				"user_id":         verifiedUserID,
+				"product_id":      orderAttrs.FirstOrderItem.ProductID,
+				"variant_id":      orderAttrs.FirstOrderItem.VariantID,
+				"total":           orderAttrs.Total,
+				"total_formatted": orderAttrs.TotalFormatted,
+				"currency":        orderAttrs.Currency,
+			})
+			h.publishWebhook(r, verifiedUserID, webhooks.EventOrderCreated, order)
+		}
 		log.Printf("[Webhook] Processed order creation")
 
 	case "order_refunded":
 		log.Printf("[Webhook] Processing order refund")
 		err2 = h.DB.UpdateOrderRefund(
+			r.Context(),
 			orderAttrs.OrderID,
 			orderAttrs.RefundedAt,
+			orderAttrs.RefundedAmount,
 			orderAttrs.RefundedAmountFormatted,
 		)
-		if err2 == nil && len(payload.Meta.CustomData) > 0 {
-			// Invalidate user cache after refund
-			h.DB.InvalidateUserCache(payload.Meta.CustomData["user_id"])
+		if err2 == nil {
+			// The stored order names its owner whether or not the custom data is signed
+			order, err := h.DB.GetOrder(r.Context(), orderAttrs.OrderID)
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Printf("[Webhook] Refunded order %d is not stored locally", orderAttrs.OrderID)
+			} else if err != nil {
+				log.Printf("[Webhook] Error loading refunded order %d: %v", orderAttrs.OrderID, err)
+			}
+
+			userID := verifiedUserID
+			if order != nil {
+				userID = order.UserID
+			}
+			if userID != "" {
+				// Invalidate user cache after refund on every instance
+				if err := h.DB.InvalidateUserCache(r.Context(), userID); err != nil {
+					log.Printf("[Webhook] Error invalidating user cache: %v", err)
+				}
+			}
+			h.Activity.Publish(activity.TypeOrder, map[string]any{
+				"event":                     payload.Meta.EventName,
+				"order_id":                  orderAttrs.OrderID,
+				"user_id":                   userID,
+				"refunded_amount":           orderAttrs.RefundedAmount,
+				"refunded_amount_formatted": orderAttrs.RefundedAmountFormatted,
+				"currency":                  orderAttrs.Currency,
+			})
+			if order != nil {
+				h.publishWebhook(r, order.UserID, webhooks.EventOrderRefunded, order)
+			}
 		}
 		log.Printf("[Webhook] Processed order refund")
 
 	case "subscription_created":
 		log.Printf("[Webhook] Processing subscription creation")
-		if len(payload.Meta.CustomData) == 0 {
-			log.Printf("[Webhook] Error: No user ID provided in CustomData")
-			http.Error(w, "Missing user ID in CustomData", http.StatusBadRequest)
+		if !verified {
+			log.Printf("[Webhook] Error: No verified user ID in CustomData")
+			http.Error(w, "Missing or invalid signed CustomData", http.StatusBadRequest)
 			return
 		}
 
@@ -257,61 +348,99 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Parse user ID as UUID
-		userID := payload.Meta.CustomData["user_id"]
+		userID := verifiedUserID
 		if _, err := uuid.Parse(userID); err != nil {
 			log.Printf("[Webhook] Error: Invalid UUID format for user ID: %v", err)
 			http.Error(w, "Invalid user ID format", http.StatusBadRequest)
 			return
 		}
 
-		err2 = h.DB.CreateSubscription(
-			userID,
-			subscriptionID,
-			subscriptionAttrs.OrderID,
-			subscriptionAttrs.CustomerID,
-			subscriptionAttrs.ProductID,
-			subscriptionAttrs.VariantID,
-			subscriptionAttrs.Status,
-			subscriptionAttrs.RenewsAt,
-			subscriptionAttrs.EndsAt,
-			subscriptionAttrs.TrialEndsAt,
-		)
+		// Record the subscription and the user's summary together so they never disagree
+		err2 = h.DB.WithTx(r.Context(), func(tx database.Store) error {
+			if err := tx.CreateSubscription(
+				r.Context(),
+				userID,
+				subscriptionID,
+				subscriptionAttrs.OrderID,
+				subscriptionAttrs.CustomerID,
+				subscriptionAttrs.ProductID,
+				subscriptionAttrs.VariantID,
+				subscriptionAttrs.Status,
+				subscriptionAttrs.RenewsAt,
+				subscriptionAttrs.EndsAt,
+				subscriptionAttrs.TrialEndsAt,
+			); err != nil {
+				log.Printf("[Webhook] Error creating subscription: %v", err)
+				return err
+			}
+
+			if err := tx.UpdateUserSubscription(
+				r.Context(),
+				userID,
+				subscriptionID,
+				subscriptionAttrs.Status,
+				subscriptionAttrs.ProductID,
+				subscriptionAttrs.VariantID,
+				subscriptionAttrs.RenewsAt,
+				subscriptionAttrs.EndsAt,
+			); err != nil {
+				log.Printf("[Webhook] Error updating user subscription: %v", err)
+				return err
+			}
+			return nil
+		})
 		if err2 != nil {
-			log.Printf("[Webhook] Error creating subscription: %v", err2)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		err2 = h.DB.UpdateUserSubscription(
-			userID,
-			subscriptionID,
-			subscriptionAttrs.Status,
-			subscriptionAttrs.ProductID,
-			subscriptionAttrs.VariantID,
-			subscriptionAttrs.RenewsAt,
-			subscriptionAttrs.EndsAt,
-		)
-		if err2 != nil {
-			log.Printf("[Webhook] Error updating user subscription: %v", err2)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+		// Updating the user's subscription invalidates their cached status on every instance
+		h.subscriptionChanged(r, payload.Meta.EventName, subscriptionID)
+		analytics.Emit(r.Context(), h.DB, analytics.EventSubscriptionCreated, userID, map[string]any{
+			"subscription_id": subscriptionID,
+			"product_id":      subscriptionAttrs.ProductID,
+			"variant_id":      subscriptionAttrs.VariantID,
+			"status":          subscriptionAttrs.Status,
+		})
+		log.Printf("[Webhook] Successfully processed subscription creation")
+
+	case "subscription_payment_success", "subscription_payment_refunded":
+		// These events carry a subscription invoice rather than the subscription itself
+		log.Printf("[Webhook] Processing subscription invoice event: %s", payload.Meta.EventName)
+		err2 = h.recordSubscriptionInvoice(r, payload.Meta.EventName, payload.Data.ID, verifiedUserID, invoiceAttrs)
+		if err2 == nil {
+			log.Printf("[Webhook] Processed subscription invoice event: %s", payload.Meta.EventName)
+		}
+
+	case "subscription_payment_failed":
+		// The subscriber keeps access for the grace period while the dunning job
+		// sends reminders, and is downgraded if it runs out
+		log.Printf("[Webhook] Processing failed subscription payment")
+		err2 = h.recordSubscriptionInvoice(r, payload.Meta.EventName, payload.Data.ID, verifiedUserID, invoiceAttrs)
+		if err2 == nil {
+			err2 = h.paymentFailed(r, invoiceAttrs.SubscriptionID)
+		}
+		if err2 == nil {
+			log.Printf("[Webhook] Processed failed subscription payment")
 		}
 
-		// Invalidate user cache after subscription creation
-		h.DB.InvalidateUserCache(userID)
-		log.Printf("[Webhook] Successfully processed subscription creation and invalidated cache")
+	case "subscription_payment_recovered":
+		log.Printf("[Webhook] Processing recovered subscription payment")
+		err2 = h.recordSubscriptionInvoice(r, payload.Meta.EventName, payload.Data.ID, verifiedUserID, invoiceAttrs)
+		if err2 == nil {
+			err2 = h.paymentRecovered(r, invoiceAttrs.SubscriptionID)
+		}
+		if err2 == nil {
+			log.Printf("[Webhook] Processed recovered subscription payment")
+		}
 
 	case "subscription_updated",
-		"subscription_payment_success",
-		"subscription_payment_recovered",
 		"subscription_plan_changed",
 		"subscription_paused",
 		"subscription_cancelled",
 		"subscription_expired",
 		"subscription_unpaused",
-		"subscription_resumed",
-		"subscription_payment_failed",
-		"subscription_payment_refunded":
+		"subscription_resumed":
 		log.Printf("[Webhook] Processing subscription event: %s", payload.Meta.EventName)
 
 		subscriptionID, err := strconv.Atoi(payload.Data.ID)
@@ -331,60 +460,87 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		case "subscription_unpaused", "subscription_resumed":
 			status = "active"
 			cancelled = false
-		case "subscription_payment_failed":
-			status = "failed"
-			cancelled = false
-		case "subscription_payment_refunded":
-			status = "refunded"
-			cancelled = false
 		case "subscription_paused":
 			status = "pause"
 			cancelled = false
 		}
 
-		err2 = h.DB.UpdateSubscription(
-			subscriptionID,
-			status,
-			cancelled,
-			subscriptionAttrs.ProductID,
-			subscriptionAttrs.VariantID,
-			subscriptionAttrs.RenewsAt,
-			subscriptionAttrs.EndsAt,
-			subscriptionAttrs.TrialEndsAt,
-		)
-		if err2 != nil {
-			log.Printf("[Webhook] Error updating subscription: %v", err2)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+		// A past-due subscription keeps its entitlements during the dunning grace period
+		userStatus := h.Dunning.EntitlementStatus(r.Context(), subscriptionID, status)
+
+		userID := verifiedUserID
+		err2 = h.DB.WithTx(r.Context(), func(tx database.Store) error {
+			if err := tx.UpdateSubscription(
+				r.Context(),
+				subscriptionID,
+				status,
+				cancelled,
+				subscriptionAttrs.ProductID,
+				subscriptionAttrs.VariantID,
+				subscriptionAttrs.RenewsAt,
+				subscriptionAttrs.EndsAt,
+				subscriptionAttrs.TrialEndsAt,
+			); err != nil {
+				log.Printf("[Webhook] Error updating subscription: %v", err)
+				return err
+			}
 
-		// Update user's subscription details
-		if len(payload.Meta.CustomData) > 0 {
-			userID := payload.Meta.CustomData["user_id"]
+			// Without signed custom data the subscription's stored owner is updated
+			if userID == "" {
+				sub, err := tx.GetSubscriptionByID(r.Context(), subscriptionID)
+				if errors.Is(err, sql.ErrNoRows) {
+					log.Printf("[Webhook] Skipping user subscription update - subscription %d is not stored locally", subscriptionID)
+					return nil
+				}
+				if err != nil {
+					log.Printf("[Webhook] Error loading subscription %d: %v", subscriptionID, err)
+					return err
+				}
+				userID = sub.UserID
+			}
+
+			// Update user's subscription details
 			log.Printf("[Webhook] Updating user subscription details - UserID: %s", userID)
-			err2 = h.DB.UpdateUserSubscription(
+			if err := tx.UpdateUserSubscription(
+				r.Context(),
 				userID,
 				subscriptionID,
-				status,
+				userStatus,
 				subscriptionAttrs.ProductID,
 				subscriptionAttrs.VariantID,
 				subscriptionAttrs.RenewsAt,
 				subscriptionAttrs.EndsAt,
-			)
-			if err2 != nil {
-				log.Printf("[Webhook] Error updating user subscription: %v", err2)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
+			); err != nil {
+				log.Printf("[Webhook] Error updating user subscription: %v", err)
+				return err
 			}
+			return nil
+		})
+		if err2 != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 
-			// Invalidate user cache after subscription update
-			h.DB.InvalidateUserCache(userID)
-			log.Printf("[Webhook] Successfully updated user subscription details and invalidated cache")
-		} else {
-			log.Printf("[Webhook] Skipping user subscription update - no user_id in CustomData")
+		h.subscriptionChanged(r, payload.Meta.EventName, subscriptionID)
+		if payload.Meta.EventName == "subscription_expired" {
+			if err := h.Dunning.SubscriptionEnded(r.Context(), subscriptionID); err != nil {
+				log.Printf("[Webhook] Error closing dunning case for subscription %d: %v", subscriptionID, err)
+			}
+		}
+
+		if userID != "" {
+			log.Printf("[Webhook] Successfully updated user subscription details")
 		}
 		log.Printf("[Webhook] Processed subscription event: %s", payload.Meta.EventName)
 
+	case "product_created", "product_updated", "product_deleted",
+		"variant_created", "variant_updated", "variant_deleted":
+		log.Printf("[Webhook] Processing catalog event: %s", payload.Meta.EventName)
+		err2 = h.handleCatalogEvent(r, &payload)
+		if err2 == nil {
+			log.Printf("[Webhook] Processed catalog event: %s", payload.Meta.EventName)
+		}
+
 	default:
 		log.Printf("[Webhook] Unhandled event type: %s", payload.Meta.EventName)
 		w.WriteHeader(http.StatusOK)
@@ -399,3 +555,226 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// recordSubscriptionInvoice stores a subscription charge for the invoice history and
+// shows it in the activity stream. userID may be empty, in which case the owner of
+// the subscription is used; invoices of subscriptions not stored locally are skipped.
+func (h *WebhookHandler) recordSubscriptionInvoice(r *http.Request, event, id, userID string, attrs lemonsqueezy.SubscriptionInvoiceAttributes) error {
+	invoiceID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid subscription invoice ID %q", id)
+	}
+
+	if userID == "" {
+		sub, err := h.DB.GetSubscriptionByID(r.Context(), attrs.SubscriptionID)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[Webhook] Skipping invoice %d - subscription %d is not stored locally and the custom data is not signed",
+				invoiceID, attrs.SubscriptionID)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("loading subscription %d of invoice %d: %w", attrs.SubscriptionID, invoiceID, err)
+		}
+		userID = sub.UserID
+	}
+
+	createdAt := attrs.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	invoice := &models.SubscriptionInvoice{
+		InvoiceID:      invoiceID,
+		SubscriptionID: attrs.SubscriptionID,
+		UserID:         userID,
+		CustomerID:     attrs.CustomerID,
+		BillingReason:  attrs.BillingReason,
+		Status:         attrs.Status,
+		Currency:       attrs.Currency,
+		Subtotal:       attrs.Subtotal,
+		DiscountTotal:  attrs.DiscountTotal,
+		Tax:            attrs.Tax,
+		Total:          attrs.Total,
+		TaxInclusive:   attrs.TaxInclusive,
+		Refunded:       attrs.Refunded,
+		RefundedAmount: attrs.RefundedAmount,
+		RefundedAt:     attrs.RefundedAt,
+		BillingName:    attrs.UserName,
+		BillingEmail:   attrs.UserEmail,
+		CardBrand:      attrs.CardBrand,
+		CardLastFour:   attrs.CardLastFour,
+		InvoiceURL:     attrs.URLs.InvoiceURL,
+		CreatedAt:      createdAt,
+	}
+	if err := h.DB.UpsertSubscriptionInvoice(r.Context(), invoice); err != nil {
+		return err
+	}
+
+	h.Activity.Publish(activity.TypePayment, map[string]any{
+		"event":           event,
+		"invoice_id":      invoiceID,
+		"subscription_id": attrs.SubscriptionID,
+		"user_id":         userID,
+		"billing_reason":  attrs.BillingReason,
+		"status":          attrs.Status,
+		"total":           attrs.Total,
+		"total_formatted": attrs.TotalFormatted,
+		"currency":        attrs.Currency,
+	})
+
+	if eventType, ok := paymentWebhookEvents[event]; ok {
+		h.publishWebhook(r, invoice.UserID, eventType, invoice)
+	}
+	return nil
+}
+
+// paymentFailed marks a subscription past due and opens a dunning case for it. The
+// account summary is left alone so the subscriber keeps access during the grace period.
+func (h *WebhookHandler) paymentFailed(r *http.Request, subscriptionID int) error {
+	sub, err := h.DB.GetSubscriptionByID(r.Context(), subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[Webhook] Ignoring failed payment for unknown subscription %d", subscriptionID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := h.DB.UpdateSubscription(r.Context(), subscriptionID, "past_due", sub.Cancelled,
+		sub.ProductID, sub.VariantID, sub.RenewsAt, sub.EndsAt, sub.TrialEndsAt); err != nil {
+		return err
+	}
+	h.subscriptionChanged(r, "subscription_payment_failed", subscriptionID)
+	return h.Dunning.PaymentFailed(r.Context(), sub, time.Now())
+}
+
+// paymentRecovered reactivates a subscription whose retried payment succeeded and
+// resolves its dunning case, restoring access if it had been withdrawn
+func (h *WebhookHandler) paymentRecovered(r *http.Request, subscriptionID int) error {
+	sub, err := h.DB.GetSubscriptionByID(r.Context(), subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[Webhook] Ignoring recovered payment for unknown subscription %d", subscriptionID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.WithTx(r.Context(), func(tx database.Store) error {
+		if err := tx.UpdateSubscription(r.Context(), subscriptionID, "active", sub.Cancelled,
+			sub.ProductID, sub.VariantID, sub.RenewsAt, sub.EndsAt, sub.TrialEndsAt); err != nil {
+			return err
+		}
+		return tx.UpdateUserSubscription(r.Context(), sub.UserID, subscriptionID, "active",
+			sub.ProductID, sub.VariantID, sub.RenewsAt, sub.EndsAt)
+	})
+	if err != nil {
+		return err
+	}
+	h.subscriptionChanged(r, "subscription_payment_recovered", subscriptionID)
+	return h.Dunning.PaymentRecovered(r.Context(), subscriptionID)
+}
+
+// subscriptionChanged records the stored state of a subscription after an event in its
+// revenue history, tracks trial starts, extensions and conversions and shows the change
+// in the activity stream. Failures are logged rather than failing the webhook.
+func (h *WebhookHandler) subscriptionChanged(r *http.Request, event string, subscriptionID int) {
+	sub, err := h.DB.GetSubscriptionByID(r.Context(), subscriptionID)
+	if err != nil {
+		log.Printf("[Webhook] Error loading subscription %d: %v", subscriptionID, err)
+		return
+	}
+
+	// Without the variant in the local catalog the subscription is recorded as earning nothing
+	variant, err := h.DB.GetVariant(r.Context(), sub.VariantID)
+	if err != nil {
+		log.Printf("[Webhook] Error loading variant %d for revenue history: %v", sub.VariantID, err)
+	}
+	if _, err := h.DB.RecordSubscriptionEvent(r.Context(), &models.SubscriptionEvent{
+		SubscriptionID: subscriptionID,
+		UserID:         sub.UserID,
+		Event:          event,
+		Status:         sub.Status,
+		ProductID:      sub.ProductID,
+		VariantID:      sub.VariantID,
+		MRR:            revenue.SubscriptionMRR(sub.Status, variant),
+		OccurredAt:     time.Now(),
+	}); err != nil {
+		log.Printf("[Webhook] Error recording revenue history for subscription %d: %v", subscriptionID, err)
+	}
+
+	if err := h.Trials.SubscriptionChanged(r.Context(), sub); err != nil {
+		log.Printf("[Webhook] Error tracking trial for subscription %d: %v", subscriptionID, err)
+	}
+
+	h.Activity.Publish(activity.TypeSubscription, map[string]any{
+		"event":           event,
+		"subscription_id": subscriptionID,
+		"user_id":         sub.UserID,
+		"status":          sub.Status,
+		"product_id":      sub.ProductID,
+		"variant_id":      sub.VariantID,
+	})
+
+	eventType := webhooks.EventSubscriptionUpdated
+	if event == "subscription_created" {
+		eventType = webhooks.EventSubscriptionCreated
+	}
+	h.publishWebhook(r, sub.UserID, eventType, sub)
+}
+
+// paymentWebhookEvents maps the subscription invoice events to the outgoing webhook events
+var paymentWebhookEvents = map[string]string{
+	"subscription_payment_success":   webhooks.EventPaymentSucceeded,
+	"subscription_payment_failed":    webhooks.EventPaymentFailed,
+	"subscription_payment_recovered": webhooks.EventPaymentRecovered,
+	"subscription_payment_refunded":  webhooks.EventPaymentRefunded,
+}
+
+// publishWebhook queues an event for the user's webhook endpoints. Failures are
+// logged rather than failing the webhook.
+func (h *WebhookHandler) publishWebhook(r *http.Request, userID, eventType string, data any) {
+	if err := h.Webhooks.Publish(r.Context(), userID, eventType, data); err != nil {
+		log.Printf("[Webhook] Error queueing %s webhooks for user %s: %v", eventType, userID, err)
+	}
+}
+
+// handleCatalogEvent applies a product or variant change to the local catalog
+func (h *WebhookHandler) handleCatalogEvent(r *http.Request, payload *WebhookPayload) error {
+	id, err := strconv.Atoi(payload.Data.ID)
+	if err != nil {
+		return fmt.Errorf("invalid %s ID %q", payload.Data.Type, payload.Data.ID)
+	}
+
+	attrsBytes, err := json.Marshal(payload.Data.Attributes)
+	if err != nil {
+		return err
+	}
+
+	switch payload.Meta.EventName {
+	case "product_deleted":
+		return h.DB.DeleteProduct(r.Context(), id)
+	case "variant_deleted":
+		return h.DB.DeleteVariant(r.Context(), id)
+	case "product_created", "product_updated":
+		data := lemonsqueezy.ProductData{ID: payload.Data.ID}
+		if err := json.Unmarshal(attrsBytes, &data.Attributes); err != nil {
+			return err
+		}
+		product, err := catalog.ProductFromAPI(data)
+		if err != nil {
+			return err
+		}
+		// Variants are left as they are; they arrive through their own events and the periodic sync
+		return h.DB.UpsertProduct(r.Context(), &product)
+	default:
+		data := lemonsqueezy.VariantData{ID: payload.Data.ID}
+		if err := json.Unmarshal(attrsBytes, &data.Attributes); err != nil {
+			return err
+		}
+		variant, err := catalog.VariantFromAPI(data)
+		if err != nil {
+			return err
+		}
+		return h.DB.UpsertVariant(r.Context(), &variant)
+	}
+}
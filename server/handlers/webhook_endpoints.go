@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"saas-server/database"
+	"saas-server/middleware"
+	"saas-server/models"
+	"saas-server/pkg/webhooks"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxWebhookEndpoints is the number of endpoints a user may register
+	maxWebhookEndpoints = 10
+	// maxWebhookURLLength is the longest endpoint URL accepted
+	maxWebhookURLLength = 2048
+	// maxWebhookDescriptionLength matches the description column
+	maxWebhookDescriptionLength = 255
+	// defaultWebhookDeliveries and maxWebhookDeliveries bound the delivery log returned at once
+	defaultWebhookDeliveries = 50
+	maxWebhookDeliveries     = 100
+)
+
+// WebhookEndpointsHandler lets users register endpoints that are notified of events on
+// their account, and inspect and test the deliveries made to them
+type WebhookEndpointsHandler struct {
+	db       database.Store
+	webhooks *webhooks.Service
+}
+
+// NewWebhookEndpointsHandler creates a handler for the signed-in user's webhook endpoints
+func NewWebhookEndpointsHandler(db database.Store, service *webhooks.Service) *WebhookEndpointsHandler {
+	return &WebhookEndpointsHandler{db: db, webhooks: service}
+}
+
+// WebhookEndpointRequest is the body of POST /api/user/webhooks and PUT /api/user/webhooks/{id}.
+// An empty EventTypes subscribes the endpoint to every event; Enabled defaults to true
+// on creation and is left unchanged on update when omitted.
+type WebhookEndpointRequest struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// webhookEndpointWithSecret shows an endpoint with its signing secret, which is only
+// returned when the endpoint is created or its secret rotated
+type webhookEndpointWithSecret struct {
+	*models.WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// Endpoints handles GET and POST /api/user/webhooks, listing and registering endpoints
+func (h *WebhookEndpointsHandler) Endpoints(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		endpoints, err := h.db.GetWebhookEndpoints(r.Context(), userID)
+		if err != nil {
+			log.Printf("[Webhooks] Error loading endpoints for user %s: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, endpoints)
+
+	case http.MethodPost:
+		endpoints, err := h.db.GetWebhookEndpoints(r.Context(), userID)
+		if err != nil {
+			log.Printf("[Webhooks] Error loading endpoints for user %s: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if len(endpoints) >= maxWebhookEndpoints {
+			http.Error(w, fmt.Sprintf("At most %d webhook endpoints may be registered", maxWebhookEndpoints), http.StatusConflict)
+			return
+		}
+
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			log.Printf("[Webhooks] Error generating secret: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		endpoint := &models.WebhookEndpoint{
+			ID:      uuid.NewString(),
+			UserID:  userID,
+			Secret:  secret,
+			Enabled: true,
+		}
+		if !h.decodeEndpoint(w, r, endpoint) {
+			return
+		}
+		if err := h.db.CreateWebhookEndpoint(r.Context(), endpoint); err != nil {
+			log.Printf("[Webhooks] Error creating endpoint for user %s: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[Webhooks] User %s registered endpoint %s", userID, endpoint.ID)
+		sendJSONResponse(w, http.StatusCreated, webhookEndpointWithSecret{endpoint, endpoint.Secret})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Endpoint handles the routes under /api/user/webhooks/:
+//
+//	GET    /api/user/webhooks/event-types        the event types endpoints can subscribe to
+//	GET    /api/user/webhooks/{id}               one endpoint
+//	PUT    /api/user/webhooks/{id}               update an endpoint
+//	DELETE /api/user/webhooks/{id}               remove an endpoint and its delivery log
+//	GET    /api/user/webhooks/{id}/deliveries    the latest deliveries, ?limit= up to 100
+//	POST   /api/user/webhooks/{id}/test          send a ping event and return its delivery
+//	POST   /api/user/webhooks/{id}/secret        replace the signing secret
+func (h *WebhookEndpointsHandler) Endpoint(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	if userID == "" {
+		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/user/webhooks/")
+	if rest == "event-types" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sendJSONResponse(w, http.StatusOK, webhooks.EventTypes)
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+		return
+	}
+	endpoint, err := h.db.GetWebhookEndpoint(r.Context(), userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Webhooks] Error loading endpoint %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		sendJSONResponse(w, http.StatusOK, endpoint)
+	case action == "" && r.Method == http.MethodPut:
+		h.updateEndpoint(w, r, endpoint)
+	case action == "" && r.Method == http.MethodDelete:
+		h.deleteEndpoint(w, r, endpoint)
+	case action == "deliveries" && r.Method == http.MethodGet:
+		h.getDeliveries(w, r, endpoint)
+	case action == "test" && r.Method == http.MethodPost:
+		h.sendTest(w, r, endpoint)
+	case action == "secret" && r.Method == http.MethodPost:
+		h.rotateSecret(w, r, endpoint)
+	case action == "" || action == "deliveries" || action == "test" || action == "secret":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *WebhookEndpointsHandler) updateEndpoint(w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) {
+	if !h.decodeEndpoint(w, r, endpoint) {
+		return
+	}
+	if err := h.db.UpdateWebhookEndpoint(r.Context(), endpoint); err != nil {
+		log.Printf("[Webhooks] Error updating endpoint %s: %v", endpoint.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, endpoint)
+}
+
+func (h *WebhookEndpointsHandler) deleteEndpoint(w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) {
+	err := h.db.DeleteWebhookEndpoint(r.Context(), endpoint.UserID, endpoint.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Webhooks] Error deleting endpoint %s: %v", endpoint.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Webhooks] User %s removed endpoint %s", endpoint.UserID, endpoint.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookEndpointsHandler) getDeliveries(w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) {
+	limit := defaultWebhookDeliveries
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxWebhookDeliveries {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveries), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.db.GetWebhookDeliveries(r.Context(), endpoint.ID, limit)
+	if err != nil {
+		log.Printf("[Webhooks] Error loading deliveries of endpoint %s: %v", endpoint.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, deliveries)
+}
+
+func (h *WebhookEndpointsHandler) sendTest(w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) {
+	delivery, err := h.webhooks.SendTest(r.Context(), endpoint)
+	if err != nil {
+		log.Printf("[Webhooks] Error sending test event to endpoint %s: %v", endpoint.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// The outcome of the test, successful or not, is in the delivery
+	sendJSONResponse(w, http.StatusOK, delivery)
+}
+
+func (h *WebhookEndpointsHandler) rotateSecret(w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) {
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		log.Printf("[Webhooks] Error generating secret: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	endpoint.Secret = secret
+	if err := h.db.UpdateWebhookEndpoint(r.Context(), endpoint); err != nil {
+		log.Printf("[Webhooks] Error rotating secret of endpoint %s: %v", endpoint.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[Webhooks] User %s rotated the secret of endpoint %s", endpoint.UserID, endpoint.ID)
+	sendJSONResponse(w, http.StatusOK, webhookEndpointWithSecret{endpoint, endpoint.Secret})
+}
+
+// decodeEndpoint validates a WebhookEndpointRequest and applies it to endpoint,
+// writing an error response and returning false if it is invalid
+func (h *WebhookEndpointsHandler) decodeEndpoint(w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) bool {
+	var req WebhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" || len(req.URL) > maxWebhookURLLength {
+		http.Error(w, fmt.Sprintf("url is required and may be up to %d characters", maxWebhookURLLength), http.StatusBadRequest)
+		return false
+	}
+	if err := h.webhooks.ValidateURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if len(req.Description) > maxWebhookDescriptionLength {
+		http.Error(w, fmt.Sprintf("description may be up to %d characters", maxWebhookDescriptionLength), http.StatusBadRequest)
+		return false
+	}
+	eventTypes := []string{}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(webhooks.EventTypes, t) {
+			http.Error(w, fmt.Sprintf("Unknown event type %q; expected any of %s", t, strings.Join(webhooks.EventTypes, ", ")), http.StatusBadRequest)
+			return false
+		}
+		if !slices.Contains(eventTypes, t) {
+			eventTypes = append(eventTypes, t)
+		}
+	}
+
+	endpoint.URL = req.URL
+	endpoint.Description = req.Description
+	endpoint.EventTypes = eventTypes
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"saas-server/database/memstore"
+	"saas-server/models"
+	"saas-server/pkg/activity"
+	"saas-server/pkg/webhooks"
+)
+
+const (
+	testSigningSecret  = "signing-secret"
+	testCheckoutSecret = "checkout-secret"
+)
+
+func newTestWebhookHandler(store *memstore.Store) *WebhookHandler {
+	return &WebhookHandler{
+		DB:             store,
+		SigningSecret:  testSigningSecret,
+		CheckoutSecret: testCheckoutSecret,
+		Activity:       activity.NewHub(),
+		Webhooks:       webhooks.NewService(store, webhooks.Options{}),
+	}
+}
+
+// orderPayload builds an order webhook body with the given custom data
+func orderPayload(t *testing.T, event string, orderID int, customData map[string]interface{}) []byte {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{
+		"meta": map[string]interface{}{
+			"event_name":  event,
+			"custom_data": customData,
+		},
+		"data": map[string]interface{}{
+			"type": "orders",
+			"id":   "1",
+			"attributes": map[string]interface{}{
+				"order_number":              orderID,
+				"status":                    "paid",
+				"currency":                  "USD",
+				"total":                     1000,
+				"refunded_amount":           1000,
+				"refunded_amount_formatted": "$10.00",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func sign(body []byte, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestHandleWebhookSignature(t *testing.T) {
+	store := memstore.New()
+	user, err := store.CreateUser(context.Background(), "buyer@example.com", "", "Buyer", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := signCustomData(testCheckoutSecret, user.ID, "checkout-1")
+	body := orderPayload(t, "order_created", 42, signed)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		want      int
+	}{
+		{"missing signature", body, "", http.StatusBadRequest},
+		{"wrong secret", body, sign(body, "other-secret"), http.StatusForbidden},
+		{"tampered body", orderPayload(t, "order_created", 43, signed), sign(body, testSigningSecret), http.StatusForbidden},
+		{"valid signature", body, sign(body, testSigningSecret), http.StatusOK},
+	}
+
+	h := newTestWebhookHandler(store)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(tt.body))
+			if tt.signature != "" {
+				req.Header.Set("X-Signature", tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	orders, err := store.GetUserOrders(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].OrderID != 42 {
+		t.Errorf("orders = %+v, want only order 42", orders)
+	}
+}
+
+func TestHandleWebhookOrders(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	owner, err := store.CreateUser(ctx, "owner@example.com", "", "Owner", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.CreateUser(ctx, "other@example.com", "", "Other", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateOrder(ctx, &models.Orders{UserID: owner.ID, OrderID: 7, Status: "paid"}); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &models.WebhookEndpoint{
+		ID:         "endpoint-1",
+		UserID:     owner.ID,
+		URL:        "https://hooks.example.com/orders",
+		EventTypes: []string{webhooks.EventOrderRefunded},
+		Enabled:    true,
+	}
+	if err := store.CreateWebhookEndpoint(ctx, endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	forged := signCustomData("guessed-secret", other.ID, "checkout-2")
+
+	tests := []struct {
+		name       string
+		event      string
+		orderID    int
+		customData map[string]interface{}
+		want       int
+		check      func(t *testing.T)
+	}{
+		{
+			name:       "order with forged custom data is refused",
+			event:      "order_created",
+			orderID:    8,
+			customData: forged,
+			want:       http.StatusBadRequest,
+			check: func(t *testing.T) {
+				if _, err := store.GetOrder(ctx, 8); err == nil {
+					t.Error("order 8 was stored")
+				}
+			},
+		},
+		{
+			name:       "refund without signed custom data updates the stored order and notifies its owner",
+			event:      "order_refunded",
+			orderID:    7,
+			customData: nil,
+			want:       http.StatusOK,
+			check: func(t *testing.T) {
+				order, err := store.GetOrder(ctx, 7)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if order.Status != "refunded" || order.RefundedAmount != 1000 || order.UserID != owner.ID {
+					t.Errorf("order = %+v, want refunded order of %s", order, owner.ID)
+				}
+				deliveries, err := store.GetWebhookDeliveries(ctx, endpoint.ID, 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(deliveries) != 1 || deliveries[0].EventType != webhooks.EventOrderRefunded {
+					t.Errorf("deliveries = %+v, want one %s delivery", deliveries, webhooks.EventOrderRefunded)
+				}
+			},
+		},
+		{
+			name:       "refund of an unknown order is acknowledged",
+			event:      "order_refunded",
+			orderID:    99,
+			customData: nil,
+			want:       http.StatusOK,
+		},
+	}
+
+	h := newTestWebhookHandler(store)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := orderPayload(t, tt.event, tt.orderID, tt.customData)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+			req.Header.Set("X-Signature", sign(body, testSigningSecret))
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.check != nil {
+				tt.check(t)
+			}
+		})
+	}
+}
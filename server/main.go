@@ -5,66 +5,161 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"saas-server/config"
 	"saas-server/database"
 	"saas-server/handlers"
 	"saas-server/middleware"
+	"saas-server/pkg/activity"
+	"saas-server/pkg/analytics"
+	"saas-server/pkg/catalog"
+	"saas-server/pkg/cleanup"
+	"saas-server/pkg/dunning"
+	"saas-server/pkg/geoip"
+	"saas-server/pkg/ingest"
+	"saas-server/pkg/lemonsqueezy"
+	"saas-server/pkg/plunk"
+	"saas-server/pkg/rollup"
+	"saas-server/pkg/telemetry"
+	"saas-server/pkg/trial"
+	"saas-server/pkg/webhooks"
 
-	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
 // main initializes and starts the HTTP server with the following steps:
-// 1. Loads environment variables from .env file
-// 2. Establishes database connection and initializes schema
-// 3. Sets up authentication handlers and middleware
-// 4. Configures routes for both public and protected endpoints
-// 5. Configures CORS settings for cross-origin requests
-// 6. Starts the HTTP server on the specified port
+// 1. Loads and validates configuration from defaults, config file, .env and environment
+// 2. Initializes OpenTelemetry tracing
+// 3. Establishes database connection and initializes schema
+// 4. Starts background workers
+// 5. Sets up authentication handlers and middleware
+// 6. Configures routes for both public and protected endpoints
+// 7. Configures CORS settings for cross-origin requests
+// 8. Starts the HTTP server and shuts it down gracefully on SIGINT/SIGTERM
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	// Schema management runs as a one-off command instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		return
 	}
 
-	// Create database connection string
-	dbURL := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-	)
+	// Load configuration and refuse to start with missing or inconsistent settings
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Error loading configuration:", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	log.Print(cfg.Summary())
+
+	// Initialize tracing before anything creates spans
+	shutdownTracing, err := telemetry.Init(context.Background(), cfg.Telemetry.ServiceName, cfg.Telemetry.OTLPEndpoint)
+	if err != nil {
+		log.Fatal("Error initializing tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	// Initialize database
-	db, err := database.New(dbURL)
+	db, err := database.New(cfg.Database.DSN(), cfg.Database.Options())
 	if err != nil {
 		log.Fatal("Error connecting to database:", err)
 	}
 	defer db.Close()
 
-	// Run database migrations
+	// Keep the subscription status cache coherent with other replicas
+	listenCtx, stopListening := context.WithCancel(context.Background())
+	defer stopListening()
+	if err := db.ListenForInvalidations(listenCtx); err != nil {
+		log.Fatal("Error listening for cache invalidations:", err)
+	}
+
+	// Run database migrations; an advisory lock serializes replicas starting together
 	migrationManager := database.NewMigrationManager(db)
-	if err := migrationManager.RunMigrations(); err != nil {
+	if err := migrationManager.Up(context.Background()); err != nil {
 		log.Fatal("Error running migrations:", err)
 	}
 	log.Println("Database migrations applied successfully")
 
+	// Start background workers
+	tokenCleanup := cleanup.NewTokenCleanupService(db)
+	tokenCleanup.StartCleanupJob()
+
+	// Health and readiness probes
+	healthHandler := handlers.NewHealthHandler()
+	healthHandler.AddCheck("database", db.PingContext)
+	healthHandler.AddCheck("migrations", migrationManager.CheckUpToDate)
+
+	// Third-party API clients shared by handlers
+	mailer := plunk.NewClient(cfg.Plunk.SecretAPIKey)
+	lsClient := lemonsqueezy.NewClient(cfg.LemonSqueezy.APIKey, cfg.LemonSqueezy.StoreID, cfg.LemonSqueezy.Options())
+
+	// Keep the local product catalog in step with Lemon Squeezy
+	catalogSync := catalog.NewSyncService(db, lsClient, cfg.LemonSqueezy.CatalogSyncInterval)
+	if cfg.LemonSqueezy.Enabled() {
+		catalogSync.StartSyncJob()
+	}
+
+	// Chase failed subscription payments with reminders and downgrade after the grace period
+	dunningService := dunning.NewService(db, lsClient, mailer, cfg.Dunning.Options(cfg.Server.FrontendURL))
+	if cfg.LemonSqueezy.Enabled() {
+		dunningService.StartDunningJob()
+	}
+
+	// Remind users before their trial ends and end app-managed trials that run out
+	trials := trial.NewService(db, mailer, cfg.Trial.Options(cfg.Server.FrontendURL))
+	trials.StartTrialJob()
+
+	// Roll up page views for reporting and remove raw views past the retention period
+	pageViewRollups := rollup.NewService(db, cfg.Analytics.RollupOptions())
+	pageViewRollups.StartRollupJob()
+
+	// Notify the endpoints users registered of events on their account
+	outgoingWebhooks := webhooks.NewService(db, cfg.Webhooks.Options())
+	outgoingWebhooks.StartDeliveryJob()
+
+	// Live activity shown to admins as it happens on this instance
+	activityHub := activity.NewHub()
+
 	// Initialize handlers and middleware
-	authHandler := handlers.NewAuthHandler(db, os.Getenv("JWT_SECRET"))
-	authMiddleware := middleware.NewAuthMiddleware(db, os.Getenv("JWT_SECRET"))
-	adminHandler := handlers.NewAdminHandler(db)
-	adminMiddleware := middleware.NewAdminMiddleware()
-	analyticsHandler := handlers.NewAnalyticsHandler(db)
+	authHandler := handlers.NewAuthHandler(db, cfg, mailer, trials, activityHub)
+	authMiddleware := middleware.NewAuthMiddleware(db, db, cfg.Auth.JWTSecret, cfg.Server.TrustedProxyPrefixes())
+	// Forwarding headers are only believed from the configured proxies
+	clientIPs := middleware.NewClientIPResolver(cfg.Server.TrustedProxyPrefixes())
+	adminHandler := handlers.NewAdminHandler(db, cfg.Admin)
+	adminMiddleware := middleware.NewAdminMiddleware(db, cfg.Admin.JWTSecret)
+	visitors := analytics.NewIdentifier(db, cfg.Analytics.VisitorID, clientIPs)
+	var countries analytics.CountryLookup
+	if cfg.Analytics.GeoIPDatabase != "" {
+		geo, err := geoip.Open(cfg.Analytics.GeoIPDatabase)
+		if err != nil {
+			log.Fatalf("Failed to open GeoIP database: %v", err)
+		}
+		countries = geo
+	}
+	enricher := analytics.NewEnricher(countries, clientIPs, cfg.Server.FrontendURL)
+	// Write tracked page views and events in batches off the request path
+	analyticsIngest := ingest.NewPipeline(db, cfg.Analytics.IngestOptions())
+	analyticsIngest.StartFlushJob()
+	analyticsHandler := handlers.NewAnalyticsHandler(db, analyticsIngest, cfg.Auth.JWTSecret, visitors, enricher, clientIPs, activityHub)
 
 	// Create router
 	mux := http.NewServeMux()
 
+	// Health routes (public)
+	mux.HandleFunc("/healthz", healthHandler.Liveness)
+	mux.HandleFunc("/readyz", healthHandler.Readiness)
+
 	// Auth routes (public)
 	mux.HandleFunc("/auth/register", authHandler.Register)
 	mux.HandleFunc("/auth/login", authHandler.Login)
@@ -76,47 +171,87 @@ func main() {
 	mux.HandleFunc("/auth/verify", authHandler.VerifyEmail)
 
 	// Auth Routes (protected)
-	mux.Handle("/auth/verify-email", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.SendVerificationEmail)))
-	mux.Handle("/auth/logout", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.Logout)))
-	mux.Handle("/auth/account-password/reset", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.AccountPasswordReset)))
+	mux.Handle("/auth/verify-email", authMiddleware.RequireSession(http.HandlerFunc(authHandler.SendVerificationEmail)))
+	mux.Handle("/auth/logout", authMiddleware.RequireSession(http.HandlerFunc(authHandler.Logout)))
+	mux.Handle("/auth/account-password/reset", authMiddleware.RequireSession(http.HandlerFunc(authHandler.AccountPasswordReset)))
 
-	// User routes (protected)
-	mux.Handle("/user/profile/update", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.UpdateProfile)))
+	// User routes (protected). Profile changes, which include the email, need a session.
+	mux.Handle("/user/profile/update", authMiddleware.RequireSession(http.HandlerFunc(authHandler.UpdateProfile)))
 	mux.Handle("/user/verify-user", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.VerifyUser)))
 
 	// Payment webhook routes - initialize handler once for better resource management
-	webhookHandler := &handlers.WebhookHandler{DB: db}
+	webhookHandler := &handlers.WebhookHandler{
+		DB:             db,
+		SigningSecret:  cfg.LemonSqueezy.SigningSecret,
+		CheckoutSecret: cfg.LemonSqueezy.CheckoutSecret,
+		Dunning:        dunningService,
+		Trials:         trials,
+		Activity:       activityHub,
+		Webhooks:       outgoingWebhooks,
+	}
 	mux.HandleFunc("/payment/webhook", webhookHandler.HandleWebhook)
 
 	// Product routes
-	productsHandler := handlers.NewProductsHandler()
+	productsHandler := handlers.NewProductsHandler(db, catalogSync)
 	mux.HandleFunc("/api/products", productsHandler.GetProducts)
 	mux.HandleFunc("/api/products/", productsHandler.GetProduct)
 	mux.HandleFunc("/api/products/store/", productsHandler.GetProductsByStore)
 
 	// Checkout routes
-	checkoutHandler := handlers.NewCheckoutHandler(db)
-	mux.HandleFunc("/api/checkout", checkoutHandler.CreateCheckout)
+	checkoutHandler := handlers.NewCheckoutHandler(db, lsClient, cfg.LemonSqueezy.CheckoutSecret, cfg.CORSOrigins())
+	mux.Handle("/api/checkout", authMiddleware.RequireAuth(http.HandlerFunc(checkoutHandler.CreateCheckout)))
 
 	// User data routes (protected)
-	userDataHandler := handlers.NewUserDataHandler(db)
+	userDataHandler := handlers.NewUserDataHandler(db, lsClient, dunningService, trials)
 	mux.Handle("/api/user/orders", authMiddleware.RequireAuth(http.HandlerFunc(userDataHandler.GetUserOrders)))
 	mux.Handle("/api/user/subscription", authMiddleware.RequireAuth(http.HandlerFunc(userDataHandler.GetUserSubscription)))
-	mux.Handle("/api/user/subscription/billing", authMiddleware.RequireAuth(http.HandlerFunc(userDataHandler.GetBillingPortal)))
+	// The billing portal can cancel the subscription and change the card, so it needs a session
+	mux.Handle("/api/user/subscription/billing", authMiddleware.RequireSession(http.HandlerFunc(userDataHandler.GetBillingPortal)))
+
+	// Invoice routes (protected)
+	invoicesHandler := handlers.NewInvoicesHandler(db, cfg.Invoice.Brand())
+	mux.Handle("/api/user/invoices", authMiddleware.RequireAuth(http.HandlerFunc(invoicesHandler.GetInvoices)))
+	mux.Handle("/api/user/invoices/", authMiddleware.RequireAuth(http.HandlerFunc(invoicesHandler.DownloadInvoice)))
+
+	// Subscription management routes (protected). Changes need a session rather than an API key.
+	subscriptionHandler := handlers.NewSubscriptionHandler(db, lsClient)
+	mux.Handle("/api/user/subscription/plan/preview", authMiddleware.RequireAuth(http.HandlerFunc(subscriptionHandler.PreviewPlanChange)))
+	mux.Handle("/api/user/subscription/plan", authMiddleware.RequireSession(http.HandlerFunc(subscriptionHandler.ChangePlan)))
+	mux.Handle("/api/user/subscription/cancel", authMiddleware.RequireSession(http.HandlerFunc(subscriptionHandler.CancelSubscription)))
+	mux.Handle("/api/user/subscription/resume", authMiddleware.RequireSession(http.HandlerFunc(subscriptionHandler.ResumeSubscription)))
+	mux.Handle("/api/user/subscription/pause", authMiddleware.RequireSession(http.HandlerFunc(subscriptionHandler.PauseSubscription)))
+
+	// Outgoing webhook routes (protected, session only)
+	webhookEndpointsHandler := handlers.NewWebhookEndpointsHandler(db, outgoingWebhooks)
+	mux.Handle("/api/user/webhooks", authMiddleware.RequireSession(http.HandlerFunc(webhookEndpointsHandler.Endpoints)))
+	mux.Handle("/api/user/webhooks/", authMiddleware.RequireSession(http.HandlerFunc(webhookEndpointsHandler.Endpoint)))
+
+	// API key routes (protected, session only)
+	apiKeysHandler := handlers.NewAPIKeysHandler(db)
+	mux.Handle("/api/user/api-keys", authMiddleware.RequireSession(http.HandlerFunc(apiKeysHandler.Keys)))
+	mux.Handle("/api/user/api-keys/", authMiddleware.RequireSession(http.HandlerFunc(apiKeysHandler.Key)))
 
 	// Analytics routes (public)
 	mux.HandleFunc("/api/analytics/pageview", analyticsHandler.TrackPageView)
+	mux.HandleFunc("/api/analytics/event", analyticsHandler.TrackEvent)
+	mux.HandleFunc("/api/analytics/collect", analyticsHandler.Collect)
 
 	// Admin routes
 	mux.HandleFunc("/admin/login", adminHandler.Login)
 	mux.Handle("/admin/users", adminMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.GetUsers)))
+	mux.Handle("/admin/products/sync", adminMiddleware.RequireAdmin(http.HandlerFunc(productsHandler.SyncCatalog)))
+	mux.Handle("/admin/checkouts/abandoned", adminMiddleware.RequireAdmin(http.HandlerFunc(checkoutHandler.GetAbandonedCheckouts)))
+	dunningHandler := handlers.NewDunningHandler(db)
+	mux.Handle("/admin/dunning/stats", adminMiddleware.RequireAdmin(http.HandlerFunc(dunningHandler.GetDunningStats)))
+	trialHandler := handlers.NewTrialHandler(db)
+	mux.Handle("/admin/trials/conversions", adminMiddleware.RequireAdmin(http.HandlerFunc(trialHandler.GetConversionReport)))
 
 	// Add the new admin email route
-	emailHandler := &handlers.Handler{DB: db}
+	emailHandler := &handlers.Handler{DB: db, Mailer: mailer}
 	mux.Handle("/admin/send-email", adminMiddleware.RequireAdmin(http.HandlerFunc(emailHandler.AdminSendEmailHandler)))
 
 	// Contact form route - public, no authentication required
-	contactHandler := handlers.NewContactHandler()
+	contactHandler := handlers.NewContactHandler(mailer, cfg.Admin.Email, activityHub)
 	mux.HandleFunc("/api/contact", contactHandler.SendContactEmail)
 
 	// Early access waitlist route - public, no authentication required
@@ -127,7 +262,7 @@ func main() {
 	mux.Handle("/admin/early-access", adminMiddleware.RequireAdmin(http.HandlerFunc(earlyAccessHandler.GetAllEarlyAccessRegistrations)))
 
 	// Newsletter subscription routes - public, no authentication required
-	newsletterHandler := handlers.NewNewsletterHandler(db)
+	newsletterHandler := handlers.NewNewsletterHandler(db, mailer)
 	mux.HandleFunc("/api/newsletter/subscribe", newsletterHandler.Subscribe)
 
 	// Admin-only route to view all newsletter subscriptions
@@ -137,32 +272,80 @@ func main() {
 	mux.Handle("/admin/analytics/user-journey", adminMiddleware.RequireAdmin(http.HandlerFunc(analyticsHandler.GetUserJourney)))
 	mux.Handle("/admin/analytics/visitor-journey", adminMiddleware.RequireAdmin(http.HandlerFunc(analyticsHandler.GetVisitorJourney)))
 	mux.Handle("/admin/analytics/page-stats", adminMiddleware.RequireAdmin(http.HandlerFunc(analyticsHandler.GetPageViewStats)))
+	mux.Handle("/admin/analytics/funnel", adminMiddleware.RequireAdmin(http.HandlerFunc(analyticsHandler.GetFunnel)))
+	revenueHandler := handlers.NewRevenueHandler(db)
+	mux.Handle("/admin/analytics/revenue", adminMiddleware.RequireAdmin(http.HandlerFunc(revenueHandler.GetRevenue)))
+
+	// Admin dashboard KPIs
+	dashboardHandler := handlers.NewDashboardHandler(db)
+	mux.Handle("/admin/dashboard", adminMiddleware.RequireAdmin(http.HandlerFunc(dashboardHandler.GetDashboard)))
 
-	// Protected admin routes (example)
-	mux.Handle("/admin/dashboard", adminMiddleware.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"message": "Admin dashboard data"}`))
-	})))
+	// Live admin activity stream
+	activityHandler := handlers.NewActivityHandler(activityHub)
+	mux.Handle("/admin/stream", adminMiddleware.RequireAdminStream(http.HandlerFunc(activityHandler.Stream)))
+	mux.Handle("/admin/stream/token", adminMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.StreamToken)))
 
 	// Configure CORS
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:      []string{"http://localhost:3001", os.Getenv("FRONTEND_URL")}, // Add your frontend URL
+		AllowedOrigins:      cfg.CORSOrigins(),
 		AllowedMethods:      []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:      []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With"},
-		ExposedHeaders:      []string{"Link"},
+		AllowedHeaders:      []string{"Accept", "Authorization", "Content-Type", "If-None-Match", "X-CSRF-Token", "X-Requested-With"},
+		ExposedHeaders:      []string{"ETag", "Link"},
 		AllowCredentials:    true,
 		MaxAge:              300, // Maximum value not ignored by any of major browsers
 		AllowPrivateNetwork: true,
 	})
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Start server; timeouts protect the connection pool from slow or stalled clients
+	port := cfg.Server.Port
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           telemetry.HTTPHandler(corsHandler.Handler(mux), mux),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
+	// Activity streams never finish on their own; end them so that shutdown can drain
+	server.RegisterOnShutdown(activityHub.Close)
+
+	// Listen for termination signals from the orchestrator or terminal
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), corsHandler.Handler(mux)); err != nil {
+	select {
+	case err := <-serverErr:
 		log.Fatal("Error starting server:", err)
+	case <-ctx.Done():
 	}
+	stop()
+
+	log.Println("Shutdown signal received, draining connections")
+	healthHandler.SetDraining()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error during server shutdown: %v", err)
+	}
+
+	// Stop background workers once in-flight requests have drained, writing out
+	// the page views and events still buffered first
+	analyticsIngest.Stop()
+	tokenCleanup.Stop()
+	catalogSync.Stop()
+	dunningService.Stop()
+	trials.Stop()
+	pageViewRollups.Stop()
+	outgoingWebhooks.Stop()
+	log.Println("Server stopped")
 }
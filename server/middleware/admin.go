@@ -1,17 +1,28 @@
 package middleware
 
 import (
+	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 
+	"saas-server/database"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type AdminMiddleware struct{}
+// AdminStreamRole is the role of the short-lived tokens that open the admin activity
+// stream from a browser, whose EventSource cannot send an Authorization header. They
+// are not accepted by RequireAdmin, and each opens the stream only once.
+const AdminStreamRole = "admin_stream"
+
+type AdminMiddleware struct {
+	tokens    database.TokenRepository // Records the stream tokens already used
+	jwtSecret []byte
+}
 
-func NewAdminMiddleware() *AdminMiddleware {
-	return &AdminMiddleware{}
+func NewAdminMiddleware(tokens database.TokenRepository, jwtSecret string) *AdminMiddleware {
+	return &AdminMiddleware{tokens: tokens, jwtSecret: []byte(jwtSecret)}
 }
 
 func (m *AdminMiddleware) RequireAdmin(next http.Handler) http.Handler {
@@ -30,29 +41,76 @@ func (m *AdminMiddleware) RequireAdmin(next http.Handler) http.Handler {
 			return
 		}
 
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("ADMIN_JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		// Check if token has admin role
+		if _, ok := m.authorize(w, tokenString, "admin"); !ok {
 			return
 		}
 
-		// Check if token has admin role
-		claims, ok := token.Claims.(jwt.MapClaims)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdminStream accepts an admin token in the Authorization header, like
+// RequireAdmin, or a stream token with AdminStreamRole in the token query parameter.
+// A stream token is refused once it has been used, as URLs end up in logs and history.
+func (m *AdminMiddleware) RequireAdminStream(next http.Handler) http.Handler {
+	admin := m.RequireAdmin(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.URL.Query().Get("token")
+		if tokenString == "" {
+			admin.ServeHTTP(w, r)
+			return
+		}
+		claims, ok := m.authorize(w, tokenString, AdminStreamRole)
 		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
 			return
 		}
 
-		role, ok := claims["role"].(string)
-		if !ok || role != "admin" {
-			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		jti, _ := claims["jti"].(string)
+		exp, err := claims.GetExpirationTime()
+		if jti == "" || err != nil || exp == nil {
+			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			return
+		}
+		first, err := m.tokens.UseAdminStreamToken(r.Context(), jti, exp.Time)
+		if err != nil {
+			log.Printf("[Admin Middleware] Error recording stream token use: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !first {
+			http.Error(w, "Token already used", http.StatusUnauthorized)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authorize parses and validates a token and checks that it carries the given role,
+// returning its claims, or writing an error response and returning false otherwise
+func (m *AdminMiddleware) authorize(w http.ResponseWriter, tokenString, role string) (jwt.MapClaims, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return m.jwtSecret, nil
+	})
+
+	if err != nil || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if claimed, ok := claims["role"].(string); !ok || claimed != role {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
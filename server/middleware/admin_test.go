@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"saas-server/database/memstore"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRequireAdminStream(t *testing.T) {
+	const secret = "admin-secret"
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+	streamToken := sign(jwt.MapClaims{"sub": "admin", "exp": exp, "role": AdminStreamRole, "jti": "6f1c2c9e-9d4b-4c57-a2a4-0c4d1e0e8a11"})
+	adminToken := sign(jwt.MapClaims{"sub": "admin", "exp": exp, "role": "admin"})
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"first use of a stream token", "?token=" + streamToken, http.StatusOK},
+		{"replayed stream token", "?token=" + streamToken, http.StatusUnauthorized},
+		{"stream token without jti", "?token=" + sign(jwt.MapClaims{"sub": "admin", "exp": exp, "role": AdminStreamRole}), http.StatusUnauthorized},
+		{"admin token in the query", "?token=" + adminToken, http.StatusForbidden},
+		{"no token", "", http.StatusUnauthorized},
+	}
+
+	m := NewAdminMiddleware(memstore.New(), secret)
+	handler := m.RequireAdminStream(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/stream"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
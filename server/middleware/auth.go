@@ -3,11 +3,17 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
 
 	"saas-server/database"
+	"saas-server/pkg/apikeys"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -21,29 +27,58 @@ const UserIDKey contextKey = "userID"
 // UserIDContextKey is the exported string version of UserIDKey for external use
 const UserIDContextKey = "userID"
 
+// APIKeyIDKey is the context key for storing the ID of the API key a request was
+// authenticated with; it is unset for requests made with a session cookie
+const APIKeyIDKey contextKey = "apiKeyID"
+
 // AuthMiddleware handles JWT authentication for protected routes
 type AuthMiddleware struct {
-	db        *database.DB // Database connection for user operations
-	jwtSecret []byte       // Secret key for JWT signing and validation
+	tokens    database.TokenRepository  // Token store used to reject revoked access tokens
+	apiKeys   database.APIKeyRepository // Key store used to authenticate Bearer API keys
+	clientIPs *ClientIPResolver         // Resolves the address recorded as an API key's last use
+	jwtSecret []byte                    // Secret key for JWT signing and validation
 }
 
-// NewAuthMiddleware creates a new AuthMiddleware instance
-func NewAuthMiddleware(db *database.DB, jwtSecret string) *AuthMiddleware {
+// NewAuthMiddleware creates a new AuthMiddleware instance. X-Forwarded-For is only
+// trusted from trustedProxies.
+func NewAuthMiddleware(tokens database.TokenRepository, apiKeys database.APIKeyRepository, jwtSecret string, trustedProxies []netip.Prefix) *AuthMiddleware {
 	return &AuthMiddleware{
-		db:        db,
+		tokens:    tokens,
+		apiKeys:   apiKeys,
+		clientIPs: NewClientIPResolver(trustedProxies),
 		jwtSecret: []byte(jwtSecret),
 	}
 }
 
-// RequireAuth is a middleware that checks for a valid JWT token in the cookie
-// If the token is valid, it adds the user ID to the request context
+// RequireAuth is a middleware that accepts either a personal API key sent as
+// "Authorization: Bearer <key>" or a session cookie, see RequireSession.
+// Either way it adds the user ID to the request context.
 func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
+	session := m.RequireSession(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			m.serveAPIKey(w, r, header, next)
+			return
+		}
+		session.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession is a middleware that checks for a valid JWT token in the cookie
+// If the token is valid, it adds the user ID to the request context. Routes that
+// manage the account itself use it so that API keys cannot reach them.
+func (m *AuthMiddleware) RequireSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Log request details
 		log.Printf("[Auth Middleware] Request received - Method: %s, Path: %s", r.Method, r.URL.Path)
 
 		// Extract token from HTTP-only cookie
 		cookie, err := r.Cookie("access_token")
+		if err != nil && strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			log.Printf("[Auth Middleware] API key used on session-only route %s", r.URL.Path)
+			http.Error(w, "API keys cannot be used for this request; sign in instead", http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			log.Printf("[Auth Middleware] No access token cookie found: %v", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -91,7 +126,7 @@ func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 
 		// Check if token is blacklisted
 		if jti, ok := claims["jti"].(string); ok {
-			blacklisted, err := m.db.IsTokenBlacklisted(jti)
+			blacklisted, err := m.tokens.IsTokenBlacklisted(r.Context(), jti)
 			if err != nil {
 				log.Printf("[Auth Middleware] Error checking token blacklist: %v", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -120,6 +155,56 @@ func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// serveAPIKey authenticates a request by the API key in its Authorization header.
+// The key must be active and hold the scope the request method needs.
+func (m *AuthMiddleware) serveAPIKey(w http.ResponseWriter, r *http.Request, header string, next http.Handler) {
+	key, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		log.Printf("[Auth Middleware] Unsupported authorization scheme")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	prefix, ok := apikeys.Prefix(strings.TrimSpace(key))
+	if !ok {
+		log.Printf("[Auth Middleware] Malformed API key")
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	apiKey, err := m.apiKeys.GetAPIKeyByPrefix(r.Context(), prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[Auth Middleware] Unknown API key %s", prefix)
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("[Auth Middleware] Error loading API key %s: %v", prefix, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	if !apikeys.Matches(strings.TrimSpace(key), apiKey.KeyHash) || !apiKey.Active(now) {
+		log.Printf("[Auth Middleware] Rejected API key %s", prefix)
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	if scope := apikeys.ScopeFor(r.Method); !apiKey.Allows(scope) {
+		log.Printf("[Auth Middleware] API key %s lacks the %s scope", prefix, scope)
+		http.Error(w, fmt.Sprintf("API key lacks the %s scope", scope), http.StatusForbidden)
+		return
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apikeys.TouchInterval {
+		if err := m.apiKeys.TouchAPIKey(r.Context(), apiKey.ID, now, m.clientIPs.ClientIP(r)); err != nil {
+			log.Printf("[Auth Middleware] Error recording use of API key %s: %v", prefix, err)
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, apiKey.UserID)
+	ctx = context.WithValue(ctx, APIKeyIDKey, apiKey.ID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetUserID retrieves the user ID from the context
 // Returns an empty string if the user ID is not found in the context
 func GetUserID(ctx context.Context) string {
@@ -133,3 +218,10 @@ func GetUserID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// GetAPIKeyID returns the ID of the API key the request was authenticated with, or
+// an empty string if it was made with a session cookie
+func GetAPIKeyID(ctx context.Context) string {
+	apiKeyID, _ := ctx.Value(APIKeyIDKey).(string)
+	return apiKeyID
+}
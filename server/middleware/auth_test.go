@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"saas-server/database/memstore"
+	"saas-server/models"
+	"saas-server/pkg/apikeys"
+
+	"github.com/google/uuid"
+)
+
+// createKey stores a key for the user and returns it in full
+func createKey(t *testing.T, store *memstore.Store, userID string, scopes []string, expiresAt *time.Time) string {
+	t.Helper()
+	secret, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &models.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      "test",
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := store.CreateAPIKey(context.Background(), key, 10); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestRequireAuthAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	user, err := store.CreateUser(ctx, "dev@example.com", "", "Dev", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	readKey := createKey(t, store, user.ID, []string{apikeys.ScopeRead}, nil)
+	writeKey := createKey(t, store, user.ID, []string{apikeys.ScopeRead, apikeys.ScopeWrite}, nil)
+	expiredKey := createKey(t, store, user.ID, []string{apikeys.ScopeRead}, &expired)
+	revokedKey := createKey(t, store, user.ID, []string{apikeys.ScopeRead}, nil)
+	keys, err := store.GetAPIKeys(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedPrefix, _ := apikeys.Prefix(revokedKey)
+	for _, k := range keys {
+		if k.Prefix == revokedPrefix {
+			if _, err := store.RevokeAPIKey(ctx, user.ID, k.ID, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	unknownKey, _, _, err := apikeys.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		want   int
+	}{
+		{"read key may read", http.MethodGet, "Bearer " + readKey, http.StatusOK},
+		{"read key may not write", http.MethodPost, "Bearer " + readKey, http.StatusForbidden},
+		{"write key may write", http.MethodPost, "Bearer " + writeKey, http.StatusOK},
+		{"write key may delete", http.MethodDelete, "Bearer " + writeKey, http.StatusOK},
+		{"expired key", http.MethodGet, "Bearer " + expiredKey, http.StatusUnauthorized},
+		{"revoked key", http.MethodGet, "Bearer " + revokedKey, http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "Bearer " + unknownKey, http.StatusUnauthorized},
+		{"malformed key", http.MethodGet, "Bearer sk_nope", http.StatusUnauthorized},
+		{"other scheme", http.MethodGet, "Basic " + readKey, http.StatusUnauthorized},
+		{"no credentials", http.MethodGet, "", http.StatusUnauthorized},
+	}
+
+	m := NewAuthMiddleware(store, store, "jwt-secret", nil)
+	var gotUser, gotKey string
+	handler := m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotKey = GetUserID(r.Context()), GetAPIKeyID(r.Context())
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotKey = "", ""
+			req := httptest.NewRequest(tt.method, "/api/user/orders", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusOK && (gotUser != user.ID || gotKey == "") {
+				t.Errorf("context user = %q, key = %q; want user %s and a key", gotUser, gotKey, user.ID)
+			}
+		})
+	}
+}
+
+func TestRequireSessionRefusesAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	user, err := store.CreateUser(ctx, "dev@example.com", "", "Dev", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey := createKey(t, store, user.ID, []string{apikeys.ScopeRead, apikeys.ScopeWrite}, nil)
+
+	m := NewAuthMiddleware(store, store, "jwt-secret", nil)
+	handler := m.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("session-only handler reached with an API key")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/user/profile/update", nil)
+	req.Header.Set("Authorization", "Bearer "+writeKey)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ClientIPResolver determines the address of the client making a request. The
+// X-Forwarded-For header is only believed when the request comes from one of the
+// trusted proxies, as any client can set it.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver creates a resolver trusting X-Forwarded-For from the given proxies
+func NewClientIPResolver(trustedProxies []netip.Prefix) *ClientIPResolver {
+	return &ClientIPResolver{trusted: trustedProxies}
+}
+
+// ClientIP returns the address of the client making r, or an empty string if it
+// cannot be determined. Behind trusted proxies it is the last X-Forwarded-For entry
+// not added by one of them.
+func (c *ClientIPResolver) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+
+	// Walk the chain back from the nearest hop until an address no proxy of ours added
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && c.isTrusted(addr); i-- {
+		if addr, err = netip.ParseAddr(strings.TrimSpace(hops[i])); err != nil {
+			return ""
+		}
+	}
+	return addr.Unmap().WithZone("").String()
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return slices.ContainsFunc(c.trusted, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// FromTrustedProxy reports whether r was made by one of the trusted proxies, so that
+// the headers they add about the client may be believed
+func (c *ClientIPResolver) FromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && c.isTrusted(addr)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"saas-server/config"
+	"saas-server/database"
+)
+
+const migrateUsage = `Usage: %s migrate <command> [arguments]
+
+Commands:
+  up              Apply all pending migrations
+  down [N]        Roll back the N most recently applied migrations (default 1)
+  status          List migrations and whether they have been applied
+  goto VERSION    Migrate up or down to VERSION (0 rolls back everything)
+  create NAME     Create an empty up/down migration pair in -dir
+
+Flags:
+`
+
+// runMigrate implements the "migrate" subcommand. Migrations are embedded in the
+// binary, so only create touches the filesystem.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "database/migrations", "directory new migrations are created in")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), migrateUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing migrate command")
+	}
+	command, rest := flags.Arg(0), flags.Args()[1:]
+
+	if command == "create" {
+		if len(rest) != 1 {
+			return errors.New("usage: migrate create NAME")
+		}
+		upPath, downPath, err := database.CreateMigration(*dir, rest[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\nCreated %s\n", upPath, downPath)
+		return nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+	db, err := database.New(cfg.Database.DSN(), cfg.Database.Options())
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	manager := database.NewMigrationManager(db)
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		return manager.Up(ctx)
+	case "down":
+		n := 1
+		if len(rest) > 0 {
+			if n, err = strconv.Atoi(rest[0]); err != nil {
+				return fmt.Errorf("invalid number of migrations %q", rest[0])
+			}
+		}
+		return manager.Down(ctx, n)
+	case "goto":
+		if len(rest) != 1 {
+			return errors.New("usage: migrate goto VERSION")
+		}
+		return manager.Goto(ctx, rest[0])
+	case "status":
+		statuses, err := manager.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(statuses)
+		return nil
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+// printMigrationStatus writes the migration status as an aligned table
+func printMigrationStatus(statuses []database.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Missing:
+			state = "applied (file missing)"
+		case s.Modified:
+			state = "applied (modified)"
+		case s.Applied:
+			state = "applied"
+		}
+		appliedAt := "-"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// APIKey is a personal key a user created to call the API from scripts and tools
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	// Prefix is the start of the key, shown to tell keys apart
+	Prefix string `json:"prefix"`
+	// KeyHash is the SHA-256 of the key, which itself is only shown when created
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Allows reports whether the key was granted the given scope
+func (k *APIKey) Allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
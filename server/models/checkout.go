@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Checkout statuses
+const (
+	CheckoutPending   = "pending"
+	CheckoutCompleted = "completed"
+)
+
+// Checkout is a checkout session started by a signed-in user
+type Checkout struct {
+	ID                 string     `json:"id"`
+	UserID             string     `json:"user_id"`
+	UserEmail          string     `json:"user_email,omitempty"`
+	VariantID          int        `json:"variant_id"`
+	DiscountCode       string     `json:"discount_code,omitempty"`
+	ProviderCheckoutID string     `json:"provider_checkout_id,omitempty"`
+	CheckoutURL        string     `json:"checkout_url,omitempty"`
+	Status             string     `json:"status"`
+	OrderID            *int       `json:"order_id,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	CompletedAt        *time.Time `json:"completed_at,omitempty"`
+}
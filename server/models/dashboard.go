@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+)
+
+// DashboardSummary is the overview shown on the admin dashboard
+type DashboardSummary struct {
+	GeneratedAt   time.Time        `json:"generated_at"`
+	Users         UserKPIs         `json:"users"`
+	Subscriptions SubscriptionKPIs `json:"subscriptions"`
+	Revenue       RevenueKPIs      `json:"revenue"`
+	Waitlist      GrowthKPIs       `json:"waitlist"`
+	Newsletter    GrowthKPIs       `json:"newsletter"`
+	TopPages      []PageCount      `json:"top_pages"`
+	RecentSignups []RecentSignup   `json:"recent_signups"`
+}
+
+// UserKPIs counts user accounts. New accounts are counted since the start of the
+// UTC day and over the last 7 and 30 days.
+type UserKPIs struct {
+	Total      int `json:"total"`
+	Verified   int `json:"verified"`
+	Unverified int `json:"unverified"`
+	NewToday   int `json:"new_today"`
+	New7Days   int `json:"new_7_days"`
+	New30Days  int `json:"new_30_days"`
+}
+
+// SubscriptionKPIs counts live subscriptions by status, overall and per plan.
+// AppTrials are trials granted at signup, which have no subscription.
+type SubscriptionKPIs struct {
+	Active    int         `json:"active"`
+	Trialing  int         `json:"trialing"`
+	PastDue   int         `json:"past_due"`
+	AppTrials int         `json:"app_trials"`
+	ByPlan    []PlanCount `json:"by_plan"`
+}
+
+// PlanCount counts the live subscriptions on one variant
+type PlanCount struct {
+	ProductID   int    `json:"product_id"`
+	VariantID   int    `json:"variant_id"`
+	ProductName string `json:"product_name"`
+	VariantName string `json:"variant_name"`
+	Active      int    `json:"active"`
+	Trialing    int    `json:"trialing"`
+	PastDue     int    `json:"past_due"`
+}
+
+// RevenueKPIs reports the money collected since the start of the UTC month, per currency
+type RevenueKPIs struct {
+	MonthStart time.Time        `json:"month_start"`
+	ThisMonth  []CurrencyAmount `json:"this_month"`
+}
+
+// CurrencyAmount is an amount in the smallest unit of a currency
+type CurrencyAmount struct {
+	Currency string `json:"currency"`
+	Amount   int    `json:"amount"`
+}
+
+// GrowthKPIs counts a signup list and its recent growth
+type GrowthKPIs struct {
+	Total     int `json:"total"`
+	New7Days  int `json:"new_7_days"`
+	New30Days int `json:"new_30_days"`
+}
+
+// PageCount is the number of views of a path
+type PageCount struct {
+	Path  string `json:"path"`
+	Views int    `json:"views"`
+}
+
+// RecentSignup is a newly registered user
+type RecentSignup struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
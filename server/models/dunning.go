@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Dunning case statuses. An open case keeps the user's entitlements during the grace
+// period; a downgraded case has outlived it. Both end as recovered when a retried
+// payment succeeds, or closed when the subscription ends without paying.
+const (
+	DunningOpen       = "open"
+	DunningDowngraded = "downgraded"
+	DunningRecovered  = "recovered"
+	DunningClosed     = "closed"
+)
+
+// DunningCase tracks a subscription whose renewal payment failed
+type DunningCase struct {
+	ID               int        `json:"id"`
+	SubscriptionID   int        `json:"subscription_id"`
+	UserID           string     `json:"user_id"`
+	Status           string     `json:"status"`
+	FailedAt         time.Time  `json:"failed_at"`
+	GraceEndsAt      time.Time  `json:"grace_ends_at"`
+	RemindersSent    int        `json:"reminders_sent"`
+	LastReminderAt   *time.Time `json:"last_reminder_at,omitempty"`
+	UpdatePaymentURL string     `json:"update_payment_url,omitempty"`
+	DowngradedAt     *time.Time `json:"downgraded_at,omitempty"`
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// DunningBanner is the in-app notice shown while a subscription payment is failing
+type DunningBanner struct {
+	Status           string    `json:"status"`
+	FailedAt         time.Time `json:"failed_at"`
+	GraceEndsAt      time.Time `json:"grace_ends_at"`
+	InGracePeriod    bool      `json:"in_grace_period"`
+	UpdatePaymentURL string    `json:"update_payment_url,omitempty"`
+}
+
+// DunningStats summarizes dunning cases opened since a point in time
+type DunningStats struct {
+	Since              time.Time `json:"since"`
+	Opened             int       `json:"opened"`
+	Open               int       `json:"open"`
+	Downgraded         int       `json:"downgraded"`
+	Recovered          int       `json:"recovered"`
+	Closed             int       `json:"closed"`
+	RecoveryRate       float64   `json:"recovery_rate"`
+	RemindersSent      int       `json:"reminders_sent"`
+	AvgHoursToRecovery float64   `json:"avg_hours_to_recovery"`
+}
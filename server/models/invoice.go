@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// Invoice kinds
+const (
+	InvoiceKindOrder        = "order"
+	InvoiceKindSubscription = "subscription"
+)
+
+// SubscriptionInvoice is a single charge of a subscription. Amounts are in the
+// smallest unit of Currency.
+type SubscriptionInvoice struct {
+	ID             int        `json:"id"`
+	InvoiceID      int        `json:"invoice_id"`
+	SubscriptionID int        `json:"subscription_id"`
+	UserID         string     `json:"user_id"`
+	CustomerID     int        `json:"customer_id"`
+	BillingReason  string     `json:"billing_reason"`
+	Status         string     `json:"status"`
+	Currency       string     `json:"currency"`
+	Subtotal       int        `json:"subtotal"`
+	DiscountTotal  int        `json:"discount_total"`
+	Tax            int        `json:"tax"`
+	Total          int        `json:"total"`
+	TaxInclusive   bool       `json:"tax_inclusive"`
+	Refunded       bool       `json:"refunded"`
+	RefundedAmount int        `json:"refunded_amount"`
+	RefundedAt     *time.Time `json:"refunded_at,omitempty"`
+	BillingName    string     `json:"billing_name,omitempty"`
+	BillingEmail   string     `json:"billing_email,omitempty"`
+	CardBrand      string     `json:"card_brand,omitempty"`
+	CardLastFour   string     `json:"card_last_four,omitempty"`
+	InvoiceURL     string     `json:"invoice_url,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Invoice is an entry of a user's billing history: either a one-off order or a
+// subscription charge. ID is "<kind>-<provider ID>" and identifies the PDF download.
+type Invoice struct {
+	ID             string     `json:"id"`
+	Kind           string     `json:"kind"`
+	Number         int        `json:"number"`
+	Description    string     `json:"description"`
+	Status         string     `json:"status"`
+	Currency       string     `json:"currency"`
+	Subtotal       int        `json:"subtotal"`
+	DiscountTotal  int        `json:"discount_total"`
+	Tax            int        `json:"tax"`
+	Total          int        `json:"total"`
+	TaxInclusive   bool       `json:"tax_inclusive"`
+	RefundedAmount int        `json:"refunded_amount"`
+	RefundedAt     *time.Time `json:"refunded_at,omitempty"`
+	ReceiptURL     string     `json:"receipt_url,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -4,6 +4,9 @@ import (
 	"time"
 )
 
+// Orders is a one-off purchase. Amounts are in the smallest unit of Currency,
+// e.g. cents; the formatted strings are the provider's own rendering of them. Orders
+// recorded before amounts were stored have no Currency and zero amounts.
 type Orders struct {
 	ID                      int        `json:"id"`
 	OrderID                 int        `json:"order_id"`
@@ -12,10 +15,20 @@ type Orders struct {
 	ProductID               int        `json:"product_id"`
 	VariantID               int        `json:"variant_id"`
 	Status                  string     `json:"status"`
+	Currency                string     `json:"currency"`
+	Subtotal                int        `json:"subtotal"`
+	DiscountTotal           int        `json:"discount_total"`
+	Tax                     int        `json:"tax"`
+	Total                   int        `json:"total"`
+	RefundedAmount          int        `json:"refunded_amount"`
+	TaxName                 string     `json:"tax_name,omitempty"`
 	SubtotalFormatted       string     `json:"subtotal_formatted"`
 	TaxFormatted            string     `json:"tax_formatted"`
 	TotalFormatted          string     `json:"total_formatted"`
 	TaxInclusive            bool       `json:"tax_inclusive"`
+	BillingName             string     `json:"billing_name,omitempty"`
+	BillingEmail            string     `json:"billing_email,omitempty"`
+	ReceiptURL              string     `json:"receipt_url,omitempty"`
 	RefundedAt              *time.Time `json:"refunded_at,omitempty"`
 	RefundedAmountFormatted string     `json:"refunded_amount_formatted,omitempty"`
 	CreatedAt               time.Time  `json:"created_at"`
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// Product is a Lemon Squeezy product mirrored into the local catalog
+type Product struct {
+	ID             int       `json:"id"`
+	StoreID        int       `json:"store_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Slug           string    `json:"slug"`
+	Status         string    `json:"status"`
+	Price          int       `json:"price"`
+	PriceFormatted string    `json:"price_formatted"`
+	ThumbURL       string    `json:"thumb_url"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SyncedAt       time.Time `json:"synced_at"`
+	Variants       []Variant `json:"variants"`
+}
+
+// Variant is a purchasable option of a Product. Subscription variants bill every
+// IntervalCount Intervals, e.g. every 1 "month".
+type Variant struct {
+	ID             int       `json:"id"`
+	ProductID      int       `json:"product_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Price          int       `json:"price"`
+	Status         string    `json:"status"`
+	IsSubscription bool      `json:"is_subscription"`
+	Interval       string    `json:"interval,omitempty"`
+	IntervalCount  int       `json:"interval_count,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SyncedAt       time.Time `json:"synced_at"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// SubscriptionEvent records a subscription's state after a change, with the monthly
+// recurring revenue that state is worth in the smallest currency unit
+type SubscriptionEvent struct {
+	ID             int       `json:"id"`
+	SubscriptionID int       `json:"subscription_id"`
+	UserID         string    `json:"user_id"`
+	Event          string    `json:"event"`
+	Status         string    `json:"status"`
+	ProductID      int       `json:"product_id"`
+	VariantID      int       `json:"variant_id"`
+	MRR            int       `json:"mrr"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// Payment is money collected from an order or subscription charge, net of refunds
+type Payment struct {
+	UserID    string    `json:"user_id"`
+	ProductID int       `json:"product_id"`
+	VariantID int       `json:"variant_id"`
+	Amount    int       `json:"amount"`
+	Currency  string    `json:"currency"`
+	PaidAt    time.Time `json:"paid_at"`
+}
+
+// RevenuePeriod holds the revenue metrics of one month. MRR figures are at the end of
+// the period; movements compare each customer's MRR at its start and end.
+type RevenuePeriod struct {
+	Period               string    `json:"period"`
+	Start                time.Time `json:"start"`
+	End                  time.Time `json:"end"`
+	MRR                  int       `json:"mrr"`
+	ARR                  int       `json:"arr"`
+	NewMRR               int       `json:"new_mrr"`
+	ExpansionMRR         int       `json:"expansion_mrr"`
+	ContractionMRR       int       `json:"contraction_mrr"`
+	ChurnedMRR           int       `json:"churned_mrr"`
+	ReactivationMRR      int       `json:"reactivation_mrr"`
+	NetNewMRR            int       `json:"net_new_mrr"`
+	Customers            int       `json:"customers"`
+	NewCustomers         int       `json:"new_customers"`
+	ChurnedCustomers     int       `json:"churned_customers"`
+	ReactivatedCustomers int       `json:"reactivated_customers"`
+	LogoChurnRate        float64   `json:"logo_churn_rate"`
+	RevenueChurnRate     float64   `json:"revenue_churn_rate"`
+	ARPU                 float64   `json:"arpu"`
+	LTV                  float64   `json:"ltv"`
+	Revenue              int       `json:"revenue"`
+}
+
+// RevenueSummary describes the latest period, with churn averaged over the whole range
+type RevenueSummary struct {
+	MRR              int     `json:"mrr"`
+	ARR              int     `json:"arr"`
+	Customers        int     `json:"customers"`
+	ARPU             float64 `json:"arpu"`
+	AvgLogoChurnRate float64 `json:"avg_logo_churn_rate"`
+	LTV              float64 `json:"ltv"`
+	Revenue          int     `json:"revenue"`
+}
+
+// CohortRetention follows the customers who started paying in one month. Retained[i]
+// counts those still paying at the end of the i-th month after it.
+type CohortRetention struct {
+	Cohort    string    `json:"cohort"`
+	Customers int       `json:"customers"`
+	Retained  []int     `json:"retained"`
+	Retention []float64 `json:"retention"`
+}
+
+// RevenueReport is the admin revenue analytics report. Amounts are in the smallest
+// unit of the store currency.
+type RevenueReport struct {
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	ProductID int               `json:"product_id,omitempty"`
+	VariantID int               `json:"variant_id,omitempty"`
+	Summary   RevenueSummary    `json:"summary"`
+	Periods   []RevenuePeriod   `json:"periods"`
+	Cohorts   []CohortRetention `json:"cohorts"`
+}
@@ -20,4 +20,8 @@ type Subscription struct {
 	TrialEndsAt    *time.Time `json:"trial_ends_at,omitempty"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
+	// Dunning is set while a payment for the subscription is failing
+	Dunning *DunningBanner `json:"dunning,omitempty"`
+	// Trial is set while the user is on a free trial
+	Trial *TrialInfo `json:"trial,omitempty"`
 }
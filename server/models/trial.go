@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// Trial sources: granted by the app at signup, or a subscription that started on trial
+const (
+	TrialSourceApp          = "app"
+	TrialSourceLemonSqueezy = "lemonsqueezy"
+)
+
+// Trial statuses. A trial is active until it converts to a paid plan or expires.
+const (
+	TrialActive    = "active"
+	TrialConverted = "converted"
+	TrialExpired   = "expired"
+)
+
+// Trial tracks a free trial from start to conversion or expiry
+type Trial struct {
+	ID             int        `json:"id"`
+	UserID         string     `json:"user_id"`
+	Source         string     `json:"source"`
+	SubscriptionID *int       `json:"subscription_id,omitempty"`
+	ProductID      int        `json:"product_id"`
+	VariantID      int        `json:"variant_id"`
+	Status         string     `json:"status"`
+	StartedAt      time.Time  `json:"started_at"`
+	EndsAt         time.Time  `json:"ends_at"`
+	ReminderSentAt *time.Time `json:"reminder_sent_at,omitempty"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TrialInfo is the trial state shown to the user alongside their subscription
+type TrialInfo struct {
+	Source        string    `json:"source"`
+	EndsAt        time.Time `json:"ends_at"`
+	DaysRemaining int       `json:"days_remaining"`
+}
+
+// TrialConversion counts the outcomes of trials started in a reporting window
+type TrialConversion struct {
+	Source           string  `json:"source,omitempty"`
+	Started          int     `json:"started"`
+	Active           int     `json:"active"`
+	Converted        int     `json:"converted"`
+	Expired          int     `json:"expired"`
+	ConversionRate   float64 `json:"conversion_rate"`
+	AvgDaysToConvert float64 `json:"avg_days_to_convert"`
+}
+
+// TrialReport is the trial-to-paid conversion report for admins
+type TrialReport struct {
+	Since    time.Time         `json:"since"`
+	Total    TrialConversion   `json:"total"`
+	BySource []TrialConversion `json:"by_source"`
+}
+
+// SetRates fills in the derived figures given the total days the converted trials took.
+// The conversion rate is taken over trials that have ended, since active trials may
+// still go either way.
+func (c *TrialConversion) SetRates(daysToConvert float64) {
+	if ended := c.Converted + c.Expired; ended > 0 {
+		c.ConversionRate = float64(c.Converted) / float64(ended)
+	}
+	if c.Converted > 0 {
+		c.AvgDaysToConvert = daysToConvert / float64(c.Converted)
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Webhook delivery statuses. A pending delivery waits for its next attempt; it ends
+// as succeeded once the endpoint answers with a 2xx status, or as failed once every
+// retry is used up.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL a user registered to be notified of account events
+type WebhookEndpoint struct {
+	ID          string `json:"id"`
+	UserID      string `json:"user_id"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	// EventTypes lists the events sent to the endpoint; empty means every event
+	EventTypes []string `json:"event_types"`
+	// Secret signs deliveries. It is only shown when created or rotated.
+	Secret    string    `json:"-"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Wants reports whether events of the given type are sent to the endpoint
+func (e *WebhookEndpoint) Wants(eventType string) bool {
+	return e.Enabled && (len(e.EventTypes) == 0 || slices.Contains(e.EventTypes, eventType))
+}
+
+// WebhookDelivery is an event sent, or waiting to be sent, to an endpoint, together
+// with the outcome of its latest attempt
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	EndpointID     string          `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	DurationMS     int             `json:"duration_ms"`
+	CreatedAt      time.Time       `json:"created_at"`
+	// URL and Secret are those of the endpoint, filled when the delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
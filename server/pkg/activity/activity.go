@@ -0,0 +1,205 @@
+// Package activity is an in-process publish/subscribe hub for live events shown to
+// admins: page views, signups, payments and the like. Events are only delivered to
+// subscribers connected to the same instance and are not persisted.
+package activity
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	TypePageView      = "pageview"
+	TypeSignup        = "signup"
+	TypeEmailVerified = "email_verified"
+	TypeOrder         = "order"
+	TypePayment       = "payment"
+	TypeSubscription  = "subscription"
+	TypeContact       = "contact"
+	// TypeVisitors carries the number of visitors online
+	TypeVisitors = "visitors"
+)
+
+// Types lists every event type
+var Types = []string{
+	TypePageView, TypeSignup, TypeEmailVerified, TypeOrder,
+	TypePayment, TypeSubscription, TypeContact, TypeVisitors,
+}
+
+// OnlineWindow is how recently a visitor must have viewed a page to count as online
+const OnlineWindow = 5 * time.Minute
+
+const (
+	// subscriberBuffer is the number of events a subscriber may fall behind by;
+	// further events are dropped for that subscriber until it catches up
+	subscriberBuffer = 64
+	// historySize is the number of recent events kept for reconnecting subscribers
+	historySize = 100
+)
+
+// Event is a published event. IDs increase by one per event and restart with the process.
+type Event struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// Visitors is the data of a TypeVisitors event
+type Visitors struct {
+	Online int `json:"online"`
+}
+
+// Subscription receives the events of the types it asked for
+type Subscription struct {
+	events chan Event
+	types  map[string]bool
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription ends or the hub is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// wants reports whether the subscription asked for events of type t
+func (s *Subscription) wants(t string) bool {
+	return len(s.types) == 0 || s.types[t]
+}
+
+// Hub fans published events out to subscribers and tracks who is online
+type Hub struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	subscribers map[*Subscription]bool
+	closed      bool
+
+	// online maps each visitor to when they last viewed a page
+	online     map[string]time.Time
+	lastOnline int
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscription]bool),
+		online:      make(map[string]time.Time),
+	}
+}
+
+// Subscribe starts delivering events of the given types, or of every type if none
+// are given. Events published after lastID and still held in the recent history
+// are delivered first, so that a reconnecting client misses as little as possible.
+func (h *Hub) Subscribe(types []string, lastID uint64) *Subscription {
+	s := &Subscription{events: make(chan Event, subscriberBuffer), types: make(map[string]bool, len(types))}
+	for _, t := range types {
+		s.types[t] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.events)
+		return s
+	}
+	// An ID from before a restart refers to a different sequence
+	if lastID > 0 && lastID <= h.nextID {
+		for _, e := range h.history {
+			if e.ID > lastID && s.wants(e.Type) {
+				s.send(e)
+			}
+		}
+	}
+	h.subscribers[s] = true
+	return s
+}
+
+// Unsubscribe stops delivering events to s and closes its channel
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Close ends every subscription, so that streams finish when the server shuts down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subscribers {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Publish sends an event to every subscriber that wants its type. It never blocks.
+func (h *Hub) Publish(eventType string, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publish(eventType, data)
+}
+
+// Visit records a page view by visitor and publishes the number of visitors online
+// if it changed
+func (h *Hub) Visit(visitor string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.online[visitor] = time.Now()
+	h.publishOnline()
+}
+
+// Online returns the number of visitors online, publishing it if it changed since
+// visitors went offline
+func (h *Hub) Online() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.publishOnline()
+}
+
+// publishOnline forgets visitors who are no longer online and publishes the count
+// if it changed. h.mu must be held.
+func (h *Hub) publishOnline() int {
+	cutoff := time.Now().Add(-OnlineWindow)
+	for visitor, seen := range h.online {
+		if seen.Before(cutoff) {
+			delete(h.online, visitor)
+		}
+	}
+	if n := len(h.online); n != h.lastOnline {
+		h.lastOnline = n
+		h.publish(TypeVisitors, Visitors{Online: n})
+	}
+	return h.lastOnline
+}
+
+// publish records and fans out an event. h.mu must be held.
+func (h *Hub) publish(eventType string, data any) {
+	if h.closed {
+		return
+	}
+	h.nextID++
+	e := Event{ID: h.nextID, Type: eventType, Time: time.Now(), Data: data}
+	if len(h.history) == historySize {
+		h.history = append(h.history[:0], h.history[1:]...)
+	}
+	h.history = append(h.history, e)
+
+	for s := range h.subscribers {
+		if s.wants(eventType) {
+			s.send(e)
+		}
+	}
+}
+
+// send delivers e unless the subscriber has fallen too far behind
+func (s *Subscription) send(e Event) {
+	select {
+	case s.events <- e:
+	default:
+	}
+}
@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CountryLookup resolves an IP address to an ISO 3166-1 alpha-2 country code
+type CountryLookup interface {
+	Country(ip net.IP) (string, error)
+}
+
+// Enricher derives the reporting dimensions of a page view from its request
+type Enricher struct {
+	countries CountryLookup
+	clients   ClientResolver
+	siteHost  string
+}
+
+// NewEnricher creates an enricher that resolves the countries of the client addresses
+// given by clients with countries, which may be nil to rely on the CF-IPCountry header
+// alone. Referrers from siteURL are internal navigation and are not counted as a source.
+func NewEnricher(countries CountryLookup, clients ClientResolver, siteURL string) *Enricher {
+	e := &Enricher{countries: countries, clients: clients}
+	if u, err := url.Parse(siteURL); err == nil {
+		e.siteHost = u.Hostname()
+	}
+	return e
+}
+
+// Enrich moves the UTM parameters out of the path and fills in the source, channel,
+// browser, OS, device type and country of view. It must be called with the full
+// client address still available on r, before anything is stored.
+func (e *Enricher) Enrich(view *PageView, r *http.Request) {
+	view.Path, view.UTM = SplitUTM(view.Path)
+	domain := ReferrerDomain(view.Referrer, e.siteHost)
+	view.Channel = Channel(view.UTM, domain)
+	view.Source = clip(domain, MaxDimensionLength)
+	if view.Source == "" {
+		view.Source = strings.ToLower(view.UTM.Source)
+	}
+
+	ua := ParseUserAgent(view.UserAgent)
+	view.Browser, view.OS, view.DeviceType = ua.Browser, ua.OS, ua.Device
+	view.Country = e.country(r)
+}
+
+// country looks the client address up in the GeoIP database, falling back to the
+// country Cloudflare resolved when the request came through it. The header is only
+// believed from a trusted proxy, as any client can set it.
+func (e *Enricher) country(r *http.Request) string {
+	if e.countries != nil {
+		if ip := net.ParseIP(e.clients.ClientIP(r)); ip != nil {
+			code, err := e.countries.Country(ip)
+			if err != nil {
+				log.Printf("[Analytics] Error resolving country: %v", err)
+			}
+			if code != "" {
+				return code
+			}
+		}
+	}
+	if !e.clients.FromTrustedProxy(r) {
+		return ""
+	}
+	code := strings.ToUpper(r.Header.Get("CF-IPCountry"))
+	if len(code) != 2 || code == "XX" || code == "T1" {
+		return ""
+	}
+	return code
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Events emitted by the server. Clients cannot send these names, so funnels built
+// on them only count what really happened.
+const (
+	EventSignup              = "signup"
+	EventEmailVerified       = "email_verified"
+	EventCheckoutStarted     = "checkout_started"
+	EventSubscriptionCreated = "subscription_created"
+)
+
+// serverEvents lists the names reserved for server-side events
+var serverEvents = map[string]bool{
+	EventSignup:              true,
+	EventEmailVerified:       true,
+	EventCheckoutStarted:     true,
+	EventSubscriptionCreated: true,
+}
+
+// eventNamePattern restricts event names to short identifiers such as "plan_selected"
+var eventNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,100}$`)
+
+// Event is a named action taken by a visitor or user, with free-form properties
+type Event struct {
+	ID         int64          `json:"id"`
+	Name       string         `json:"name"`
+	Properties map[string]any `json:"properties"`
+	UserID     *uuid.UUID     `json:"user_id,omitempty"`
+	VisitorID  string         `json:"visitor_id,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// ValidEventName reports whether name may be used for an event
+func ValidEventName(name string) bool {
+	return eventNamePattern.MatchString(name)
+}
+
+// ServerEvent reports whether name is reserved for events emitted by the server
+func ServerEvent(name string) bool {
+	return serverEvents[name]
+}
+
+// EventStore records events
+type EventStore interface {
+	TrackEvent(ctx context.Context, event *Event) error
+}
+
+// Emit records a server-side event for a user. Failures are logged rather than
+// returned so that analytics never breaks the request that caused the event.
+func Emit(ctx context.Context, store EventStore, name, userID string, properties map[string]any) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		log.Printf("[Analytics] Not recording %s event for invalid user ID %q", name, userID)
+		return
+	}
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	event := &Event{
+		Name:       name,
+		Properties: properties,
+		UserID:     &id,
+		CreatedAt:  time.Now(),
+	}
+	if err := store.TrackEvent(ctx, event); err != nil {
+		log.Printf("[Analytics] Error recording %s event for user %s: %v", name, userID, err)
+	}
+}
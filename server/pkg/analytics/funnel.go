@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// FunnelStep reports how many people reached a step of a funnel
+type FunnelStep struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// ConversionRate is the share of the previous step that reached this one
+	ConversionRate float64 `json:"conversion_rate"`
+	// OverallRate is the share of the first step that reached this one
+	OverallRate float64 `json:"overall_rate"`
+	// MedianSecondsFromPrevious is the median time taken from the previous step,
+	// or nil for the first step and for steps nobody reached
+	MedianSecondsFromPrevious *float64 `json:"median_seconds_from_previous"`
+}
+
+// Funnel is the step-by-step conversion through an ordered list of events
+type Funnel struct {
+	From  time.Time    `json:"from"`
+	To    time.Time    `json:"to"`
+	Steps []FunnelStep `json:"steps"`
+}
+
+// BuildFunnel follows each person through steps in order. A person enters the funnel
+// at their first occurrence of the first step, and reaches each later step at its
+// first occurrence after they reached the step before. People are the signed-in user
+// when known and the anonymous visitor otherwise. events must be in time order.
+func BuildFunnel(events []Event, steps []string, from, to time.Time) *Funnel {
+	funnel := &Funnel{From: from, To: to, Steps: make([]FunnelStep, len(steps))}
+	for i, name := range steps {
+		funnel.Steps[i].Name = name
+	}
+	if len(steps) == 0 {
+		return funnel
+	}
+
+	// progress is the number of steps each person has reached and when they reached the last one
+	type progress struct {
+		reached int
+		at      time.Time
+	}
+	people := make(map[string]*progress)
+	durations := make([][]float64, len(steps))
+	for _, e := range events {
+		key := e.VisitorID
+		if e.UserID != nil {
+			key = e.UserID.String()
+		}
+		if key == "" {
+			continue
+		}
+
+		p, ok := people[key]
+		if !ok {
+			if e.Name != steps[0] {
+				continue
+			}
+			people[key] = &progress{reached: 1, at: e.CreatedAt}
+			funnel.Steps[0].Count++
+			continue
+		}
+		if p.reached < len(steps) && e.Name == steps[p.reached] && !e.CreatedAt.Before(p.at) {
+			durations[p.reached] = append(durations[p.reached], e.CreatedAt.Sub(p.at).Seconds())
+			funnel.Steps[p.reached].Count++
+			p.reached++
+			p.at = e.CreatedAt
+		}
+	}
+
+	first := funnel.Steps[0].Count
+	for i := range funnel.Steps {
+		step := &funnel.Steps[i]
+		if first > 0 {
+			step.OverallRate = float64(step.Count) / float64(first)
+		}
+		if i == 0 {
+			if first > 0 {
+				step.ConversionRate = 1
+			}
+			continue
+		}
+		if previous := funnel.Steps[i-1].Count; previous > 0 {
+			step.ConversionRate = float64(step.Count) / float64(previous)
+		}
+		if len(durations[i]) > 0 {
+			m := median(durations[i])
+			step.MedianSecondsFromPrevious = &m
+		}
+	}
+	return funnel
+}
+
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
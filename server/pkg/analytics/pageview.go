@@ -1,6 +1,7 @@
 package analytics
 
 import (
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,11 +12,21 @@ type PageView struct {
 	ID        int64
 	UserID    *uuid.UUID
 	VisitorID string
+	SessionID string
 	Path      string
 	Referrer  string
 	UserAgent string
 	IPAddress string
 	CreatedAt time.Time
+
+	// Dimensions derived when the view is tracked; see Enricher
+	UTM        UTM
+	Source     string
+	Channel    string
+	Browser    string
+	OS         string
+	DeviceType string
+	Country    string
 }
 
 // PageViewStats represents aggregated statistics for a page
@@ -38,29 +49,30 @@ type ReferrerStats struct {
 
 // PageViewResponse represents the complete analytics response
 type PageViewResponse struct {
-	PageStats     []PageViewStats `json:"pageStats"`
-	DailyStats    []DailyStats    `json:"dailyStats"`
-	ReferrerStats []ReferrerStats `json:"referrerStats"`
-	TotalViews    int             `json:"totalViews"`
-	UniquePaths   int             `json:"uniquePaths"`
+	PageStats     []PageViewStats    `json:"pageStats"`
+	DailyStats    []DailyStats       `json:"dailyStats"`
+	ReferrerStats []ReferrerStats    `json:"referrerStats"`
+	TotalViews    int                `json:"totalViews"`
+	UniquePaths   int                `json:"uniquePaths"`
+	Sessions      SessionStats       `json:"sessions"`
+	Breakdowns    Breakdowns         `json:"breakdowns"`
+	Attribution   []AttributionStats `json:"attribution"`
 }
 
-// PageViewService defines the interface for page view analytics
-type PageViewService interface {
-	TrackPageView(view *PageView) error
-	GetUserJourney(userID uuid.UUID, startTime, endTime time.Time) ([]PageView, error)
-	GetVisitorJourneys(startTime, endTime time.Time) ([]PageView, error)
-	GetPageViewStats(startTime, endTime time.Time) (*PageViewResponse, error)
+// SessionStats summarizes the sessions that had page views in a time range
+type SessionStats struct {
+	UniqueVisitors  int     `json:"uniqueVisitors"`
+	Sessions        int     `json:"sessions"`
+	PagesPerSession float64 `json:"pagesPerSession"`
+	AvgDurationSecs float64 `json:"avgDurationSeconds"`
+	BounceRate      float64 `json:"bounceRate"`
 }
 
-type PageViewDB interface {
-	TrackPageView(view *PageView) error
-	GetUserJourney(userID uuid.UUID, startTime, endTime time.Time) ([]PageView, error)
-	GetVisitorJourneys(startTime, endTime time.Time) ([]PageView, error)
-	GetPageViewStats(startTime, endTime time.Time) (*PageViewResponse, error)
-}
+// MaxPathLength is the longest path stored, after UTM parameters are removed
+const MaxPathLength = 255
 
-// NewPageView creates a new page view instance
+// NewPageView creates a new page view instance. The IP address is truncated so
+// that the full address is never stored.
 func NewPageView(userID *uuid.UUID, visitorID, path, referrer, userAgent, ipAddress string) *PageView {
 	return &PageView{
 		UserID:    userID,
@@ -68,7 +80,85 @@ func NewPageView(userID *uuid.UUID, visitorID, path, referrer, userAgent, ipAddr
 		Path:      path,
 		Referrer:  referrer,
 		UserAgent: userAgent,
-		IPAddress: ipAddress,
+		IPAddress: TruncateIP(ipAddress),
 		CreatedAt: time.Now(),
 	}
 }
+
+// DimensionStats counts the views and visitors with one value of a dimension.
+// An empty value means the dimension was not recorded for those views.
+type DimensionStats struct {
+	Value    string `json:"value"`
+	Views    int    `json:"views"`
+	Visitors int    `json:"visitors"`
+}
+
+// Breakdowns splits page views by each reporting dimension, most viewed first
+type Breakdowns struct {
+	Channels         []DimensionStats `json:"channels"`
+	Sources          []DimensionStats `json:"sources"`
+	Campaigns        []DimensionStats `json:"campaigns"`
+	Browsers         []DimensionStats `json:"browsers"`
+	OperatingSystems []DimensionStats `json:"operatingSystems"`
+	Devices          []DimensionStats `json:"devices"`
+	Countries        []DimensionStats `json:"countries"`
+}
+
+// BreakdownLimit is the number of values reported per dimension
+const BreakdownLimit = 50
+
+// Attribution models
+const (
+	// AttributionFirstTouch credits the first visit within AttributionLookback
+	AttributionFirstTouch = "first_touch"
+	// AttributionLastTouch credits the latest visit that was not direct, or the
+	// latest visit if they all were
+	AttributionLastTouch = "last_touch"
+)
+
+// AttributionLookback is how far before a conversion visits are considered
+const AttributionLookback = 90 * 24 * time.Hour
+
+// AttributionConversions are the events credited to the visits that led to them
+var AttributionConversions = []string{EventSignup, EventSubscriptionCreated}
+
+// AttributionStats counts the conversions of one kind credited to a channel,
+// source and campaign under a model
+type AttributionStats struct {
+	Conversion  string `json:"conversion"`
+	Model       string `json:"model"`
+	Channel     string `json:"channel"`
+	Source      string `json:"source"`
+	Campaign    string `json:"campaign"`
+	Conversions int    `json:"conversions"`
+}
+
+// AssignSessions groups a batch of page views into sessions the way views tracked
+// one at a time would be. Each view must carry a new session ID; a view made less
+// than SessionTimeout after an earlier view in the batch by the same visitor or
+// user takes that view's session ID instead. The views are sorted by time.
+// Continuing sessions recorded before the batch is up to the store.
+func AssignSessions(views []*PageView) {
+	sort.SliceStable(views, func(i, j int) bool { return views[i].CreatedAt.Before(views[j].CreatedAt) })
+
+	byVisitor := make(map[string]*PageView)
+	byUser := make(map[uuid.UUID]*PageView)
+	for _, v := range views {
+		latest := byVisitor[v.VisitorID]
+		if v.UserID != nil {
+			if u := byUser[*v.UserID]; u != nil && (latest == nil || u.CreatedAt.After(latest.CreatedAt)) {
+				latest = u
+			}
+		}
+		if latest != nil && v.CreatedAt.Sub(latest.CreatedAt) < SessionTimeout {
+			v.SessionID = latest.SessionID
+		}
+
+		if v.VisitorID != "" {
+			byVisitor[v.VisitorID] = v
+		}
+		if v.UserID != nil {
+			byUser[*v.UserID] = v
+		}
+	}
+}
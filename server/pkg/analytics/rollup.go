@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"time"
+)
+
+// Rollups of page views, named as stored in page_view_rollup_state
+const (
+	// RollupHourly counts views per hour by path and referrer
+	RollupHourly = "hourly"
+	// RollupDaily counts views, visitors and sessions per UTC day by dimension
+	RollupDaily = "daily"
+)
+
+// RollupPeriods is the bucket size of each rollup
+var RollupPeriods = map[string]time.Duration{
+	RollupHourly: time.Hour,
+	RollupDaily:  24 * time.Hour,
+}
+
+// RollupDelay is how long after a bucket ends before it is rolled up, so that
+// views written late still make it in
+const RollupDelay = 15 * time.Minute
+
+// RollupWindow is the part [From, To) of a reporting range that is read from a
+// rollup. The rest of the range is read from raw page views. An empty window has
+// From equal to To.
+type RollupWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+// NewRollupWindow returns the whole buckets of period within [start, end] that
+// have been rolled up, given the rollup is complete up to rolledUpTo. The window
+// is empty when there are none.
+func NewRollupWindow(start, end time.Time, period time.Duration, rolledUpTo time.Time) RollupWindow {
+	from := start.Truncate(period)
+	if from.Before(start) {
+		from = from.Add(period)
+	}
+	to := end.Truncate(period)
+	if rolledUpTo.Before(to) {
+		to = rolledUpTo.Truncate(period)
+	}
+	if !from.Before(to) {
+		return RollupWindow{From: start, To: start}
+	}
+	return RollupWindow{From: from, To: to}
+}
@@ -0,0 +1,158 @@
+package analytics
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Marketing channels a visit can be attributed to
+const (
+	ChannelDirect        = "Direct"
+	ChannelOrganicSearch = "Organic Search"
+	ChannelPaidSearch    = "Paid Search"
+	ChannelOrganicSocial = "Organic Social"
+	ChannelPaidSocial    = "Paid Social"
+	ChannelEmail         = "Email"
+	ChannelAffiliate     = "Affiliate"
+	ChannelDisplay       = "Display"
+	ChannelReferral      = "Referral"
+)
+
+// UTM holds the campaign parameters of a landing URL
+type UTM struct {
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+}
+
+// MaxDimensionLength is the longest campaign parameter or source stored; longer
+// values are cut short
+const MaxDimensionLength = 255
+
+// searchEngines and socialNetworks map well-known referrer domains to a channel.
+// A domain matches if the referrer host is the domain or one of its subdomains.
+var (
+	searchEngines = []string{
+		"google.com", "bing.com", "duckduckgo.com", "yahoo.com", "baidu.com",
+		"yandex.ru", "yandex.com", "ecosia.org", "search.brave.com", "startpage.com",
+		"qwant.com", "kagi.com",
+	}
+	socialNetworks = []string{
+		"facebook.com", "fb.com", "instagram.com", "twitter.com", "x.com", "t.co",
+		"linkedin.com", "lnkd.in", "reddit.com", "youtube.com", "tiktok.com",
+		"pinterest.com", "news.ycombinator.com", "mastodon.social", "threads.net",
+		"bsky.app",
+	}
+)
+
+// SplitUTM removes the utm_ parameters from a path and returns them, so that
+// campaign links count as views of the same page
+func SplitUTM(path string) (string, UTM) {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path, UTM{}
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return path, UTM{}
+	}
+
+	utm := UTM{
+		Source:   clip(query.Get("utm_source"), MaxDimensionLength),
+		Medium:   clip(query.Get("utm_medium"), MaxDimensionLength),
+		Campaign: clip(query.Get("utm_campaign"), MaxDimensionLength),
+		Term:     clip(query.Get("utm_term"), MaxDimensionLength),
+		Content:  clip(query.Get("utm_content"), MaxDimensionLength),
+	}
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+	if encoded := query.Encode(); encoded != "" {
+		return base + "?" + encoded, utm
+	}
+	return base, utm
+}
+
+// ReferrerDomain returns the host of a referrer URL without "www.", or an empty
+// string for no referrer, an unparsable one or one from siteHost itself
+func ReferrerDomain(referrer, siteHost string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if siteHost != "" && host == strings.TrimPrefix(strings.ToLower(siteHost), "www.") {
+		return ""
+	}
+	return host
+}
+
+// Channel classifies a visit by its campaign medium, falling back to the referrer domain
+func Channel(utm UTM, domain string) string {
+	medium := strings.ToLower(utm.Medium)
+	paid := medium == "cpc" || medium == "ppc" || medium == "paid" || strings.HasPrefix(medium, "paid")
+	social := medium == "social" || strings.Contains(medium, "social") || matchesDomain(domain, socialNetworks) ||
+		matchesDomain(strings.ToLower(utm.Source), socialNetworks)
+
+	switch {
+	case paid && social:
+		return ChannelPaidSocial
+	case paid:
+		return ChannelPaidSearch
+	case medium == "email" || medium == "newsletter":
+		return ChannelEmail
+	case medium == "affiliate":
+		return ChannelAffiliate
+	case medium == "display" || medium == "banner" || medium == "cpm":
+		return ChannelDisplay
+	case social:
+		return ChannelOrganicSocial
+	case matchesDomain(domain, searchEngines) || isSearchDomain(domain):
+		return ChannelOrganicSearch
+	case domain != "" || utm.Source != "":
+		return ChannelReferral
+	}
+	return ChannelDirect
+}
+
+// matchesDomain reports whether host is one of domains or a subdomain of one
+func matchesDomain(host string, domains []string) bool {
+	if host == "" {
+		return false
+	}
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSearchDomain catches the country-specific domains of Google and Yahoo such as google.co.uk
+func isSearchDomain(host string) bool {
+	for _, engine := range []string{"google.", "yahoo.", "yandex."} {
+		if strings.HasPrefix(host, engine) || strings.Contains(host, "."+engine) {
+			return true
+		}
+	}
+	return false
+}
+
+// clip cuts s to at most n bytes without splitting a UTF-8 sequence
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"strings"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// botMarkers are lowercase substrings of the user agents of crawlers, uptime
+// monitors, headless browsers and HTTP libraries
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "archiver", "facebookexternalhit", "embedly",
+	"preview", "headless", "phantomjs", "lighthouse", "pagespeed", "pingdom", "uptime",
+	"monitor", "curl/", "wget/", "python-", "go-http-client", "java/", "okhttp",
+	"axios/", "node-fetch", "httpclient", "scrapy", "feedfetcher",
+}
+
+// UserAgent is the browser, operating system and device type of a user agent string
+type UserAgent struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Device  string `json:"device_type"`
+}
+
+// ParseUserAgent classifies a user agent string. Only the families worth reporting
+// on are recognized; anything else is "Other".
+func ParseUserAgent(ua string) UserAgent {
+	return UserAgent{
+		Browser: browserFamily(ua),
+		OS:      osFamily(ua),
+		Device:  deviceType(ua),
+	}
+}
+
+// browserFamily checks the tokens that other browsers also send last, since
+// Chrome-based browsers include "Chrome" and "Safari" and Chrome includes "Safari"
+func browserFamily(ua string) string {
+	switch {
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "EdgA/"), strings.Contains(ua, "EdgiOS/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		return "Opera"
+	case strings.Contains(ua, "SamsungBrowser/"):
+		return "Samsung Internet"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"), strings.Contains(ua, "Chromium/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/") && strings.Contains(ua, "Version/"):
+		return "Safari"
+	}
+	return "Other"
+}
+
+func osFamily(ua string) string {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return "Other"
+}
+
+func deviceType(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPad"), strings.Contains(ua, "Tablet"),
+		strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile"):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobi"), strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPod"):
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
+
+// IsBot reports whether ua belongs to automated traffic that should not be counted.
+// Requests without a user agent are treated as automated.
+func IsBot(ua string) bool {
+	if strings.TrimSpace(ua) == "" {
+		return true
+	}
+	ua = strings.ToLower(ua)
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionTimeout is the inactivity after which a visitor's next page view starts a new session
+const SessionTimeout = 30 * time.Minute
+
+// Visitor identification modes
+const (
+	// VisitorHash derives the visitor ID from the IP address and user agent with a
+	// salt that rotates daily, so no identifier is stored on the device and visits
+	// cannot be linked across days
+	VisitorHash = "hash"
+	// VisitorCookie keeps a random visitor ID in a first-party cookie
+	VisitorCookie = "cookie"
+)
+
+// visitorCookie is the first-party cookie holding the visitor ID in cookie mode
+const visitorCookie = "visitor_id"
+
+// visitorCookieMaxAge is how long a visitor cookie lives without being renewed
+const visitorCookieMaxAge = 365 * 24 * time.Hour
+
+// SaltStore shares the daily salts between instances. A salt is only kept while it
+// is in use so that hashed visitor IDs cannot be recomputed afterwards.
+type SaltStore interface {
+	// GetOrCreateAnalyticsSalt stores candidate as the salt for day unless one exists,
+	// and returns the salt in use
+	GetOrCreateAnalyticsSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error)
+	DeleteAnalyticsSaltsBefore(ctx context.Context, day time.Time) (int64, error)
+}
+
+// ClientResolver determines the address of the client making a request, believing
+// the headers about it only from trusted proxies. middleware.ClientIPResolver is one.
+type ClientResolver interface {
+	// ClientIP returns the client address, or an empty string if it cannot be determined
+	ClientIP(r *http.Request) string
+	// FromTrustedProxy reports whether r was made by a trusted proxy
+	FromTrustedProxy(r *http.Request) bool
+}
+
+// Identifier assigns anonymous visitor IDs to tracking requests
+type Identifier struct {
+	salts   SaltStore
+	mode    string
+	clients ClientResolver
+
+	mu   sync.Mutex
+	day  time.Time
+	salt []byte
+}
+
+// NewIdentifier creates an identifier using mode, VisitorHash or VisitorCookie, that
+// hashes client addresses as resolved by clients
+func NewIdentifier(salts SaltStore, mode string, clients ClientResolver) *Identifier {
+	return &Identifier{salts: salts, mode: mode, clients: clients}
+}
+
+// VisitorID returns the anonymous ID of the visitor making r. In cookie mode a new
+// visitor is given a cookie on w.
+func (i *Identifier) VisitorID(ctx context.Context, w http.ResponseWriter, r *http.Request) (string, error) {
+	if i.mode == VisitorCookie {
+		return i.cookieID(w, r)
+	}
+
+	salt, err := i.dailySalt(ctx, time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(i.clients.ClientIP(r)))
+	h.Write([]byte{0})
+	h.Write([]byte(r.UserAgent()))
+	return "v_" + hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+func (i *Identifier) cookieID(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(visitorCookie); err == nil && strings.HasPrefix(cookie.Value, "v_") && len(cookie.Value) == 34 {
+		return cookie.Value, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := "v_" + hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(visitorCookieMaxAge.Seconds()),
+	})
+	return id, nil
+}
+
+// dailySalt returns the salt of the UTC day containing now. When the day changes
+// the previous salts are deleted, which makes the old visitor IDs irreversible.
+func (i *Identifier) dailySalt(ctx context.Context, now time.Time) ([]byte, error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.salt != nil && i.day.Equal(day) {
+		return i.salt, nil
+	}
+
+	candidate := make([]byte, 32)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, err
+	}
+	salt, err := i.salts.GetOrCreateAnalyticsSalt(ctx, day, candidate)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := i.salts.DeleteAnalyticsSaltsBefore(ctx, day); err != nil {
+		return nil, err
+	}
+	i.day, i.salt = day, salt
+	return salt, nil
+}
+
+// TruncateIP anonymizes an address before it is stored by zeroing the host part:
+// the last octet of an IPv4 address and all but the first 48 bits of an IPv6 one.
+// Anything that does not parse as an address is dropped.
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
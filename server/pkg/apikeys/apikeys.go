@@ -0,0 +1,75 @@
+// Package apikeys generates and checks the personal API keys users create for
+// scripts and tools. A key reads sk_<id>_<secret>: the sk_<id> prefix is stored in
+// the clear to find the key and tell keys apart, the whole key only as a SHA-256 hash.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scopes a key may be granted. Read allows GET and HEAD requests; write allows
+// every other method.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Scopes lists every scope
+var Scopes = []string{ScopeRead, ScopeWrite}
+
+// TouchInterval is how often the last use of a key is recorded, sparing a write on
+// every request made with it
+const TouchInterval = time.Minute
+
+const (
+	keyPrefix = "sk_"
+	// idBytes and secretBytes are the random bytes in the prefix and the secret part
+	idBytes     = 6
+	secretBytes = 32
+)
+
+// Generate returns a new key together with its prefix and hash
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, idBytes+secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = keyPrefix + hex.EncodeToString(b[:idBytes])
+	key = prefix + "_" + hex.EncodeToString(b[idBytes:])
+	return key, prefix, Hash(key), nil
+}
+
+// Prefix returns the prefix of a key, or false if it is not shaped like one
+func Prefix(key string) (string, bool) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(key, keyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, keyPrefix) ||
+		len(id) != 2*idBytes || len(secret) != 2*secretBytes {
+		return "", false
+	}
+	return keyPrefix + id, true
+}
+
+// Hash returns the hex SHA-256 of a key, as stored
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports in constant time whether key hashes to hash
+func Matches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
+
+// ScopeFor returns the scope a key needs to make a request with the given method
+func ScopeFor(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return ScopeRead
+	}
+	return ScopeWrite
+}
@@ -0,0 +1,61 @@
+// Package billing holds pricing calculations shared by the billing endpoints
+package billing
+
+import (
+	"math"
+	"time"
+)
+
+// Proration estimates the cost of switching plans part-way through a billing period
+type Proration struct {
+	// Credit is the unused portion of the current plan, in cents
+	Credit int `json:"credit"`
+	// Charge is the cost of the new plan for the rest of the period, in cents
+	Charge int `json:"charge"`
+	// Amount is Charge minus Credit; negative amounts are credited to the customer
+	Amount int `json:"amount"`
+	// RemainingFraction is the share of the current period still to run, between 0 and 1
+	RemainingFraction float64   `json:"remaining_fraction"`
+	PeriodStart       time.Time `json:"period_start"`
+	PeriodEnd         time.Time `json:"period_end"`
+}
+
+// PeriodStart returns the start of the billing period that ends at end for a plan
+// billed every count intervals ("day", "week", "month" or "year")
+func PeriodStart(end time.Time, interval string, count int) time.Time {
+	if count <= 0 {
+		count = 1
+	}
+	switch interval {
+	case "day":
+		return end.AddDate(0, 0, -count)
+	case "week":
+		return end.AddDate(0, 0, -7*count)
+	case "year":
+		return end.AddDate(-count, 0, 0)
+	default:
+		return end.AddDate(0, -count, 0)
+	}
+}
+
+// Prorate estimates the amount due at now when moving from currentPrice to newPrice
+// for the period [periodStart, periodEnd). Prices are per period, in cents.
+func Prorate(currentPrice, newPrice int, periodStart, periodEnd, now time.Time) Proration {
+	p := Proration{PeriodStart: periodStart, PeriodEnd: periodEnd}
+
+	total := periodEnd.Sub(periodStart)
+	remaining := periodEnd.Sub(now)
+	switch {
+	case total <= 0 || remaining <= 0:
+		p.RemainingFraction = 0
+	case remaining >= total:
+		p.RemainingFraction = 1
+	default:
+		p.RemainingFraction = float64(remaining) / float64(total)
+	}
+
+	p.Credit = int(math.Round(float64(currentPrice) * p.RemainingFraction))
+	p.Charge = int(math.Round(float64(newPrice) * p.RemainingFraction))
+	p.Amount = p.Charge - p.Credit
+	return p
+}
@@ -0,0 +1,153 @@
+// Package cache provides a concurrency-safe in-process cache with per-entry
+// expiry and least-recently-used eviction once a size limit is reached.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entry is a cached value together with its expiry time
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// Cache is a size-bounded LRU cache whose entries expire after a fixed TTL.
+// Expired entries are dropped lazily when they are read or evicted.
+type Cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	capacity int
+	items    map[K]*list.Element
+	order    *list.List // front is most recently used
+	now      func() time.Time
+	// epoch advances on every Delete and Purge so that GetOrLoad does not
+	// cache a value that was loaded before a concurrent invalidation
+	epoch uint64
+}
+
+// New creates a cache holding at most capacity entries, each valid for ttl.
+// A non-positive ttl keeps entries until they are evicted or deleted.
+func New[K comparable, V any](capacity int, ttl time.Duration) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache[K, V]{
+		ttl:      ttl,
+		capacity: capacity,
+		items:    make(map[K]*list.Element, capacity),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns the cached value for key and whether a live entry was found
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := elem.Value.(*entry[K, V])
+	if c.expired(e) {
+		c.remove(elem)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return e.value, true
+}
+
+// Set stores value under key, evicting the least recently used entry if the cache is full
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+func (c *Cache[K, V]) set(key K, value V) {
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = c.now().Add(c.ttl)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		e.value = value
+		e.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// GetOrLoad returns the cached value for key, calling load and caching its result on a miss.
+// Errors from load are returned without being cached, and so are values whose load
+// overlapped an invalidation, since they may predate the change that caused it.
+func (c *Cache[K, V]) GetOrLoad(key K, load func() (V, error)) (V, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	c.mu.Lock()
+	epoch := c.epoch
+	c.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	if c.epoch == epoch {
+		c.set(key, value)
+	}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Delete removes key from the cache
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge removes every entry
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.items = make(map[K]*list.Element, c.capacity)
+	c.order.Init()
+}
+
+// Len returns the number of entries, including expired ones not yet dropped
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) expired(e *entry[K, V]) bool {
+	return !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt)
+}
+
+func (c *Cache[K, V]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,134 @@
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"saas-server/models"
+	"saas-server/pkg/lemonsqueezy"
+)
+
+// apiBaseURL is used to build the relationship links served alongside cached products
+const apiBaseURL = "https://api.lemonsqueezy.com/v1"
+
+// ProductFromAPI converts a Lemon Squeezy product into a catalog product
+func ProductFromAPI(p lemonsqueezy.ProductData) (models.Product, error) {
+	id, err := strconv.Atoi(p.ID)
+	if err != nil {
+		return models.Product{}, fmt.Errorf("invalid product ID %q", p.ID)
+	}
+	return models.Product{
+		ID:             id,
+		StoreID:        p.Attributes.StoreID,
+		Name:           p.Attributes.Name,
+		Description:    p.Attributes.Description,
+		Slug:           p.Attributes.Slug,
+		Status:         p.Attributes.Status,
+		Price:          p.Attributes.Price,
+		PriceFormatted: p.Attributes.PriceFormatted,
+		ThumbURL:       p.Attributes.ThumbURL,
+		CreatedAt:      parseTime(p.Attributes.CreatedAt),
+		UpdatedAt:      parseTime(p.Attributes.UpdatedAt),
+	}, nil
+}
+
+// VariantFromAPI converts a Lemon Squeezy variant into a catalog variant
+func VariantFromAPI(v lemonsqueezy.VariantData) (models.Variant, error) {
+	id, err := strconv.Atoi(v.ID)
+	if err != nil {
+		return models.Variant{}, fmt.Errorf("invalid variant ID %q", v.ID)
+	}
+	return models.Variant{
+		ID:             id,
+		ProductID:      v.Attributes.ProductID,
+		Name:           v.Attributes.Name,
+		Description:    v.Attributes.Description,
+		Price:          v.Attributes.Price,
+		Status:         v.Attributes.Status,
+		IsSubscription: v.Attributes.IsSubscription,
+		Interval:       v.Attributes.Interval,
+		IntervalCount:  v.Attributes.IntervalCount,
+		CreatedAt:      parseTime(v.Attributes.CreatedAt),
+		UpdatedAt:      parseTime(v.Attributes.UpdatedAt),
+	}, nil
+}
+
+// ToAPI renders a catalog product in the Lemon Squeezy JSON:API shape that the
+// products endpoints have always returned
+func ToAPI(p models.Product) lemonsqueezy.ProductData {
+	variants := make([]lemonsqueezy.VariantData, 0, len(p.Variants))
+	for _, v := range p.Variants {
+		variants = append(variants, lemonsqueezy.VariantData{
+			ID:   strconv.Itoa(v.ID),
+			Type: "variants",
+			Attributes: lemonsqueezy.VariantAttributes{
+				ProductID:      v.ProductID,
+				Name:           v.Name,
+				Description:    v.Description,
+				Price:          v.Price,
+				Status:         v.Status,
+				IsSubscription: v.IsSubscription,
+				Interval:       v.Interval,
+				IntervalCount:  v.IntervalCount,
+				CreatedAt:      formatTime(v.CreatedAt),
+				UpdatedAt:      formatTime(v.UpdatedAt),
+			},
+		})
+	}
+
+	return lemonsqueezy.ProductData{
+		ID:   strconv.Itoa(p.ID),
+		Type: "products",
+		Attributes: lemonsqueezy.ProductAttributes{
+			StoreID:        p.StoreID,
+			Name:           p.Name,
+			Description:    p.Description,
+			Slug:           p.Slug,
+			Status:         p.Status,
+			Price:          p.Price,
+			PriceFormatted: p.PriceFormatted,
+			ThumbURL:       p.ThumbURL,
+			CreatedAt:      formatTime(p.CreatedAt),
+			UpdatedAt:      formatTime(p.UpdatedAt),
+		},
+		Relationships: lemonsqueezy.Relationships{
+			Variants: lemonsqueezy.VariantRelationship{
+				Links: lemonsqueezy.Links{
+					Href: fmt.Sprintf("%s/products/%d/relationships/variants", apiBaseURL, p.ID),
+				},
+				Data: variants,
+			},
+		},
+	}
+}
+
+// ResponseFromProducts wraps catalog products in a single-page Lemon Squeezy list response
+func ResponseFromProducts(products []models.Product) *lemonsqueezy.ProductResponse {
+	resp := &lemonsqueezy.ProductResponse{Data: make([]lemonsqueezy.ProductData, 0, len(products))}
+	for _, p := range products {
+		resp.Data = append(resp.Data, ToAPI(p))
+	}
+	n := len(products)
+	resp.Meta.Page = lemonsqueezy.MetaPage{CurrentPage: 1, LastPage: 1, PerPage: n, Total: n}
+	if n > 0 {
+		resp.Meta.Page.From = 1
+		resp.Meta.Page.To = n
+	}
+	return resp
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,130 @@
+// Package catalog keeps the local product catalog in step with Lemon Squeezy so
+// that catalog pages are served from the database and keep working while the
+// provider API is unavailable.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/lemonsqueezy"
+)
+
+// SyncResult summarizes a completed catalog sync
+type SyncResult struct {
+	Products int       `json:"products"`
+	Variants int       `json:"variants"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// SyncService periodically copies the store's products and variants into the database
+type SyncService struct {
+	catalog  database.CatalogRepository
+	client   *lemonsqueezy.Client
+	interval time.Duration
+
+	mu       sync.Mutex // serializes syncs so a manual run never races the periodic job
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewSyncService creates a catalog sync service that runs every interval once started
+func NewSyncService(catalog database.CatalogRepository, client *lemonsqueezy.Client, interval time.Duration) *SyncService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SyncService{
+		catalog:  catalog,
+		client:   client,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// StartSyncJob syncs the catalog immediately and then on every interval until Stop is called
+func (s *SyncService) StartSyncJob() {
+	ticker := time.NewTicker(s.interval)
+	s.started = true
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		for {
+			if _, err := s.Sync(s.ctx); err != nil && s.ctx.Err() == nil {
+				log.Printf("[Catalog] Error syncing product catalog: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the sync job to exit, cancelling any in-progress run, and waits for it to finish
+func (s *SyncService) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		if s.started {
+			<-s.done
+		}
+	})
+}
+
+// Sync fetches every product and variant of the configured store and replaces the
+// local catalog with them. If any request fails the local catalog is left unchanged.
+func (s *SyncService) Sync(ctx context.Context) (*SyncResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storeID, err := strconv.Atoi(s.client.StoreID())
+	if err != nil {
+		return nil, fmt.Errorf("invalid store ID %q", s.client.StoreID())
+	}
+
+	result := &SyncResult{}
+	products := []models.Product{}
+	for data, err := range s.client.Products(ctx, "") {
+		if err != nil {
+			return nil, err
+		}
+
+		product, err := ProductFromAPI(data)
+		if err != nil {
+			return nil, err
+		}
+
+		product.Variants = []models.Variant{}
+		for v, err := range s.client.Variants(ctx, data.ID) {
+			if err != nil {
+				return nil, fmt.Errorf("fetching variants for product %d: %w", product.ID, err)
+			}
+			variant, err := VariantFromAPI(v)
+			if err != nil {
+				return nil, err
+			}
+			product.Variants = append(product.Variants, variant)
+		}
+
+		result.Variants += len(product.Variants)
+		products = append(products, product)
+	}
+
+	if err := s.catalog.ReplaceStoreCatalog(ctx, storeID, products); err != nil {
+		return nil, err
+	}
+
+	result.Products = len(products)
+	result.SyncedAt = time.Now()
+	log.Printf("[Catalog] Synced %d products and %d variants", result.Products, result.Variants)
+	return result, nil
+}
@@ -1,78 +1,75 @@
 package cleanup
 
 import (
+	"context"
 	"log"
+	"sync"
 	"time"
 
-	"saas-server/models"
-
-	"gorm.io/gorm"
+	"saas-server/database"
 )
 
 // TokenCleanupService handles the cleanup of expired tokens
 type TokenCleanupService struct {
-	db *gorm.DB
+	tokens   database.TokenRepository
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
 }
 
 // NewTokenCleanupService creates a new instance of TokenCleanupService
-func NewTokenCleanupService(db *gorm.DB) *TokenCleanupService {
+func NewTokenCleanupService(tokens database.TokenRepository) *TokenCleanupService {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &TokenCleanupService{
-		db: db,
+		tokens: tokens,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
 	}
 }
 
 // StartCleanupJob starts the background job to clean up expired tokens
+// The job runs until Stop is called.
 func (s *TokenCleanupService) StartCleanupJob() {
 	// Run cleanup every hour
 	ticker := time.NewTicker(1 * time.Hour)
+	s.started = true
 	go func() {
-		for range ticker.C {
-			if err := s.cleanupExpiredTokens(); err != nil {
-				log.Printf("Error cleaning up expired tokens: %v", err)
+		defer close(s.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.cleanupExpiredTokens(s.ctx); err != nil && s.ctx.Err() == nil {
+					log.Printf("Error cleaning up expired tokens: %v", err)
+				}
+			case <-s.ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
-// cleanupExpiredTokens removes expired tokens and blacklist entries
-func (s *TokenCleanupService) cleanupExpiredTokens() error {
-	now := time.Now()
-
-	// Delete expired refresh tokens
-	result := s.db.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected > 0 {
-		log.Printf("Deleted %d expired refresh tokens", result.RowsAffected)
-	}
-
-	// Delete expired access tokens
-	result = s.db.Where("expires_at < ?", now).Delete(&models.AccessToken{})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected > 0 {
-		log.Printf("Deleted %d expired access tokens", result.RowsAffected)
-	}
-
-	// Clean up expired entries from token blacklist
-	result = s.db.Exec("DELETE FROM token_blacklist WHERE expires_at < ?", now)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected > 0 {
-		log.Printf("Deleted %d expired blacklist entries", result.RowsAffected)
-	}
+// Stop signals the cleanup job to exit, cancelling any in-progress run, and waits for it to finish
+func (s *TokenCleanupService) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		if s.started {
+			<-s.done
+		}
+	})
+}
 
-	// Clean up expired password reset tokens
-	result = s.db.Exec("DELETE FROM password_reset_tokens WHERE expires_at < ?", now)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected > 0 {
-		log.Printf("Deleted %d expired password reset tokens", result.RowsAffected)
+// cleanupExpiredTokens removes expired tokens and blacklist entries. Stop cancels
+// ctx, abandoning a run in progress rather than waiting for its query timeout.
+func (s *TokenCleanupService) cleanupExpiredTokens(ctx context.Context) error {
+	deleted, err := s.tokens.DeleteExpiredTokens(ctx, time.Now())
+	for kind, rows := range deleted {
+		if rows > 0 {
+			log.Printf("Deleted %d expired %s", rows, kind)
+		}
 	}
-
-	return nil
+	return err
 }
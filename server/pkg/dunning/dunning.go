@@ -0,0 +1,375 @@
+// Package dunning chases failed subscription payments. When a renewal fails the
+// subscriber keeps access for a grace period while reminder emails ask them to
+// update their payment method; if the grace period runs out first, access is
+// withdrawn until a retried payment succeeds.
+package dunning
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/lemonsqueezy"
+	"saas-server/pkg/plunk"
+)
+
+const (
+	// paymentURLTTL is how long a payment update link fetched from Lemon Squeezy is
+	// reused, so that showing the banner does not call the API on every request
+	paymentURLTTL = time.Hour
+	// paymentURLRetry is how long the fallback link is used after fetching one failed
+	paymentURLRetry = time.Minute
+)
+
+// Options controls the dunning schedule
+type Options struct {
+	// GracePeriod is how long a subscriber keeps access after a failed payment
+	GracePeriod time.Duration
+	// Reminders are offsets from the failed payment at which reminder emails are sent
+	Reminders []time.Duration
+	// CheckInterval is how often due reminders and expired grace periods are processed
+	CheckInterval time.Duration
+	// BillingURL is linked from emails when no payment update link is available
+	BillingURL string
+}
+
+// Service opens dunning cases for failed payments and works through them in the background
+type Service struct {
+	store  database.Store
+	client *lemonsqueezy.Client
+	mailer *plunk.Client
+	opts   Options
+
+	// paymentURLs caches the payment update link of each subscription in dunning
+	paymentURLsMu sync.Mutex
+	paymentURLs   map[int]cachedURL
+
+	wake     chan struct{} // asks the job to run early, e.g. for the first reminder of a new case
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewService creates a dunning service that processes cases every CheckInterval once started
+func NewService(store database.Store, client *lemonsqueezy.Client, mailer *plunk.Client, opts Options) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		store:  store,
+		client: client,
+		mailer: mailer,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+
+		paymentURLs: make(map[int]cachedURL),
+	}
+}
+
+// StartDunningJob processes cases immediately and then on every interval until Stop is called
+func (s *Service) StartDunningJob() {
+	ticker := time.NewTicker(s.opts.CheckInterval)
+	s.started = true
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		for {
+			if err := s.Run(s.ctx); err != nil && s.ctx.Err() == nil {
+				log.Printf("[Dunning] Error processing dunning cases: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the dunning job to exit, cancelling any in-progress run, and waits for it to finish
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		if s.started {
+			<-s.done
+		}
+	})
+}
+
+// PaymentFailed opens a dunning case for a subscription whose payment failed at
+// failedAt. Further failures while a case is unresolved are part of the same case.
+func (s *Service) PaymentFailed(ctx context.Context, sub *models.Subscription, failedAt time.Time) error {
+	subscriptionID, err := strconv.Atoi(sub.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	c := &models.DunningCase{
+		SubscriptionID: subscriptionID,
+		UserID:         sub.UserID,
+		FailedAt:       failedAt,
+		GraceEndsAt:    failedAt.Add(s.opts.GracePeriod),
+	}
+	created, err := s.store.OpenDunningCase(ctx, c)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("[Dunning] Opened case %d for subscription %d, grace period ends %s",
+			c.ID, subscriptionID, c.GraceEndsAt.Format(time.RFC3339))
+		s.trigger()
+	}
+	return nil
+}
+
+// openCase opens a case for a stored subscription that was reported past due, failing
+// now. It returns sql.ErrNoRows if the subscription is not stored locally.
+func (s *Service) openCase(ctx context.Context, subscriptionID int) (*models.DunningCase, error) {
+	sub, err := s.store.GetSubscriptionByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.PaymentFailed(ctx, sub, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.store.GetUnresolvedDunningCase(ctx, subscriptionID)
+}
+
+// PaymentRecovered resolves the case of a subscription whose retried payment succeeded
+func (s *Service) PaymentRecovered(ctx context.Context, subscriptionID int) error {
+	return s.resolve(ctx, subscriptionID, models.DunningRecovered)
+}
+
+// SubscriptionEnded closes the case of a subscription that expired without paying
+func (s *Service) SubscriptionEnded(ctx context.Context, subscriptionID int) error {
+	return s.resolve(ctx, subscriptionID, models.DunningClosed)
+}
+
+func (s *Service) resolve(ctx context.Context, subscriptionID int, status string) error {
+	s.paymentURLsMu.Lock()
+	delete(s.paymentURLs, subscriptionID)
+	s.paymentURLsMu.Unlock()
+
+	c, err := s.store.GetUnresolvedDunningCase(ctx, subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The job may downgrade the case concurrently, so retry from the status it moved to
+	for _, from := range []string{c.Status, models.DunningDowngraded} {
+		ok, err := s.store.TransitionDunningCase(ctx, c.ID, from, status, time.Now())
+		if err != nil {
+			return err
+		}
+		if ok {
+			log.Printf("[Dunning] Case %d for subscription %d %s", c.ID, subscriptionID, status)
+			return nil
+		}
+	}
+	return nil
+}
+
+// EntitlementStatus returns the status to record on the subscriber's account for a
+// subscription in the given status. Within the grace period of an open case a
+// past-due subscription keeps the access of an active one. Webhooks arrive in no
+// particular order, so a subscription reported past due before its failed payment
+// gets its case, and grace period, opened here.
+func (s *Service) EntitlementStatus(ctx context.Context, subscriptionID int, status string) string {
+	if !pastDue(status) {
+		return status
+	}
+	c, err := s.store.GetUnresolvedDunningCase(ctx, subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c, err = s.openCase(ctx, subscriptionID)
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[Dunning] Error loading case for subscription %d: %v", subscriptionID, err)
+		}
+		return status
+	}
+	if c.Status == models.DunningOpen && time.Now().Before(c.GraceEndsAt) {
+		return "active"
+	}
+	return status
+}
+
+// Banner returns the in-app notice for a subscription, or nil if its payments are in order
+func (s *Service) Banner(ctx context.Context, subscriptionID int) (*models.DunningBanner, error) {
+	c, err := s.store.GetUnresolvedDunningCase(ctx, subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.DunningBanner{
+		Status:           c.Status,
+		FailedAt:         c.FailedAt,
+		GraceEndsAt:      c.GraceEndsAt,
+		InGracePeriod:    c.Status == models.DunningOpen && time.Now().Before(c.GraceEndsAt),
+		UpdatePaymentURL: s.updatePaymentURL(ctx, c),
+	}, nil
+}
+
+// Run sends the reminders that are due and downgrades subscriptions whose grace
+// period has ended. A failure on one case does not stop the others.
+func (s *Service) Run(ctx context.Context) error {
+	cases, err := s.store.GetUnresolvedDunningCases(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range cases {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.Status != models.DunningOpen {
+			continue
+		}
+
+		var err error
+		switch {
+		case !now.Before(c.GraceEndsAt):
+			err = s.downgrade(ctx, c, now)
+		case c.RemindersSent < len(s.opts.Reminders) && !now.Before(c.FailedAt.Add(s.opts.Reminders[c.RemindersSent])):
+			err = s.remind(ctx, c, now)
+		}
+		if err != nil {
+			log.Printf("[Dunning] Error processing case %d for subscription %d: %v", c.ID, c.SubscriptionID, err)
+		}
+	}
+	return nil
+}
+
+// remind emails the next reminder of a case. The reminder is claimed before it is
+// sent so that several instances never email the same one twice.
+func (s *Service) remind(ctx context.Context, c models.DunningCase, now time.Time) error {
+	user, err := s.store.GetUserByID(ctx, c.UserID)
+	if err != nil {
+		return err
+	}
+
+	link := s.updatePaymentURL(ctx, &c)
+	claimed, err := s.store.ClaimDunningReminder(ctx, c.ID, c.RemindersSent, now, link)
+	if err != nil || !claimed {
+		return err
+	}
+
+	err = sendReminderEmail(ctx, s.mailer, user.Email, c.RemindersSent == 0, c.GraceEndsAt, link)
+	if errors.Is(err, plunk.ErrNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[Dunning] Sent reminder %d for subscription %d", c.RemindersSent+1, c.SubscriptionID)
+	return nil
+}
+
+// downgrade withdraws the subscriber's access once the grace period has ended
+func (s *Service) downgrade(ctx context.Context, c models.DunningCase, now time.Time) error {
+	sub, err := s.store.GetSubscriptionByID(ctx, c.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	status := sub.Status
+	if !pastDue(status) {
+		status = "past_due"
+	}
+
+	downgraded := false
+	err = s.store.WithTx(ctx, func(tx database.Store) error {
+		ok, err := tx.TransitionDunningCase(ctx, c.ID, models.DunningOpen, models.DunningDowngraded, now)
+		if err != nil || !ok {
+			return err
+		}
+		downgraded = true
+		return tx.UpdateUserSubscription(ctx, c.UserID, c.SubscriptionID, status,
+			sub.ProductID, sub.VariantID, sub.RenewsAt, sub.EndsAt)
+	})
+	if err != nil || !downgraded {
+		return err
+	}
+	log.Printf("[Dunning] Grace period ended for subscription %d, access withdrawn", c.SubscriptionID)
+
+	user, err := s.store.GetUserByID(ctx, c.UserID)
+	if err != nil {
+		return err
+	}
+	err = sendDowngradeEmail(ctx, s.mailer, user.Email, s.updatePaymentURL(ctx, &c))
+	if errors.Is(err, plunk.ErrNotConfigured) {
+		return nil
+	}
+	return err
+}
+
+// cachedURL is a payment update link and when it should be fetched again
+type cachedURL struct {
+	url       string
+	expiresAt time.Time
+}
+
+// updatePaymentURL returns a recent payment update link from Lemon Squeezy, since the
+// signed links it hands out expire, falling back to the last known link and then
+// to the billing page. Links are cached for paymentURLTTL.
+func (s *Service) updatePaymentURL(ctx context.Context, c *models.DunningCase) string {
+	now := time.Now()
+	s.paymentURLsMu.Lock()
+	cached, ok := s.paymentURLs[c.SubscriptionID]
+	s.paymentURLsMu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.url
+	}
+
+	link := cachedURL{expiresAt: now.Add(paymentURLTTL)}
+	sub, err := s.client.GetSubscription(ctx, strconv.Itoa(c.SubscriptionID))
+	if err == nil {
+		link.url = sub.Data.Attributes.URLs.UpdatePaymentMethod
+	} else {
+		log.Printf("[Dunning] Error fetching payment link for subscription %d: %v", c.SubscriptionID, err)
+		link.expiresAt = now.Add(paymentURLRetry)
+	}
+	if link.url == "" {
+		link.url = c.UpdatePaymentURL
+	}
+	if link.url == "" {
+		link.url = s.opts.BillingURL
+	}
+
+	s.paymentURLsMu.Lock()
+	s.paymentURLs[c.SubscriptionID] = link
+	s.paymentURLsMu.Unlock()
+	return link.url
+}
+
+// trigger wakes the job without blocking; a pending wake-up already covers this one
+func (s *Service) trigger() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pastDue reports whether a subscription status means its latest payment failed
+func pastDue(status string) bool {
+	switch status {
+	case "past_due", "unpaid", "failed":
+		return true
+	}
+	return false
+}
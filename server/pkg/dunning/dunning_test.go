@@ -0,0 +1,145 @@
+package dunning
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"saas-server/database/memstore"
+	"saas-server/models"
+	"saas-server/pkg/lemonsqueezy"
+)
+
+func TestEntitlementStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		// failedAt opens a case before the status arrives when set
+		failedAt   *time.Time
+		stored     bool
+		status     string
+		want       string
+		wantOpened bool
+	}{
+		{"active subscription", nil, true, "active", "active", false},
+		{"past due before the failed payment webhook", nil, true, "past_due", "active", true},
+		{"past due within the grace period", ptr(time.Now().Add(-time.Hour)), true, "past_due", "active", true},
+		{"past due after the grace period", ptr(time.Now().Add(-8 * 24 * time.Hour)), true, "past_due", "past_due", true},
+		{"unknown subscription", nil, false, "unpaid", "unpaid", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New()
+			s := NewService(store, nil, nil, Options{GracePeriod: 7 * 24 * time.Hour})
+
+			user, err := store.CreateUser(ctx, "a@example.com", "", "A", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.stored {
+				if err := store.CreateSubscription(ctx, user.ID, 1, 10, 100, 1000, 2000, "active", nil, nil, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.failedAt != nil {
+				sub, err := store.GetSubscriptionByID(ctx, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.PaymentFailed(ctx, sub, *tt.failedAt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := s.EntitlementStatus(ctx, 1, tt.status); got != tt.want {
+				t.Errorf("EntitlementStatus = %q, want %q", got, tt.want)
+			}
+			c, err := store.GetUnresolvedDunningCase(ctx, 1)
+			if opened := err == nil; opened != tt.wantOpened {
+				t.Fatalf("case opened = %v, want %v (%v)", opened, tt.wantOpened, err)
+			}
+			if tt.wantOpened && (c.UserID != user.ID || c.Status != models.DunningOpen) {
+				t.Errorf("case = %+v, want an open case of %s", c, user.ID)
+			}
+		})
+	}
+}
+
+func TestBannerCachesPaymentURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantURL string
+	}{
+		{"link from Lemon Squeezy", http.StatusOK, "https://store.lemonsqueezy.com/billing/1/update"},
+		{"billing page while the API fails", http.StatusInternalServerError, "https://app.example.com/billing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"data":{"id":"1","type":"subscriptions","attributes":{"urls":{"update_payment_method":"https://store.lemonsqueezy.com/billing/1/update"}}}}`)
+			}))
+			defer srv.Close()
+
+			ctx := context.Background()
+			store := memstore.New()
+			client := lemonsqueezy.NewClient("key", "1", lemonsqueezy.Options{BaseURL: srv.URL, HTTPClient: srv.Client()})
+			s := NewService(store, client, nil, Options{GracePeriod: time.Hour, BillingURL: "https://app.example.com/billing"})
+
+			user, err := store.CreateUser(ctx, "a@example.com", "", "A", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.CreateSubscription(ctx, user.ID, 1, 10, 100, 1000, 2000, "past_due", nil, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			sub, err := store.GetSubscriptionByID(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.PaymentFailed(ctx, sub, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 3; i++ {
+				banner, err := s.Banner(ctx, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if banner.UpdatePaymentURL != tt.wantURL {
+					t.Errorf("UpdatePaymentURL = %q, want %q", banner.UpdatePaymentURL, tt.wantURL)
+				}
+			}
+			if got := calls.Load(); got != 1 {
+				t.Errorf("%d API requests for three banners, want 1", got)
+			}
+
+			// A later case fetches a fresh link
+			if err := s.PaymentRecovered(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.PaymentFailed(ctx, sub, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Banner(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if got := calls.Load(); got != 2 {
+				t.Errorf("%d API requests after a new case, want 2", got)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,101 @@
+package dunning
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"time"
+
+	"saas-server/pkg/plunk"
+)
+
+// emailStyle is shared by the dunning emails
+const emailStyle = `
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.button {
+					display: inline-block;
+					padding: 12px 24px;
+					background-color: #3b82f6;
+					color: white;
+					text-decoration: none;
+					border-radius: 6px;
+					margin: 20px 0;
+				}
+				.footer { margin-top: 30px; font-size: 14px; color: #666; }
+			</style>`
+
+// sendReminderEmail asks the subscriber to update their payment method before graceEndsAt
+func sendReminderEmail(ctx context.Context, mailer *plunk.Client, email string, first bool, graceEndsAt time.Time, link string) error {
+	subject := "Reminder: update your payment method"
+	heading := "Your payment is still outstanding"
+	if first {
+		subject = "Your subscription payment failed"
+		heading = "We couldn't process your payment"
+	}
+	link = html.EscapeString(link)
+
+	htmlBody := fmt.Sprintf(`
+		<!DOCTYPE html>
+		<html>
+		<head>%s
+		</head>
+		<body>
+			<div class="container">
+				<h2>%s</h2>
+				<p>The latest payment for your subscription did not go through. Your access continues until <strong>%s</strong>; please update your payment method before then to keep your subscription active.</p>
+
+				<a href="%s" class="button">Update Payment Method</a>
+
+				<p>If the button doesn't work, you can also copy and paste this link into your browser:</p>
+				<p>%s</p>
+
+				<div class="footer">
+					<p>We will retry the payment automatically once your details are updated.</p>
+				</div>
+			</div>
+		</body>
+		</html>
+	`, emailStyle, heading, graceEndsAt.UTC().Format("January 2, 2006"), link, link)
+
+	return mailer.Send(ctx, plunk.Email{
+		To:      email,
+		Subject: subject,
+		Body:    htmlBody,
+	})
+}
+
+// sendDowngradeEmail tells the subscriber their access was withdrawn and how to restore it
+func sendDowngradeEmail(ctx context.Context, mailer *plunk.Client, email, link string) error {
+	link = html.EscapeString(link)
+
+	htmlBody := fmt.Sprintf(`
+		<!DOCTYPE html>
+		<html>
+		<head>%s
+		</head>
+		<body>
+			<div class="container">
+				<h2>Your subscription has been paused</h2>
+				<p>We were unable to collect the payment for your subscription, so access to paid features has been paused. Update your payment method to restore it straight away.</p>
+
+				<a href="%s" class="button">Update Payment Method</a>
+
+				<p>If the button doesn't work, you can also copy and paste this link into your browser:</p>
+				<p>%s</p>
+
+				<div class="footer">
+					<p>Your account and data are unaffected.</p>
+				</div>
+			</div>
+		</body>
+		</html>
+	`, emailStyle, link, link)
+
+	return mailer.Send(ctx, plunk.Email{
+		To:      email,
+		Subject: "Your subscription has been paused",
+		Body:    htmlBody,
+	})
+}
@@ -0,0 +1,341 @@
+// Package geoip resolves IP addresses to countries using an offline MaxMind DB
+// (.mmdb) file such as GeoLite2-Country or DB-IP Country Lite. Only the parts
+// of the format needed for lookups are implemented, so no network access or
+// third-party dependency is required.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata section at the end of the file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree and the data section
+const dataSectionSeparator = 16
+
+// ErrInvalidDatabase is returned when a file is not a readable MaxMind DB
+var ErrInvalidDatabase = errors.New("geoip: invalid MaxMind DB file")
+
+// DB is an in-memory MaxMind DB
+type DB struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	data       []byte
+	ipv4Start  uint
+}
+
+// Open loads the MaxMind DB file at path
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New reads a MaxMind DB from its raw contents
+func New(buf []byte) (*DB, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaStart := start + len(metadataMarker)
+
+	d := decoder{buf: buf[metaStart:]}
+	value, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: reading metadata: %w", err)
+	}
+	meta, ok := value.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	db := &DB{
+		buf:        buf,
+		nodeCount:  uint(asUint(meta["node_count"])),
+		recordSize: uint(asUint(meta["record_size"])),
+		ipVersion:  uint(asUint(meta["ip_version"])),
+	}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	dataStart := treeSize + dataSectionSeparator
+	if dataStart > uint(start) {
+		return nil, ErrInvalidDatabase
+	}
+	db.data = buf[dataStart:start]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip is located in,
+// or an empty string if the database has no entry for it
+func (db *DB) Country(ip net.IP) (string, error) {
+	record, err := db.Lookup(ip)
+	if err != nil || record == nil {
+		return "", err
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := record[key].(map[string]any); ok {
+			if code, ok := country["iso_code"].(string); ok && code != "" {
+				return code, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Lookup returns the record stored for ip, or nil if there is none
+func (db *DB) Lookup(ip net.IP) (map[string]any, error) {
+	bits := ip.To4()
+	node := uint(0)
+	if bits != nil {
+		node = db.ipv4Start
+	} else {
+		if db.ipVersion == 4 {
+			return nil, nil
+		}
+		bits = ip.To16()
+		if bits == nil {
+			return nil, fmt.Errorf("geoip: invalid IP address %q", ip)
+		}
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+		node = db.record(node, uint(bit))
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount {
+		return nil, ErrInvalidDatabase
+	}
+
+	offset := node - db.nodeCount - dataSectionSeparator
+	d := decoder{buf: db.data}
+	value, _, err := d.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+// record reads the left (0) or right (1) record of a search tree node
+func (db *DB) record(node, side uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.buf[node*6+side*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.buf[node*7:]
+		if side == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.buf[node*8+side*4:]))
+	}
+}
+
+// Data section field types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder reads values from the data section
+type decoder struct {
+	buf []byte
+}
+
+// decode reads the value at offset and returns it with the offset following it
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind := int(ctrl >> 5)
+
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	b := d.buf[offset:end]
+	switch kind {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, end, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), end, nil
+	case typeUint128:
+		// Too wide for the lookups this package serves; keep the raw bytes
+		return append([]byte(nil), b...), end, nil
+	}
+	return nil, 0, fmt.Errorf("geoip: unsupported data type %d", kind)
+}
+
+// size reads the payload size encoded in a control byte and any extension bytes
+func (d *decoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	var ext uint
+	for _, c := range d.buf[offset : offset+n] {
+		ext = ext<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		return 29 + ext, offset + n, nil
+	case 30:
+		return 285 + ext, offset + n, nil
+	default:
+		return 65821 + ext, offset + n, nil
+	}
+}
+
+// pointer reads the data section offset a pointer refers to
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	b := d.buf[offset : offset+n]
+	v := uint(ctrl & 0x7)
+	switch n {
+	case 1:
+		return v<<8 | uint(b[0]), offset + n, nil
+	case 2:
+		return (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048, offset + n, nil
+	case 3:
+		return (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336, offset + n, nil
+	default:
+		return uint(binary.BigEndian.Uint32(b)), offset + n, nil
+	}
+}
+
+func asUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
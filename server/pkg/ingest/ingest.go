@@ -0,0 +1,196 @@
+// Package ingest buffers tracked page views and events in memory and writes them
+// to the database in batches, off the request path. The buffer is bounded: when it
+// is full, new items are refused so that callers can ask clients to retry later.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"saas-server/database"
+	"saas-server/pkg/analytics"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrQueueFull is returned when the buffer has no room for the items
+	ErrQueueFull = errors.New("ingest: queue full")
+	// ErrStopped is returned once the pipeline is shutting down
+	ErrStopped = errors.New("ingest: pipeline stopped")
+)
+
+// flushAttempts is how many times a batch is written before it is dropped
+const flushAttempts = 3
+
+// Options controls batching
+type Options struct {
+	// BatchSize is the number of buffered items that triggers a flush
+	BatchSize int
+	// FlushInterval is the longest an item waits before it is written
+	FlushInterval time.Duration
+	// QueueSize is the number of items that may wait to be written
+	QueueSize int
+}
+
+// Item is one tracked page view or event, or a request to link a visitor's
+// anonymous history to a user. Exactly one field is set.
+type Item struct {
+	PageView *analytics.PageView
+	Event    *analytics.Event
+	Stitch   *Stitch
+}
+
+// Stitch links the anonymous page views and events of a visitor to a user
+type Stitch struct {
+	VisitorID string
+	UserID    uuid.UUID
+}
+
+// Pipeline buffers items and flushes them in the background
+type Pipeline struct {
+	store database.AnalyticsRepository
+	opts  Options
+	items chan Item
+
+	// mu serializes enqueuers so that a request's items are accepted all together or not at all
+	mu      sync.Mutex
+	stopped bool
+
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewPipeline creates a pipeline that writes to store once started
+func NewPipeline(store database.AnalyticsRepository, opts Options) *Pipeline {
+	return &Pipeline{
+		store: store,
+		opts:  opts,
+		items: make(chan Item, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Enqueue buffers items for writing. Either all of them are accepted or, if the
+// buffer lacks room or the pipeline is stopping, none are.
+func (p *Pipeline) Enqueue(items ...Item) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return ErrStopped
+	}
+	if cap(p.items)-len(p.items) < len(items) {
+		return ErrQueueFull
+	}
+	for _, item := range items {
+		p.items <- item
+	}
+	return nil
+}
+
+// StartFlushJob writes buffered items whenever BatchSize of them are waiting or
+// FlushInterval has passed, until Stop is called
+func (p *Pipeline) StartFlushJob() {
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	p.started = true
+	go func() {
+		defer close(p.done)
+		defer ticker.Stop()
+		batch := make([]Item, 0, p.opts.BatchSize)
+		for {
+			select {
+			case item, ok := <-p.items:
+				if !ok {
+					p.flush(batch)
+					return
+				}
+				batch = append(batch, item)
+				if len(batch) >= p.opts.BatchSize {
+					p.flush(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}()
+}
+
+// Stop refuses new items, writes everything already buffered and waits for it to finish
+func (p *Pipeline) Stop() {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
+		close(p.items)
+		p.mu.Unlock()
+		if p.started {
+			<-p.done
+		}
+	})
+}
+
+// flush writes a batch: page views first, then events, then the stitches, so that
+// a visitor's views buffered before they signed in are linked too
+func (p *Pipeline) flush(batch []Item) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var views []*analytics.PageView
+	var events []*analytics.Event
+	var stitches []Stitch
+	seen := make(map[Stitch]bool)
+	for _, item := range batch {
+		switch {
+		case item.PageView != nil:
+			views = append(views, item.PageView)
+		case item.Event != nil:
+			events = append(events, item.Event)
+		case item.Stitch != nil && !seen[*item.Stitch]:
+			seen[*item.Stitch] = true
+			stitches = append(stitches, *item.Stitch)
+		}
+	}
+
+	// The request contexts are long gone; each store call applies its own timeout
+	ctx := context.Background()
+	if len(views) > 0 {
+		if err := retry(func() error { return p.store.TrackPageViews(ctx, views) }); err != nil {
+			log.Printf("[Ingest] Dropped %d page views: %v", len(views), err)
+		}
+	}
+	if len(events) > 0 {
+		if err := retry(func() error { return p.store.TrackEvents(ctx, events) }); err != nil {
+			log.Printf("[Ingest] Dropped %d events: %v", len(events), err)
+		}
+	}
+	for _, s := range stitches {
+		stitched, err := p.store.StitchVisitor(ctx, s.VisitorID, s.UserID)
+		if err != nil {
+			log.Printf("[Ingest] Error linking visitor to user %s: %v", s.UserID, err)
+			continue
+		}
+		if stitched > 0 {
+			log.Printf("[Ingest] Linked %d page views and events to user %s", stitched, s.UserID)
+		}
+	}
+}
+
+// retry runs write up to flushAttempts times, backing off between attempts
+func retry(write func() error) error {
+	var err error
+	for attempt := 1; attempt <= flushAttempts; attempt++ {
+		if err = write(); err == nil {
+			return nil
+		}
+		if attempt < flushAttempts {
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"saas-server/database/memstore"
+	"saas-server/pkg/analytics"
+
+	"github.com/google/uuid"
+)
+
+func pageView(visitorID, path string, at time.Time) Item {
+	return Item{PageView: &analytics.PageView{VisitorID: visitorID, Path: path, CreatedAt: at}}
+}
+
+func TestEnqueue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		queue   int
+		first   int
+		second  int
+		stop    bool
+		wantErr error
+	}{
+		{"fits", 3, 1, 2, false, nil},
+		{"refused whole when it does not fit", 3, 2, 2, false, ErrQueueFull},
+		{"refused once stopped", 3, 1, 1, true, ErrStopped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPipeline(memstore.New(), Options{BatchSize: 10, FlushInterval: time.Hour, QueueSize: tt.queue})
+			items := func(n int) []Item {
+				var batch []Item
+				for i := 0; i < n; i++ {
+					batch = append(batch, pageView("v1", "/", now))
+				}
+				return batch
+			}
+			if err := p.Enqueue(items(tt.first)...); err != nil {
+				t.Fatal(err)
+			}
+			if tt.stop {
+				p.Stop()
+			}
+			if err := p.Enqueue(items(tt.second)...); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Enqueue = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.stop && tt.wantErr != nil && len(p.items) != tt.first {
+				t.Errorf("%d items buffered, want the %d accepted first", len(p.items), tt.first)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	userID := uuid.New()
+
+	tests := []struct {
+		name string
+		opts Options
+		// stop flushes the rest; otherwise the batch size or interval must trigger it
+		stop bool
+	}{
+		{"on stop", Options{BatchSize: 100, FlushInterval: time.Hour, QueueSize: 100}, true},
+		{"when the batch is full", Options{BatchSize: 4, FlushInterval: time.Hour, QueueSize: 100}, false},
+		{"on the interval", Options{BatchSize: 100, FlushInterval: 10 * time.Millisecond, QueueSize: 100}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memstore.New()
+			p := NewPipeline(store, tt.opts)
+			p.StartFlushJob()
+			defer p.Stop()
+
+			err := p.Enqueue(
+				pageView("v1", "/", now.Add(-2*time.Minute)),
+				pageView("v1", "/pricing", now.Add(-time.Minute)),
+				Item{Event: &analytics.Event{Name: "signup_started", VisitorID: "v1", CreatedAt: now}},
+				Item{Stitch: &Stitch{VisitorID: "v1", UserID: userID}},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.stop {
+				p.Stop()
+			}
+
+			// The stitch is written last, so the journey is complete once it shows the user
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				views, err := store.GetUserJourney(ctx, userID, now.Add(-time.Hour), now.Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(views) == 2 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("journey has %d page views, want 2", len(views))
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			events, err := store.GetEvents(ctx, []string{"signup_started"}, now.Add(-time.Hour), now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].UserID == nil || *events[0].UserID != userID {
+				t.Errorf("events = %+v, want one event linked to %s", events, userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package invoice
+
+// font is one of the standard PDF Type 1 fonts, which every reader provides,
+// so nothing has to be embedded in the document
+type font struct {
+	resource string
+	baseFont string
+	// widths holds the advance of the printable ASCII characters, in 1/1000 em
+	widths [95]int
+}
+
+// defaultWidth is used for characters outside printable ASCII
+const defaultWidth = 556
+
+var helvetica = &font{
+	resource: "F1",
+	baseFont: "Helvetica",
+	widths: [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, // 0 to 9
+		278, 278, 584, 584, 584, 556, 1015, // : to @
+		667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, // A to M
+		722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, // N to Z
+		278, 278, 278, 469, 556, 333, // [ to `
+		556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, // a to m
+		556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, // n to z
+		334, 260, 334, 584, // { to ~
+	},
+}
+
+var helveticaBold = &font{
+	resource: "F2",
+	baseFont: "Helvetica-Bold",
+	widths: [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, // 0 to 9
+		333, 333, 584, 584, 584, 611, 975, // : to @
+		722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, // A to M
+		722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, // N to Z
+		333, 278, 333, 584, 556, 333, // [ to `
+		556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, // a to m
+		611, 611, 611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, // n to z
+		389, 280, 389, 584, // { to ~
+	},
+}
+
+// width returns the width of WinAnsi-encoded text set in f at size points
+func (f *font) width(text []byte, size float64) float64 {
+	total := 0
+	for _, c := range text {
+		if c >= 32 && c <= 126 {
+			total += f.widths[c-32]
+		} else {
+			total += defaultWidth
+		}
+	}
+	return float64(total) * size / 1000
+}
@@ -0,0 +1,180 @@
+// Package invoice renders branded PDF invoices. Documents use the standard PDF
+// fonts so they need no font files and stay small enough to generate per request.
+package invoice
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultAccentColor is used when the brand does not set one
+const DefaultAccentColor = "#4f46e5"
+
+// Brand identifies the seller printed at the top of every invoice
+type Brand struct {
+	Name        string
+	Address     []string
+	Email       string
+	TaxID       string
+	AccentColor string
+}
+
+// Party is the customer an invoice is addressed to
+type Party struct {
+	Name          string
+	Email         string
+	PaymentMethod string
+}
+
+// Item is a line of an invoice. Amount is in the smallest unit of the invoice currency.
+type Item struct {
+	Description string
+	Amount      int
+}
+
+// Document holds everything printed on an invoice. Amounts are in the smallest
+// unit of Currency.
+type Document struct {
+	Brand        Brand
+	Number       string
+	IssuedAt     time.Time
+	Status       string
+	BillTo       Party
+	Items        []Item
+	Currency     string
+	Subtotal     int
+	Discount     int
+	Tax          int
+	TaxName      string
+	TaxInclusive bool
+	Total        int
+	Refunded     int
+	Note         string
+}
+
+const (
+	margin      = 50.0
+	rightEdge   = pageWidth - margin
+	totalsLabel = 340.0
+)
+
+// Render writes doc to w as a single-page PDF
+func Render(w io.Writer, doc Document) error {
+	accentHex := doc.Brand.AccentColor
+	if accentHex == "" {
+		accentHex = DefaultAccentColor
+	}
+	accent, err := parseColor(accentHex)
+	if err != nil {
+		return err
+	}
+
+	p := &page{}
+
+	// Header band with the seller's name
+	p.rect(0, pageHeight-90, pageWidth, 90, accent)
+	p.text(margin, pageHeight-55, helveticaBold, 22, white, fit(doc.Brand.Name, helveticaBold, 22, 330))
+	p.textRight(rightEdge, pageHeight-55, helveticaBold, 14, white, "INVOICE")
+
+	// Seller details on the left, invoice details on the right
+	y := pageHeight - 125
+	sellerY := y
+	for _, line := range sellerLines(doc.Brand) {
+		p.text(margin, sellerY, helvetica, 9, gray, fit(line, helvetica, 9, 250))
+		sellerY -= 13
+	}
+	for _, field := range [][2]string{
+		{"Invoice number", doc.Number},
+		{"Date", doc.IssuedAt.Format("January 2, 2006")},
+		{"Status", strings.ToUpper(strings.ReplaceAll(doc.Status, "_", " "))},
+	} {
+		p.text(totalsLabel, y, helvetica, 9, gray, field[0])
+		p.textRight(rightEdge, y, helveticaBold, 9, black, field[1])
+		y -= 15
+	}
+
+	// Billing details
+	y = min(y, sellerY) - 25
+	p.text(margin, y, helveticaBold, 8, gray, "BILL TO")
+	y -= 16
+	if doc.BillTo.Name != "" {
+		p.text(margin, y, helveticaBold, 11, black, fit(doc.BillTo.Name, helveticaBold, 11, 300))
+		y -= 14
+	}
+	for _, line := range []string{doc.BillTo.Email, doc.BillTo.PaymentMethod} {
+		if line != "" {
+			p.text(margin, y, helvetica, 9, gray, fit(line, helvetica, 9, 300))
+			y -= 13
+		}
+	}
+
+	// Line items
+	y -= 25
+	p.rect(margin, y-7, rightEdge-margin, 22, lightGray)
+	p.text(margin+8, y, helveticaBold, 9, black, "Description")
+	p.textRight(rightEdge-8, y, helveticaBold, 9, black, "Amount")
+	y -= 27
+	for _, item := range doc.Items {
+		p.text(margin+8, y, helvetica, 10, black, fit(item.Description, helvetica, 10, 360))
+		p.textRight(rightEdge-8, y, helvetica, 10, black, FormatAmount(item.Amount, doc.Currency))
+		p.line(margin, y-9, rightEdge, y-9, lineGray)
+		y -= 25
+	}
+
+	// Totals
+	y -= 10
+	total := func(label, value string, f *font, size float64) {
+		p.text(totalsLabel, y, f, size, black, label)
+		p.textRight(rightEdge-8, y, f, size, black, value)
+		y -= size + 8
+	}
+	total("Subtotal", FormatAmount(doc.Subtotal, doc.Currency), helvetica, 10)
+	if doc.Discount > 0 {
+		total("Discount", FormatAmount(-doc.Discount, doc.Currency), helvetica, 10)
+	}
+	if doc.Tax > 0 || doc.TaxName != "" {
+		label := "Tax"
+		if doc.TaxName != "" {
+			label = doc.TaxName
+		}
+		if doc.TaxInclusive {
+			label += " (included)"
+		}
+		total(fit(label, helvetica, 10, rightEdge-totalsLabel-90), FormatAmount(doc.Tax, doc.Currency), helvetica, 10)
+	}
+	p.line(totalsLabel, y+10, rightEdge, y+10, lineGray)
+	y -= 6
+	total("Total", FormatAmount(doc.Total, doc.Currency), helveticaBold, 12)
+	if doc.Refunded > 0 {
+		total("Refunded", FormatAmount(-doc.Refunded, doc.Currency), helvetica, 10)
+		total("Net paid", FormatAmount(doc.Total-doc.Refunded, doc.Currency), helveticaBold, 10)
+	}
+
+	// Footer
+	note := doc.Note
+	if note == "" {
+		note = "Thank you for your business."
+	}
+	p.line(margin, 75, rightEdge, 75, lineGray)
+	p.text(margin, 58, helvetica, 8, gray, fit(note, helvetica, 8, rightEdge-margin))
+
+	return writePDF(w, p, doc.Brand.Name+" invoice "+doc.Number, doc.IssuedAt)
+}
+
+// sellerLines lists the brand details printed under the header
+func sellerLines(b Brand) []string {
+	lines := make([]string, 0, len(b.Address)+2)
+	for _, line := range b.Address {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if b.Email != "" {
+		lines = append(lines, b.Email)
+	}
+	if b.TaxID != "" {
+		lines = append(lines, "Tax ID: "+b.TaxID)
+	}
+	return lines
+}
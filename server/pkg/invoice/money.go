@@ -0,0 +1,72 @@
+package invoice
+
+import (
+	"strconv"
+	"strings"
+)
+
+// zeroDecimal lists currencies whose smallest unit is the whole unit
+var zeroDecimal = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true,
+	"KMF": true, "KRW": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// symbols are printed before the amount; other currencies are prefixed with their code
+var symbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CAD": "CA$",
+	"AUD": "A$",
+}
+
+// FormatAmount renders an amount given in the smallest unit of currency,
+// e.g. FormatAmount(123456, "USD") is "$1,234.56"
+func FormatAmount(amount int, currency string) string {
+	currency = strings.ToUpper(currency)
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	var number string
+	if zeroDecimal[currency] {
+		number = groupThousands(strconv.Itoa(amount))
+	} else {
+		number = groupThousands(strconv.Itoa(amount/100)) + "." + leftPad(strconv.Itoa(amount%100), 2)
+	}
+
+	if symbol, ok := symbols[currency]; ok {
+		return sign + symbol + number
+	}
+	return sign + currency + " " + number
+}
+
+func groupThousands(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	lead := len(digits) % 3
+	if lead > 0 {
+		b.WriteString(digits[:lead])
+	}
+	for i := lead; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+func leftPad(s string, n int) string {
+	for len(s) < n {
+		s = "0" + s
+	}
+	return s
+}
@@ -0,0 +1,184 @@
+package invoice
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A4 page size in points
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+)
+
+// color is an RGB color with components between 0 and 1
+type color struct{ r, g, b float64 }
+
+var (
+	black     = color{0.13, 0.13, 0.15}
+	gray      = color{0.42, 0.45, 0.50}
+	lightGray = color{0.95, 0.96, 0.97}
+	lineGray  = color{0.86, 0.87, 0.89}
+	white     = color{1, 1, 1}
+)
+
+// ValidateColor reports whether hex is a "#rrggbb" color usable as a brand accent
+func ValidateColor(hex string) error {
+	_, err := parseColor(hex)
+	return err
+}
+
+// parseColor parses a "#rrggbb" hex color
+func parseColor(hex string) (color, error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) != 6 {
+		return color{}, fmt.Errorf("invalid color %q: expected #rrggbb", hex)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color{}, fmt.Errorf("invalid color %q: expected #rrggbb", hex)
+	}
+	return color{
+		r: float64(v>>16&0xff) / 255,
+		g: float64(v>>8&0xff) / 255,
+		b: float64(v&0xff) / 255,
+	}, nil
+}
+
+// page accumulates the drawing operators of a single PDF page.
+// Coordinates are in points from the bottom-left corner.
+type page struct {
+	buf bytes.Buffer
+}
+
+func (p *page) rect(x, y, w, h float64, c color) {
+	fmt.Fprintf(&p.buf, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", c.r, c.g, c.b, x, y, w, h)
+}
+
+func (p *page) line(x1, y1, x2, y2 float64, c color) {
+	fmt.Fprintf(&p.buf, "%.3f %.3f %.3f RG 0.75 w %.2f %.2f m %.2f %.2f l S\n", c.r, c.g, c.b, x1, y1, x2, y2)
+}
+
+// text draws s with its baseline starting at (x, y)
+func (p *page) text(x, y float64, f *font, size float64, c color, s string) {
+	encoded := encodeWinAnsi(s)
+	fmt.Fprintf(&p.buf, "BT %.3f %.3f %.3f rg /%s %.1f Tf %.2f %.2f Td (", c.r, c.g, c.b, f.resource, size, x, y)
+	writeEscaped(&p.buf, encoded)
+	p.buf.WriteString(") Tj ET\n")
+}
+
+// textRight draws s so that it ends at x
+func (p *page) textRight(x, y float64, f *font, size float64, c color, s string) {
+	p.text(x-f.width(encodeWinAnsi(s), size), y, f, size, c, s)
+}
+
+// fit shortens s with an ellipsis until it is at most maxWidth wide
+func fit(s string, f *font, size, maxWidth float64) string {
+	if f.width(encodeWinAnsi(s), size) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "..."
+		if f.width(encodeWinAnsi(candidate), size) <= maxWidth {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// winAnsi maps the characters above Latin-1 that WinAnsiEncoding supports
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encodeWinAnsi converts UTF-8 text to the single-byte encoding of the standard fonts.
+// Characters the encoding cannot represent are replaced with '?'.
+func encodeWinAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		case winAnsi[r] != 0:
+			out = append(out, winAnsi[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// writeEscaped writes text as the body of a PDF literal string
+func writeEscaped(buf *bytes.Buffer, text []byte) {
+	for _, c := range text {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 32 || c > 126:
+			fmt.Fprintf(buf, "\\%03o", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// writePDF writes a complete single-page document with the given page content
+func writePDF(w io.Writer, p *page, title string, created time.Time) error {
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	if _, err := zw.Write(p.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+		"/Resources << /Font << /%s 4 0 R /%s 5 0 R >> >> /Contents 6 0 R >>",
+		pageWidth, pageHeight, helvetica.resource, helveticaBold.resource))
+	for _, f := range []*font{helvetica, helveticaBold} {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.baseFont))
+	}
+	object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+
+	var info bytes.Buffer
+	info.WriteString("<< /Title (")
+	writeEscaped(&info, encodeWinAnsi(title))
+	fmt.Fprintf(&info, ") /CreationDate (D:%s) >>", created.UTC().Format("20060102150405Z"))
+	object(info.String())
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, len(offsets), xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
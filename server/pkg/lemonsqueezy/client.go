@@ -2,118 +2,273 @@ package lemonsqueezy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
+	"log"
+	"math/rand"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"saas-server/pkg/telemetry"
 )
 
+// DefaultBaseURL is the production Lemon Squeezy API
+const DefaultBaseURL = "https://api.lemonsqueezy.com/v1"
+
 const (
-	baseURL = "https://api.lemonsqueezy.com/v1"
+	// jsonAPIMediaType is the content type Lemon Squeezy expects and returns
+	jsonAPIMediaType = "application/vnd.api+json"
+
+	// maxPageSize is the largest page Lemon Squeezy serves for list endpoints
+	maxPageSize = 100
+
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
 )
 
+// Options tunes how the client talks to the API. Zero values select the defaults.
+type Options struct {
+	// BaseURL overrides DefaultBaseURL, for example to point at a local fake server
+	BaseURL string
+	// Timeout bounds each HTTP attempt, including reading the response body
+	Timeout time.Duration
+	// MaxRetries is how many times a request is retried after a 429, a 5xx or a network error
+	MaxRetries int
+	// HTTPClient replaces the default traced client; Timeout is not applied to it
+	HTTPClient *http.Client
+}
+
 // Client represents a Lemon Squeezy API client
 type Client struct {
-	apiKey string
-	client *http.Client
+	apiKey     string
+	storeID    string
+	baseURL    string
+	maxRetries int
+	client     *http.Client
 }
 
-// NewClient creates a new Lemon Squeezy API client
-func NewClient() *Client {
-	return &Client{
-		apiKey: os.Getenv("LEMON_SQUEEZY_API_KEY"),
-		client: &http.Client{},
+// NewClient creates a new Lemon Squeezy API client.
+// storeID is used by store-scoped calls when no store is given explicitly.
+func NewClient(apiKey, storeID string, opts Options) *Client {
+	c := &Client{
+		apiKey:     apiKey,
+		storeID:    storeID,
+		baseURL:    strings.TrimRight(opts.BaseURL, "/"),
+		maxRetries: opts.MaxRetries,
+		client:     opts.HTTPClient,
+	}
+	if c.baseURL == "" {
+		c.baseURL = DefaultBaseURL
+	}
+	if c.maxRetries < 0 {
+		c.maxRetries = 0
 	}
+	if c.client == nil {
+		c.client = telemetry.NewHTTPClient()
+		c.client.Timeout = opts.Timeout
+	}
+	return c
 }
 
-// doRequest performs an HTTP request to the Lemon Squeezy API
-func (c *Client) doRequest(method, path string, body interface{}) (*http.Response, error) {
-	url := fmt.Sprintf("%s%s", baseURL, path)
+// StoreID returns the default store the client operates on
+func (c *Client) StoreID() string {
+	return c.storeID
+}
 
-	var req *http.Request
-	var jsonBody []byte
-	var err error
-	var buf *bytes.Buffer
+// resolve turns an API path, or an absolute link returned by the API, into a URL.
+// Absolute links must point at the configured API so the key is never sent elsewhere.
+func (c *Client) resolve(path string) (string, error) {
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		return c.baseURL + path, nil
+	}
+	if !strings.HasPrefix(path, c.baseURL+"/") {
+		return "", fmt.Errorf("refusing to follow link outside %s: %s", c.baseURL, path)
+	}
+	return path, nil
+}
+
+// doRequest performs a request against the Lemon Squeezy API, retrying throttled,
+// failed and unreachable requests with exponential backoff. A 2xx response body is
+// decoded into out when out is not nil; any other status is returned as an *APIError.
+func (c *Client) doRequest(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
 	if body != nil {
-		jsonBody, err = json.Marshal(body)
-		if err != nil {
-			return nil, err
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
 		}
-		buf = bytes.NewBuffer(jsonBody)
-	} else {
-		buf = bytes.NewBuffer(nil)
 	}
-	req, err = http.NewRequest(method, url, buf)
+	return c.send(ctx, method, path, jsonAPIMediaType, jsonAPIMediaType, payload, out)
+}
+
+// doFormRequest posts a form to one of the plain JSON endpoints, such as the License API
+func (c *Client) doFormRequest(ctx context.Context, path string, form url.Values, out interface{}) error {
+	return c.send(ctx, http.MethodPost, path, "application/x-www-form-urlencoded", "application/json", []byte(form.Encode()), out)
+}
 
+// send performs the request with retries; see doRequest
+func (c *Client) send(ctx context.Context, method, path, contentType, accept string, payload []byte, out interface{}) error {
+	endpoint, err := c.resolve(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+		req.Header.Set("Accept", accept)
+		if payload != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := c.client.Do(req)
+		var respBody []byte
+		if err == nil {
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
 
-	return c.client.Do(req)
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			if out == nil || len(respBody) == 0 {
+				return nil
+			}
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			return nil
+		}
+
+		if err == nil {
+			err = newAPIError(resp.StatusCode, respBody)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= c.maxRetries || !retryable(method, resp) {
+			return err
+		}
+
+		wait := backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = after
+			}
+		}
+		log.Printf("[LemonSqueezy] %s %s failed (%v), retrying in %s (attempt %d of %d)",
+			method, req.URL.Path, err, wait.Round(time.Millisecond), attempt+1, c.maxRetries)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
 }
 
-// GetProducts retrieves all products for a store
-func (c *Client) GetProducts(storeID string) (*ProductResponse, error) {
-	if storeID == "" {
-		storeID = os.Getenv("LEMON_SQUEEZY_STORE_ID")
+// retryable reports whether a failed attempt may be repeated. Throttled requests were
+// never processed and are always retried; server and network errors are retried only
+// for methods that are safe to repeat, so a checkout is never created twice.
+func retryable(method string, resp *http.Response) bool {
+	if resp == nil {
+		return method == http.MethodGet || method == http.MethodDelete
 	}
-	if storeID == "" {
-		return nil, fmt.Errorf("store ID is required")
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 500:
+		return method == http.MethodGet || method == http.MethodDelete
+	default:
+		return false
 	}
+}
 
-	resp, err := c.doRequest(http.MethodGet, fmt.Sprintf("/products?filter[store_id]=%s", storeID), nil)
-	if err != nil {
-		return nil, err
+// backoff returns the delay before retry attempt+1: exponential with jitter
+func backoff(attempt int) time.Duration {
+	d := initialBackoff << attempt
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
 	}
-	defer resp.Body.Close()
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch products: %d", resp.StatusCode)
+// retryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, maxBackoff), true
 	}
+	if at, err := http.ParseTime(header); err == nil {
+		return min(max(time.Until(at), 0), maxBackoff), true
+	}
+	return 0, false
+}
 
-	var result ProductResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+// listPath builds a list endpoint path with filters and the maximum page size
+func listPath(resource string, filters map[string]string) string {
+	q := url.Values{}
+	for k, v := range filters {
+		q.Set("filter["+k+"]", v)
 	}
+	q.Set("page[size]", strconv.Itoa(maxPageSize))
+	return "/" + resource + "?" + q.Encode()
+}
 
-	return &result, nil
+// Products iterates over every product of a store, following pagination links
+func (c *Client) Products(ctx context.Context, storeID string) iter.Seq2[ProductData, error] {
+	if storeID == "" {
+		storeID = c.storeID
+	}
+	if storeID == "" {
+		return failed[ProductData](fmt.Errorf("store ID is required"))
+	}
+	return paginate[ProductData](ctx, c, listPath("products", map[string]string{"store_id": storeID}))
 }
 
-// GetProduct retrieves a specific product
-func (c *Client) GetProduct(productID string) (*ProductResponse, error) {
-	resp, err := c.doRequest(http.MethodGet, fmt.Sprintf("/products/%s", productID), nil)
+// Variants iterates over every variant of a product, following pagination links
+func (c *Client) Variants(ctx context.Context, productID string) iter.Seq2[VariantData, error] {
+	return paginate[VariantData](ctx, c, listPath("variants", map[string]string{"product_id": productID}))
+}
+
+// GetProducts retrieves all products for a store
+func (c *Client) GetProducts(ctx context.Context, storeID string) (*ProductResponse, error) {
+	data, err := collect(c.Products(ctx, storeID))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &ProductResponse{Data: data, Meta: singlePageMeta(len(data))}, nil
+}
 
-	var result ProductResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+// GetProduct retrieves a specific product
+func (c *Client) GetProduct(ctx context.Context, productID string) (*ProductResponse, error) {
+	var result struct {
+		Data ProductData `json:"data"`
+	}
+	if err := c.doRequest(ctx, http.MethodGet, "/products/"+url.PathEscape(productID), nil, &result); err != nil {
 		return nil, err
 	}
-
-	return &result, nil
+	return &ProductResponse{Data: []ProductData{result.Data}, Meta: singlePageMeta(1)}, nil
 }
 
 // GetVariants retrieves all variants for a product
-func (c *Client) GetVariants(productID string) (*VariantResponse, error) {
-	resp, err := c.doRequest(http.MethodGet, fmt.Sprintf("/variants?filter[product_id]=%s", productID), nil)
+func (c *Client) GetVariants(ctx context.Context, productID string) (*VariantResponse, error) {
+	data, err := collect(c.Variants(ctx, productID))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var result VariantResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	return &result, nil
+	return &VariantResponse{Data: data, Meta: singlePageMeta(len(data))}, nil
 }
 
 // CheckoutResponse represents the response from creating a checkout
@@ -136,7 +291,8 @@ type CheckoutOptions struct {
 
 // ProductOptions represents the options for the product in checkout
 type ProductOptions struct {
-	EnabledVariants []int `json:"enabled_variants,omitempty"`
+	EnabledVariants []int  `json:"enabled_variants,omitempty"`
+	RedirectURL     string `json:"redirect_url,omitempty"`
 }
 
 // CheckoutData represents additional data for the checkout
@@ -146,14 +302,20 @@ type CheckoutData struct {
 }
 
 // CreateCheckout creates a new checkout
-func (c *Client) CreateCheckout(storeID string, variantID string, options map[string]interface{}) (*CheckoutResponse, error) {
+func (c *Client) CreateCheckout(ctx context.Context, storeID string, variantID string, options map[string]interface{}) (*CheckoutResponse, error) {
 	// Prepare checkout data
 	checkoutData := map[string]interface{}{}
 	if email, ok := options["email"].(string); ok && email != "" {
 		checkoutData["email"] = email
 	}
+	if name, ok := options["name"].(string); ok && name != "" {
+		checkoutData["name"] = name
+	}
 	if customData, ok := options["checkout_data"].(CheckoutData); ok {
 		checkoutData["custom"] = customData.Custom
+		if customData.DiscountCode != "" {
+			checkoutData["discount_code"] = customData.DiscountCode
+		}
 	}
 
 	body := map[string]interface{}{
@@ -198,28 +360,9 @@ func (c *Client) CreateCheckout(storeID string, variantID string, options map[st
 		attributes["preview"] = preview
 	}
 
-	resp, err := c.doRequest(http.MethodPost, "/checkouts", body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make checkout request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to create checkout: status=%d body=%s", resp.StatusCode, string(respBody))
-	}
-
-	// Create a new buffer with the response body for json.Decoder
-	bodyBuffer := bytes.NewBuffer(respBody)
-
 	var result CheckoutResponse
-	if err := json.NewDecoder(bodyBuffer).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.doRequest(ctx, http.MethodPost, "/checkouts", body, &result); err != nil {
+		return nil, fmt.Errorf("failed to create checkout: %w", err)
 	}
 
 	return &result, nil
@@ -0,0 +1,196 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeServer serves the given statuses in turn, then 200 with body
+func fakeServer(t *testing.T, statuses []int, headers map[string]string, errorBody, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		n := int(calls.Add(1))
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		w.Header().Set("Content-Type", jsonAPIMediaType)
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			fmt.Fprint(w, errorBody)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newTestClient(srv *httptest.Server, maxRetries int) *Client {
+	return NewClient("test-key", "1", Options{BaseURL: srv.URL, MaxRetries: maxRetries, HTTPClient: srv.Client()})
+}
+
+func TestRetries(t *testing.T) {
+	const order = `{"data":{"id":"5","type":"orders","attributes":{"order_number":5}}}`
+	const invalid = `{"errors":[{"status":"422","title":"Unprocessable Entity","detail":"The amount is too large.","source":{"pointer":"/data/attributes/amount"}}]}`
+	// Retry-After: 0 keeps the retries immediate
+	retryNow := map[string]string{"Retry-After": "0"}
+
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		maxRetries int
+		wantCalls  int32
+		wantStatus int
+	}{
+		{"throttled GET is retried", http.MethodGet, []int{429, 429}, 3, 3, 0},
+		{"throttled POST is retried", http.MethodPost, []int{429}, 3, 2, 0},
+		{"server error on GET is retried", http.MethodGet, []int{503}, 3, 2, 0},
+		{"server error on POST is not retried", http.MethodPost, []int{500}, 3, 1, 500},
+		{"client error is not retried", http.MethodPost, []int{422}, 3, 1, 422},
+		{"retries run out", http.MethodGet, []int{429, 429, 429}, 2, 3, 429},
+		{"no retries configured", http.MethodGet, []int{429}, 0, 1, 429},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := fakeServer(t, tt.statuses, retryNow, invalid, order)
+			c := newTestClient(srv, tt.maxRetries)
+
+			var err error
+			if tt.method == http.MethodGet {
+				_, err = c.GetOrder(context.Background(), "5")
+			} else {
+				_, err = c.RefundOrder(context.Background(), "5", RefundRequest{})
+			}
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("%d requests made, want %d", got, tt.wantCalls)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+				t.Fatalf("error = %v, want an APIError with status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantMessage  string
+		wantNotFound bool
+	}{
+		{
+			name:        "JSON:API errors",
+			status:      422,
+			body:        `{"errors":[{"status":"422","title":"Unprocessable Entity","detail":"The amount is too large.","source":{"pointer":"/data/attributes/amount"}}]}`,
+			wantMessage: "lemonsqueezy: 422 The amount is too large. (/data/attributes/amount)",
+		},
+		{
+			name:        "License API error",
+			status:      400,
+			body:        `{"activated":false,"error":"license_key not found."}`,
+			wantMessage: "lemonsqueezy: 400 license_key not found.",
+		},
+		{
+			name:         "not found without a body",
+			status:       404,
+			body:         ``,
+			wantMessage:  "lemonsqueezy: 404 Not Found",
+			wantNotFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := fakeServer(t, []int{tt.status}, nil, tt.body, "")
+			_, err := newTestClient(srv, 0).GetOrder(context.Background(), "5")
+			if err == nil || err.Error() != tt.wantMessage {
+				t.Errorf("error = %v, want %q", err, tt.wantMessage)
+			}
+			if IsNotFound(err) != tt.wantNotFound {
+				t.Errorf("IsNotFound = %v, want %v", IsNotFound(err), tt.wantNotFound)
+			}
+		})
+	}
+}
+
+func TestPagination(t *testing.T) {
+	var srv *httptest.Server
+	pages := map[string]string{
+		"1": `{"data":[{"id":"1"},{"id":"2"}],"links":{"next":"{base}/products?page[number]=2"}}`,
+		"2": `{"data":[{"id":"3"}],"links":{"next":"{base}/products?page[number]=3"}}`,
+		"3": `{"data":[{"id":"4"}],"links":{"next":""}}`,
+	}
+	var requests atomic.Int32
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		number := r.URL.Query().Get("page[number]")
+		if number == "" {
+			if got := r.URL.Query().Get("filter[store_id]"); got != "1" {
+				t.Errorf("filter[store_id] = %q, want the client's store", got)
+			}
+			number = "1"
+		}
+		fmt.Fprint(w, strings.ReplaceAll(pages[number], "{base}", srv.URL))
+	}))
+	defer srv.Close()
+	c := newTestClient(srv, 0)
+
+	var ids []string
+	for product, err := range c.Products(context.Background(), "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, product.ID)
+	}
+	if got := strings.Join(ids, ","); got != "1,2,3,4" {
+		t.Errorf("products = %s, want 1,2,3,4", got)
+	}
+
+	// Stopping early leaves the remaining pages unrequested
+	requests.Store(0)
+	for range c.Products(context.Background(), "") {
+		break
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("%d pages requested after stopping at the first item, want 1", got)
+	}
+}
+
+func TestPaginationRefusesForeignLinks(t *testing.T) {
+	srv, _ := fakeServer(t, nil, nil, "", `{"data":[{"id":"1"}],"links":{"next":"https://attacker.example/products?page[number]=2"}}`)
+	c := newTestClient(srv, 0)
+
+	var ids []string
+	var err error
+	for product, e := range c.Products(context.Background(), "") {
+		if e != nil {
+			err = e
+			break
+		}
+		ids = append(ids, product.ID)
+	}
+	if len(ids) != 1 || err == nil || !strings.Contains(err.Error(), "refusing to follow link") {
+		t.Errorf("products = %v, error = %v; want the first page and a refused link", ids, err)
+	}
+}
@@ -1,9 +1,9 @@
 package lemonsqueezy
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"net/http"
+	"net/url"
 )
 
 // CustomerResponse represents the response from the Lemon Squeezy API for customers
@@ -40,21 +40,10 @@ type CustomerURL struct {
 }
 
 // GetCustomer retrieves a specific customer
-func (c *Client) GetCustomer(customerID string) (*CustomerResponse, error) {
-	resp, err := c.doRequest(http.MethodGet, fmt.Sprintf("/customers/%s", customerID), nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch customer: %d", resp.StatusCode)
-	}
-
+func (c *Client) GetCustomer(ctx context.Context, customerID string) (*CustomerResponse, error) {
 	var result CustomerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := c.doRequest(ctx, http.MethodGet, "/customers/"+url.PathEscape(customerID), nil, &result); err != nil {
 		return nil, err
 	}
-
 	return &result, nil
 }
@@ -0,0 +1,125 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Discount amount types and durations
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+
+	DiscountOnce      = "once"
+	DiscountRepeating = "repeating"
+	DiscountForever   = "forever"
+)
+
+// DiscountResponse represents the response from the Lemon Squeezy API for a discount
+type DiscountResponse struct {
+	Data DiscountData `json:"data"`
+}
+
+// DiscountData represents a single discount in the API response
+type DiscountData struct {
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	Attributes DiscountAttributes `json:"attributes"`
+}
+
+// DiscountAttributes represents the attributes of a discount. Amount is a
+// percentage or, for fixed discounts, an amount in cents.
+type DiscountAttributes struct {
+	StoreID              int        `json:"store_id"`
+	Name                 string     `json:"name"`
+	Code                 string     `json:"code"`
+	Amount               int        `json:"amount"`
+	AmountType           string     `json:"amount_type"`
+	IsLimitedToProducts  bool       `json:"is_limited_to_products"`
+	IsLimitedRedemptions bool       `json:"is_limited_redemptions"`
+	MaxRedemptions       int        `json:"max_redemptions"`
+	StartsAt             *time.Time `json:"starts_at"`
+	ExpiresAt            *time.Time `json:"expires_at"`
+	Duration             string     `json:"duration"`
+	DurationInMonths     int        `json:"duration_in_months"`
+	Status               string     `json:"status"`
+	StatusFormatted      string     `json:"status_formatted"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	TestMode             bool       `json:"test_mode"`
+}
+
+// CreateDiscountRequest holds the attributes of a new discount. VariantIDs limits the
+// discount to those variants; leave it empty for a store-wide discount.
+type CreateDiscountRequest struct {
+	Name                 string     `json:"name"`
+	Code                 string     `json:"code"`
+	Amount               int        `json:"amount"`
+	AmountType           string     `json:"amount_type"`
+	IsLimitedRedemptions bool       `json:"is_limited_redemptions,omitempty"`
+	MaxRedemptions       int        `json:"max_redemptions,omitempty"`
+	StartsAt             *time.Time `json:"starts_at,omitempty"`
+	ExpiresAt            *time.Time `json:"expires_at,omitempty"`
+	Duration             string     `json:"duration,omitempty"`
+	DurationInMonths     int        `json:"duration_in_months,omitempty"`
+	TestMode             bool       `json:"test_mode,omitempty"`
+	VariantIDs           []int      `json:"-"`
+}
+
+// GetDiscount retrieves a specific discount
+func (c *Client) GetDiscount(ctx context.Context, discountID string) (*DiscountResponse, error) {
+	var result DiscountResponse
+	if err := c.doRequest(ctx, http.MethodGet, "/discounts/"+url.PathEscape(discountID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Discounts iterates over the discounts of the client's store
+func (c *Client) Discounts(ctx context.Context) iter.Seq2[DiscountData, error] {
+	return paginate[DiscountData](ctx, c, listPath("discounts", c.storeFilters(nil)))
+}
+
+// CreateDiscount creates a discount code in the client's store
+func (c *Client) CreateDiscount(ctx context.Context, req CreateDiscountRequest) (*DiscountResponse, error) {
+	attributes := struct {
+		CreateDiscountRequest
+		IsLimitedToProducts bool `json:"is_limited_to_products"`
+	}{req, len(req.VariantIDs) > 0}
+
+	relationships := map[string]interface{}{
+		"store": map[string]interface{}{
+			"data": map[string]interface{}{"type": "stores", "id": c.storeID},
+		},
+	}
+	if len(req.VariantIDs) > 0 {
+		variants := make([]map[string]interface{}, 0, len(req.VariantIDs))
+		for _, id := range req.VariantIDs {
+			variants = append(variants, map[string]interface{}{"type": "variants", "id": strconv.Itoa(id)})
+		}
+		relationships["variants"] = map[string]interface{}{"data": variants}
+	}
+
+	body := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":          "discounts",
+			"attributes":    attributes,
+			"relationships": relationships,
+		},
+	}
+
+	var result DiscountResponse
+	if err := c.doRequest(ctx, http.MethodPost, "/discounts", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteDiscount deletes a discount
+func (c *Client) DeleteDiscount(ctx context.Context, discountID string) error {
+	return c.doRequest(ctx, http.MethodDelete, "/discounts/"+url.PathEscape(discountID), nil, nil)
+}
@@ -0,0 +1,69 @@
+package lemonsqueezy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorObject is a single JSON:API error returned by the API
+type ErrorObject struct {
+	Status string `json:"status"`
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Source struct {
+		Pointer   string `json:"pointer"`
+		Parameter string `json:"parameter"`
+	} `json:"source"`
+}
+
+// APIError is returned for any non-2xx response. Errors holds the decoded JSON:API
+// error objects, if the response carried any.
+type APIError struct {
+	StatusCode int
+	Errors     []ErrorObject
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: status}
+	var doc struct {
+		Errors []ErrorObject `json:"errors"`
+		// The License API reports a single message instead of JSON:API errors
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &doc) == nil {
+		apiErr.Errors = doc.Errors
+		if len(apiErr.Errors) == 0 && doc.Error != "" {
+			apiErr.Errors = []ErrorObject{{Status: strconv.Itoa(status), Detail: doc.Error}}
+		}
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("lemonsqueezy: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	details := make([]string, 0, len(e.Errors))
+	for _, obj := range e.Errors {
+		msg := obj.Title
+		if obj.Detail != "" {
+			msg = obj.Detail
+		}
+		if obj.Source.Pointer != "" {
+			msg += " (" + obj.Source.Pointer + ")"
+		}
+		details = append(details, msg)
+	}
+	return fmt.Sprintf("lemonsqueezy: %d %s", e.StatusCode, strings.Join(details, "; "))
+}
+
+// IsNotFound reports whether err is an API error for a resource that does not exist
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
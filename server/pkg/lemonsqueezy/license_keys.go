@@ -0,0 +1,80 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// LicenseKey describes a license key as returned by the License API
+type LicenseKey struct {
+	ID              int        `json:"id"`
+	Status          string     `json:"status"`
+	Key             string     `json:"key"`
+	ActivationLimit int        `json:"activation_limit"`
+	ActivationUsage int        `json:"activation_usage"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+}
+
+// LicenseInstance is a single activation of a license key
+type LicenseInstance struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LicenseMeta identifies the purchase a license key belongs to
+type LicenseMeta struct {
+	StoreID       int    `json:"store_id"`
+	OrderID       int    `json:"order_id"`
+	OrderItemID   int    `json:"order_item_id"`
+	ProductID     int    `json:"product_id"`
+	ProductName   string `json:"product_name"`
+	VariantID     int    `json:"variant_id"`
+	VariantName   string `json:"variant_name"`
+	CustomerID    int    `json:"customer_id"`
+	CustomerName  string `json:"customer_name"`
+	CustomerEmail string `json:"customer_email"`
+}
+
+// LicenseResponse represents the response of the License API endpoints. Only the
+// flag matching the call that was made is set.
+type LicenseResponse struct {
+	Activated   bool             `json:"activated"`
+	Valid       bool             `json:"valid"`
+	Deactivated bool             `json:"deactivated"`
+	Error       string           `json:"error"`
+	LicenseKey  LicenseKey       `json:"license_key"`
+	Instance    *LicenseInstance `json:"instance"`
+	Meta        LicenseMeta      `json:"meta"`
+}
+
+// ActivateLicenseKey activates a license key for a named instance, such as a machine or site
+func (c *Client) ActivateLicenseKey(ctx context.Context, licenseKey, instanceName string) (*LicenseResponse, error) {
+	form := url.Values{"license_key": {licenseKey}, "instance_name": {instanceName}}
+	return c.licenseRequest(ctx, "/licenses/activate", form)
+}
+
+// ValidateLicenseKey checks a license key and, if instanceID is not empty, that activation
+func (c *Client) ValidateLicenseKey(ctx context.Context, licenseKey, instanceID string) (*LicenseResponse, error) {
+	form := url.Values{"license_key": {licenseKey}}
+	if instanceID != "" {
+		form.Set("instance_id", instanceID)
+	}
+	return c.licenseRequest(ctx, "/licenses/validate", form)
+}
+
+// DeactivateLicenseKey releases an activation of a license key
+func (c *Client) DeactivateLicenseKey(ctx context.Context, licenseKey, instanceID string) (*LicenseResponse, error) {
+	form := url.Values{"license_key": {licenseKey}, "instance_id": {instanceID}}
+	return c.licenseRequest(ctx, "/licenses/deactivate", form)
+}
+
+func (c *Client) licenseRequest(ctx context.Context, path string, form url.Values) (*LicenseResponse, error) {
+	var result LicenseResponse
+	if err := c.doFormRequest(ctx, path, form, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,116 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// OrderResponse represents the response from the Lemon Squeezy API for an order
+type OrderResponse struct {
+	Data OrderData `json:"data"`
+}
+
+// OrderData represents a single order in the API response
+type OrderData struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Attributes OrderAttributes `json:"attributes"`
+}
+
+// OrderAttributes represents the attributes of an order. Amounts are in the
+// smallest unit of Currency; the _usd fields are converted at CurrencyRate.
+type OrderAttributes struct {
+	StoreID                 int        `json:"store_id"`
+	CustomerID              int        `json:"customer_id"`
+	Identifier              string     `json:"identifier"`
+	OrderNumber             int        `json:"order_number"`
+	UserName                string     `json:"user_name"`
+	UserEmail               string     `json:"user_email"`
+	Currency                string     `json:"currency"`
+	CurrencyRate            string     `json:"currency_rate"`
+	Subtotal                int        `json:"subtotal"`
+	SetupFee                int        `json:"setup_fee"`
+	DiscountTotal           int        `json:"discount_total"`
+	Tax                     int        `json:"tax"`
+	Total                   int        `json:"total"`
+	RefundedAmount          int        `json:"refunded_amount"`
+	SubtotalUSD             int        `json:"subtotal_usd"`
+	DiscountTotalUSD        int        `json:"discount_total_usd"`
+	TaxUSD                  int        `json:"tax_usd"`
+	TotalUSD                int        `json:"total_usd"`
+	RefundedAmountUSD       int        `json:"refunded_amount_usd"`
+	TaxName                 string     `json:"tax_name"`
+	TaxRate                 string     `json:"tax_rate"`
+	TaxInclusive            bool       `json:"tax_inclusive"`
+	Status                  string     `json:"status"`
+	StatusFormatted         string     `json:"status_formatted"`
+	Refunded                bool       `json:"refunded"`
+	RefundedAt              *time.Time `json:"refunded_at"`
+	SubtotalFormatted       string     `json:"subtotal_formatted"`
+	DiscountTotalFormatted  string     `json:"discount_total_formatted"`
+	TaxFormatted            string     `json:"tax_formatted"`
+	TotalFormatted          string     `json:"total_formatted"`
+	RefundedAmountFormatted string     `json:"refunded_amount_formatted"`
+	FirstOrderItem          OrderItem  `json:"first_order_item"`
+	URLs                    OrderURLs  `json:"urls"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+	TestMode                bool       `json:"test_mode"`
+}
+
+// OrderItem represents the product and variant bought in an order
+type OrderItem struct {
+	ID          int    `json:"id"`
+	OrderID     int    `json:"order_id"`
+	ProductID   int    `json:"product_id"`
+	VariantID   int    `json:"variant_id"`
+	ProductName string `json:"product_name"`
+	VariantName string `json:"variant_name"`
+	Price       int    `json:"price"`
+	Quantity    int    `json:"quantity"`
+}
+
+// OrderURLs holds the customer-facing links of an order
+type OrderURLs struct {
+	Receipt string `json:"receipt"`
+}
+
+// RefundRequest holds the amount to refund, in the smallest currency unit.
+// A zero Amount refunds the remaining balance in full.
+type RefundRequest struct {
+	Amount int `json:"amount,omitempty"`
+}
+
+// GetOrder retrieves a specific order
+func (c *Client) GetOrder(ctx context.Context, orderID string) (*OrderResponse, error) {
+	var result OrderResponse
+	if err := c.doRequest(ctx, http.MethodGet, "/orders/"+url.PathEscape(orderID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Orders iterates over the orders of a store, optionally narrowed by filters such as "user_email"
+func (c *Client) Orders(ctx context.Context, filters map[string]string) iter.Seq2[OrderData, error] {
+	return paginate[OrderData](ctx, c, listPath("orders", c.storeFilters(filters)))
+}
+
+// RefundOrder refunds an order fully or partially
+func (c *Client) RefundOrder(ctx context.Context, orderID string, req RefundRequest) (*OrderResponse, error) {
+	body := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "orders",
+			"id":         orderID,
+			"attributes": req,
+		},
+	}
+
+	var result OrderResponse
+	if err := c.doRequest(ctx, http.MethodPost, "/orders/"+url.PathEscape(orderID)+"/refund", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,72 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"iter"
+	"net/http"
+)
+
+// PageLinks holds the JSON:API pagination links of a list response
+type PageLinks struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Next  string `json:"next"`
+	Prev  string `json:"prev"`
+}
+
+// page is one page of a list endpoint
+type page[T any] struct {
+	Data  []T       `json:"data"`
+	Links PageLinks `json:"links"`
+}
+
+// paginate iterates over every item of a list endpoint, requesting the next page
+// only when the previous one is exhausted. The iteration stops after yielding an error.
+func paginate[T any](ctx context.Context, c *Client, path string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for next := path; next != ""; {
+			var p page[T]
+			if err := c.doRequest(ctx, http.MethodGet, next, nil, &p); err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range p.Data {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			next = p.Links.Next
+		}
+	}
+}
+
+// failed returns an iterator that yields only err
+func failed[T any](err error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		yield(zero, err)
+	}
+}
+
+// collect drains an iterator into a slice, stopping at the first error
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	items := []T{}
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// singlePageMeta describes a fully collected list as a single page
+func singlePageMeta(n int) Meta {
+	meta := Meta{Page: MetaPage{CurrentPage: 1, LastPage: 1, PerPage: n, Total: n}}
+	if n > 0 {
+		meta.Page.From = 1
+		meta.Page.To = n
+	}
+	return meta
+}
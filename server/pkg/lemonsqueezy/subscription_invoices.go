@@ -0,0 +1,97 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SubscriptionInvoiceResponse represents the response from the Lemon Squeezy API for a subscription invoice
+type SubscriptionInvoiceResponse struct {
+	Data SubscriptionInvoiceData `json:"data"`
+}
+
+// SubscriptionInvoiceData represents a single subscription invoice in the API response
+type SubscriptionInvoiceData struct {
+	ID         string                        `json:"id"`
+	Type       string                        `json:"type"`
+	Attributes SubscriptionInvoiceAttributes `json:"attributes"`
+}
+
+// SubscriptionInvoiceAttributes represents the attributes of a subscription invoice.
+// Amounts are in the smallest unit of Currency.
+type SubscriptionInvoiceAttributes struct {
+	StoreID                 int                     `json:"store_id"`
+	SubscriptionID          int                     `json:"subscription_id"`
+	CustomerID              int                     `json:"customer_id"`
+	UserName                string                  `json:"user_name"`
+	UserEmail               string                  `json:"user_email"`
+	BillingReason           string                  `json:"billing_reason"`
+	CardBrand               string                  `json:"card_brand"`
+	CardLastFour            string                  `json:"card_last_four"`
+	Currency                string                  `json:"currency"`
+	CurrencyRate            string                  `json:"currency_rate"`
+	Status                  string                  `json:"status"`
+	StatusFormatted         string                  `json:"status_formatted"`
+	Refunded                bool                    `json:"refunded"`
+	RefundedAt              *time.Time              `json:"refunded_at"`
+	Subtotal                int                     `json:"subtotal"`
+	DiscountTotal           int                     `json:"discount_total"`
+	Tax                     int                     `json:"tax"`
+	TaxInclusive            bool                    `json:"tax_inclusive"`
+	Total                   int                     `json:"total"`
+	RefundedAmount          int                     `json:"refunded_amount"`
+	SubtotalUSD             int                     `json:"subtotal_usd"`
+	DiscountTotalUSD        int                     `json:"discount_total_usd"`
+	TaxUSD                  int                     `json:"tax_usd"`
+	TotalUSD                int                     `json:"total_usd"`
+	RefundedAmountUSD       int                     `json:"refunded_amount_usd"`
+	SubtotalFormatted       string                  `json:"subtotal_formatted"`
+	DiscountTotalFormatted  string                  `json:"discount_total_formatted"`
+	TaxFormatted            string                  `json:"tax_formatted"`
+	TotalFormatted          string                  `json:"total_formatted"`
+	RefundedAmountFormatted string                  `json:"refunded_amount_formatted"`
+	URLs                    SubscriptionInvoiceURLs `json:"urls"`
+	CreatedAt               time.Time               `json:"created_at"`
+	UpdatedAt               time.Time               `json:"updated_at"`
+	TestMode                bool                    `json:"test_mode"`
+}
+
+// SubscriptionInvoiceURLs holds the customer-facing links of a subscription invoice
+type SubscriptionInvoiceURLs struct {
+	InvoiceURL string `json:"invoice_url"`
+}
+
+// GetSubscriptionInvoice retrieves a specific subscription invoice
+func (c *Client) GetSubscriptionInvoice(ctx context.Context, invoiceID string) (*SubscriptionInvoiceResponse, error) {
+	var result SubscriptionInvoiceResponse
+	if err := c.doRequest(ctx, http.MethodGet, "/subscription-invoices/"+url.PathEscape(invoiceID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SubscriptionInvoices iterates over the subscription invoices of a store, optionally
+// narrowed by filters such as "subscription_id", "status" or "refunded"
+func (c *Client) SubscriptionInvoices(ctx context.Context, filters map[string]string) iter.Seq2[SubscriptionInvoiceData, error] {
+	return paginate[SubscriptionInvoiceData](ctx, c, listPath("subscription-invoices", c.storeFilters(filters)))
+}
+
+// RefundSubscriptionInvoice refunds a subscription invoice fully or partially
+func (c *Client) RefundSubscriptionInvoice(ctx context.Context, invoiceID string, req RefundRequest) (*SubscriptionInvoiceResponse, error) {
+	body := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "subscription-invoices",
+			"id":         invoiceID,
+			"attributes": req,
+		},
+	}
+
+	var result SubscriptionInvoiceResponse
+	if err := c.doRequest(ctx, http.MethodPost, "/subscription-invoices/"+url.PathEscape(invoiceID)+"/refund", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
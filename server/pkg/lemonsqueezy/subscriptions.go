@@ -0,0 +1,174 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Pause modes accepted by PauseSubscription
+const (
+	PauseModeVoid = "void" // neither billed nor served while paused
+	PauseModeFree = "free" // served for free while paused
+)
+
+// SubscriptionResponse represents the response from the Lemon Squeezy API for a subscription
+type SubscriptionResponse struct {
+	Data SubscriptionData `json:"data"`
+}
+
+// SubscriptionData represents a single subscription in the API response
+type SubscriptionData struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes SubscriptionAttributes `json:"attributes"`
+}
+
+// SubscriptionAttributes represents the attributes of a subscription
+type SubscriptionAttributes struct {
+	StoreID               int                `json:"store_id"`
+	CustomerID            int                `json:"customer_id"`
+	OrderID               int                `json:"order_id"`
+	OrderItemID           int                `json:"order_item_id"`
+	ProductID             int                `json:"product_id"`
+	VariantID             int                `json:"variant_id"`
+	ProductName           string             `json:"product_name"`
+	VariantName           string             `json:"variant_name"`
+	UserName              string             `json:"user_name"`
+	UserEmail             string             `json:"user_email"`
+	Status                string             `json:"status"`
+	StatusFormatted       string             `json:"status_formatted"`
+	CardBrand             string             `json:"card_brand"`
+	CardLastFour          string             `json:"card_last_four"`
+	Pause                 *SubscriptionPause `json:"pause"`
+	Cancelled             bool               `json:"cancelled"`
+	TrialEndsAt           *time.Time         `json:"trial_ends_at"`
+	BillingAnchor         int                `json:"billing_anchor"`
+	FirstSubscriptionItem *SubscriptionItem  `json:"first_subscription_item"`
+	URLs                  SubscriptionURLs   `json:"urls"`
+	RenewsAt              *time.Time         `json:"renews_at"`
+	EndsAt                *time.Time         `json:"ends_at"`
+	CreatedAt             time.Time          `json:"created_at"`
+	UpdatedAt             time.Time          `json:"updated_at"`
+	TestMode              bool               `json:"test_mode"`
+}
+
+// SubscriptionPause describes how a paused subscription behaves and when it resumes
+type SubscriptionPause struct {
+	Mode      string     `json:"mode"`
+	ResumesAt *time.Time `json:"resumes_at"`
+}
+
+// SubscriptionItem represents the price and quantity a subscription bills for
+type SubscriptionItem struct {
+	ID             int       `json:"id"`
+	SubscriptionID int       `json:"subscription_id"`
+	PriceID        int       `json:"price_id"`
+	Quantity       int       `json:"quantity"`
+	IsUsageBased   bool      `json:"is_usage_based"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SubscriptionURLs holds the customer-facing links of a subscription
+type SubscriptionURLs struct {
+	UpdatePaymentMethod              string `json:"update_payment_method"`
+	CustomerPortal                   string `json:"customer_portal"`
+	CustomerPortalUpdateSubscription string `json:"customer_portal_update_subscription"`
+}
+
+// UpdateSubscriptionRequest holds the subscription attributes to change. Unset fields
+// are left as they are.
+type UpdateSubscriptionRequest struct {
+	// VariantID moves the subscription to another plan
+	VariantID int `json:"variant_id,omitempty"`
+	// InvoiceImmediately charges the prorated difference now instead of at the next renewal
+	InvoiceImmediately bool `json:"invoice_immediately,omitempty"`
+	// DisableProrations switches plans without charging or crediting the difference
+	DisableProrations bool `json:"disable_prorations,omitempty"`
+	// BillingAnchor sets the day of the month renewals are billed on
+	BillingAnchor *int `json:"billing_anchor,omitempty"`
+	// TrialEndsAt extends or shortens an active trial
+	TrialEndsAt *time.Time `json:"trial_ends_at,omitempty"`
+}
+
+// GetSubscription retrieves a specific subscription
+func (c *Client) GetSubscription(ctx context.Context, subscriptionID string) (*SubscriptionResponse, error) {
+	var result SubscriptionResponse
+	if err := c.doRequest(ctx, http.MethodGet, "/subscriptions/"+url.PathEscape(subscriptionID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Subscriptions iterates over the subscriptions of a store, optionally narrowed by
+// filters such as "status", "user_email", "product_id" or "variant_id"
+func (c *Client) Subscriptions(ctx context.Context, filters map[string]string) iter.Seq2[SubscriptionData, error] {
+	return paginate[SubscriptionData](ctx, c, listPath("subscriptions", c.storeFilters(filters)))
+}
+
+// UpdateSubscription changes the plan, billing anchor or trial of a subscription
+func (c *Client) UpdateSubscription(ctx context.Context, subscriptionID string, req UpdateSubscriptionRequest) (*SubscriptionResponse, error) {
+	return c.patchSubscription(ctx, subscriptionID, req)
+}
+
+// PauseSubscription pauses payment collection using one of the PauseMode constants.
+// A nil resumesAt pauses the subscription until it is unpaused.
+func (c *Client) PauseSubscription(ctx context.Context, subscriptionID, mode string, resumesAt *time.Time) (*SubscriptionResponse, error) {
+	return c.patchSubscription(ctx, subscriptionID, map[string]interface{}{
+		"pause": SubscriptionPause{Mode: mode, ResumesAt: resumesAt},
+	})
+}
+
+// UnpauseSubscription resumes payment collection for a paused subscription
+func (c *Client) UnpauseSubscription(ctx context.Context, subscriptionID string) (*SubscriptionResponse, error) {
+	return c.patchSubscription(ctx, subscriptionID, map[string]interface{}{
+		"pause": nil,
+	})
+}
+
+// ResumeSubscription reverses a cancellation while the subscription is still in its grace period
+func (c *Client) ResumeSubscription(ctx context.Context, subscriptionID string) (*SubscriptionResponse, error) {
+	return c.patchSubscription(ctx, subscriptionID, map[string]interface{}{
+		"cancelled": false,
+	})
+}
+
+// CancelSubscription cancels a subscription at the end of the current billing period
+func (c *Client) CancelSubscription(ctx context.Context, subscriptionID string) (*SubscriptionResponse, error) {
+	var result SubscriptionResponse
+	if err := c.doRequest(ctx, http.MethodDelete, "/subscriptions/"+url.PathEscape(subscriptionID), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) patchSubscription(ctx context.Context, subscriptionID string, attributes interface{}) (*SubscriptionResponse, error) {
+	body := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "subscriptions",
+			"id":         subscriptionID,
+			"attributes": attributes,
+		},
+	}
+
+	var result SubscriptionResponse
+	if err := c.doRequest(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// storeFilters scopes filters to the client's store unless they name a store_id themselves
+func (c *Client) storeFilters(filters map[string]string) map[string]string {
+	scoped := map[string]string{}
+	if c.storeID != "" {
+		scoped["store_id"] = c.storeID
+	}
+	for k, v := range filters {
+		scoped[k] = v
+	}
+	return scoped
+}
@@ -44,13 +44,16 @@ type VariantData struct {
 
 // VariantAttributes represents the attributes of a variant
 type VariantAttributes struct {
-	ProductID   int    `json:"product_id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Price       int    `json:"price"`
-	Status      string `json:"status"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	ProductID      int    `json:"product_id"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Price          int    `json:"price"`
+	Status         string `json:"status"`
+	IsSubscription bool   `json:"is_subscription"`
+	Interval       string `json:"interval"`
+	IntervalCount  int    `json:"interval_count"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
 }
 
 // Relationships represents the relationships of a product or variant
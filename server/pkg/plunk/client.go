@@ -0,0 +1,96 @@
+// Package plunk provides a minimal client for the Plunk transactional email API
+package plunk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"saas-server/pkg/telemetry"
+)
+
+const (
+	baseURL = "https://api.useplunk.com/v1"
+)
+
+// ErrNotConfigured is returned when the client has no API key
+var ErrNotConfigured = errors.New("PLUNK_SECRET_API_KEY not set")
+
+// Client represents a Plunk API client
+type Client struct {
+	apiKey string
+	client *http.Client
+}
+
+// Email represents a transactional email to send
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Type    string `json:"type,omitempty"`
+	Reply   string `json:"reply,omitempty"`
+}
+
+// Event represents a contact event used to trigger Plunk automations
+type Event struct {
+	Event      string                 `json:"event"`
+	Email      string                 `json:"email"`
+	Subscribed bool                   `json:"subscribed"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewClient creates a new Plunk API client.
+// An empty API key yields a client whose calls fail with ErrNotConfigured.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		apiKey: apiKey,
+		client: telemetry.NewHTTPClient(),
+	}
+}
+
+// Send delivers a transactional email
+func (c *Client) Send(ctx context.Context, email Email) error {
+	return c.post(ctx, "/send", email)
+}
+
+// Track records a contact event
+func (c *Client) Track(ctx context.Context, event Event) error {
+	return c.post(ctx, "/track", event)
+}
+
+// post sends a JSON payload to the Plunk API and checks the response status
+func (c *Client) post(ctx context.Context, path string, payload interface{}) error {
+	if c.apiKey == "" {
+		return ErrNotConfigured
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Plunk API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error response from Plunk API: %d - %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
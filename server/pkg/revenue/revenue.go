@@ -0,0 +1,260 @@
+// Package revenue derives subscription revenue metrics (MRR and its movements,
+// churn, ARPU, LTV and cohort retention) from the history of subscription state
+// changes and the payments collected.
+package revenue
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"saas-server/models"
+)
+
+// PeriodLayout formats the month a period or cohort covers
+const PeriodLayout = "2006-01"
+
+// Counts reports whether a subscription in status contributes to MRR. Cancelled
+// subscriptions stop counting when they are cancelled rather than when they run
+// out, and trials count once they convert.
+func Counts(status string) bool {
+	return status == "active" || status == "past_due"
+}
+
+// MonthlyAmount normalizes a price billed every count intervals ("day", "week",
+// "month" or "year") to a monthly amount
+func MonthlyAmount(price int, interval string, count int) int {
+	if count <= 0 {
+		count = 1
+	}
+	var monthly float64
+	switch interval {
+	case "day":
+		monthly = float64(price) * 365 / 12 / float64(count)
+	case "week":
+		monthly = float64(price) * 52 / 12 / float64(count)
+	case "year":
+		monthly = float64(price) / 12 / float64(count)
+	default:
+		monthly = float64(price) / float64(count)
+	}
+	return int(math.Round(monthly))
+}
+
+// SubscriptionMRR returns the monthly recurring revenue of a subscription in status
+// on variant v. v may be nil when the variant is not in the local catalog.
+func SubscriptionMRR(status string, v *models.Variant) int {
+	if v == nil || !v.IsSubscription || !Counts(status) {
+		return 0
+	}
+	return MonthlyAmount(v.Price, v.Interval, v.IntervalCount)
+}
+
+// Filter selects the report range [From, To) and optionally a single plan. A
+// subscription that moves off the selected plan counts as churned from it.
+type Filter struct {
+	From      time.Time
+	To        time.Time
+	ProductID int
+	VariantID int
+}
+
+func (f Filter) matches(productID, variantID int) bool {
+	return (f.ProductID == 0 || f.ProductID == productID) && (f.VariantID == 0 || f.VariantID == variantID)
+}
+
+// BuildReport computes monthly revenue metrics and cohort retention for f. events
+// must include the history before f.From so that the opening MRR is known.
+func BuildReport(events []models.SubscriptionEvent, payments []models.Payment, f Filter) *models.RevenueReport {
+	events = append([]models.SubscriptionEvent(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].OccurredAt.Before(events[j].OccurredAt) })
+
+	report := &models.RevenueReport{
+		From:      f.From,
+		To:        f.To,
+		ProductID: f.ProductID,
+		VariantID: f.VariantID,
+		Periods:   []models.RevenuePeriod{},
+		Cohorts:   []models.CohortRetention{},
+	}
+
+	subMRR := make(map[int]int)
+	userMRR := make(map[string]int)
+	firstPaid := make(map[string]time.Time)
+	apply := func(e models.SubscriptionEvent) {
+		mrr := e.MRR
+		if !f.matches(e.ProductID, e.VariantID) {
+			mrr = 0
+		}
+		userMRR[e.UserID] += mrr - subMRR[e.SubscriptionID]
+		subMRR[e.SubscriptionID] = mrr
+		if _, ok := firstPaid[e.UserID]; !ok && userMRR[e.UserID] > 0 {
+			firstPaid[e.UserID] = e.OccurredAt
+		}
+	}
+
+	// Replay the history up to the first period to find the opening state
+	first := monthStart(f.From)
+	next := 0
+	for ; next < len(events) && events[next].OccurredAt.Before(first); next++ {
+		apply(events[next])
+	}
+
+	var paying []map[string]bool // customers paying at the end of each period
+	var churnRates []float64
+	for start := first; start.Before(f.To); start = start.AddDate(0, 1, 0) {
+		end := start.AddDate(0, 1, 0)
+		if end.After(f.To) {
+			end = f.To
+		}
+
+		opening := payingMRR(userMRR)
+		for ; next < len(events) && events[next].OccurredAt.Before(end); next++ {
+			apply(events[next])
+		}
+		closing := payingMRR(userMRR)
+
+		p := models.RevenuePeriod{Period: start.Format(PeriodLayout), Start: start, End: end}
+		openingMRR := 0
+		for _, mrr := range opening {
+			openingMRR += mrr
+		}
+		active := make(map[string]bool, len(closing))
+		for user, mrr := range closing {
+			p.MRR += mrr
+			active[user] = true
+		}
+		p.Customers = len(closing)
+		paying = append(paying, active)
+
+		for user, before := range opening {
+			after := closing[user]
+			switch {
+			case after == 0:
+				p.ChurnedMRR += before
+				p.ChurnedCustomers++
+			case after > before:
+				p.ExpansionMRR += after - before
+			case after < before:
+				p.ContractionMRR += before - after
+			}
+		}
+		for user, after := range closing {
+			if opening[user] > 0 {
+				continue
+			}
+			if firstPaid[user].Before(start) {
+				p.ReactivationMRR += after
+				p.ReactivatedCustomers++
+			} else {
+				p.NewMRR += after
+				p.NewCustomers++
+			}
+		}
+
+		p.NetNewMRR = p.NewMRR + p.ReactivationMRR + p.ExpansionMRR - p.ContractionMRR - p.ChurnedMRR
+		p.ARR = p.MRR * 12
+		if len(opening) > 0 {
+			p.LogoChurnRate = float64(p.ChurnedCustomers) / float64(len(opening))
+			churnRates = append(churnRates, p.LogoChurnRate)
+		}
+		if openingMRR > 0 {
+			p.RevenueChurnRate = float64(p.ChurnedMRR+p.ContractionMRR) / float64(openingMRR)
+		}
+		if p.Customers > 0 {
+			p.ARPU = float64(p.MRR) / float64(p.Customers)
+		}
+		if p.LogoChurnRate > 0 {
+			p.LTV = p.ARPU / p.LogoChurnRate
+		}
+		for _, payment := range payments {
+			if !payment.PaidAt.Before(start) && payment.PaidAt.Before(end) && f.matches(payment.ProductID, payment.VariantID) {
+				p.Revenue += payment.Amount
+			}
+		}
+		report.Periods = append(report.Periods, p)
+	}
+
+	report.Summary = summarize(report.Periods, churnRates)
+	report.Cohorts = cohorts(report.Periods, paying, firstPaid)
+	return report
+}
+
+// summarize describes the latest period, using the churn rate averaged over the
+// range for LTV since a single month is too noisy
+func summarize(periods []models.RevenuePeriod, churnRates []float64) models.RevenueSummary {
+	var s models.RevenueSummary
+	if len(periods) == 0 {
+		return s
+	}
+	last := periods[len(periods)-1]
+	s.MRR = last.MRR
+	s.ARR = last.ARR
+	s.Customers = last.Customers
+	s.ARPU = last.ARPU
+	for _, p := range periods {
+		s.Revenue += p.Revenue
+	}
+	for _, rate := range churnRates {
+		s.AvgLogoChurnRate += rate
+	}
+	if len(churnRates) > 0 {
+		s.AvgLogoChurnRate /= float64(len(churnRates))
+	}
+	if s.AvgLogoChurnRate > 0 {
+		s.LTV = s.ARPU / s.AvgLogoChurnRate
+	}
+	return s
+}
+
+// cohorts groups customers by the month they first paid in and counts how many
+// are still paying at the end of each following period
+func cohorts(periods []models.RevenuePeriod, paying []map[string]bool, firstPaid map[string]time.Time) []models.CohortRetention {
+	index := make(map[string]int, len(periods))
+	for i, p := range periods {
+		index[p.Period] = i
+	}
+	members := make([][]string, len(periods))
+	for user, at := range firstPaid {
+		if i, ok := index[at.UTC().Format(PeriodLayout)]; ok && !at.Before(periods[i].Start) {
+			members[i] = append(members[i], user)
+		}
+	}
+
+	result := []models.CohortRetention{}
+	for i, cohort := range members {
+		if len(cohort) == 0 {
+			continue
+		}
+		row := models.CohortRetention{Cohort: periods[i].Period, Customers: len(cohort)}
+		for _, active := range paying[i:] {
+			retained := 0
+			for _, user := range cohort {
+				if active[user] {
+					retained++
+				}
+			}
+			row.Retained = append(row.Retained, retained)
+			row.Retention = append(row.Retention, float64(retained)/float64(len(cohort)))
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+// payingMRR copies the customers whose MRR is positive
+func payingMRR(userMRR map[string]int) map[string]int {
+	paying := make(map[string]int, len(userMRR))
+	for user, mrr := range userMRR {
+		if mrr > 0 {
+			paying[user] = mrr
+		}
+	}
+	return paying
+}
+
+// monthStart returns the first instant of the UTC month containing t
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
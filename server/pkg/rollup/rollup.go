@@ -0,0 +1,174 @@
+// Package rollup keeps the page view rollups up to date and enforces the retention
+// period of raw page views. Reports over long ranges read the rollups, so raw views
+// are only removed once every rollup covers them.
+package rollup
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"saas-server/database"
+	"saas-server/pkg/analytics"
+)
+
+// batch is the longest range rolled up in one transaction, so that catching up on
+// a large backlog does not hold one long-running transaction
+const batch = 7 * 24 * time.Hour
+
+// purgeBatch is the number of raw page views removed per statement
+const purgeBatch = 10000
+
+// Options controls the rollup and retention job
+type Options struct {
+	// Interval is how often the rollups are brought up to date
+	Interval time.Duration
+	// Retention is how long raw page views are kept; zero keeps them forever
+	Retention time.Duration
+	// Archive moves expired page views to page_views_archive instead of deleting them
+	Archive bool
+}
+
+// Service rolls up page views and removes expired ones in the background
+type Service struct {
+	store database.AnalyticsRepository
+	opts  Options
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewService creates a rollup service that runs every Interval once started
+func NewService(store database.AnalyticsRepository, opts Options) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		store:  store,
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// StartRollupJob runs immediately and then on every interval until Stop is called
+func (s *Service) StartRollupJob() {
+	ticker := time.NewTicker(s.opts.Interval)
+	s.started = true
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		for {
+			if err := s.Run(s.ctx); err != nil && s.ctx.Err() == nil {
+				log.Printf("[Rollup] Error rolling up page views: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the rollup job to exit, cancelling any in-progress run, and waits for it to finish
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		if s.started {
+			<-s.done
+		}
+	})
+}
+
+// Run brings every rollup up to date and then removes the raw page views past the
+// retention period that all rollups cover
+func (s *Service) Run(ctx context.Context) error {
+	now := time.Now()
+	watermarks, err := s.store.GetRollupWatermarks(ctx)
+	if err != nil {
+		return err
+	}
+
+	covered := now
+	for _, rollup := range []string{analytics.RollupHourly, analytics.RollupDaily} {
+		rolledUpTo, err := s.rollUp(ctx, rollup, watermarks[rollup], now)
+		if err != nil {
+			return err
+		}
+		if rolledUpTo.Before(covered) {
+			covered = rolledUpTo
+		}
+	}
+
+	if s.opts.Retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-s.opts.Retention)
+	if covered.Before(cutoff) {
+		cutoff = covered
+	}
+	return s.purge(ctx, cutoff)
+}
+
+// rollUp rolls up the whole periods between rolledUpTo and now, less
+// analytics.RollupDelay, and returns how far the rollup is complete
+func (s *Service) rollUp(ctx context.Context, rollup string, rolledUpTo, now time.Time) (time.Time, error) {
+	period := analytics.RollupPeriods[rollup]
+	until := now.Add(-analytics.RollupDelay).Truncate(period)
+
+	from := rolledUpTo
+	if from.IsZero() {
+		oldest, err := s.store.GetOldestPageView(ctx)
+		if err != nil {
+			return rolledUpTo, err
+		}
+		from = until
+		if !oldest.IsZero() && oldest.Before(until) {
+			from = oldest.Truncate(period)
+		}
+		// Record the starting point even when there is nothing to roll up yet
+		if !from.Before(until) {
+			return until, s.store.RollUpPageViews(ctx, rollup, until, until)
+		}
+	}
+
+	start := from
+	for from.Before(until) {
+		to := from.Add(batch)
+		if to.After(until) {
+			to = until
+		}
+		if err := s.store.RollUpPageViews(ctx, rollup, from, to); err != nil {
+			return from, err
+		}
+		from = to
+	}
+	// Only catching up on a backlog is worth logging
+	if from.Sub(start) > period {
+		log.Printf("[Rollup] Rolled up %s page views to %s", rollup, from.Format(time.RFC3339))
+	}
+	return from, nil
+}
+
+// purge removes raw page views made before cutoff in batches
+func (s *Service) purge(ctx context.Context, cutoff time.Time) error {
+	var total int64
+	for {
+		n, err := s.store.PurgePageViews(ctx, cutoff, s.opts.Archive, purgeBatch)
+		total += n
+		if err != nil || n < purgeBatch {
+			if total > 0 {
+				action := "Deleted"
+				if s.opts.Archive {
+					action = "Archived"
+				}
+				log.Printf("[Rollup] %s %d page views made before %s", action, total, cutoff.Format(time.RFC3339))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package telemetry configures OpenTelemetry tracing for the server.
+// It owns the global tracer provider and propagators and provides traced
+// HTTP clients for outbound calls to third-party APIs.
+package telemetry
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the default service name reported on every span
+const ServiceName = "saas-server"
+
+// tracerName is the instrumentation scope used for spans created by this application
+const tracerName = "saas-server"
+
+// Init sets up the global tracer provider and W3C trace context propagation.
+// Spans are exported over OTLP/HTTP when endpoint is set; otherwise spans are
+// still created so that trace context is propagated, but they are not exported anywhere.
+// The returned function flushes and stops the provider and must be called on shutdown.
+func Init(ctx context.Context, serviceName, endpoint string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	if endpoint != "" {
+		otlpExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlpExporter
+		log.Printf("[Telemetry] Exporting traces via OTLP to %s", endpoint)
+	} else {
+		log.Println("[Telemetry] OTEL_EXPORTER_OTLP_ENDPOINT not set, traces will not be exported")
+	}
+
+	tp := NewTracerProvider(serviceName, exporter)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider creates a tracer provider that batches spans to the given exporter.
+// A nil exporter produces a provider that records spans without exporting them.
+// Tests can pass tracetest.NewInMemoryExporter() and register the result with
+// otel.SetTracerProvider to inspect spans produced by handlers and queries.
+func NewTracerProvider(serviceName string, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = ServiceName
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// Tracer returns the application tracer from the current global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// NewHTTPClient returns an HTTP client whose transport creates a client span
+// for every outbound request and injects the trace context into its headers
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+}
+
+// HTTPHandler wraps an HTTP handler so that each incoming request gets a server span,
+// continuing any trace context supplied by the caller. Spans are named after the method
+// and the pattern of routes that matches the request, so that IDs in paths do not make
+// every request its own span name; the path itself is recorded as url.path. Requests
+// no route matches, or every request when routes is nil, are named after the method alone.
+func HTTPHandler(handler http.Handler, routes *http.ServeMux) http.Handler {
+	traced := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("url.path", r.URL.Path))
+		handler.ServeHTTP(w, r)
+	})
+	return otelhttp.NewHandler(traced, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if routes != nil {
+				if _, pattern := routes.Handler(r); pattern != "" {
+					return r.Method + " " + pattern
+				}
+			}
+			return r.Method
+		}),
+	)
+}
@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useInMemoryExporter installs a global provider exporting to memory for the test
+// and returns a function flushing it and listing the spans exported so far
+func useInMemoryExporter(t *testing.T) func() tracetest.SpanStubs {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := NewTracerProvider("test-service", exporter)
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	return func() tracetest.SpanStubs {
+		if err := tp.ForceFlush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return exporter.GetSpans()
+	}
+}
+
+func TestHTTPHandlerSpans(t *testing.T) {
+	spans := useInMemoryExporter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantName string
+		// wantChild is set when a route runs and starts a span of its own
+		wantChild bool
+	}{
+		{"named after the matched pattern", http.MethodGet, "/api/products/42", "GET /api/products/", true},
+		{"same name for another ID", http.MethodGet, "/api/products/43", "GET /api/products/", true},
+		{"exact route", http.MethodPost, "/checkout", "POST /checkout", true},
+		{"unmatched path", http.MethodGet, "/wp-login.php", "GET", false},
+	}
+
+	mux := http.NewServeMux()
+	query := func(w http.ResponseWriter, r *http.Request) {
+		_, span := Tracer().Start(r.Context(), "query")
+		span.End()
+	}
+	mux.HandleFunc("/api/products/", query)
+	mux.HandleFunc("/checkout", query)
+	handler := HTTPHandler(mux, mux)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(spans())
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			got := spans()[before:]
+			want := 1
+			if tt.wantChild {
+				want = 2
+			}
+			if len(got) != want {
+				t.Fatalf("%d spans exported, want %d", len(got), want)
+			}
+			server := got[len(got)-1]
+			if server.Name != tt.wantName || server.SpanKind != trace.SpanKindServer {
+				t.Errorf("server span = %q (%v), want %q", server.Name, server.SpanKind, tt.wantName)
+			}
+			if tt.wantChild && got[0].Parent.SpanID() != server.SpanContext.SpanID() {
+				t.Error("span started in the handler is not a child of the server span")
+			}
+			if path := attributeValue(server, "url.path"); path != tt.path {
+				t.Errorf("url.path = %q, want %q", path, tt.path)
+			}
+			if v, _ := server.Resource.Set().Value("service.name"); v.AsString() != "test-service" {
+				t.Errorf("service.name = %q, want test-service", v.AsString())
+			}
+		})
+	}
+}
+
+// attributeValue returns the value of a span attribute as a string
+func attributeValue(span tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestHTTPClientPropagatesTraceContext(t *testing.T) {
+	spans := useInMemoryExporter(t)
+
+	// The downstream service continues the trace of the outbound request
+	downstream := httptest.NewServer(HTTPHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), nil))
+	defer downstream.Close()
+
+	ctx, parent := Tracer().Start(context.Background(), "job")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL+"/v1/orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewHTTPClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	traceID := parent.SpanContext().TraceID()
+	kinds := map[trace.SpanKind]bool{}
+	for _, s := range spans() {
+		if s.SpanContext.TraceID() != traceID {
+			t.Errorf("span %q is in trace %s, want %s", s.Name, s.SpanContext.TraceID(), traceID)
+		}
+		kinds[s.SpanKind] = true
+	}
+	if !kinds[trace.SpanKindClient] || !kinds[trace.SpanKindServer] {
+		t.Errorf("span kinds = %v, want client and server spans", kinds)
+	}
+}
@@ -0,0 +1,69 @@
+package trial
+
+import (
+	"context"
+	"fmt"
+	"html"
+
+	"saas-server/models"
+	"saas-server/pkg/plunk"
+)
+
+// sendReminderEmail tells the user their trial ends in days days. Users of an
+// app-managed trial are asked to pick a plan; subscribers who gave a card at
+// checkout are told when billing starts.
+func sendReminderEmail(ctx context.Context, mailer *plunk.Client, email string, t models.Trial, days int, upgradeURL string) error {
+	when := fmt.Sprintf("in %d days", days)
+	if days <= 1 {
+		when = "tomorrow"
+	}
+	endsOn := t.EndsAt.UTC().Format("January 2, 2006")
+
+	message := fmt.Sprintf("Your free trial ends %s, on <strong>%s</strong>. Choose a plan before then to keep access to every feature.", when, endsOn)
+	button := "Choose a Plan"
+	if t.Source == models.TrialSourceLemonSqueezy {
+		message = fmt.Sprintf("Your free trial ends %s, on <strong>%s</strong>, and your subscription will then be billed to the payment method you provided.", when, endsOn)
+		button = "Manage Subscription"
+	}
+	link := html.EscapeString(upgradeURL)
+
+	htmlBody := fmt.Sprintf(`
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<style>
+				body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+				.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+				.button {
+					display: inline-block;
+					padding: 12px 24px;
+					background-color: #3b82f6;
+					color: white;
+					text-decoration: none;
+					border-radius: 6px;
+					margin: 20px 0;
+				}
+				.footer { margin-top: 30px; font-size: 14px; color: #666; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>Your trial ends %s</h2>
+				<p>%s</p>
+
+				<a href="%s" class="button">%s</a>
+
+				<div class="footer">
+					<p>Thanks for trying us out.</p>
+				</div>
+			</div>
+		</body>
+		</html>
+	`, when, message, link, button)
+
+	return mailer.Send(ctx, plunk.Email{
+		To:      email,
+		Subject: "Your trial ends " + when,
+		Body:    htmlBody,
+	})
+}
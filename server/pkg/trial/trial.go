@@ -0,0 +1,279 @@
+// Package trial manages free trials: app-managed trials granted at signup without a
+// card, and Lemon Squeezy subscriptions that start on trial. It reminds users before
+// a trial ends, ends app-managed trials when they run out, and records conversions.
+package trial
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"saas-server/database"
+	"saas-server/models"
+	"saas-server/pkg/plunk"
+)
+
+// StatusOnTrial is the account status recorded while a user is on a trial, matching
+// the status Lemon Squeezy reports for trialling subscriptions
+const StatusOnTrial = "on_trial"
+
+// Options controls trials
+type Options struct {
+	// Period is the length of the app-managed trial; zero disables it
+	Period time.Duration
+	// VariantID is the plan the app-managed trial grants
+	VariantID int
+	// ReminderLead is how long before a trial ends the reminder email is sent; zero disables it
+	ReminderLead time.Duration
+	// CheckInterval is how often reminders and expired trials are processed
+	CheckInterval time.Duration
+	// UpgradeURL is linked from reminder emails
+	UpgradeURL string
+}
+
+// Service grants trials and works through their reminders and expiry in the background
+type Service struct {
+	store  database.Store
+	mailer *plunk.Client
+	opts   Options
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewService creates a trial service that processes trials every CheckInterval once started
+func NewService(store database.Store, mailer *plunk.Client, opts Options) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		store:  store,
+		mailer: mailer,
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// StartTrialJob processes trials immediately and then on every interval until Stop is called
+func (s *Service) StartTrialJob() {
+	ticker := time.NewTicker(s.opts.CheckInterval)
+	s.started = true
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		for {
+			if err := s.Run(s.ctx); err != nil && s.ctx.Err() == nil {
+				log.Printf("[Trial] Error processing trials: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the trial job to exit, cancelling any in-progress run, and waits for it to finish
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		if s.started {
+			<-s.done
+		}
+	})
+}
+
+// StartAppTrial grants a newly registered user the app-managed trial, if one is
+// configured. Each user gets at most one.
+func (s *Service) StartAppTrial(ctx context.Context, user *models.User) error {
+	if s.opts.Period <= 0 || s.opts.VariantID <= 0 {
+		return nil
+	}
+
+	// The product is only needed for reporting, so a catalog that has not synced yet
+	// does not hold up the trial
+	productID := 0
+	if variant, err := s.store.GetVariant(ctx, s.opts.VariantID); err == nil {
+		productID = variant.ProductID
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	now := time.Now()
+	t := &models.Trial{
+		UserID:    user.ID,
+		Source:    models.TrialSourceApp,
+		ProductID: productID,
+		VariantID: s.opts.VariantID,
+		StartedAt: now,
+		EndsAt:    now.Add(s.opts.Period),
+	}
+	return s.store.WithTx(ctx, func(tx database.Store) error {
+		created, err := tx.CreateTrial(ctx, t)
+		if err != nil || !created {
+			return err
+		}
+		log.Printf("[Trial] Started trial for user %s until %s", user.ID, t.EndsAt.Format(time.RFC3339))
+		return tx.UpdateUserSubscription(ctx, user.ID, 0, StatusOnTrial, productID, s.opts.VariantID, nil, &t.EndsAt)
+	})
+}
+
+// SubscriptionChanged records trial starts, extensions, conversions and expiries
+// from the latest state of a Lemon Squeezy subscription
+func (s *Service) SubscriptionChanged(ctx context.Context, sub *models.Subscription) error {
+	subscriptionID, err := strconv.Atoi(sub.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	switch sub.Status {
+	case StatusOnTrial:
+		if sub.TrialEndsAt == nil {
+			return nil
+		}
+		t, err := s.store.GetSubscriptionTrial(ctx, subscriptionID)
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = s.store.CreateTrial(ctx, &models.Trial{
+				UserID:         sub.UserID,
+				Source:         models.TrialSourceLemonSqueezy,
+				SubscriptionID: &subscriptionID,
+				ProductID:      sub.ProductID,
+				VariantID:      sub.VariantID,
+				StartedAt:      time.Now(),
+				EndsAt:         *sub.TrialEndsAt,
+			})
+			return err
+		}
+		if err != nil || t.EndsAt.Equal(*sub.TrialEndsAt) {
+			return err
+		}
+		return s.store.SetTrialEnd(ctx, t.ID, *sub.TrialEndsAt)
+
+	case "active":
+		// Paying for any plan converts whichever trials the user was on
+		n, err := s.store.ConvertUserTrials(ctx, sub.UserID, time.Now())
+		if n > 0 {
+			log.Printf("[Trial] User %s converted to a paid subscription", sub.UserID)
+		}
+		return err
+
+	case "expired":
+		t, err := s.store.GetSubscriptionTrial(ctx, subscriptionID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = s.store.EndTrial(ctx, t.ID, models.TrialExpired, time.Now())
+		return err
+	}
+	return nil
+}
+
+// UserTrial returns the user's active trial, or nil if they are not on one
+func (s *Service) UserTrial(ctx context.Context, userID string) (*models.Trial, error) {
+	t, err := s.store.GetUserTrial(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// Run sends the reminders that are due and ends app-managed trials that have run out.
+// Trials of Lemon Squeezy subscriptions end through webhooks. A failure on one trial
+// does not stop the others.
+func (s *Service) Run(ctx context.Context) error {
+	now := time.Now()
+	trials, err := s.store.GetTrialsEndingBefore(ctx, now.Add(s.opts.ReminderLead))
+	if err != nil {
+		return err
+	}
+
+	for _, t := range trials {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var err error
+		switch {
+		case !now.Before(t.EndsAt):
+			if t.Source == models.TrialSourceApp {
+				err = s.expire(ctx, t, now)
+			}
+		case t.ReminderSentAt == nil && s.opts.ReminderLead > 0:
+			err = s.remind(ctx, t, now)
+		}
+		if err != nil {
+			log.Printf("[Trial] Error processing trial %d for user %s: %v", t.ID, t.UserID, err)
+		}
+	}
+	return nil
+}
+
+// remind emails the user that their trial is ending. The reminder is claimed before
+// it is sent so that several instances never email it twice.
+func (s *Service) remind(ctx context.Context, t models.Trial, now time.Time) error {
+	user, err := s.store.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	claimed, err := s.store.ClaimTrialReminder(ctx, t.ID, now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	err = sendReminderEmail(ctx, s.mailer, user.Email, t, DaysRemaining(t.EndsAt, now), s.opts.UpgradeURL)
+	if errors.Is(err, plunk.ErrNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[Trial] Sent trial ending reminder to user %s", t.UserID)
+	return nil
+}
+
+// expire ends an app-managed trial and withdraws its access, unless the user has
+// since subscribed
+func (s *Service) expire(ctx context.Context, t models.Trial, now time.Time) error {
+	return s.store.WithTx(ctx, func(tx database.Store) error {
+		ended, err := tx.EndTrial(ctx, t.ID, models.TrialExpired, now)
+		if err != nil || !ended {
+			return err
+		}
+		log.Printf("[Trial] Trial of user %s expired", t.UserID)
+
+		_, err = tx.GetSubscriptionByUserID(ctx, t.UserID)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return tx.UpdateUserSubscription(ctx, t.UserID, 0, "expired", t.ProductID, t.VariantID, nil, &t.EndsAt)
+	})
+}
+
+// Info describes a trial ending at endsAt for the user
+func Info(source string, endsAt, now time.Time) *models.TrialInfo {
+	return &models.TrialInfo{
+		Source:        source,
+		EndsAt:        endsAt,
+		DaysRemaining: DaysRemaining(endsAt, now),
+	}
+}
+
+// DaysRemaining counts the days left until endsAt, including a partial last day
+func DaysRemaining(endsAt, now time.Time) int {
+	if !now.Before(endsAt) {
+		return 0
+	}
+	return int(math.Ceil(endsAt.Sub(now).Hours() / 24))
+}
@@ -0,0 +1,495 @@
+// Package webhooks notifies the endpoints users register of events on their account.
+// Each event is stored as one delivery per subscribed endpoint and sent by a
+// background job, signed with the endpoint's secret; failed deliveries are retried
+// on a schedule. Deliveries are claimed with row locks, so several instances can
+// share the work, and they are not guaranteed to arrive in order.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"saas-server/database"
+	"saas-server/models"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Event types
+const (
+	EventOrderCreated        = "order.created"
+	EventOrderRefunded       = "order.refunded"
+	EventSubscriptionCreated = "subscription.created"
+	EventSubscriptionUpdated = "subscription.updated"
+	EventPaymentSucceeded    = "payment.succeeded"
+	EventPaymentFailed       = "payment.failed"
+	EventPaymentRecovered    = "payment.recovered"
+	EventPaymentRefunded     = "payment.refunded"
+	// EventPing is only sent as a test event, whatever the endpoint subscribes to
+	EventPing = "ping"
+)
+
+// EventTypes lists the event types endpoints can subscribe to
+var EventTypes = []string{
+	EventOrderCreated, EventOrderRefunded,
+	EventSubscriptionCreated, EventSubscriptionUpdated,
+	EventPaymentSucceeded, EventPaymentFailed, EventPaymentRecovered, EventPaymentRefunded,
+}
+
+// Request headers of a delivery
+const (
+	// SignatureHeader holds the hex-encoded HMAC-SHA256 of the timestamp, a dot and
+	// the request body, keyed with the endpoint's secret
+	SignatureHeader = "X-Signature"
+	// TimestampHeader holds the Unix time the attempt was signed at, which changes
+	// across retries
+	TimestampHeader = "X-Webhook-Timestamp"
+	// EventHeader holds the event type
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader holds the delivery ID, which stays the same across retries
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+const (
+	// SignatureTolerance is how old a delivery's timestamp may be when Verify checks it
+	SignatureTolerance = 5 * time.Minute
+)
+
+const (
+	secretPrefix = "whsec_"
+	userAgent    = "saas-server-webhooks/1.0"
+	// claimBatch is the number of due deliveries sent at a time
+	claimBatch = 20
+	// maxResponseBody is how much of an endpoint's response is kept in the delivery log
+	maxResponseBody = 1024
+	// purgeInterval is how often delivery logs past the retention period are removed
+	purgeInterval = time.Hour
+)
+
+// ErrForbiddenAddress is returned when an endpoint resolves to a private, loopback or
+// other non-public address
+var ErrForbiddenAddress = errors.New("webhooks: endpoint address is not allowed")
+
+// Options controls delivery
+type Options struct {
+	// Interval is how often due deliveries are sent
+	Interval time.Duration
+	// Timeout is how long an endpoint has to respond
+	Timeout time.Duration
+	// Retries are the delays before each retry of a failed delivery; a delivery is
+	// attempted len(Retries)+1 times in all
+	Retries []time.Duration
+	// LogRetention is how long finished deliveries are kept; zero keeps them forever
+	LogRetention time.Duration
+	// AllowPrivateNetworks accepts plain HTTP endpoints and private or loopback
+	// addresses, for local development
+	AllowPrivateNetworks bool
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Service queues events for the endpoints subscribed to them and delivers them in the background
+type Service struct {
+	store  database.WebhookRepository
+	client *http.Client
+	opts   Options
+
+	lastPurge time.Time
+	wake      chan struct{} // asks the job to run early, e.g. for newly queued deliveries
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	started   bool
+	stopOnce  sync.Once
+}
+
+// NewService creates a webhook service that sends due deliveries every Interval once started
+func NewService(store database.WebhookRepository, opts Options) *Service {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !opts.AllowPrivateNetworks {
+		dialer.Control = guardAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Connect directly so that the address guard sees the endpoint itself
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		store: store,
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(transport),
+			Timeout:   opts.Timeout,
+			// A redirect is logged as the endpoint's response rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Sign returns the signature of a payload sent with the given TimestampHeader, as
+// sent in SignatureHeader. Signing the timestamp keeps a captured delivery from
+// being replayed once it is older than the receiver's tolerance.
+func Sign(timestamp string, payload []byte, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of payload and timestamp under
+// secret, and the timestamp is within SignatureTolerance of now
+func Verify(timestamp string, payload []byte, signature, secret string, now time.Time) bool {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(timestamp, payload, secret)))
+}
+
+// NewSecret generates a random signing secret for an endpoint
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// ValidateURL checks that deliveries can be sent to an endpoint URL: an absolute
+// HTTPS URL without credentials that does not name a private, loopback or reserved address.
+// Host names are checked again each time a delivery connects.
+func (s *Service) ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return errors.New("URL must be absolute")
+	}
+	if u.Scheme != "https" && !(s.opts.AllowPrivateNetworks && u.Scheme == "http") {
+		return errors.New("URL must use https")
+	}
+	if u.User != nil {
+		return errors.New("URL must not contain credentials")
+	}
+	if s.opts.AllowPrivateNetworks {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("URL must not point at a private, loopback or reserved address")
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !public(ip) {
+		return errors.New("URL must not point at a private, loopback or reserved address")
+	}
+	return nil
+}
+
+// StartDeliveryJob sends due deliveries immediately and then on every interval until Stop is called
+func (s *Service) StartDeliveryJob() {
+	ticker := time.NewTicker(s.opts.Interval)
+	s.started = true
+	go func() {
+		defer close(s.done)
+		defer ticker.Stop()
+		for {
+			if err := s.Run(s.ctx); err != nil && s.ctx.Err() == nil {
+				log.Printf("[Webhooks] Error sending webhook deliveries: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the delivery job to exit, cancelling any in-progress requests, and waits for it to finish
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		if s.started {
+			<-s.done
+		}
+	})
+}
+
+// Publish queues an event for every enabled endpoint of the user that subscribes to
+// its type, with data as the payload's data. The delivery job sends it shortly after.
+func (s *Service) Publish(ctx context.Context, userID, eventType string, data any) error {
+	if userID == "" {
+		return nil
+	}
+	endpoints, err := s.store.GetWebhookEndpoints(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	eventID := uuid.NewString()
+	var payload []byte
+	for _, e := range endpoints {
+		if !e.Wants(eventType) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(Payload{ID: eventID, Type: eventType, CreatedAt: now.UTC(), Data: data})
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.store.CreateWebhookDelivery(ctx, &models.WebhookDelivery{
+			ID:            uuid.NewString(),
+			EndpointID:    e.ID,
+			EventID:       eventID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		}); err != nil {
+			return err
+		}
+	}
+	if payload != nil {
+		s.trigger()
+	}
+	return nil
+}
+
+// SendTest sends a ping event to an endpoint straight away, whether or not it is
+// enabled, and returns the logged delivery. Test events are not retried.
+func (s *Service) SendTest(ctx context.Context, endpoint *models.WebhookEndpoint) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	eventID := uuid.NewString()
+	payload, err := json.Marshal(Payload{
+		ID:        eventID,
+		Type:      EventPing,
+		CreatedAt: now.UTC(),
+		Data:      map[string]string{"endpoint_id": endpoint.ID, "message": "This is a test event"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Counted as attempted and held like a claimed delivery, so the job leaves it alone
+	leaseUntil := now.Add(s.lease())
+	d := &models.WebhookDelivery{
+		ID:            uuid.NewString(),
+		EndpointID:    endpoint.ID,
+		EventID:       eventID,
+		EventType:     EventPing,
+		Payload:       payload,
+		Status:        models.WebhookDeliveryPending,
+		Attempts:      1,
+		NextAttemptAt: &leaseUntil,
+		URL:           endpoint.URL,
+		Secret:        endpoint.Secret,
+	}
+	if err := s.store.CreateWebhookDelivery(ctx, d); err != nil {
+		return nil, err
+	}
+	s.deliver(ctx, d, false)
+	return d, nil
+}
+
+// Run sends every due delivery, a batch at a time, and then removes the delivery
+// logs past the retention period
+func (s *Service) Run(ctx context.Context) error {
+	for {
+		now := time.Now()
+		deliveries, err := s.store.ClaimWebhookDeliveries(ctx, now, now.Add(s.lease()), claimBatch)
+		if err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(d *models.WebhookDelivery) {
+				defer wg.Done()
+				s.deliver(ctx, d, true)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < claimBatch || ctx.Err() != nil {
+			break
+		}
+	}
+	return s.purge(ctx)
+}
+
+// deliver makes one attempt at a delivery and records its outcome. Unless retry is
+// false, a failed attempt is retried after the next delay in the schedule.
+func (s *Service) deliver(ctx context.Context, d *models.WebhookDelivery, retry bool) {
+	start := time.Now()
+	status, body, err := s.post(ctx, d)
+	d.LastAttemptAt = &start
+	d.DurationMS = int(time.Since(start).Milliseconds())
+	d.ResponseStatus = status
+	d.ResponseBody = body
+	d.NextAttemptAt = nil
+	d.Error = ""
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		d.Status = models.WebhookDeliverySucceeded
+	case retry && d.Attempts <= len(s.opts.Retries):
+		d.Status = models.WebhookDeliveryPending
+		next := time.Now().Add(s.opts.Retries[d.Attempts-1])
+		d.NextAttemptAt = &next
+	default:
+		d.Status = models.WebhookDeliveryFailed
+	}
+	if err != nil {
+		d.Error = err.Error()
+	} else if d.Status != models.WebhookDeliverySucceeded {
+		d.Error = fmt.Sprintf("endpoint responded with status %d", status)
+	}
+	if retry && d.Status == models.WebhookDeliveryFailed {
+		log.Printf("[Webhooks] Giving up on delivery %s of %s to endpoint %s after %d attempts: %s",
+			d.ID, d.EventType, d.EndpointID, d.Attempts, d.Error)
+	}
+
+	// Record the outcome even when the job is stopping mid-request
+	if err := s.store.RecordWebhookAttempt(context.WithoutCancel(ctx), d); err != nil {
+		log.Printf("[Webhooks] Error recording delivery %s: %v", d.ID, err)
+	}
+}
+
+// post sends a delivery and returns the response status and the start of its body
+func (s *Service) post(ctx context.Context, d *models.WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(timestamp, d.Payload, d.Secret))
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// Kept as text, which may hold neither invalid UTF-8 nor NUL bytes
+	return resp.StatusCode, strings.ReplaceAll(strings.ToValidUTF8(string(body), ""), "\x00", ""), nil
+}
+
+// purge removes finished deliveries past the retention period, at most once per purgeInterval
+func (s *Service) purge(ctx context.Context) error {
+	if s.opts.LogRetention <= 0 || time.Since(s.lastPurge) < purgeInterval {
+		return nil
+	}
+	n, err := s.store.DeleteWebhookDeliveriesBefore(ctx, time.Now().Add(-s.opts.LogRetention))
+	if err != nil {
+		return err
+	}
+	s.lastPurge = time.Now()
+	if n > 0 {
+		log.Printf("[Webhooks] Removed %d webhook deliveries past the retention period", n)
+	}
+	return nil
+}
+
+// lease is how long a claimed delivery is held before another instance may retry it
+func (s *Service) lease() time.Duration {
+	return s.opts.Timeout + time.Minute
+}
+
+// trigger wakes the delivery job without blocking
+func (s *Service) trigger() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// guardAddress refuses connections to private, loopback and other non-public
+// addresses, whatever the endpoint's host name resolved to
+func guardAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip, err := netip.ParseAddr(host); err != nil || !public(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// specialPurpose lists the ranges of the IANA special-purpose address registries that
+// are not globally reachable, or that embed an IPv4 address behind a translator,
+// beyond the loopback, private, link-local and multicast ranges netip reports itself
+var specialPurpose = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space (carrier-grade NAT)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including the limited broadcast address
+	netip.MustParsePrefix("::/96"),           // IPv4-compatible
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, including Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+}
+
+// public reports whether ip is a publicly routable unicast address. IPv4-mapped IPv6
+// addresses are checked as the IPv4 address they carry.
+func public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range specialPurpose {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}